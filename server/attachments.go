@@ -0,0 +1,188 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxAttachmentURLs caps how many files a single message may attach, whatever
+	// MaxFilesPerPost says.
+	maxAttachmentURLs = 10
+
+	// defaultMaxAttachmentsPerPost applies when MaxAttachmentsPerPost is not configured.
+	defaultMaxAttachmentsPerPost = 20
+
+	// defaultMaxAttachmentSizeMB applies when MaxAttachmentSizeMB is not configured.
+	defaultMaxAttachmentSizeMB = 10
+
+	// attachmentFetchTimeout bounds how long fetching a single attachment may take.
+	attachmentFetchTimeout = 10 * time.Second
+)
+
+// nonPublicNetworks are the ranges attachments are never fetched from unless
+// AttachmentAllowedNetworks lists them, such as loopback, private and link-local addresses
+// where cloud metadata services live.
+var nonPublicNetworks = mustParseCIDRs(
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12",
+	"192.0.0.0/24", "192.168.0.0/16", "198.18.0.0/15", "224.0.0.0/4", "240.0.0.0/4",
+	"::/128", "::1/128", "fc00::/7", "fe80::/10", "ff00::/8",
+)
+
+// publicAttachmentClient fetches attachments when no configuration built its own client.
+var publicAttachmentClient = newAttachmentHTTPClient(nil)
+
+// mustParseCIDRs parses networks, panicking on an invalid one.
+func mustParseCIDRs(networks ...string) []*net.IPNet {
+	parsed, err := parseCIDRs(networks)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+// parseCIDRs parses networks in CIDR notation.
+func parseCIDRs(networks []string) ([]*net.IPNet, error) {
+	parsed := make([]*net.IPNet, 0, len(networks))
+	for _, network := range networks {
+		_, ipNet, err := net.ParseCIDR(network)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid network %q", network)
+		}
+		parsed = append(parsed, ipNet)
+	}
+	return parsed, nil
+}
+
+// isAllowedAttachmentIP reports whether attachments may be fetched from ip: it is public, or in
+// one of the allowed networks.
+func isAllowedAttachmentIP(ip net.IP, allowed []*net.IPNet) bool {
+	for _, network := range allowed {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// newAttachmentHTTPClient returns a client fetching files referenced by attachment_urls. It only
+// connects to addresses allowed by isAllowedAttachmentIP, which is checked on the resolved
+// address of every connection, redirects included, and bypasses any proxy so the check sees the
+// real destination.
+func newAttachmentHTTPClient(allowed []*net.IPNet) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: attachmentFetchTimeout,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isAllowedAttachmentIP(ip, allowed) {
+				return errors.Errorf("fetching attachments from %s is not allowed", host)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout:   attachmentFetchTimeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: attachmentFetchTimeout},
+	}
+}
+
+// uploadAttachments fetches every image in urls and uploads it to channelID, returning the IDs
+// of the uploaded files in order. Anything that is not an image or exceeds the size limit
+// rejects the whole request before the message is posted. The number of urls is checked by
+// validateRequestBody.
+func (p *Plugin) uploadAttachments(channelID string, urls []string) ([]string, error) {
+	config := p.getConfiguration()
+	client := config.attachmentClient
+	if client == nil {
+		client = publicAttachmentClient
+	}
+	limit := config.maxAttachmentBytes()
+	fileIDs := make([]string, 0, len(urls))
+	for i, rawURL := range urls {
+		if !isHTTPURL(rawURL) {
+			return nil, newValidationError("attachment_urls[%d] is not an http(s) URL", i)
+		}
+
+		data, err := fetchAttachment(client, rawURL, limit)
+		if err != nil {
+			return nil, newValidationError("attachment_urls[%d]: %s", i, err.Error())
+		}
+
+		fileInfo, appErr := p.API.UploadFile(data, channelID, attachmentFilename(rawURL))
+		if appErr != nil {
+			return nil, errors.Wrapf(appErr, "failed to upload attachment %d", i)
+		}
+		fileIDs = append(fileIDs, fileInfo.Id)
+	}
+
+	return fileIDs, nil
+}
+
+// fetchAttachment downloads the image at rawURL with client, failing if it cannot be fetched, is
+// not an image, or is larger than limit bytes.
+func fetchAttachment(client *http.Client, rawURL string, limit int64) ([]byte, error) {
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return nil, errors.New("failed to fetch attachment")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("fetching attachment returned status %d", resp.StatusCode)
+	}
+	if resp.ContentLength > limit {
+		return nil, errors.Errorf("attachment exceeds %d bytes", limit)
+	}
+	if mediaType, _, parseErr := mime.ParseMediaType(resp.Header.Get("Content-Type")); parseErr != nil || !strings.HasPrefix(mediaType, "image/") {
+		return nil, errors.New("attachment is not an image")
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, errors.New("failed to read attachment")
+	}
+	if int64(len(data)) > limit {
+		return nil, errors.Errorf("attachment exceeds %d bytes", limit)
+	}
+
+	// The declared type is not trusted on its own; the content must look like an image too.
+	if !strings.HasPrefix(http.DetectContentType(data), "image/") {
+		return nil, errors.New("attachment is not an image")
+	}
+
+	return data, nil
+}
+
+// attachmentFilename derives a file name for an attachment from the last element of its URL.
+func attachmentFilename(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "attachment"
+	}
+	name := path.Base(u.Path)
+	if name == "." || name == "/" || name == "" {
+		return "attachment"
+	}
+	return name
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttachmentURLs(t *testing.T) {
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 64)...)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/snapshot.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write(png)
+		case "/huge.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write(append(png, bytes.Repeat([]byte{0}, 1<<20)...))
+		case "/page.html":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte("<html></html>"))
+		case "/disguised.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write([]byte("<html></html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	body := func(path string) string {
+		return `{"channel_id":"town","message":"Whiteboard","attachment_urls":["` + server.URL + path + `"]}`
+	}
+	// The test server listens on loopback, which has to be allowed explicitly.
+	const loopback = "127.0.0.0/8, ::1/128"
+
+	t.Run("image is uploaded and attached", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{AttachmentAllowedNetworks: loopback})
+		api.On("UploadFile", png, "town", "snapshot.png").Return(&model.FileInfo{Id: "file1"}, nil).Once()
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", body("/snapshot.png"))
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, model.StringArray{"file1"}, (*posts)[0].FileIds)
+	})
+
+	for name, path := range map[string]string{
+		"oversized file":                 "/huge.png",
+		"non-image":                      "/page.html",
+		"non-image declared as an image": "/disguised.png",
+		"missing file":                   "/missing.png",
+	} {
+		t.Run(name+" is rejected", func(t *testing.T) {
+			p, api, _ := newTestPlugin(t, &configuration{MaxAttachmentSizeMB: 1, AttachmentAllowedNetworks: loopback})
+
+			w := doRequest(p, http.MethodPost, "/webhook", body(path))
+			assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+			assert.Contains(t, w.Body.String(), "attachment_urls[0]")
+			api.AssertNotCalled(t, "UploadFile", mock.Anything, mock.Anything, mock.Anything)
+			api.AssertNotCalled(t, "CreatePost", mock.Anything)
+		})
+	}
+
+	t.Run("loopback URL is rejected by default", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+
+		w := doRequest(p, http.MethodPost, "/webhook", body("/snapshot.png"))
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), "attachment_urls[0]: failed to fetch attachment")
+		api.AssertNotCalled(t, "UploadFile", mock.Anything, mock.Anything, mock.Anything)
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("invalid allowed network is rejected", func(t *testing.T) {
+		assert.Error(t, (&configuration{AttachmentAllowedNetworks: "localhost"}).process())
+	})
+}
+
+func TestIsAllowedAttachmentIP(t *testing.T) {
+	for address, allowed := range map[string]bool{
+		"93.184.216.34":    true,
+		"2606:4700::1111":  true,
+		"127.0.0.1":        false,
+		"::1":              false,
+		"::ffff:127.0.0.1": false,
+		"10.1.2.3":         false,
+		"172.20.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"fd00::1":          false,
+		"0.0.0.0":          false,
+	} {
+		assert.Equal(t, allowed, isAllowedAttachmentIP(net.ParseIP(address), nil), address)
+	}
+
+	assert.True(t, isAllowedAttachmentIP(net.ParseIP("10.1.2.3"), mustParseCIDRs("10.1.0.0/16")))
+	assert.False(t, isAllowedAttachmentIP(net.ParseIP("10.2.0.1"), mustParseCIDRs("10.1.0.0/16")))
+}
+
+func TestAttachmentLimits(t *testing.T) {
+	config := &configuration{MaxAttachmentsPerPost: 2, MaxFilesPerPost: 1}
+
+	t.Run("message under the caps is posted", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi","attachments":[{"title":"HQ"},{"title":"Annex"}]}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Len(t, (*posts)[0].Attachments(), 2)
+	})
+
+	t.Run("too many attachments are rejected", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi","attachments":[{"title":"HQ"},{"title":"Annex"},{"title":"Lobby"}]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "3 attachments exceed the limit of 2 per post")
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("too many files are rejected", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi","attachment_urls":["https://example.com/a.png","https://example.com/b.png"]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "2 attachment_urls exceed the limit of 1 files per post")
+		api.AssertNotCalled(t, "UploadFile", mock.Anything, mock.Anything, mock.Anything)
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("batch attachments are counted after dedup", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		posts := mockCreatePost(api)
+		const messages = `"messages":[` +
+			`{"channel_id":"channel","message":"one","attachments":[{"title":"HQ"},{"title":"Annex"}]},` +
+			`{"channel_id":"channel","message":"two","attachments":[{"title":"HQ"},{"title":"Annex"},{"title":"Lobby"}]}]`
+
+		w := doRequest(p, http.MethodPost, "/webhook/batch", `{`+messages+`,"dedup_attachments":true}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 2)
+		assert.Len(t, (*posts)[1].Attachments(), 1)
+
+		w = doRequest(p, http.MethodPost, "/webhook/batch", `{`+messages+`}`)
+		assert.Equal(t, http.StatusMultiStatus, w.Code)
+		assert.Contains(t, w.Body.String(), "3 attachments exceed the limit of 2 per post")
+	})
+
+	t.Run("file cap cannot exceed the hard limit", func(t *testing.T) {
+		assert.Error(t, (&configuration{MaxFilesPerPost: maxAttachmentURLs + 1}).process())
+		assert.Error(t, (&configuration{MaxAttachmentsPerPost: -1}).process())
+	})
+}
@@ -0,0 +1,12 @@
+package main
+
+const (
+	auditEventPostCreated = "ovice_post_created"
+	auditEventPostFailed  = "ovice_post_failed"
+)
+
+// logAudit emits a structured log record with a stable event name so oVice-originated posts can
+// be traced from the server logs. Callers must never pass secrets such as signatures.
+func (p *Plugin) logAudit(event string, keyValuePairs ...interface{}) {
+	p.API.LogInfo("oVice audit", append([]interface{}{"event", event}, keyValuePairs...)...)
+}
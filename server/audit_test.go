@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditLog(t *testing.T) {
+	const secret = "s3cret"
+	config := &configuration{SignatureScheme: signatureSchemeHMACSimple, WebhookSecret: secret, TrustedProxies: "192.0.2.0/24, 10.0.0.0/8"}
+
+	assertNoSecretLogged := func(t *testing.T, calls []interface{}, signature string) {
+		for _, arg := range calls {
+			assert.NotContains(t, fmt.Sprint(arg), secret)
+			assert.NotContains(t, fmt.Sprint(arg), signature)
+		}
+	}
+
+	t.Run("successful post", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		mockCreatePost(api)
+		body := `{"channel_id":"channel","message":"hi"}`
+		header := signHMACSimple(secret, body)
+		header.Set(idempotencyKeyHeader, "key1")
+
+		w := doSignedRequest(p, "/webhook", body, header)
+		assert.Equal(t, http.StatusOK, w.Code)
+		api.AssertCalled(t, "LogInfo", "oVice audit",
+			"event", auditEventPostCreated,
+			"channel_id", "channel",
+			"post_id", "post0",
+			"source_ip", "192.0.2.1",
+			"idempotency_key", "key1",
+		)
+		for _, call := range api.Calls {
+			assertNoSecretLogged(t, call.Arguments, header.Get(hmacSignatureHeader))
+		}
+	})
+
+	t.Run("failed post", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		body := `{"channel_id":"channel","message":""}`
+		header := signHMACSimple(secret, body)
+		header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+
+		w := doSignedRequest(p, "/webhook", body, header)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		api.AssertCalled(t, "LogInfo", "oVice audit",
+			"event", auditEventPostFailed,
+			"channel_id", "channel",
+			"source_ip", "203.0.113.7",
+			"idempotency_key", "",
+			"status", http.StatusUnprocessableEntity,
+		)
+	})
+}
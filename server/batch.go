@@ -0,0 +1,177 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// maxBatchMessages caps how many messages a single batch request may post.
+const maxBatchMessages = 50
+
+// batchRequestBody is the payload accepted by the batch webhook endpoint.
+type batchRequestBody struct {
+	Messages []*RequestBody `json:"messages"`
+
+	// DedupAttachments keeps only the first occurrence of attachments repeated across messages,
+	// such as a shared space banner. Every message is still posted.
+	DedupAttachments bool `json:"dedup_attachments"`
+}
+
+// batchItemResponse is the result of one message of a batch: the webhookResponse of a posted
+// message, or status "error" with the HTTP status and message of the error that rejected it.
+type batchItemResponse struct {
+	// Index is the position of the message in the request, so failed messages can be retried.
+	Index int `json:"index"`
+
+	// ChannelID is the channel a category message was posted to.
+	ChannelID string `json:"channel_id,omitempty"`
+
+	webhookResponse
+	ErrorCode int    `json:"error_code,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Field     string `json:"field,omitempty"`
+}
+
+// newBatchItemError returns the result of the message at index rejected with herr.
+func newBatchItemError(index int, herr *httpError) *batchItemResponse {
+	return &batchItemResponse{Index: index, webhookResponse: webhookResponse{Status: "error"}, ErrorCode: herr.Status, Error: herr.Message, Field: herr.Field}
+}
+
+// batchSummary counts the results of a batch.
+type batchSummary struct {
+	Total     int `json:"total"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+}
+
+// batchResponse is returned once every message of a batch has been processed, in request order.
+type batchResponse struct {
+	Summary batchSummary         `json:"summary"`
+	Results []*batchItemResponse `json:"results"`
+}
+
+// status returns the HTTP status of the batch: 200 when every message was posted, the status of
+// the failures when every message failed with the same one, and 207 otherwise.
+func (r *batchResponse) status() int {
+	if r.Summary.Failed == 0 {
+		return http.StatusOK
+	}
+	if r.Summary.Succeeded == 0 {
+		status := r.Results[0].ErrorCode
+		for _, result := range r.Results[1:] {
+			if result.ErrorCode != status {
+				return http.StatusMultiStatus
+			}
+		}
+		return status
+	}
+	return http.StatusMultiStatus
+}
+
+// handleWebhookBatch decodes a batchRequestBody and posts each of its messages as the bot. A
+// message that fails is reported in its result without stopping the others, and a batch with
+// both posted and failed messages is answered with 207.
+func (p *Plugin) handleWebhookBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		p.writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+		p.writeError(w, newHTTPError(http.StatusUnsupportedMediaType, "Content-Type must be application/json"))
+		return
+	}
+
+	data, err := readRequestBody(w, r)
+	if err != nil {
+		p.writeError(w, err)
+		return
+	}
+	signingTeam, err := p.verifySignature(r.Header, data, time.Now())
+	if err != nil {
+		p.writeError(w, err)
+		return
+	}
+
+	var batch batchRequestBody
+	if err = p.decodeBatchBody(data, &batch); err != nil {
+		p.writeError(w, err)
+		return
+	}
+	if len(batch.Messages) == 0 {
+		p.writeError(w, newValidationError("messages is required"))
+		return
+	}
+	if len(batch.Messages) > maxBatchMessages {
+		p.writeError(w, newValidationError("at most %d messages are allowed", maxBatchMessages))
+		return
+	}
+
+	if batch.DedupAttachments {
+		dedupBatchAttachments(batch.Messages)
+	}
+
+	response := &batchResponse{
+		Summary: batchSummary{Total: len(batch.Messages)},
+		Results: make([]*batchItemResponse, 0, len(batch.Messages)),
+	}
+	for i, body := range batch.Messages {
+		if body == nil {
+			response.Results = append(response.Results, newBatchItemError(i, newValidationError("message is required")))
+			response.Summary.Failed++
+			continue
+		}
+
+		body.signingTeam = signingTeam
+		result, processErr := p.processMessage(body, nil)
+		if processErr != nil {
+			herr, ok := processErr.(*httpError)
+			if !ok {
+				p.API.LogError("Failed to process batch message", "index", i, "err", processErr.Error())
+				herr = newHTTPError(http.StatusInternalServerError, "internal error")
+			}
+			response.Results = append(response.Results, newBatchItemError(i, herr))
+			response.Summary.Failed++
+			continue
+		}
+
+		p.logAudit(auditEventPostCreated,
+			"channel_id", body.ChannelID,
+			"post_id", result.PostID,
+			"source_ip", p.sourceIP(r),
+		)
+		response.Results = append(response.Results, &batchItemResponse{Index: i, webhookResponse: *result})
+		response.Summary.Succeeded++
+	}
+
+	writeJSON(w, response.status(), response)
+}
+
+// dedupBatchAttachments removes every attachment identical to one of an earlier message, or an
+// earlier one of the same message, so a repeated attachment is only shown once per batch.
+func dedupBatchAttachments(messages []*RequestBody) {
+	seen := map[[sha256.Size]byte]bool{}
+	for _, body := range messages {
+		if body == nil || len(body.Attachments) == 0 {
+			continue
+		}
+
+		kept := body.Attachments[:0]
+		for _, attachment := range body.Attachments {
+			data, err := json.Marshal(attachment)
+			if err != nil {
+				kept = append(kept, attachment)
+				continue
+			}
+			sum := sha256.Sum256(data)
+			if seen[sum] {
+				continue
+			}
+			seen[sum] = true
+			kept = append(kept, attachment)
+		}
+		body.Attachments = kept
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookBatch(t *testing.T) {
+	t.Run("all messages posted", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook/batch", `{"messages":[{"channel_id":"a","message":"one"},{"channel_id":"b","message":"two"}]}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 2)
+		assert.JSONEq(t, `{
+			"summary":{"total":2,"succeeded":2,"failed":0},
+			"results":[
+				{"index":0,"status":"ok","post_id":"post0"},
+				{"index":1,"status":"ok","post_id":"post1"}
+			]
+		}`, w.Body.String())
+	})
+
+	t.Run("mixed results are reported by index with 207", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook/batch", `{"messages":[{"channel_id":"a","message":"one"},{"channel_id":"b"},null,{"channel_id":"b","message":"two"}]}`)
+		require.Equal(t, http.StatusMultiStatus, w.Code)
+		require.Len(t, *posts, 2)
+		assert.Equal(t, "a", (*posts)[0].ChannelId)
+		assert.Equal(t, "b", (*posts)[1].ChannelId)
+
+		var response batchResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, batchSummary{Total: 4, Succeeded: 2, Failed: 2}, response.Summary)
+		require.Len(t, response.Results, 4)
+		for i, result := range response.Results {
+			assert.Equal(t, i, result.Index)
+		}
+		assert.Equal(t, "post0", response.Results[0].PostID)
+		assert.Equal(t, "error", response.Results[1].Status)
+		assert.Equal(t, http.StatusUnprocessableEntity, response.Results[1].ErrorCode)
+		assert.Equal(t, "message is required", response.Results[1].Error)
+		assert.Equal(t, "error", response.Results[2].Status)
+		assert.Equal(t, "post1", response.Results[3].PostID)
+		assert.Zero(t, response.Results[3].ErrorCode)
+	})
+
+	t.Run("all messages failed", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{Spaces: `[{"name":"HQ","url":"https://hq.ovice.in"}]`})
+
+		w := doRequest(p, http.MethodPost, "/webhook/batch", `{"messages":[{"channel_id":"a"},{"channel_id":"a","message":"hi","space":"Lab"}]}`)
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.JSONEq(t, `{
+			"summary":{"total":2,"succeeded":0,"failed":2},
+			"results":[
+				{"index":0,"status":"error","error_code":422,"error":"message is required"},
+				{"index":1,"status":"error","error_code":422,"error":"unknown space \"Lab\""}
+			]
+		}`, w.Body.String())
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("failures with different statuses are reported with 207", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		unmock(api, "HasPermissionToChannel")
+		api.On("HasPermissionToChannel", testBotUserID, "private", model.PermissionCreatePost).Return(false)
+
+		w := doRequest(p, http.MethodPost, "/webhook/batch", `{"messages":[{"channel_id":"a"},{"channel_id":"private","message":"hi"}]}`)
+		require.Equal(t, http.StatusMultiStatus, w.Code)
+
+		var response batchResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, batchSummary{Total: 2, Succeeded: 0, Failed: 2}, response.Summary)
+		assert.Equal(t, http.StatusUnprocessableEntity, response.Results[0].ErrorCode)
+		assert.Equal(t, http.StatusForbidden, response.Results[1].ErrorCode)
+	})
+
+	t.Run("repeated attachment is deduplicated", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook/batch", `{"dedup_attachments":true,"messages":[
+			{"channel_id":"a","message":"one","attachments":[{"title":"HQ banner","image_url":"https://hq.ovice.in/banner.png"}]},
+			{"channel_id":"a","message":"two","attachments":[{"title":"HQ banner","image_url":"https://hq.ovice.in/banner.png"},{"text":"Agenda"}]}
+		]}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 2)
+		require.Len(t, (*posts)[0].Attachments(), 1)
+		assert.Equal(t, "HQ banner", (*posts)[0].Attachments()[0].Title)
+		require.Len(t, (*posts)[1].Attachments(), 1)
+		assert.Equal(t, "Agenda", (*posts)[1].Attachments()[0].Text)
+	})
+
+	t.Run("distinct attachments are untouched", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook/batch", `{"dedup_attachments":true,"messages":[
+			{"channel_id":"a","message":"one","attachments":[{"title":"HQ"}]},
+			{"channel_id":"a","message":"two","attachments":[{"title":"Lab"}]}
+		]}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 2)
+		assert.Len(t, (*posts)[0].Attachments(), 1)
+		assert.Len(t, (*posts)[1].Attachments(), 1)
+	})
+
+	t.Run("repeated attachment is kept without dedup", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook/batch", `{"messages":[
+			{"channel_id":"a","message":"one","attachments":[{"title":"HQ banner"}]},
+			{"channel_id":"a","message":"two","attachments":[{"title":"HQ banner"}]}
+		]}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 2)
+		assert.Len(t, (*posts)[1].Attachments(), 1)
+	})
+
+	t.Run("empty batch", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, nil)
+
+		w := doRequest(p, http.MethodPost, "/webhook/batch", `{"messages":[]}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	botUsername    = "ovice"
+	botDisplayName = "oVice"
+	botDescription = "Posts notifications from oVice spaces."
+)
+
+// ensureBot returns the user ID of the bot with the given username, creating the bot if it does
+// not exist yet. An existing bot is reactivated if it was deactivated, and its display name and
+// description are brought up to date, as the plugin Helpers' EnsureBot did before it was moved
+// out of the server module.
+func (p *Plugin) ensureBot(username, displayName string) (string, error) {
+	user, appErr := p.API.GetUserByUsername(username)
+	if appErr != nil || user == nil {
+		bot, createErr := p.API.CreateBot(&model.Bot{
+			Username:    username,
+			DisplayName: displayName,
+			Description: botDescription,
+		})
+		if createErr != nil {
+			return "", errors.Wrapf(createErr, "failed to create bot %q", username)
+		}
+		return bot.UserId, nil
+	}
+	if !user.IsBot {
+		return "", errors.Errorf("user %q exists but is not a bot", username)
+	}
+
+	bot, appErr := p.API.GetBot(user.Id, true)
+	if appErr != nil {
+		return "", errors.Wrapf(appErr, "failed to get bot %q", username)
+	}
+	if bot.DeleteAt != 0 {
+		if bot, appErr = p.API.UpdateBotActive(user.Id, true); appErr != nil {
+			return "", errors.Wrapf(appErr, "failed to reactivate bot %q", username)
+		}
+	}
+	if bot.DisplayName != displayName || bot.Description != botDescription {
+		description := botDescription
+		if _, appErr = p.API.PatchBot(user.Id, &model.BotPatch{DisplayName: &displayName, Description: &description}); appErr != nil {
+			return "", errors.Wrapf(appErr, "failed to update bot %q", username)
+		}
+	}
+
+	return user.Id, nil
+}
+
+// sendDirectMessage posts message from the bot into its direct channel with userID.
+func (p *Plugin) sendDirectMessage(userID, message string) error {
+	_, err := p.sendDirectPost(userID, &model.Post{Message: message})
+	return err
+}
+
+// sendDirectPost creates post as the bot in its direct channel with userID.
+func (p *Plugin) sendDirectPost(userID string, post *model.Post) (*model.Post, error) {
+	channel, appErr := p.API.GetDirectChannel(p.botUserID, userID)
+	if appErr != nil {
+		return nil, errors.Wrapf(appErr, "failed to get direct channel with user %s", userID)
+	}
+
+	post.UserId = p.botUserID
+	post.ChannelId = channel.Id
+	created, appErr := p.createIntegrationPost(post)
+	if appErr != nil {
+		return nil, errors.Wrapf(appErr, "failed to send direct message to user %s", userID)
+	}
+
+	return created, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnsureBot(t *testing.T) {
+	current := &model.Bot{UserId: testBotUserID, Username: botUsername, DisplayName: botDisplayName, Description: botDescription}
+
+	t.Run("missing bot is created", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		api.On("GetUserByUsername", botUsername).Return(nil, &model.AppError{StatusCode: http.StatusNotFound})
+		api.On("CreateBot", mock.MatchedBy(func(bot *model.Bot) bool {
+			return bot.Username == botUsername && bot.DisplayName == botDisplayName
+		})).Return(current, nil).Once()
+
+		botUserID, err := p.ensureBot(botUsername, botDisplayName)
+		require.NoError(t, err)
+		assert.Equal(t, testBotUserID, botUserID)
+	})
+
+	t.Run("up-to-date bot is left alone", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		api.On("GetUserByUsername", botUsername).Return(&model.User{Id: testBotUserID, IsBot: true}, nil)
+		api.On("GetBot", testBotUserID, true).Return(current, nil)
+
+		botUserID, err := p.ensureBot(botUsername, botDisplayName)
+		require.NoError(t, err)
+		assert.Equal(t, testBotUserID, botUserID)
+		api.AssertNotCalled(t, "UpdateBotActive", mock.Anything, mock.Anything)
+		api.AssertNotCalled(t, "PatchBot", mock.Anything, mock.Anything)
+	})
+
+	t.Run("deactivated bot is reactivated", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		deactivated := *current
+		deactivated.DeleteAt = 1
+		api.On("GetUserByUsername", botUsername).Return(&model.User{Id: testBotUserID, IsBot: true, DeleteAt: 1}, nil)
+		api.On("GetBot", testBotUserID, true).Return(&deactivated, nil)
+		api.On("UpdateBotActive", testBotUserID, true).Return(current, nil).Once()
+
+		botUserID, err := p.ensureBot(botUsername, botDisplayName)
+		require.NoError(t, err)
+		assert.Equal(t, testBotUserID, botUserID)
+	})
+
+	t.Run("changed display name is updated", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		renamed := *current
+		renamed.DisplayName = "Old oVice"
+		api.On("GetUserByUsername", botUsername).Return(&model.User{Id: testBotUserID, IsBot: true}, nil)
+		api.On("GetBot", testBotUserID, true).Return(&renamed, nil)
+		api.On("PatchBot", testBotUserID, mock.MatchedBy(func(patch *model.BotPatch) bool {
+			return patch.DisplayName != nil && *patch.DisplayName == botDisplayName
+		})).Return(current, nil).Once()
+
+		_, err := p.ensureBot(botUsername, botDisplayName)
+		require.NoError(t, err)
+	})
+
+	t.Run("regular user is rejected", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		api.On("GetUserByUsername", botUsername).Return(&model.User{Id: "someone"}, nil)
+
+		_, err := p.ensureBot(botUsername, botDisplayName)
+		require.Error(t, err)
+		api.AssertNotCalled(t, "CreateBot", mock.Anything)
+	})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// capacityEvent is sent by oVice whenever the occupancy of a space changes.
+type capacityEvent struct {
+	Current   int    `json:"current"`
+	Max       int    `json:"max"`
+	SpaceName string `json:"space_name"`
+}
+
+// validate checks the fields a capacity event requires.
+func (e *capacityEvent) validate() error {
+	if e.SpaceName == "" {
+		return newValidationError("space_name is required")
+	}
+	if e.Max <= 0 {
+		return newValidationError("max must be positive")
+	}
+	return nil
+}
+
+// handleCapacityEvent DMs the configured admins when a space becomes full. Only the first event
+// of a full episode alerts; the episode ends once the space drops below capacity again.
+func (p *Plugin) handleCapacityEvent(data []byte) error {
+	var event capacityEvent
+	if err := decodeEvent(data, &event); err != nil {
+		return err
+	}
+	if err := event.validate(); err != nil {
+		return err
+	}
+
+	if err := p.recordOccupancy(event.SpaceName, event.Current, time.Now()); err != nil {
+		p.API.LogWarn("Failed to record space occupancy", "space_name", event.SpaceName, "err", err.Error())
+	}
+
+	key := hashedKey(capacityAlertKeyPrefix, event.SpaceName)
+	if event.Current < event.Max {
+		if appErr := p.API.KVDelete(key); appErr != nil {
+			return errors.Wrap(appErr, "failed to reset capacity alert")
+		}
+		return nil
+	}
+
+	first, err := p.kvSetIfAbsent(key, []byte("1"))
+	if err != nil {
+		return err
+	}
+	if !first {
+		return nil
+	}
+
+	message := fmt.Sprintf("The oVice space **%s** is full (%d/%d).", event.SpaceName, event.Current, event.Max)
+	for _, username := range splitList(p.getConfiguration().CapacityAlertUsernames) {
+		user, appErr := p.API.GetUserByUsername(strings.TrimPrefix(username, "@"))
+		if appErr != nil {
+			p.API.LogWarn("Failed to resolve capacity alert recipient", "username", username, "err", appErr.Error())
+			continue
+		}
+		if err = p.sendDirectMessage(user.Id, message); err != nil {
+			p.API.LogWarn("Failed to send capacity alert", "username", username, "err", err.Error())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCapacityEvent(t *testing.T) {
+	const (
+		full    = `{"event":"capacity","current":10,"max":10,"space_name":"HQ"}`
+		notFull = `{"event":"capacity","current":9,"max":10,"space_name":"HQ"}`
+	)
+
+	setup := func(t *testing.T) (*Plugin, *plugintest.API) {
+		p, api, _ := newTestPlugin(t, &configuration{CapacityAlertUsernames: "alice, @bob"})
+		api.On("GetUserByUsername", "alice").Return(&model.User{Id: "alice"}, nil)
+		api.On("GetUserByUsername", "bob").Return(&model.User{Id: "bob"}, nil)
+		api.On("GetDirectChannel", testBotUserID, "alice").Return(&model.Channel{Id: "dm-alice"}, nil)
+		api.On("GetDirectChannel", testBotUserID, "bob").Return(&model.Channel{Id: "dm-bob"}, nil)
+		api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(&model.Post{Id: "post"}, nil)
+		return p, api
+	}
+
+	t.Run("first full event alerts every admin", func(t *testing.T) {
+		p, api := setup(t)
+		w := doRequest(p, http.MethodPost, "/events", full)
+		assert.Equal(t, http.StatusOK, w.Code)
+		api.AssertCalled(t, "CreatePost", postMatcher("dm-alice", "**HQ** is full (10/10)"))
+		api.AssertCalled(t, "CreatePost", postMatcher("dm-bob", "**HQ** is full (10/10)"))
+	})
+
+	t.Run("repeat while still full is suppressed", func(t *testing.T) {
+		p, api := setup(t)
+		doRequest(p, http.MethodPost, "/events", full)
+		w := doRequest(p, http.MethodPost, "/events", `{"event":"capacity","current":11,"max":10,"space_name":"HQ"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		api.AssertNumberOfCalls(t, "CreatePost", 2)
+	})
+
+	t.Run("dropping below capacity resets the alert", func(t *testing.T) {
+		p, api := setup(t)
+		doRequest(p, http.MethodPost, "/events", full)
+		doRequest(p, http.MethodPost, "/events", notFull)
+		doRequest(p, http.MethodPost, "/events", full)
+		api.AssertNumberOfCalls(t, "CreatePost", 4)
+	})
+
+	t.Run("invalid max is rejected", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, nil)
+		w := doRequest(p, http.MethodPost, "/events", `{"event":"capacity","current":1,"max":0,"space_name":"HQ"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	})
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+// handleCategoryWebhook posts body to every channel of the sidebar category it selects, answering
+// with a result per channel like a batch. A channel the bot cannot post in, such as a private
+// channel it is not a member of, is reported in its result without stopping the others. The
+// caller has claimed idempotencyKey, if set; the result is stored under it once anything was
+// posted, and the claim released otherwise.
+func (p *Plugin) handleCategoryWebhook(w http.ResponseWriter, r *http.Request, body *RequestBody, idempotencyKey, bodyHash string) {
+	channelIDs, err := p.resolveCategoryChannelIDs(body)
+	if err != nil {
+		if idempotencyKey != "" {
+			p.releaseIdempotencyKey(idempotencyKey)
+		}
+		p.writeError(w, err)
+		return
+	}
+
+	response := &batchResponse{
+		Summary: batchSummary{Total: len(channelIDs)},
+		Results: make([]*batchItemResponse, 0, len(channelIDs)),
+	}
+	posted := false
+	for i, channelID := range channelIDs {
+		channelBody := *body
+		channelBody.Category = ""
+		channelBody.CategoryUserID = ""
+		channelBody.TeamName = ""
+		channelBody.ChannelID = channelID
+
+		result, processErr := p.processMessage(&channelBody, nil)
+		if processErr != nil {
+			herr, ok := processErr.(*httpError)
+			if !ok {
+				p.API.LogError("Failed to process category message", "channel_id", channelID, "err", processErr.Error())
+				herr = newHTTPError(http.StatusInternalServerError, "internal error")
+			}
+			item := newBatchItemError(i, herr)
+			item.ChannelID = channelID
+			response.Results = append(response.Results, item)
+			response.Summary.Failed++
+			continue
+		}
+
+		p.logAudit(auditEventPostCreated,
+			"channel_id", channelID,
+			"post_id", result.PostID,
+			"source_ip", p.sourceIP(r),
+			"idempotency_key", idempotencyKey,
+		)
+		if result.PostID != "" {
+			posted = true
+			p.sendReceipt(receiptEventID(body, idempotencyKey), result.PostID)
+		}
+		response.Results = append(response.Results, &batchItemResponse{Index: i, ChannelID: channelID, webhookResponse: *result})
+		response.Summary.Succeeded++
+	}
+
+	if idempotencyKey != "" {
+		if !posted {
+			p.releaseIdempotencyKey(idempotencyKey)
+		} else if err = p.storeIdempotentResponse(idempotencyKey, &idempotencyRecord{Batch: response, BodyHash: bodyHash}); err != nil {
+			p.API.LogWarn("Failed to store idempotency record", "idempotency_key", idempotencyKey, "err", err.Error())
+		}
+	}
+
+	writeJSON(w, response.status(), response)
+}
+
+// resolveCategoryChannelIDs returns the channels of the sidebar category body selects, in
+// sidebar order. Categories belong to a user, so the category is looked up by ID or display
+// name among the categories of CategoryUserID in the team named TeamName.
+func (p *Plugin) resolveCategoryChannelIDs(body *RequestBody) ([]string, error) {
+	for _, target := range []string{body.ChannelID, body.ChannelName, body.ChannelURL, body.DMUserID, body.RoomID} {
+		if target != "" {
+			return nil, newValidationError("category cannot be combined with channel_id, channel_name, channel_url, dm_user_id or room_id")
+		}
+	}
+	if body.TeamName == "" {
+		return nil, newValidationError("team_name is required with category")
+	}
+	if !model.IsValidId(body.CategoryUserID) {
+		return nil, newValidationError("category_user_id is required with category")
+	}
+
+	team, appErr := p.API.GetTeamByName(body.TeamName)
+	if appErr != nil {
+		if appErr.StatusCode == http.StatusNotFound {
+			return nil, newHTTPError(http.StatusNotFound, "team %q not found", body.TeamName)
+		}
+		return nil, errors.Wrap(appErr, "failed to get team by name")
+	}
+
+	categories, appErr := p.API.GetChannelSidebarCategories(body.CategoryUserID, team.Id)
+	if appErr != nil {
+		if appErr.StatusCode == http.StatusNotFound {
+			return nil, newHTTPError(http.StatusNotFound, "user %q not found in team %q", body.CategoryUserID, body.TeamName)
+		}
+		return nil, errors.Wrap(appErr, "failed to get sidebar categories")
+	}
+	for _, category := range categories.Categories {
+		if category.Id == body.Category || strings.EqualFold(category.DisplayName, body.Category) {
+			if len(category.Channels) > maxBatchMessages {
+				return nil, newValidationError("category %q has more than %d channels", body.Category, maxBatchMessages)
+			}
+			return category.Channels, nil
+		}
+	}
+	return nil, newHTTPError(http.StatusNotFound, "category %q not found in team %q", body.Category, body.TeamName)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCategoryWebhook(t *testing.T) {
+	const adminID = "adminuseridadminuseridabcd"
+
+	mockCategories := func(api *plugintest.API, channelIDs ...string) {
+		api.On("GetTeamByName", "office").Return(&model.Team{Id: "teamid", Name: "office"}, nil)
+		api.On("GetChannelSidebarCategories", adminID, "teamid").Return(&model.OrderedSidebarCategories{
+			Categories: model.SidebarCategoriesWithChannels{
+				{SidebarCategory: model.SidebarCategory{Id: "favorites", DisplayName: "Favorites"}, Channels: []string{"town"}},
+				{SidebarCategory: model.SidebarCategory{Id: "announcements", DisplayName: "Announcements"}, Channels: channelIDs},
+			},
+		}, nil)
+	}
+	const body = `{"category":"announcements","category_user_id":"` + adminID + `","team_name":"office","message":"All hands at 3pm"}`
+
+	t.Run("message is posted to every channel of the category", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockCategories(api, "general", "random", "news")
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", body)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response batchResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, batchSummary{Total: 3, Succeeded: 3, Failed: 0}, response.Summary)
+		require.Len(t, *posts, 3)
+		for i, channelID := range []string{"general", "random", "news"} {
+			assert.Equal(t, channelID, (*posts)[i].ChannelId)
+			assert.Equal(t, "All hands at 3pm", (*posts)[i].Message)
+			assert.Equal(t, channelID, response.Results[i].ChannelID)
+			assert.Equal(t, "ok", response.Results[i].Status)
+		}
+	})
+
+	t.Run("display name selects the category", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockCategories(api, "general")
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"category":"ANNOUNCEMENTS","category_user_id":"`+adminID+`","team_name":"office","message":"hi"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "general", (*posts)[0].ChannelId)
+	})
+
+	t.Run("inaccessible channel is reported without failing the others", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockCategories(api, "general", "private")
+		unmock(api, "HasPermissionToChannel")
+		api.On("HasPermissionToChannel", testBotUserID, "private", model.PermissionCreatePost).Return(false)
+		api.On("HasPermissionToChannel", testBotUserID, "general", model.PermissionCreatePost).Return(true)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", body)
+		require.Equal(t, http.StatusMultiStatus, w.Code)
+
+		var response batchResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, batchSummary{Total: 2, Succeeded: 1, Failed: 1}, response.Summary)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "general", (*posts)[0].ChannelId)
+		assert.Equal(t, "private", response.Results[1].ChannelID)
+		assert.Equal(t, "error", response.Results[1].Status)
+		assert.Equal(t, http.StatusForbidden, response.Results[1].ErrorCode)
+	})
+
+	t.Run("empty category posts nothing", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockCategories(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", body)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"summary":{"total":0,"succeeded":0,"failed":0},"results":[]}`, w.Body.String())
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("retry with an idempotency key returns the cached results", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockCategories(api, "general", "random")
+		posts := mockCreatePost(api)
+		header := http.Header{}
+		header.Set(idempotencyKeyHeader, "delivery-1")
+
+		first := doSignedRequest(p, "/webhook", body, header)
+		require.Equal(t, http.StatusOK, first.Code)
+		header.Set(deliveryAttemptHeader, "2")
+		retry := doSignedRequest(p, "/webhook", body, header)
+		require.Equal(t, http.StatusOK, retry.Code)
+		assert.JSONEq(t, first.Body.String(), retry.Body.String())
+		assert.Len(t, *posts, 2)
+	})
+
+	t.Run("category with too many channels is rejected", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		channelIDs := make([]string, maxBatchMessages+1)
+		for i := range channelIDs {
+			channelIDs[i] = fmt.Sprintf("channel%d", i)
+		}
+		mockCategories(api, channelIDs...)
+
+		w := doRequest(p, http.MethodPost, "/webhook", body)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), fmt.Sprintf("more than %d channels", maxBatchMessages))
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("unknown category is not found", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockCategories(api, "general")
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"category":"Lounges","category_user_id":"`+adminID+`","team_name":"office","message":"hi"}`)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("category requires a team and a user", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, nil)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"category":"announcements","category_user_id":"`+adminID+`","message":"hi"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+		w = doRequest(p, http.MethodPost, "/webhook", `{"category":"announcements","team_name":"office","message":"hi"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+		w = doRequest(p, http.MethodPost, "/webhook", `{"category":"announcements","channel_id":"town","category_user_id":"`+adminID+`","team_name":"office","message":"hi"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	})
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// channelInfoTTL bounds how long the names of a channel are reused before they are looked up
+// again, so renames show up without a lookup on every request.
+const channelInfoTTL = time.Minute
+
+// channelInfo holds the human-readable names of a channel reported in webhook responses.
+type channelInfo struct {
+	DisplayName string
+	TeamName    string
+
+	expiresAt time.Time
+}
+
+// getChannelInfo returns the display name of channelID and the name of its team, which is empty
+// for direct and group messages. Results are cached for channelInfoTTL.
+func (p *Plugin) getChannelInfo(channelID string, now time.Time) (*channelInfo, error) {
+	p.channelInfoLock.Lock()
+	cached, ok := p.channelInfo[channelID]
+	p.channelInfoLock.Unlock()
+	if ok && now.Before(cached.expiresAt) {
+		return cached, nil
+	}
+
+	channel, appErr := p.API.GetChannel(channelID)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get channel")
+	}
+	info := &channelInfo{DisplayName: channel.DisplayName, expiresAt: now.Add(channelInfoTTL)}
+	if channel.TeamId != "" {
+		team, teamErr := p.API.GetTeam(channel.TeamId)
+		if teamErr != nil {
+			return nil, errors.Wrap(teamErr, "failed to get team")
+		}
+		info.TeamName = team.Name
+	}
+
+	p.channelInfoLock.Lock()
+	defer p.channelInfoLock.Unlock()
+	if p.channelInfo == nil {
+		p.channelInfo = map[string]*channelInfo{}
+	}
+	// Expired entries of other channels are dropped here so the cache cannot grow without bound.
+	for id, entry := range p.channelInfo {
+		if !now.Before(entry.expiresAt) {
+			delete(p.channelInfo, id)
+		}
+	}
+	p.channelInfo[channelID] = info
+	return info, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+const (
+	// chartGlyphScale is how many pixels wide and high each dot of a chartGlyphs glyph is drawn.
+	chartGlyphScale = 2
+
+	// chartGlyphWidth and chartGlyphHeight are the size of a chartGlyphs glyph, in dots.
+	chartGlyphWidth  = 3
+	chartGlyphHeight = 5
+)
+
+// chartGlyphs is a 3x5 dot font covering the characters of chart axis labels. The charts are
+// drawn with the standard library alone, which ships no font.
+var chartGlyphs = map[rune][chartGlyphHeight]string{
+	'0': {"###", "#.#", "#.#", "#.#", "###"},
+	'1': {".#.", "##.", ".#.", ".#.", "###"},
+	'2': {"###", "..#", "###", "#..", "###"},
+	'3': {"###", "..#", "###", "..#", "###"},
+	'4': {"#.#", "#.#", "###", "..#", "..#"},
+	'5': {"###", "#..", "###", "..#", "###"},
+	'6': {"###", "#..", "###", "#.#", "###"},
+	'7': {"###", "..#", "..#", "..#", "..#"},
+	'8': {"###", "#.#", "###", "#.#", "###"},
+	'9': {"###", "#.#", "###", "..#", "###"},
+	'-': {"...", "...", "###", "...", "..."},
+	'h': {"#..", "#..", "###", "#.#", "#.#"},
+	'n': {"...", "...", "##.", "#.#", "#.#"},
+	'o': {"...", "...", "###", "#.#", "###"},
+	'w': {"...", "...", "#.#", "###", "###"},
+}
+
+// chartLabelWidth returns the width in pixels of text drawn by drawChartLabel.
+func chartLabelWidth(text string) int {
+	runes := len([]rune(text))
+	if runes == 0 {
+		return 0
+	}
+	return (runes*(chartGlyphWidth+1) - 1) * chartGlyphScale
+}
+
+// chartLabelHeight is the height in pixels of text drawn by drawChartLabel.
+const chartLabelHeight = chartGlyphHeight * chartGlyphScale
+
+// drawChartLabel draws text onto img with its top left corner at (x, y). Characters missing
+// from chartGlyphs are left blank.
+func drawChartLabel(img draw.Image, text string, x, y int, c color.Color) {
+	ink := &image.Uniform{C: c}
+	for _, r := range text {
+		glyph := chartGlyphs[r]
+		for row, dots := range glyph {
+			for col, dot := range dots {
+				if dot != '#' {
+					continue
+				}
+				left := x + col*chartGlyphScale
+				top := y + row*chartGlyphScale
+				draw.Draw(img, image.Rect(left, top, left+chartGlyphScale, top+chartGlyphScale), ink, image.Point{}, draw.Src)
+			}
+		}
+		x += (chartGlyphWidth + 1) * chartGlyphScale
+	}
+}
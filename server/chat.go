@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	// chatTruncatedMarker is appended to relayed chat messages that were cut short.
+	chatTruncatedMarker = "…(truncated)"
+
+	// chatSpaceProp holds the space a chat message posted as its sender came from, since the
+	// message itself does not say.
+	chatSpaceProp = "ovice_space_name"
+)
+
+// chatEvent is sent by oVice for every chat message posted in a space.
+type chatEvent struct {
+	UserEmail string `json:"user_email"`
+	UserName  string `json:"user_name"`
+	SpaceName string `json:"space_name"`
+	RoomID    string `json:"room_id"`
+	Message   string `json:"message"`
+
+	// URL links to the message in oVice, offered when the relayed copy is truncated.
+	URL string `json:"url"`
+}
+
+// validate checks the fields a chat event requires.
+func (e *chatEvent) validate() error {
+	if e.Message == "" {
+		return newValidationError("message is required")
+	}
+	if e.UserEmail == "" && e.UserName == "" {
+		return newValidationError("user_email or user_name is required")
+	}
+	return nil
+}
+
+// handleChatEvent relays an oVice chat message to the space's channel.
+func (p *Plugin) handleChatEvent(data []byte) error {
+	var event chatEvent
+	if err := decodeEvent(data, &event); err != nil {
+		return err
+	}
+	if err := event.validate(); err != nil {
+		return err
+	}
+
+	channelID := p.resolveSpaceChannelID(event.SpaceName, event.RoomID)
+	if channelID == "" {
+		return newHTTPError(http.StatusServiceUnavailable, "no channel is configured for chat relay")
+	}
+
+	muted, err := p.isChannelMuted(channelID)
+	if err != nil {
+		return err
+	}
+	if muted {
+		return nil
+	}
+
+	config := p.getConfiguration()
+	if config.ChatRateLimitPerMinute > 0 {
+		key := chatRateLimitKey(&event)
+		if !p.chatRateLimiter.allow(key, config.ChatRateLimitPerMinute, time.Now()).Allowed {
+			p.API.LogDebug("Dropping chat message over the per-user rate limit", "space_name", event.SpaceName, "user_name", event.UserName)
+			if config.ChatRateLimitWarning {
+				p.warnChatRateLimited(key, &event)
+			}
+			return nil
+		}
+	}
+
+	var user *model.User
+	if event.UserEmail != "" {
+		user = p.lookupUserByEmail(event.UserEmail)
+	}
+
+	limit := config.maxMessageRunes()
+	message := truncateChatMessage(sanitizeHTML(event.Message, config.ChatHTMLMode), config.MaxChatRelayLength, event.URL)
+	if utf8.RuneCountInString(message) > limit {
+		return newValidationError("message exceeds %d characters", limit)
+	}
+	if config.ChatPostAsUser && user != nil && p.relayChatAsUser(user, channelID, event.SpaceName, message) {
+		return nil
+	}
+
+	rendered := renderChatMessage(&event, user, message)
+	if utf8.RuneCountInString(rendered) > limit {
+		return newValidationError("message exceeds %d characters", limit)
+	}
+	post := &model.Post{
+		UserId:    p.botUserIDForSpace(event.SpaceName),
+		ChannelId: channelID,
+		Message:   rendered,
+	}
+	if _, appErr := p.createIntegrationPost(post); appErr != nil {
+		return errors.Wrap(appErr, "failed to relay chat message")
+	}
+
+	return nil
+}
+
+// relayChatAsUser posts message to channelID on behalf of user, reporting false if the user is
+// deactivated or not allowed to post there, so the message is relayed by the bot instead.
+func (p *Plugin) relayChatAsUser(user *model.User, channelID, spaceName, message string) bool {
+	if user.DeleteAt != 0 || !p.API.HasPermissionToChannel(user.Id, channelID, model.PermissionCreatePost) {
+		return false
+	}
+
+	post := &model.Post{
+		UserId:    user.Id,
+		ChannelId: channelID,
+		Message:   message,
+	}
+	if spaceName != "" {
+		post.AddProp(chatSpaceProp, spaceName)
+	}
+	if _, appErr := p.createIntegrationPost(post); appErr != nil {
+		p.API.LogWarn("Failed to relay chat message as its sender, relaying it as the bot", "user_id", user.Id, "err", appErr.Error())
+		return false
+	}
+	return true
+}
+
+// chatRateLimitKey identifies the sender of a chat message in chatRateLimiter.
+func chatRateLimitKey(event *chatEvent) string {
+	sender := event.UserEmail
+	if sender == "" {
+		sender = event.UserName
+	}
+	return strings.ToLower(event.SpaceName) + "\n" + strings.ToLower(sender)
+}
+
+// warnChatRateLimited DMs the sender of a dropped chat message that they are sending too fast,
+// at most once a minute. Senders without a Mattermost account are not warned.
+func (p *Plugin) warnChatRateLimited(key string, event *chatEvent) {
+	if event.UserEmail == "" || !p.chatWarningLimiter.allow(key, 1, time.Now()).Allowed {
+		return
+	}
+	user := p.lookupUserByEmail(event.UserEmail)
+	if user == nil {
+		return
+	}
+
+	locale := p.resolveUserLocale(user.Id)
+	message := translate(locale, "You are sending chat messages in the oVice space too quickly, so some of them were not relayed to Mattermost.")
+	if event.SpaceName != "" {
+		message = translate(locale, "You are sending chat messages in **%s** too quickly, so some of them were not relayed to Mattermost.", event.SpaceName)
+	}
+	if err := p.sendDirectMessage(user.Id, message); err != nil {
+		p.API.LogWarn("Failed to warn a rate-limited chat sender", "user_id", user.Id, "err", err.Error())
+	}
+}
+
+// renderChatMessage prefixes message with its author and, when known, the space it was sent in.
+func renderChatMessage(event *chatEvent, user *model.User, message string) string {
+	name := presenceDisplayName(&presenceEvent{UserEmail: event.UserEmail, UserName: event.UserName}, user)
+	if event.SpaceName == "" {
+		return fmt.Sprintf("%s: %s", name, message)
+	}
+	return fmt.Sprintf("%s in **%s**: %s", name, event.SpaceName, message)
+}
+
+// truncateChatMessage cuts message down to limit runes and marks it as truncated, linking to
+// fullURL when it is a valid http(s) URL. A limit of zero or less leaves message untouched.
+func truncateChatMessage(message string, limit int, fullURL string) string {
+	runes := []rune(message)
+	if limit <= 0 || len(runes) <= limit {
+		return message
+	}
+
+	truncated := string(runes[:limit]) + chatTruncatedMarker
+	if isHTTPURL(fullURL) {
+		truncated += " [View full message](" + fullURL + ")"
+	}
+	return truncated
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTruncateChatMessage(t *testing.T) {
+	t.Run("under the limit", func(t *testing.T) {
+		assert.Equal(t, "hello", truncateChatMessage("hello", 5, "https://hq.ovice.in/chat/1"))
+		assert.Equal(t, "hello", truncateChatMessage("hello", 0, ""))
+	})
+
+	t.Run("over the limit", func(t *testing.T) {
+		assert.Equal(t, "hello…(truncated)", truncateChatMessage("hello world", 5, ""))
+		assert.Equal(t, "hello…(truncated) [View full message](https://hq.ovice.in/chat/1)", truncateChatMessage("hello world", 5, "https://hq.ovice.in/chat/1"))
+		assert.Equal(t, "hello…(truncated)", truncateChatMessage("hello world", 5, "javascript:alert(1)"))
+	})
+
+	t.Run("multibyte characters are cut on a rune boundary", func(t *testing.T) {
+		assert.Equal(t, "こんに…(truncated)", truncateChatMessage("こんにちは世界", 3, ""))
+		assert.Equal(t, "🎉🎉…(truncated)", truncateChatMessage("🎉🎉🎉", 2, ""))
+	})
+}
+
+func TestChatEvent(t *testing.T) {
+	const event = `{"event":"chat","user_name":"Alice","space_name":"HQ","message":"こんにちは世界","url":"https://hq.ovice.in/chat/1"}`
+
+	t.Run("relays the message in full", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town"})
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/events", event)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "town", (*posts)[0].ChannelId)
+		assert.Equal(t, "Alice in **HQ**: こんにちは世界", (*posts)[0].Message)
+	})
+
+	t.Run("truncates past the configured length", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town", MaxChatRelayLength: 5})
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/events", event)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "Alice in **HQ**: こんにちは…(truncated) [View full message](https://hq.ovice.in/chat/1)", (*posts)[0].Message)
+	})
+
+	t.Run("mentions the resolved user", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town"})
+		api.On("GetUserByEmail", "alice@example.com").Return(&model.User{Id: "alice", Username: "alice"}, nil)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/events", `{"event":"chat","user_email":"alice@example.com","message":"hi"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "@alice: hi", (*posts)[0].Message)
+	})
+
+	t.Run("empty message is rejected", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town"})
+
+		w := doRequest(p, http.MethodPost, "/events", `{"event":"chat","user_name":"Alice"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+}
+
+func TestChatRateLimit(t *testing.T) {
+	chat := func(p *Plugin, email, message string) int {
+		return doRequest(p, http.MethodPost, "/events", `{"event":"chat","user_email":"`+email+`","space_name":"HQ","message":"`+message+`"}`).Code
+	}
+	setup := func(t *testing.T, config *configuration) (*Plugin, *plugintest.API, *[]*model.Post) {
+		p, api, _ := newTestPlugin(t, config)
+		api.On("GetUserByEmail", "alice@example.com").Return(&model.User{Id: "alice", Username: "alice"}, nil)
+		api.On("GetUserByEmail", "bob@example.com").Return(&model.User{Id: "bob", Username: "bob"}, nil).Maybe()
+		return p, api, mockCreatePost(api)
+	}
+
+	t.Run("caps each user", func(t *testing.T) {
+		p, _, posts := setup(t, &configuration{DefaultChannelID: "town", ChatRateLimitPerMinute: 2})
+
+		for _, message := range []string{"one", "two", "three"} {
+			require.Equal(t, http.StatusOK, chat(p, "alice@example.com", message))
+		}
+		require.Len(t, *posts, 2)
+		assert.Equal(t, "@alice in **HQ**: two", (*posts)[1].Message)
+	})
+
+	t.Run("other users are unaffected", func(t *testing.T) {
+		p, _, posts := setup(t, &configuration{DefaultChannelID: "town", ChatRateLimitPerMinute: 1})
+
+		require.Equal(t, http.StatusOK, chat(p, "alice@example.com", "one"))
+		require.Equal(t, http.StatusOK, chat(p, "alice@example.com", "two"))
+		require.Equal(t, http.StatusOK, chat(p, "bob@example.com", "hello"))
+		require.Len(t, *posts, 2)
+		assert.Equal(t, "@bob in **HQ**: hello", (*posts)[1].Message)
+	})
+
+	t.Run("warns the dropped user once", func(t *testing.T) {
+		p, api, posts := setup(t, &configuration{DefaultChannelID: "town", ChatRateLimitPerMinute: 1, ChatRateLimitWarning: true})
+		api.On("GetDirectChannel", testBotUserID, "alice").Return(&model.Channel{Id: "dm-alice"}, nil)
+		mockUserLocale(api, "alice", "")
+
+		for _, message := range []string{"one", "two", "three"} {
+			require.Equal(t, http.StatusOK, chat(p, "alice@example.com", message))
+		}
+		require.Len(t, *posts, 2)
+		assert.Equal(t, "dm-alice", (*posts)[1].ChannelId)
+		assert.Equal(t, "You are sending chat messages in **HQ** too quickly, so some of them were not relayed to Mattermost.", (*posts)[1].Message)
+	})
+
+	t.Run("unlimited by default", func(t *testing.T) {
+		p, _, posts := setup(t, &configuration{DefaultChannelID: "town"})
+
+		for i := 0; i < 5; i++ {
+			require.Equal(t, http.StatusOK, chat(p, "alice@example.com", "hi"))
+		}
+		assert.Len(t, *posts, 5)
+	})
+
+	t.Run("idle senders are pruned", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, nil)
+		now := time.Now()
+
+		alice := chatRateLimitKey(&chatEvent{UserEmail: "alice@example.com", SpaceName: "HQ"})
+		bob := chatRateLimitKey(&chatEvent{UserEmail: "Bob@Example.com", SpaceName: "hq"})
+		assert.True(t, p.chatRateLimiter.allow(alice, 1, now).Allowed)
+		assert.Equal(t, 1, p.chatRateLimiter.size())
+
+		assert.True(t, p.chatRateLimiter.allow(bob, 1, now.Add(2*time.Minute)).Allowed)
+		assert.Equal(t, 1, p.chatRateLimiter.size())
+		assert.Equal(t, chatRateLimitKey(&chatEvent{UserEmail: "bob@example.com", SpaceName: "HQ"}), bob)
+	})
+}
+
+func TestChatPostAsUser(t *testing.T) {
+	const event = `{"event":"chat","user_email":"alice@example.com","user_name":"Alice","space_name":"HQ","message":"brb"}`
+	config := &configuration{DefaultChannelID: "town", ChatPostAsUser: true, SignatureScheme: signatureSchemeHMACSimple, WebhookSecret: "secret"}
+	sendEvent := func(p *Plugin, event string) int {
+		return doSignedRequest(p, "/events", event, signHMACSimple("secret", event)).Code
+	}
+	alice := &model.User{Id: "alice", Username: "alice"}
+
+	t.Run("linked sender is the author", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		api.On("GetUserByEmail", "alice@example.com").Return(alice, nil)
+		api.On("HasPermissionToChannel", "alice", "town", model.PermissionCreatePost).Return(true)
+		posts := mockCreatePost(api)
+
+		require.Equal(t, http.StatusOK, sendEvent(p, event))
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "alice", (*posts)[0].UserId)
+		assert.Equal(t, "brb", (*posts)[0].Message)
+		assert.Equal(t, "HQ", (*posts)[0].GetProp(chatSpaceProp))
+	})
+
+	t.Run("unlinked sender falls back to the bot", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		api.On("GetUserByEmail", "alice@example.com").Return(nil, &model.AppError{Message: "not found", StatusCode: http.StatusNotFound})
+		posts := mockCreatePost(api)
+
+		require.Equal(t, http.StatusOK, sendEvent(p, event))
+		require.Len(t, *posts, 1)
+		assert.Equal(t, testBotUserID, (*posts)[0].UserId)
+		assert.Equal(t, "Alice in **HQ**: brb", (*posts)[0].Message)
+	})
+
+	t.Run("sender without permission falls back to the bot", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		api.On("GetUserByEmail", "alice@example.com").Return(alice, nil)
+		api.On("HasPermissionToChannel", "alice", "town", model.PermissionCreatePost).Return(false)
+		posts := mockCreatePost(api)
+
+		require.Equal(t, http.StatusOK, sendEvent(p, event))
+		require.Len(t, *posts, 1)
+		assert.Equal(t, testBotUserID, (*posts)[0].UserId)
+		assert.Equal(t, "@alice in **HQ**: brb", (*posts)[0].Message)
+	})
+
+	t.Run("rejected user post falls back to the bot", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		api.On("GetUserByEmail", "alice@example.com").Return(alice, nil)
+		api.On("HasPermissionToChannel", "alice", "town", model.PermissionCreatePost).Return(true)
+		api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool { return post.UserId == "alice" })).
+			Return(nil, &model.AppError{Message: "forbidden", StatusCode: http.StatusForbidden})
+		posts := mockCreatePost(api)
+
+		require.Equal(t, http.StatusOK, sendEvent(p, event))
+		require.Len(t, *posts, 1)
+		assert.Equal(t, testBotUserID, (*posts)[0].UserId)
+		assert.Equal(t, "@alice in **HQ**: brb", (*posts)[0].Message)
+	})
+
+	t.Run("requires a signature scheme", func(t *testing.T) {
+		assert.Error(t, (&configuration{ChatPostAsUser: true}).process())
+	})
+
+	t.Run("message over the length limit is rejected", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town", ChatPostAsUser: true, SignatureScheme: signatureSchemeHMACSimple, WebhookSecret: "secret", MaxMessageLength: 10})
+		api.On("GetUserByEmail", "alice@example.com").Return(alice, nil)
+
+		long := `{"event":"chat","user_email":"alice@example.com","space_name":"HQ","message":"this is far too long"}`
+		assert.Equal(t, http.StatusUnprocessableEntity, sendEvent(p, long))
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+const (
+	// maxCheckMappingEmails caps the emails one /ovice check-mapping looks up.
+	maxCheckMappingEmails = 500
+
+	// maxListedUnmatchedEmails caps the unmatched emails listed in the reply.
+	maxListedUnmatchedEmails = 20
+)
+
+// executeCheckMappingCommand shows a system admin how many of a list of oVice emails resolve to
+// a Mattermost account the way presence events do, listing the ones that do not.
+func (p *Plugin) executeCheckMappingCommand(args *model.CommandArgs, params []string, locale string) *model.CommandResponse {
+	if !p.API.HasPermissionTo(args.UserId, model.PermissionManageSystem) {
+		return ephemeralResponse(translate(locale, "Only system admins can check the oVice email mapping."))
+	}
+
+	// params are already split on spaces and line breaks, so a pasted list with one email per
+	// line works as well as a comma-separated one.
+	var emails []string
+	seen := map[string]bool{}
+	for _, param := range params {
+		for _, email := range splitList(param) {
+			if key := strings.ToLower(email); !seen[key] {
+				seen[key] = true
+				emails = append(emails, email)
+			}
+		}
+	}
+	trigger := p.getConfiguration().commandTrigger()
+	if len(emails) == 0 {
+		return ephemeralResponse(translate(locale, "Usage: `/%s check-mapping <emails>`, with one email per line.", trigger))
+	}
+	if len(emails) > maxCheckMappingEmails {
+		return ephemeralResponse(translate(locale, "At most %d emails can be checked at once.", maxCheckMappingEmails))
+	}
+
+	var unmatched []string
+	for _, email := range emails {
+		if _, appErr := p.API.GetUserByEmail(email); appErr != nil {
+			if appErr.StatusCode != http.StatusNotFound {
+				p.API.LogWarn("Failed to look up user by email", "err", appErr.Error())
+				return ephemeralResponse(translate(locale, "Failed to look up the emails. Please try again later."))
+			}
+			unmatched = append(unmatched, email)
+		}
+	}
+
+	lines := []string{translate(locale, "%d of %d emails match a Mattermost account.", len(emails)-len(unmatched), len(emails))}
+	if len(unmatched) > 0 {
+		lines = append(lines, translate(locale, "Unmatched emails:"))
+		for i, email := range unmatched {
+			if i == maxListedUnmatchedEmails {
+				lines = append(lines, translate(locale, "…and %d more.", len(unmatched)-maxListedUnmatchedEmails))
+				break
+			}
+			lines = append(lines, "- "+email)
+		}
+	}
+	return ephemeralResponse(strings.Join(lines, "\n"))
+}
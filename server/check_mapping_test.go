@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCheckMappingCommand(t *testing.T) {
+	setup := func(t *testing.T) (*Plugin, *plugintest.API) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockUserLocale(api, "admin", "")
+		api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true)
+		api.On("GetUserByEmail", "alice@example.com").Return(&model.User{Id: "alice"}, nil).Maybe()
+		api.On("GetUserByEmail", "BOB@example.com").Return(&model.User{Id: "bob"}, nil).Maybe()
+		api.On("GetUserByEmail", mock.AnythingOfType("string")).Return(nil, &model.AppError{Message: "not found", StatusCode: http.StatusNotFound})
+		return p, api
+	}
+
+	t.Run("all emails match", func(t *testing.T) {
+		p, _ := setup(t)
+
+		assert.Equal(t, "2 of 2 emails match a Mattermost account.",
+			executeCommand(t, p, "admin", "town", "/ovice check-mapping alice@example.com\nBOB@example.com\nalice@example.com"))
+	})
+
+	t.Run("unmatched emails are listed", func(t *testing.T) {
+		p, _ := setup(t)
+
+		assert.Equal(t, "1 of 3 emails match a Mattermost account.\nUnmatched emails:\n- carol@example.com\n- dave@example.com",
+			executeCommand(t, p, "admin", "town", "/ovice check-mapping carol@example.com, alice@example.com\ndave@example.com"))
+	})
+
+	t.Run("a long unmatched list is truncated", func(t *testing.T) {
+		p, _ := setup(t)
+		var emails []string
+		for i := 0; i < maxListedUnmatchedEmails+5; i++ {
+			emails = append(emails, fmt.Sprintf("guest%d@example.com", i))
+		}
+
+		reply := executeCommand(t, p, "admin", "town", "/ovice check-mapping "+strings.Join(emails, "\n"))
+		lines := strings.Split(reply, "\n")
+		assert.Equal(t, "0 of 25 emails match a Mattermost account.", lines[0])
+		assert.Len(t, lines, 2+maxListedUnmatchedEmails+1)
+		assert.Equal(t, "- guest19@example.com", lines[len(lines)-2])
+		assert.Equal(t, "…and 5 more.", lines[len(lines)-1])
+	})
+
+	t.Run("requires a system admin", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockUserLocale(api, "alice", "")
+		api.On("HasPermissionTo", "alice", model.PermissionManageSystem).Return(false)
+
+		assert.Equal(t, "Only system admins can check the oVice email mapping.", executeCommand(t, p, "alice", "town", "/ovice check-mapping alice@example.com"))
+		api.AssertNotCalled(t, "GetUserByEmail", mock.Anything)
+	})
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin"
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultCommandTrigger is used when CommandTrigger is not configured.
+	defaultCommandTrigger = "ovice"
+
+	// commandLangFlag overrides the locale of a single reply, e.g. `/ovice join --lang=ja`.
+	commandLangFlag = "--lang="
+)
+
+// commandHandler executes a single /ovice subcommand. params holds the words following the
+// subcommand name, and locale the language to reply in.
+type commandHandler struct {
+	Description string
+	Execute     func(p *Plugin, args *model.CommandArgs, params []string, locale string) *model.CommandResponse
+
+	// Mutating marks subcommands that post to a channel or change plugin state, which only the
+	// users in CommandAllowlist may run when it is set.
+	Mutating bool
+}
+
+var commandHandlers = map[string]commandHandler{
+	"check-mapping": {
+		Description: "Check how many of a list of oVice emails match a Mattermost account (system admins only)",
+		Execute:     (*Plugin).executeCheckMappingCommand,
+	},
+	"chart": {
+		Description: "Show a chart of an oVice space's occupancy over the last day, e.g. `chart HQ`",
+		Execute:     (*Plugin).executeChartCommand,
+		Mutating:    true,
+	},
+	"export": {
+		Description: "Export the oVice links and channel mutes of this server (system admins only)",
+		Execute:     (*Plugin).executeExportCommand,
+	},
+	"feedback": {
+		Description: "Send feedback to the moderators of this team, e.g. `feedback The HQ link is broken`",
+		Execute:     (*Plugin).executeFeedbackCommand,
+		Mutating:    true,
+	},
+	"import": {
+		Description: "Import oVice links and channel mutes exported from another server (system admins only)",
+		Execute:     (*Plugin).executeImportCommand,
+		Mutating:    true,
+	},
+	"join": {
+		Description: "Show the link to join an oVice space, e.g. `join HQ`",
+		Execute:     (*Plugin).executeJoinCommand,
+	},
+	"mute": {
+		Description: "Mute oVice presence and chat notifications in this channel",
+		Execute:     (*Plugin).executeMuteCommand,
+		Mutating:    true,
+	},
+	"poll": {
+		Description: "Post a yes/no poll to the channel, e.g. `poll Should we keep the space open?`",
+		Execute:     (*Plugin).executePollCommand,
+		Mutating:    true,
+	},
+	"simulate": {
+		Description: "Preview the presence notification of a user in this channel, e.g. `simulate enter @alice HQ` (system admins only)",
+		Execute:     (*Plugin).executeSimulateCommand,
+		Mutating:    true,
+	},
+	"summary": {
+		Description: "Post the daily summary of an oVice space and start its counters over, e.g. `summary HQ`",
+		Execute:     (*Plugin).executeSummaryCommand,
+		Mutating:    true,
+	},
+	"token": {
+		Description: "Get a personal token that lets your apps send you direct messages from the bot, or `token revoke` it",
+		Execute:     (*Plugin).executeTokenCommand,
+		Mutating:    true,
+	},
+	"unmute": {
+		Description: "Unmute oVice presence and chat notifications in this channel",
+		Execute:     (*Plugin).executeUnmuteCommand,
+		Mutating:    true,
+	},
+	"me": {
+		Description: "Show the oVice email and space linked to your account",
+		Execute:     (*Plugin).executeMeCommand,
+	},
+	"uptime": {
+		Description: "Show how long an oVice space has been active, e.g. `uptime HQ`",
+		Execute:     (*Plugin).executeUptimeCommand,
+	},
+}
+
+// builtinCommandTriggers are the slash commands built into Mattermost, which CommandTrigger must
+// not shadow.
+var builtinCommandTriggers = map[string]bool{
+	"away": true, "code": true, "collapse": true, "dnd": true, "echo": true, "expand": true,
+	"groupmsg": true, "header": true, "help": true, "invite": true, "invite_people": true,
+	"join": true, "kick": true, "leave": true, "logout": true, "me": true, "msg": true,
+	"mute": true, "offline": true, "online": true, "open": true, "purpose": true, "remove": true,
+	"rename": true, "search": true, "settings": true, "shortcuts": true, "shrug": true,
+}
+
+// validateCommandTrigger checks that trigger can be registered as a slash command.
+func validateCommandTrigger(trigger string) error {
+	switch {
+	case strings.HasPrefix(trigger, "/"):
+		return errors.New("must not start with a slash")
+	case strings.ContainsAny(trigger, " \t\n"):
+		return errors.New("must be a single word")
+	case utf8.RuneCountInString(trigger) > model.MaxTriggerLength:
+		return errors.Errorf("must be at most %d characters", model.MaxTriggerLength)
+	case builtinCommandTriggers[strings.ToLower(trigger)]:
+		return errors.Errorf("/%s is a built-in command", trigger)
+	}
+	return nil
+}
+
+// registerCommands registers the configured trigger, unregistering the previously registered
+// one if the trigger changed.
+func (p *Plugin) registerCommands() error {
+	trigger := p.getConfiguration().commandTrigger()
+	if trigger == p.registeredTrigger {
+		return nil
+	}
+
+	if p.registeredTrigger != "" {
+		if err := p.API.UnregisterCommand("", p.registeredTrigger); err != nil {
+			return errors.Wrapf(err, "failed to unregister /%s", p.registeredTrigger)
+		}
+		p.registeredTrigger = ""
+	}
+
+	if err := p.API.RegisterCommand(&model.Command{
+		Trigger:          trigger,
+		DisplayName:      "oVice",
+		Description:      "Interact with oVice spaces.",
+		AutoComplete:     true,
+		AutoCompleteDesc: "Available commands: " + strings.Join(commandNames(), ", "),
+		AutoCompleteHint: "[command]",
+	}); err != nil {
+		return errors.Wrapf(err, "failed to register /%s", trigger)
+	}
+	p.registeredTrigger = trigger
+
+	return nil
+}
+
+// ExecuteCommand dispatches /ovice to the handler of its subcommand, replying in the user's
+// locale unless a --lang flag overrides it.
+func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	fields := strings.Fields(args.Command)
+	if len(fields) > 0 {
+		fields = fields[1:]
+	}
+	fields, lang := parseLangFlag(fields)
+
+	locale, note := "", ""
+	if lang != "" {
+		if supported, ok := supportedLocale(lang); ok {
+			locale = supported
+		} else {
+			locale = p.resolveUserLocale(args.UserId)
+			note = translate(locale, "Language `%s` is not supported, so this reply uses `%s`. Supported languages: %s.",
+				lang, locale, strings.Join(supportedLocales(), ", "))
+		}
+	} else {
+		locale = p.resolveUserLocale(args.UserId)
+	}
+
+	response := p.dispatchCommand(args, fields, locale)
+	if note != "" {
+		response.Text = note + "\n\n" + response.Text
+	}
+	return response, nil
+}
+
+// dispatchCommand runs the subcommand named by fields[0] with the remaining fields as params.
+func (p *Plugin) dispatchCommand(args *model.CommandArgs, fields []string, locale string) *model.CommandResponse {
+	if len(fields) == 0 {
+		return ephemeralResponse(commandHelp(p.getConfiguration().commandTrigger(), locale))
+	}
+
+	handler, ok := commandHandlers[strings.ToLower(fields[0])]
+	if !ok {
+		return ephemeralResponse(translate(locale, "Unknown command `%s`.", fields[0]) + "\n\n" + commandHelp(p.getConfiguration().commandTrigger(), locale))
+	}
+
+	if handler.Mutating && !p.isCommandAllowed(args) {
+		return ephemeralResponse(translate(locale, "You are not allowed to run `/%s %s`. Please ask a system admin for access.",
+			p.getConfiguration().commandTrigger(), strings.ToLower(fields[0])))
+	}
+
+	return handler.Execute(p, args, fields[1:], locale)
+}
+
+// isCommandAllowed reports whether the user of args may run mutating subcommands: anyone when
+// CommandAllowlist is empty, else the users it lists by ID and the holders of the system, team
+// or channel roles it lists. A failed role lookup denies the command.
+func (p *Plugin) isCommandAllowed(args *model.CommandArgs) bool {
+	allowed := map[string]bool{}
+	for _, entry := range splitList(p.getConfiguration().CommandAllowlist) {
+		allowed[entry] = true
+	}
+	if len(allowed) == 0 || allowed[args.UserId] {
+		return true
+	}
+
+	hasRole := func(roles string) bool {
+		for _, role := range strings.Fields(roles) {
+			if allowed[role] {
+				return true
+			}
+		}
+		return false
+	}
+
+	user, appErr := p.API.GetUser(args.UserId)
+	if appErr != nil {
+		p.API.LogWarn("Failed to get user to check the command allowlist", "user_id", args.UserId, "err", appErr.Error())
+		return false
+	}
+	if hasRole(user.Roles) {
+		return true
+	}
+	if args.TeamId != "" {
+		if member, appErr := p.API.GetTeamMember(args.TeamId, args.UserId); appErr == nil && hasRole(member.Roles) {
+			return true
+		}
+	}
+	if member, appErr := p.API.GetChannelMember(args.ChannelId, args.UserId); appErr == nil && hasRole(member.Roles) {
+		return true
+	}
+	return false
+}
+
+// parseLangFlag removes a --lang=<locale> flag from fields, returning the remaining fields and
+// the requested locale.
+func parseLangFlag(fields []string) ([]string, string) {
+	var rest []string
+	lang := ""
+	for _, field := range fields {
+		if strings.HasPrefix(strings.ToLower(field), commandLangFlag) {
+			lang = field[len(commandLangFlag):]
+			continue
+		}
+		rest = append(rest, field)
+	}
+	return rest, lang
+}
+
+// executeMeCommand tells the user which oVice email and space apply to them.
+func (p *Plugin) executeMeCommand(args *model.CommandArgs, _ []string, locale string) *model.CommandResponse {
+	var lines []string
+
+	email, err := p.getLinkedEmail(args.UserId)
+	switch {
+	case err != nil:
+		p.API.LogWarn("Failed to get linked oVice email", "user_id", args.UserId, "err", err.Error())
+		return ephemeralResponse(translate(locale, "Failed to look up your oVice link. Please try again later."))
+	case email != "":
+		lines = append(lines, translate(locale, "Your account is linked to the oVice email **%s**.", email))
+	default:
+		user, appErr := p.API.GetUser(args.UserId)
+		if appErr != nil {
+			p.API.LogWarn("Failed to get user", "user_id", args.UserId, "err", appErr.Error())
+			return ephemeralResponse(translate(locale, "Failed to look up your account. Please try again later."))
+		}
+		lines = append(lines, translate(locale, "Your account is not linked to an oVice email, so your Mattermost email **%s** is used.", user.Email))
+	}
+
+	if url := p.resolveSpaceURL(""); url != "" {
+		lines = append(lines, translate(locale, "Your oVice space: %s", url))
+	} else {
+		lines = append(lines, translate(locale, "No oVice space is configured."))
+	}
+
+	return ephemeralResponse(strings.Join(lines, "\n"))
+}
+
+// executeJoinCommand shows the link to join the named space, or the default space.
+// With JoinLinkSecret set, the link is signed for the user and expires shortly.
+func (p *Plugin) executeJoinCommand(args *model.CommandArgs, params []string, locale string) *model.CommandResponse {
+	spaceName := strings.Join(params, " ")
+	url := p.resolveSpaceURL(spaceName)
+	if url != "" {
+		signed, err := p.mintJoinURL(args.UserId, spaceName, time.Now())
+		if err != nil {
+			p.API.LogWarn("Failed to sign join link", "user_id", args.UserId, "err", err.Error())
+			return ephemeralResponse(translate(locale, "Failed to look up the space. Please try again later."))
+		}
+		if signed != "" {
+			url = signed
+		}
+	}
+
+	switch {
+	case url == "":
+		return ephemeralResponse(translate(locale, "No oVice space is configured."))
+	case spaceName == "":
+		return ephemeralResponse(translate(locale, "Join the oVice space: %s", url))
+	default:
+		return ephemeralResponse(translate(locale, "Join **%s**: %s", spaceName, url))
+	}
+}
+
+// postedResponse confirms to the user who ran a command the post it created, with a permalink
+// when the server has a SiteURL. A post made outside the channel the command was run in names
+// its channel as well.
+func (p *Plugin) postedResponse(args *model.CommandArgs, post *model.Post, locale string) *model.CommandResponse {
+	info, err := p.getChannelInfo(post.ChannelId, time.Now())
+	if err != nil {
+		p.API.LogWarn("Failed to get channel of created post", "post_id", post.Id, "err", err.Error())
+		return ephemeralResponse(translate(locale, "Posted."))
+	}
+
+	link := p.postPermalink(post, info.TeamName, args.TeamId)
+	switch {
+	case post.ChannelId == args.ChannelId && link == "":
+		return ephemeralResponse(translate(locale, "Posted."))
+	case post.ChannelId == args.ChannelId:
+		return ephemeralResponse(translate(locale, "Posted: %s", link))
+	case link == "":
+		return ephemeralResponse(translate(locale, "Posted to **%s**.", info.DisplayName))
+	default:
+		return ephemeralResponse(translate(locale, "Posted to **%s**: %s", info.DisplayName, link))
+	}
+}
+
+// postPermalink returns the permalink of post in teamName, or an empty string when the server
+// has no SiteURL. Posts in direct and group messages, which have no team, are linked through
+// fallbackTeamID.
+func (p *Plugin) postPermalink(post *model.Post, teamName, fallbackTeamID string) string {
+	siteURL := p.API.GetConfig().ServiceSettings.SiteURL
+	if siteURL == nil || *siteURL == "" {
+		return ""
+	}
+	if teamName == "" && fallbackTeamID != "" {
+		team, appErr := p.API.GetTeam(fallbackTeamID)
+		if appErr != nil {
+			p.API.LogWarn("Failed to get team for permalink", "team_id", fallbackTeamID, "err", appErr.Error())
+			return ""
+		}
+		teamName = team.Name
+	}
+	if teamName == "" {
+		return ""
+	}
+	return strings.TrimSuffix(*siteURL, "/") + "/" + teamName + "/pl/" + post.Id
+}
+
+func ephemeralResponse(text string) *model.CommandResponse {
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeEphemeral,
+		Text:         text,
+	}
+}
+
+func commandNames() []string {
+	names := make([]string, 0, len(commandHandlers))
+	for name := range commandHandlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func commandHelp(trigger, locale string) string {
+	lines := []string{translate(locale, "Available commands:")}
+	for _, name := range commandNames() {
+		lines = append(lines, fmt.Sprintf("* `/%s %s` - %s", trigger, name, translate(locale, commandHandlers[name].Description)))
+	}
+	return strings.Join(lines, "\n")
+}
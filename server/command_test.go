@@ -0,0 +1,283 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// executeCommand runs command as userID in channelID and returns the response text.
+func executeCommand(t *testing.T, p *Plugin, userID, channelID, command string) string {
+	t.Helper()
+
+	response, appErr := p.ExecuteCommand(nil, &model.CommandArgs{
+		UserId:    userID,
+		ChannelId: channelID,
+		Command:   command,
+	})
+	require.Nil(t, appErr)
+	require.NotNil(t, response)
+	return response.Text
+}
+
+// mockUserLocale makes api report userID as a user with the given locale.
+func mockUserLocale(api *plugintest.API, userID, locale string) {
+	api.On("GetUser", userID).Return(&model.User{Id: userID, Locale: locale}, nil)
+}
+
+func TestExecuteCommandHelp(t *testing.T) {
+	p, api, _ := newTestPlugin(t, nil)
+	mockUserLocale(api, "user", "")
+
+	assert.Contains(t, executeCommand(t, p, "user", "channel", "/ovice"), "/ovice me")
+	assert.Contains(t, executeCommand(t, p, "user", "channel", "/ovice nope"), "Unknown command `nope`")
+}
+
+func TestMeCommand(t *testing.T) {
+	t.Run("linked user", func(t *testing.T) {
+		p, api, kv := newTestPlugin(t, &configuration{SpaceURL: "https://hq.ovice.in"})
+		mockUserLocale(api, "alice", "")
+		kv.data[linkKeyPrefix+"alice"] = []byte("alice@ovice.example")
+
+		text := executeCommand(t, p, "alice", "channel", "/ovice me")
+		assert.Contains(t, text, "linked to the oVice email **alice@ovice.example**")
+		assert.Contains(t, text, "https://hq.ovice.in")
+	})
+
+	t.Run("unlinked user falls back to the Mattermost email", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{SpaceURL: "https://hq.ovice.in"})
+		api.On("GetUser", "alice").Return(&model.User{Id: "alice", Email: "alice@example.com"}, nil)
+
+		text := executeCommand(t, p, "alice", "channel", "/ovice me")
+		assert.Contains(t, text, "Mattermost email **alice@example.com** is used")
+	})
+
+	t.Run("no space configured", func(t *testing.T) {
+		p, api, kv := newTestPlugin(t, nil)
+		mockUserLocale(api, "alice", "")
+		kv.data[linkKeyPrefix+"alice"] = []byte("alice@ovice.example")
+
+		assert.Contains(t, executeCommand(t, p, "alice", "channel", "/ovice me"), "No oVice space is configured.")
+	})
+}
+
+func TestJoinCommand(t *testing.T) {
+	p, api, _ := newTestPlugin(t, &configuration{SpaceURL: "https://hq.ovice.in", Spaces: `[{"name":"Lab","url":"https://lab.ovice.in"}]`})
+	mockUserLocale(api, "alice", "")
+
+	assert.Equal(t, "Join the oVice space: https://hq.ovice.in", executeCommand(t, p, "alice", "channel", "/ovice join"))
+	assert.Equal(t, "Join **Lab**: https://lab.ovice.in", executeCommand(t, p, "alice", "channel", "/ovice join Lab"))
+}
+
+func TestCommandLocale(t *testing.T) {
+	config := &configuration{SpaceURL: "https://hq.ovice.in"}
+
+	t.Run("explicit supported lang", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+
+		assert.Equal(t, "oVice スペースに参加: https://hq.ovice.in", executeCommand(t, p, "alice", "channel", "/ovice join --lang=ja"))
+		assert.Equal(t, "oVice スペースに参加: https://hq.ovice.in", executeCommand(t, p, "alice", "channel", "/ovice --lang=ja-JP join"))
+		api.AssertNotCalled(t, "GetUser", "alice")
+	})
+
+	t.Run("unsupported lang falls back with a note", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		mockUserLocale(api, "alice", "en")
+
+		text := executeCommand(t, p, "alice", "channel", "/ovice join --lang=xx")
+		assert.Equal(t, "Language `xx` is not supported, so this reply uses `en`. Supported languages: en, ja.\n\nJoin the oVice space: https://hq.ovice.in", text)
+	})
+
+	t.Run("default resolves the user's locale", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		mockUserLocale(api, "alice", "ja")
+		mockUserLocale(api, "bob", "fr")
+
+		assert.Equal(t, "oVice スペースに参加: https://hq.ovice.in", executeCommand(t, p, "alice", "channel", "/ovice join"))
+		assert.Equal(t, "Join the oVice space: https://hq.ovice.in", executeCommand(t, p, "bob", "channel", "/ovice join"))
+	})
+
+	t.Run("translations keep their format verbs", func(t *testing.T) {
+		for locale, messages := range translations {
+			for message, translated := range messages {
+				assert.Equal(t, strings.Count(message, "%"), strings.Count(translated, "%"), "%s: %s", locale, message)
+			}
+		}
+	})
+}
+
+func TestCommandTrigger(t *testing.T) {
+	triggerMatcher := func(trigger string) interface{} {
+		return mock.MatchedBy(func(command *model.Command) bool { return command.Trigger == trigger })
+	}
+
+	t.Run("custom trigger is registered on activation", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{CommandTrigger: "オフィス"})
+		p.botUserID = ""
+		api.On("GetUserByUsername", botUsername).Return(&model.User{Id: testBotUserID, IsBot: true}, nil)
+		api.On("GetBot", testBotUserID, true).Return(&model.Bot{UserId: testBotUserID, DisplayName: botDisplayName, Description: botDescription}, nil)
+		api.On("RegisterCommand", triggerMatcher("オフィス")).Return(nil).Once()
+		api.On("LoadPluginConfiguration", mock.Anything).Run(func(args mock.Arguments) {
+			args.Get(0).(*configuration).ConfigVersion = currentConfigVersion
+		}).Return(nil)
+
+		require.NoError(t, p.OnActivate())
+		require.NoError(t, p.OnDeactivate())
+	})
+
+	t.Run("changed trigger is re-registered", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		api.On("RegisterCommand", triggerMatcher("ovice")).Return(nil).Once()
+		require.NoError(t, p.registerCommands())
+
+		api.On("LoadPluginConfiguration", mock.Anything).Run(func(args mock.Arguments) {
+			args.Get(0).(*configuration).CommandTrigger = "office"
+		}).Return(nil)
+		api.On("UnregisterCommand", "", "ovice").Return(nil).Once()
+		api.On("RegisterCommand", triggerMatcher("office")).Return(nil).Once()
+
+		require.NoError(t, p.OnConfigurationChange())
+		assert.Contains(t, executeCommandWithLocale(t, p, api, "/office"), "`/office join`")
+
+		// An unchanged trigger is left alone.
+		require.NoError(t, p.OnConfigurationChange())
+	})
+
+	t.Run("invalid triggers are rejected", func(t *testing.T) {
+		for _, trigger := range []string{"join", "/ovice", "o vice"} {
+			assert.Error(t, (&configuration{CommandTrigger: trigger}).process(), trigger)
+		}
+	})
+}
+
+// executeCommandWithLocale runs command as a user with the default locale.
+func executeCommandWithLocale(t *testing.T, p *Plugin, api *plugintest.API, command string) string {
+	t.Helper()
+	mockUserLocale(api, "alice", "")
+	return executeCommand(t, p, "alice", "channel", command)
+}
+
+func TestPostedResponse(t *testing.T) {
+	setup := func(t *testing.T) (*Plugin, *plugintest.API) {
+		p, api, _ := newTestPlugin(t, nil)
+		unmock(api, "GetChannel")
+		api.On("GetChannel", "town").Return(&model.Channel{Id: "town", TeamId: "team1", DisplayName: "Town Square"}, nil).Maybe()
+		api.On("GetChannel", "ops").Return(&model.Channel{Id: "ops", TeamId: "team2", DisplayName: "Operations"}, nil).Maybe()
+		api.On("GetChannel", "dm").Return(&model.Channel{Id: "dm", DisplayName: "alice, bob"}, nil).Maybe()
+		api.On("GetTeam", "team1").Return(&model.Team{Id: "team1", Name: "eng"}, nil).Maybe()
+		api.On("GetTeam", "team2").Return(&model.Team{Id: "team2", Name: "ops-team"}, nil).Maybe()
+		mockSiteURL(api, "https://chat.example.com/")
+		return p, api
+	}
+
+	t.Run("posting command replies with the permalink", func(t *testing.T) {
+		p, api := setup(t)
+		mockUserLocale(api, "alice", "")
+		mockCreatePost(api)
+
+		assert.Equal(t, "Posted: https://chat.example.com/eng/pl/post0", executeCommand(t, p, "alice", "town", "/ovice poll Lunch?"))
+	})
+
+	t.Run("post in another channel links through that channel's team", func(t *testing.T) {
+		p, _ := setup(t)
+
+		response := p.postedResponse(&model.CommandArgs{ChannelId: "town", TeamId: "team1"}, &model.Post{Id: "p1", ChannelId: "ops"}, "")
+		assert.Equal(t, model.CommandResponseTypeEphemeral, response.ResponseType)
+		assert.Equal(t, "Posted to **Operations**: https://chat.example.com/ops-team/pl/p1", response.Text)
+	})
+
+	t.Run("post in a direct message links through the command's team", func(t *testing.T) {
+		p, _ := setup(t)
+
+		response := p.postedResponse(&model.CommandArgs{ChannelId: "town", TeamId: "team1"}, &model.Post{Id: "p1", ChannelId: "dm"}, "")
+		assert.Equal(t, "Posted to **alice, bob**: https://chat.example.com/eng/pl/p1", response.Text)
+	})
+
+	t.Run("no permalink without a SiteURL", func(t *testing.T) {
+		p, api := setup(t)
+		unmock(api, "GetConfig")
+		mockSiteURL(api, "")
+
+		response := p.postedResponse(&model.CommandArgs{ChannelId: "town"}, &model.Post{Id: "p1", ChannelId: "ops"}, "ja")
+		assert.Equal(t, "**Operations** に投稿しました。", response.Text)
+	})
+}
+
+func TestCommandAllowlist(t *testing.T) {
+	setup := func(t *testing.T) (*Plugin, *plugintest.API) {
+		p, api, _ := newTestPlugin(t, &configuration{CommandAllowlist: "lead, channel_admin"})
+		api.On("GetChannelMember", "town", "carol").Return(&model.ChannelMember{Roles: "channel_user channel_admin"}, nil).Maybe()
+		api.On("GetChannelMember", "town", "bob").Return(&model.ChannelMember{Roles: "channel_user"}, nil).Maybe()
+		return p, api
+	}
+
+	t.Run("listed user may post", func(t *testing.T) {
+		p, api := setup(t)
+		mockUserLocale(api, "lead", "")
+		mockSiteURL(api, "")
+		posts := mockCreatePost(api)
+
+		assert.Equal(t, "Posted.", executeCommand(t, p, "lead", "town", "/ovice poll Lunch?"))
+		assert.Len(t, *posts, 1)
+	})
+
+	t.Run("holder of a listed role may post", func(t *testing.T) {
+		p, api := setup(t)
+		mockUserLocale(api, "carol", "")
+		mockSiteURL(api, "")
+		posts := mockCreatePost(api)
+
+		assert.Equal(t, "Posted.", executeCommand(t, p, "carol", "town", "/ovice poll Lunch?"))
+		assert.Len(t, *posts, 1)
+	})
+
+	t.Run("other users are denied", func(t *testing.T) {
+		p, api := setup(t)
+		mockUserLocale(api, "bob", "")
+
+		assert.Equal(t, "You are not allowed to run `/ovice poll`. Please ask a system admin for access.",
+			executeCommand(t, p, "bob", "town", "/ovice poll Lunch?"))
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("feedback and tokens are denied to other users", func(t *testing.T) {
+		p, api := setup(t)
+		mockUserLocale(api, "bob", "")
+
+		assert.Equal(t, "You are not allowed to run `/ovice feedback`. Please ask a system admin for access.",
+			executeCommand(t, p, "bob", "town", "/ovice feedback The HQ link is broken"))
+		assert.Equal(t, "You are not allowed to run `/ovice token`. Please ask a system admin for access.",
+			executeCommand(t, p, "bob", "town", "/ovice token"))
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+		api.AssertNotCalled(t, "KVSetWithOptions", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("listed user may issue a token", func(t *testing.T) {
+		p, api := setup(t)
+		mockUserLocale(api, "lead", "")
+
+		assert.NotContains(t, executeCommand(t, p, "lead", "town", "/ovice token"), "not allowed")
+	})
+
+	t.Run("read-only commands stay open", func(t *testing.T) {
+		p, api := setup(t)
+		mockUserLocale(api, "bob", "")
+
+		assert.NotContains(t, executeCommand(t, p, "bob", "town", "/ovice me"), "not allowed")
+		api.AssertNotCalled(t, "GetChannelMember", mock.Anything, mock.Anything)
+	})
+
+	t.Run("everyone may post without an allowlist", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockUserLocale(api, "bob", "")
+		mockSiteURL(api, "")
+		mockCreatePost(api)
+
+		assert.Equal(t, "Posted.", executeCommand(t, p, "bob", "town", "/ovice poll Lunch?"))
+	})
+}
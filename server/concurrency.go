@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// concurrencyRetryAfterSeconds is the Retry-After sent when too many requests are in flight.
+const concurrencyRetryAfterSeconds = 1
+
+// acquireRequestSlot reserves one of the MaxConcurrentRequests slots, reporting false when all
+// of them are taken. A zero limit never runs out.
+func (p *Plugin) acquireRequestSlot() bool {
+	limit := p.getConfiguration().MaxConcurrentRequests
+
+	p.inFlightLock.Lock()
+	defer p.inFlightLock.Unlock()
+
+	if limit > 0 && p.inFlight >= limit {
+		return false
+	}
+	p.inFlight++
+	return true
+}
+
+// releaseRequestSlot frees a slot reserved by acquireRequestSlot.
+func (p *Plugin) releaseRequestSlot() {
+	p.inFlightLock.Lock()
+	defer p.inFlightLock.Unlock()
+
+	p.inFlight--
+}
+
+// limitConcurrency runs handler in a request slot, answering 503 when none is free. The slot is
+// released however handler returns, including by panicking.
+func (p *Plugin) limitConcurrency(w http.ResponseWriter, r *http.Request, handler http.HandlerFunc) {
+	if !p.acquireRequestSlot() {
+		w.Header().Set("Retry-After", strconv.Itoa(concurrencyRetryAfterSeconds))
+		p.writeError(w, newHTTPError(http.StatusServiceUnavailable, "too many requests in flight, retry later"))
+		return
+	}
+	defer p.releaseRequestSlot()
+
+	handler(w, r)
+}
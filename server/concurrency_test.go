@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitConcurrency(t *testing.T) {
+	t.Run("requests up to the limit run concurrently", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{MaxConcurrentRequests: 2})
+
+		// Both requests block in CreatePost until the third is known to be rejected.
+		started := make(chan struct{}, 2)
+		unblock := make(chan struct{})
+		api.On("CreatePost", mock.AnythingOfType("*model.Post")).Run(func(mock.Arguments) {
+			started <- struct{}{}
+			<-unblock
+		}).Return(&model.Post{Id: "post"}, nil)
+
+		var wg sync.WaitGroup
+		codes := make([]int, 2)
+		for i := range codes {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				codes[i] = doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi `+string(rune('a'+i))+`"}`).Code
+			}(i)
+		}
+		<-started
+		<-started
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi c"}`)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+		close(unblock)
+		wg.Wait()
+		assert.Equal(t, []int{http.StatusOK, http.StatusOK}, codes)
+
+		w = doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi d"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("slot is released on panic", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, &configuration{MaxConcurrentRequests: 1})
+
+		require.Panics(t, func() {
+			p.limitConcurrency(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/webhook", nil), func(http.ResponseWriter, *http.Request) {
+				panic("boom")
+			})
+		})
+		assert.Equal(t, 0, p.inFlight)
+		assert.True(t, p.acquireRequestSlot())
+	})
+
+	t.Run("unlimited by default", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, nil)
+
+		for i := 0; i < 100; i++ {
+			require.True(t, p.acquireRequestSlot())
+		}
+	})
+}
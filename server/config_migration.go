@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// currentConfigVersion is the ConfigVersion of configurations in the current shape.
+const currentConfigVersion = 2
+
+// configMigration upgrades a configuration of version From to From+1, describing each change
+// it made. A failing step must leave the configuration untouched.
+type configMigration struct {
+	From    int
+	Migrate func(c *configuration) ([]string, error)
+}
+
+// configMigrations are applied in order to configurations older than currentConfigVersion.
+var configMigrations = []configMigration{
+	{From: 1, Migrate: migrateSingleSpace},
+}
+
+// migrate upgrades c to currentConfigVersion, returning a description of every change. A
+// configuration without ConfigVersion is version 1. When a step fails, the steps before it are
+// kept and ConfigVersion names the last version reached, so the failed step runs again on the
+// next load. Migrating a current configuration changes nothing.
+func (c *configuration) migrate() ([]string, error) {
+	version := c.ConfigVersion
+	if version == 0 {
+		version = 1
+	}
+
+	var changes []string
+	for _, migration := range configMigrations {
+		if version != migration.From {
+			continue
+		}
+		stepChanges, err := migration.Migrate(c)
+		if err != nil {
+			return changes, errors.Wrapf(err, "failed to migrate from v%d", migration.From)
+		}
+		for _, change := range stepChanges {
+			changes = append(changes, fmt.Sprintf("v%d to v%d: %s", migration.From, migration.From+1, change))
+		}
+		version = migration.From + 1
+		c.ConfigVersion = version
+	}
+	return changes, nil
+}
+
+// migrateSingleSpace moves the single space of a version 1 configuration, which only had
+// SpaceURL and DefaultChannelID, into Spaces. Both settings are kept as the fallback for events
+// that name no space. A configuration that already lists Spaces needs no change.
+func migrateSingleSpace(c *configuration) ([]string, error) {
+	if strings.TrimSpace(c.Spaces) != "" || c.SpaceURL == "" {
+		return nil, nil
+	}
+
+	name, err := spaceNameFromURL(c.SpaceURL)
+	if err != nil {
+		return nil, err
+	}
+	space := map[string]string{"name": name, "url": c.SpaceURL}
+	if c.DefaultChannelID != "" {
+		space["channel_id"] = c.DefaultChannelID
+	}
+	data, err := json.Marshal([]map[string]string{space})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode Spaces")
+	}
+
+	c.Spaces = string(data)
+	return []string{fmt.Sprintf("moved SpaceURL and DefaultChannelID into Spaces as space %q", name)}, nil
+}
+
+// spaceNameFromURL names the space a URL opens: the last path segment, or the first label of
+// the host for a space on its own subdomain, so https://app.ovice.in/hq and https://hq.ovice.in
+// are both "hq".
+func spaceNameFromURL(rawURL string) (string, error) {
+	if !isHTTPURL(rawURL) {
+		return "", errors.Errorf("invalid SpaceURL %q", rawURL)
+	}
+	u, _ := url.Parse(rawURL)
+	if segments := strings.Split(strings.Trim(u.Path, "/"), "/"); segments[len(segments)-1] != "" {
+		return segments[len(segments)-1], nil
+	}
+	return strings.Split(u.Hostname(), ".")[0], nil
+}
+
+// settings returns the public fields of c in the form SavePluginConfig stores them.
+func (c *configuration) settings() (map[string]interface{}, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode configuration")
+	}
+	var settings map[string]interface{}
+	if err = json.Unmarshal(data, &settings); err != nil {
+		return nil, errors.Wrap(err, "failed to decode configuration")
+	}
+	return settings, nil
+}
+
+// storeMigratedConfiguration saves the stored configuration in the current shape once it has
+// been migrated, so the migration does not run again on every load. OnConfigurationChange only
+// migrates in memory, since saving from within it would trigger it again.
+func (p *Plugin) storeMigratedConfiguration() error {
+	stored := new(configuration)
+	if err := p.API.LoadPluginConfiguration(stored); err != nil {
+		return errors.Wrap(err, "failed to load plugin configuration")
+	}
+	if stored.ConfigVersion >= currentConfigVersion {
+		return nil
+	}
+	if _, err := stored.migrate(); err != nil {
+		return err
+	}
+
+	settings, err := stored.settings()
+	if err != nil {
+		return err
+	}
+	if appErr := p.API.SavePluginConfig(settings); appErr != nil {
+		return errors.Wrap(appErr, "failed to save migrated plugin configuration")
+	}
+	p.API.LogInfo("Stored migrated plugin configuration", "config_version", stored.ConfigVersion)
+	return nil
+}
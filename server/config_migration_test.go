@@ -0,0 +1,123 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigurationMigrate(t *testing.T) {
+	t.Run("single space moves into Spaces", func(t *testing.T) {
+		c := &configuration{SpaceURL: "https://hq.ovice.in", DefaultChannelID: "town"}
+
+		changes, err := c.migrate()
+		require.NoError(t, err)
+		require.Len(t, changes, 1)
+		assert.Contains(t, changes[0], "v1 to v2")
+		assert.Equal(t, currentConfigVersion, c.ConfigVersion)
+		assert.JSONEq(t, `[{"name":"hq","url":"https://hq.ovice.in","channel_id":"town"}]`, c.Spaces)
+		assert.Equal(t, "https://hq.ovice.in", c.SpaceURL)
+		assert.Equal(t, "town", c.DefaultChannelID)
+
+		require.NoError(t, c.process())
+		require.Len(t, c.spaces, 1)
+		assert.Equal(t, "town", c.space("HQ").ChannelID)
+
+		spaces := c.Spaces
+		changes, err = c.migrate()
+		require.NoError(t, err)
+		assert.Empty(t, changes)
+		assert.Equal(t, spaces, c.Spaces)
+	})
+
+	t.Run("space name is taken from the URL path", func(t *testing.T) {
+		c := &configuration{SpaceURL: "https://app.ovice.in/annex/"}
+
+		_, err := c.migrate()
+		require.NoError(t, err)
+		assert.JSONEq(t, `[{"name":"annex","url":"https://app.ovice.in/annex/"}]`, c.Spaces)
+	})
+
+	t.Run("configuration that already lists spaces only gets its version", func(t *testing.T) {
+		c := &configuration{SpaceURL: "https://hq.ovice.in", Spaces: `[{"name":"HQ"}]`}
+
+		changes, err := c.migrate()
+		require.NoError(t, err)
+		assert.Empty(t, changes)
+		assert.Equal(t, `[{"name":"HQ"}]`, c.Spaces)
+		assert.Equal(t, currentConfigVersion, c.ConfigVersion)
+	})
+
+	t.Run("failed step keeps the version", func(t *testing.T) {
+		c := &configuration{SpaceURL: "not a url"}
+
+		_, err := c.migrate()
+		assert.Error(t, err)
+		assert.Zero(t, c.ConfigVersion)
+		assert.Empty(t, c.Spaces)
+	})
+
+	t.Run("current configuration is unchanged", func(t *testing.T) {
+		c := &configuration{
+			ConfigVersion: currentConfigVersion,
+			SpaceURL:      "https://hq.ovice.in",
+		}
+		before := *c
+
+		changes, err := c.migrate()
+		require.NoError(t, err)
+		assert.Empty(t, changes)
+		assert.Equal(t, before, *c)
+	})
+
+	t.Run("configuration change migrates the loaded configuration", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		api.On("LoadPluginConfiguration", mock.Anything).Run(func(args mock.Arguments) {
+			args.Get(0).(*configuration).SpaceURL = "https://hq.ovice.in"
+		}).Return(nil)
+
+		require.NoError(t, p.OnConfigurationChange())
+		config := p.getConfiguration()
+		assert.Equal(t, currentConfigVersion, config.ConfigVersion)
+		require.Len(t, config.spaces, 1)
+		assert.Equal(t, "hq", config.spaces[0].Name)
+		api.AssertCalled(t, "LogInfo", "Migrated plugin configuration", "change", mock.Anything)
+	})
+
+	t.Run("migrated configuration is stored", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		api.On("LoadPluginConfiguration", mock.Anything).Run(func(args mock.Arguments) {
+			args.Get(0).(*configuration).SpaceURL = "https://hq.ovice.in"
+		}).Return(nil)
+		var saved map[string]interface{}
+		api.On("SavePluginConfig", mock.Anything).Run(func(args mock.Arguments) {
+			saved = args.Get(0).(map[string]interface{})
+		}).Return(nil).Once()
+
+		require.NoError(t, p.storeMigratedConfiguration())
+		assert.EqualValues(t, currentConfigVersion, saved["ConfigVersion"])
+		assert.Equal(t, `[{"name":"hq","url":"https://hq.ovice.in"}]`, saved["Spaces"])
+		assert.Equal(t, "https://hq.ovice.in", saved["SpaceURL"])
+	})
+
+	t.Run("current stored configuration is not saved again", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		api.On("LoadPluginConfiguration", mock.Anything).Run(func(args mock.Arguments) {
+			args.Get(0).(*configuration).ConfigVersion = currentConfigVersion
+		}).Return(nil)
+
+		require.NoError(t, p.storeMigratedConfiguration())
+		api.AssertNotCalled(t, "SavePluginConfig", mock.Anything)
+	})
+
+	t.Run("failing save is reported", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		api.On("LoadPluginConfiguration", mock.Anything).Return(nil)
+		api.On("SavePluginConfig", mock.Anything).Return(&model.AppError{Message: "read-only config"})
+
+		assert.Error(t, p.storeMigratedConfiguration())
+	})
+}
@@ -1,9 +1,19 @@
 package main
 
 import (
+	"net"
+	"net/http"
+	"net/url"
 	"reflect"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
 
+	"github.com/mattermost/mattermost-server/v6/model"
 	"github.com/pkg/errors"
+
+	root "github.com/mattermost/mattermost-plugin-starter-template"
 )
 
 // configuration captures the plugin's external configuration as exposed in the Mattermost server
@@ -18,6 +28,372 @@ import (
 // If you add non-reference types to your configuration struct, be sure to rewrite Clone as a deep
 // copy appropriate for your types.
 type configuration struct {
+	// DefaultChannelID is the channel oVice events are announced in and webhook messages that
+	// name no channel are posted to.
+	DefaultChannelID string
+
+	// TownSquareFallback posts webhook messages that name no channel to the Town Square of the
+	// only team on the server when DefaultChannelID is not set.
+	TownSquareFallback bool
+
+	// ErrorChannelID is the channel failures to handle webhooks and events are reported in.
+	// Empty only logs them.
+	ErrorChannelID string
+
+	// CommandAllowlist is a comma-separated list of the user IDs and the system, team or channel
+	// roles, e.g. system_admin or channel_admin, allowed to run the /ovice subcommands that post
+	// or change settings. Empty allows everyone.
+	CommandAllowlist string
+
+	// FeedbackChannelID is the channel /ovice feedback is posted in for teams without an entry
+	// in TeamFeedbackChannels. Empty rejects feedback from those teams.
+	FeedbackChannelID string
+
+	// TeamFeedbackChannels is a JSON object mapping a team ID to the channel /ovice feedback
+	// sent from that team is posted in, e.g. {"<team id>": "<channel id>"}.
+	TeamFeedbackChannels string
+
+	// MaintenanceMode acknowledges webhooks and events after validating them, without posting
+	// anything, so oVice does not retry during a maintenance window.
+	MaintenanceMode bool
+
+	// PayloadFieldMapping is a JSON object mapping a dotted path in a /webhook payload to the
+	// field it fills, e.g. {"data.text": "message", "data.room.id": "room_id"}, for payload
+	// shapes that differ from RequestBody.
+	PayloadFieldMapping string
+
+	// StrictJSONFields rejects webhook payloads with fields the plugin does not know, to catch
+	// typos. Off, such fields are ignored.
+	StrictJSONFields bool
+
+	// MarkIntegrationPosts sets from_webhook on every post of the plugin, so Mattermost shows and
+	// filters it as an integration post rather than one of a person.
+	MarkIntegrationPosts bool
+
+	// MarkPostsFromBot also sets from_bot on every post of the plugin.
+	MarkPostsFromBot bool
+
+	// PlainTextFallback retries a webhook post the server rejects for its attachments or props
+	// once as plain text, with the text of its attachments and a note, instead of failing.
+	PlainTextFallback bool
+
+	// SuppressSelfOriginated marks webhook posts and delivery receipts with the origin of this
+	// plugin, and ignores webhooks and events carrying that marker so a post fed back into oVice
+	// cannot loop.
+	SuppressSelfOriginated bool
+
+	// KeepMessageWhitespace posts webhook messages exactly as sent. By default the blank lines
+	// around a message and its trailing whitespace are removed.
+	KeepMessageWhitespace bool
+
+	// EnableDebugEcho serves /debug/echo, which shows how a webhook payload is decoded and
+	// resolved without posting it.
+	EnableDebugEcho bool
+
+	// EnableMetrics serves the request counters at /metrics in the Prometheus text format and at
+	// /metrics.json as JSON.
+	EnableMetrics bool
+
+	// SkipEmptyChannels drops webhook messages, answering 204, when the target channel has no
+	// members besides the posting bot.
+	SkipEmptyChannels bool
+
+	// ConfigVersion is the shape of the stored configuration, upgraded to currentConfigVersion by
+	// migrate when the configuration is loaded and stored on activation. Unset means version 1.
+	ConfigVersion int
+
+	// SpaceURL is the URL users open to join the oVice space.
+	SpaceURL string
+
+	// JoinLinkSecret signs the per-user links handed out by /ovice join, which expire after ten
+	// minutes. Empty hands out the space URL itself.
+	JoinLinkSecret string
+
+	// Spaces is a JSON array describing individual oVice spaces, each with a name and optional
+	// url, channel_id, rooms, bot_username and bot_display_name. Spaces not listed fall back to
+	// SpaceURL, DefaultChannelID and the shared bot.
+	Spaces string
+
+	// OviceAPIURL is the base URL of the oVice API used to act on spaces, such as letting a
+	// knocking user in.
+	OviceAPIURL string
+
+	// OviceAPIKey authenticates requests to the oVice API.
+	OviceAPIKey string
+
+	// OviceAPIDeadlineMs is how long after the first attempt a GET request to the oVice API or a
+	// delivery receipt may keep retrying network errors, 429 and 5xx responses; no attempt runs
+	// past it. A Retry-After from the server is honored. Zero does not retry.
+	OviceAPIDeadlineMs int
+
+	// OviceAPIRetryBackoffMs is the first pause between such retries, doubled after each one.
+	// Zero uses the default of 500 milliseconds.
+	OviceAPIRetryBackoffMs int
+
+	// ReceiptURL, if set, receives a delivery receipt for every webhook message posted.
+	ReceiptURL string
+
+	// PresenceJoinLink appends a link to SpaceURL to every enter notification.
+	PresenceJoinLink bool
+
+	// PresenceThumbnail shows the current thumbnail of the space, fetched from the oVice API, in
+	// enter notifications.
+	PresenceThumbnail bool
+
+	// PresenceRequireOccupant only announces an enter while the user is still among the tracked
+	// occupants of the space, so a delayed or coalesced enter of a user who already left is
+	// dropped.
+	PresenceRequireOccupant bool
+
+	// PresenceEnterEmoji and PresenceLeaveEmoji prefix enter and leave notifications. Empty uses
+	// defaultPresenceEnterEmoji and defaultPresenceLeaveEmoji.
+	PresenceEnterEmoji string
+	PresenceLeaveEmoji string
+
+	// PresenceTeam restricts presence notifications to members of the team with this name. Empty
+	// announces everyone.
+	PresenceTeam string
+
+	// PresenceAnnounceUnresolved announces users without a Mattermost account when PresenceTeam
+	// is set. By default they are ignored.
+	PresenceAnnounceUnresolved bool
+
+	// PresenceDeactivatedUsers is "plain" to announce users whose Mattermost account is
+	// deactivated by name instead of mentioning them, or "suppress" to not announce them at all.
+	// Empty means "plain".
+	PresenceDeactivatedUsers string
+
+	// OccupancyPost keeps a single post in the channel of each space showing how many people are
+	// in it, edited whenever someone enters or leaves.
+	OccupancyPost bool
+
+	// OccupancyPostRepostOnReplies makes a new occupancy post instead of editing one that has
+	// replies, since the edit would go unnoticed in a thread nobody follows.
+	OccupancyPostRepostOnReplies bool
+
+	// LeaveGraceSeconds holds back leave notifications for this many seconds, dropping both the
+	// leave and the enter if the user re-enters the space in the meantime. Zero announces
+	// leaves right away.
+	LeaveGraceSeconds int
+
+	// PresenceCoalesceSeconds combines the presence events of a space within this many seconds
+	// into a single post. Zero announces every event on its own.
+	PresenceCoalesceSeconds int
+
+	// SummaryTimezone is the IANA time zone, e.g. "Asia/Tokyo", whose days the daily summaries
+	// cover and in which InactivityWorkingHours are read. Empty uses UTC.
+	SummaryTimezone string
+
+	// TimestampFooterTimezone is the IANA time zone, e.g. "Asia/Tokyo", of a footer such as
+	// "posted 14:00 JST" appended to webhook posts. Empty posts no footer.
+	TimestampFooterTimezone string
+
+	// InactivityReminderMinutes posts a reminder to a space's channel once the space has been
+	// empty for this many minutes, at most once until someone enters again. Zero disables it.
+	InactivityReminderMinutes int
+
+	// InactivityWorkingHours limits inactivity reminders to a daily window such as
+	// "09:00-18:00", and only empty time within it counts. Empty allows them at any time.
+	InactivityWorkingHours string
+
+	// UserLookupRetries is how many more times a presence or chat event's user is looked up by
+	// email when the first lookup fails, for accounts provisioned moments before the event. Zero
+	// does not retry.
+	UserLookupRetries int
+
+	// UserLookupRetryDelayMs is the pause before each retried user lookup. Zero uses the default
+	// of 500 milliseconds.
+	UserLookupRetryDelayMs int
+
+	// PostDeadlineMs is how long after the first attempt a webhook message may keep retrying
+	// posts that the server rejected as rate-limited or failed. A Retry-After from the server is
+	// honored. Zero does not retry.
+	PostDeadlineMs int
+
+	// NotifyScreenshareStop updates a screen share announcement when the share stops. By default
+	// stop events are not announced.
+	NotifyScreenshareStop bool
+
+	// CapacityAlertUsernames is a comma-separated list of users who are DMed when a space is full.
+	CapacityAlertUsernames string
+
+	// MaxMessageLength caps the number of characters in a posted message, including the
+	// timestamp footer. Zero uses the Mattermost server limit.
+	MaxMessageLength int
+
+	// MaintenanceIntervalMinutes is how often expired and orphaned KV records are pruned. Zero
+	// uses the default of 60 minutes.
+	MaintenanceIntervalMinutes int
+
+	// RateLimitPerMinute caps how many webhook and event requests each source IP may make per
+	// minute, in bursts of up to the same number. Zero does not limit them.
+	RateLimitPerMinute int
+
+	// TrustedProxies lists the CIDR networks of reverse proxies, one per line or comma-separated,
+	// whose X-Forwarded-For header names the client IP for RateLimitPerMinute and audit logs.
+	// Requests from anywhere else are attributed to their remote address.
+	TrustedProxies string
+
+	// ChatRateLimitPerMinute caps how many chat messages of each oVice user are relayed per
+	// minute, in bursts of up to the same number; the rest are dropped. Zero does not limit them.
+	ChatRateLimitPerMinute int
+
+	// SpaceRateLimitPerMinute caps how many events of each space are handled per minute, unless
+	// the space sets its own rate_limit_per_minute in Spaces. Zero means no limit.
+	SpaceRateLimitPerMinute int
+
+	// ChatPostAsUser relays a chat message as the Mattermost user its sender's email resolves to,
+	// when that user may post in the channel. Other messages are relayed by the bot. It requires
+	// a SignatureScheme, since an unsigned event could post as anyone.
+	ChatPostAsUser bool
+
+	// ChatRateLimitWarning DMs a user whose chat messages are dropped by ChatRateLimitPerMinute,
+	// at most once a minute.
+	ChatRateLimitWarning bool
+
+	// MaxConcurrentRequests caps how many webhook and event requests are handled at once; the rest
+	// are answered with 503. Zero does not limit them.
+	MaxConcurrentRequests int
+
+	// MaxEphemeralRecipients caps the size of a channel that can be sent an ephemeral message
+	// per member. Zero uses the default of 1000.
+	MaxEphemeralRecipients int
+
+	// DedupWindowSeconds drops a webhook message identical to one posted to the same channel
+	// within this many seconds. Zero disables deduplication.
+	DedupWindowSeconds int
+
+	// MaxAttachmentSizeMB caps the size of each image fetched from attachment_urls. Zero uses the
+	// default of 10 MB.
+	MaxAttachmentSizeMB int
+
+	// AttachmentAllowedNetworks lists CIDR networks, one per line or comma-separated, that
+	// attachment_urls may be fetched from even though they are not public, e.g. an on-premises
+	// file server. Loopback, private and link-local addresses are refused otherwise.
+	AttachmentAllowedNetworks string
+
+	// MaxAttachmentsPerPost caps the attachments of a webhook message. Zero uses the default of
+	// 20.
+	MaxAttachmentsPerPost int
+
+	// MaxFilesPerPost caps the attachment_urls of a webhook message, each of which becomes a
+	// file of the post. Zero uses the default of 10, which is also the most allowed.
+	MaxFilesPerPost int
+
+	// MessageTemplate is a Go text/template applied to webhook messages, e.g.
+	// "**oVice:** {{.Message}}". Empty posts messages verbatim.
+	MessageTemplate string
+
+	// ChannelMessageTemplates is a JSON object mapping a channel ID to the message template used
+	// for that channel instead of MessageTemplate, e.g. {"<channel id>": "{{.Message}} :wave:"}.
+	ChannelMessageTemplates string
+
+	// AllowedProtectedProps is a comma-separated list of reserved post props, such as
+	// override_username, that webhook messages may set through props.
+	AllowedProtectedProps string
+
+	// AllowedOverrideUsernames is a comma-separated list of the names a webhook message may set
+	// as props.override_username when AllowedProtectedProps permits it. Empty allows any name.
+	AllowedOverrideUsernames string
+
+	// ReactionKeywords is a comma-separated list of keyword=emoji pairs the bot reacts with when
+	// one of its posts contains the keyword.
+	ReactionKeywords string
+
+	// SignatureScheme selects how webhook requests are authenticated: "none", "hmac-simple" or
+	// "standard-webhooks". Empty means "none".
+	SignatureScheme string
+
+	// WebhookSecret is the shared secret used to verify webhook signatures.
+	WebhookSecret string
+
+	// TeamWebhookSecrets lists team=secret pairs, one per line or comma-separated. A request
+	// naming a team in the X-Ovice-Team header is verified with that team's secret, or with
+	// WebhookSecret if the team has none. A request verified with a team's secret may only post
+	// to that team's channels, and channels of a team with a secret only accept requests
+	// verified with it.
+	TeamWebhookSecrets string
+
+	// RequireNonce requires a unique nonce on every webhook request, rejecting a nonce seen within
+	// twice SignatureToleranceSeconds as a replay. The nonce is the webhook-id of standard-webhooks
+	// requests, and the X-Ovice-Nonce header otherwise. With hmac-simple, the signature then
+	// covers "timestamp.nonce.body" with the timestamp in X-Ovice-Timestamp. It requires a
+	// SignatureScheme, so that a request is rejected as stale before its nonce can expire.
+	RequireNonce bool
+
+	// SignatureToleranceSeconds is how far a signature timestamp may be from the current time.
+	// Zero uses the default of 5 minutes.
+	SignatureToleranceSeconds int
+
+	// MaxChatRelayLength caps the number of characters of a relayed oVice chat message; longer
+	// messages are truncated with a marker. Zero relays messages in full.
+	MaxChatRelayLength int
+
+	// ChatHTMLMode is "strip" to remove HTML tags from relayed chat messages, "escape" to show
+	// them as typed, or "leave" to relay them untouched. Empty leaves them.
+	ChatHTMLMode string
+
+	// EnableTracing records a trace span for every webhook request and its parse, auth, resolve
+	// and post phases, continuing the caller's traceparent.
+	EnableTracing bool
+
+	// CommandTrigger is the slash command users invoke the plugin with, without the slash. Empty
+	// uses "ovice".
+	CommandTrigger string
+
+	// PathPrefix is the path all HTTP endpoints of the plugin live under, e.g. "/ovice". Empty or
+	// "/" serves them from the plugin root.
+	PathPrefix string
+
+	// ResponseHeaders holds one "Name: value" header per line, set on every HTTP response.
+	ResponseHeaders string
+
+	// pathPrefix is PathPrefix normalized to a leading slash and no trailing slash, or empty for
+	// the plugin root.
+	pathPrefix string
+
+	// footerLocation is loaded from TimestampFooterTimezone, or nil when no footer is posted.
+	footerLocation *time.Location
+
+	// location is loaded from SummaryTimezone.
+	location *time.Location
+
+	// workingHours is parsed from InactivityWorkingHours, or nil for the whole day.
+	workingHours *workingHours
+
+	// fieldMappings is parsed from PayloadFieldMapping.
+	fieldMappings []fieldMapping
+
+	// teamFeedbackChannels is parsed from TeamFeedbackChannels, keyed by team ID.
+	teamFeedbackChannels map[string]string
+
+	// channelTemplates is compiled from ChannelMessageTemplates, keyed by channel ID.
+	channelTemplates map[string]*template.Template
+
+	// keywordReactions is computed from ReactionKeywords.
+	keywordReactions []keywordReaction
+
+	// spaces is parsed from Spaces.
+	spaces []spaceConfig
+
+	// trustedProxies is parsed from TrustedProxies.
+	trustedProxies []*net.IPNet
+
+	// attachmentClient fetches attachment_urls, built from AttachmentAllowedNetworks.
+	attachmentClient *http.Client
+
+	// oviceClient is built from OviceAPIURL and OviceAPIKey, or nil when no API URL is set.
+	oviceClient *oviceClient
+
+	// signingKey is derived from WebhookSecret.
+	signingKey []byte
+
+	// teamSigningKeys is derived from TeamWebhookSecrets, keyed by lower-cased team name.
+	teamSigningKeys map[string][]byte
+
+	// responseHeaders is computed from ResponseHeaders, without the ignored protected headers.
+	responseHeaders        []responseHeader
+	ignoredResponseHeaders []string
 }
 
 // Clone shallow copies the configuration. Your implementation may require a deep copy if
@@ -27,6 +403,355 @@ func (c *configuration) Clone() *configuration {
 	return &clone
 }
 
+// maxMessageRunes returns the effective message length limit.
+func (c *configuration) maxMessageRunes() int {
+	if c.MaxMessageLength > 0 && c.MaxMessageLength < model.PostMessageMaxRunesV2 {
+		return c.MaxMessageLength
+	}
+	return model.PostMessageMaxRunesV2
+}
+
+// maintenanceInterval returns the effective MaintenanceIntervalMinutes.
+func (c *configuration) maintenanceInterval() time.Duration {
+	if c.MaintenanceIntervalMinutes > 0 {
+		return time.Duration(c.MaintenanceIntervalMinutes) * time.Minute
+	}
+	return defaultMaintenanceInterval
+}
+
+// maxEphemeralRecipients returns the effective MaxEphemeralRecipients.
+func (c *configuration) maxEphemeralRecipients() int {
+	if c.MaxEphemeralRecipients > 0 {
+		return c.MaxEphemeralRecipients
+	}
+	return defaultMaxEphemeralRecipients
+}
+
+// commandTrigger returns the effective CommandTrigger.
+func (c *configuration) commandTrigger() string {
+	if c.CommandTrigger == "" {
+		return defaultCommandTrigger
+	}
+	return c.CommandTrigger
+}
+
+// maxAttachmentsPerPost returns the effective MaxAttachmentsPerPost.
+func (c *configuration) maxAttachmentsPerPost() int {
+	if c.MaxAttachmentsPerPost > 0 {
+		return c.MaxAttachmentsPerPost
+	}
+	return defaultMaxAttachmentsPerPost
+}
+
+// maxFilesPerPost returns the effective MaxFilesPerPost.
+func (c *configuration) maxFilesPerPost() int {
+	if c.MaxFilesPerPost > 0 {
+		return c.MaxFilesPerPost
+	}
+	return maxAttachmentURLs
+}
+
+// maxAttachmentBytes returns the effective MaxAttachmentSizeMB in bytes.
+func (c *configuration) maxAttachmentBytes() int64 {
+	if c.MaxAttachmentSizeMB > 0 {
+		return int64(c.MaxAttachmentSizeMB) << 20
+	}
+	return defaultMaxAttachmentSizeMB << 20
+}
+
+// leaveGracePeriod returns the effective LeaveGraceSeconds.
+func (c *configuration) leaveGracePeriod() time.Duration {
+	return time.Duration(c.LeaveGraceSeconds) * time.Second
+}
+
+// presenceCoalesceWindow returns the effective PresenceCoalesceSeconds.
+func (c *configuration) presenceCoalesceWindow() time.Duration {
+	return time.Duration(c.PresenceCoalesceSeconds) * time.Second
+}
+
+// presenceEmoji returns the emoji prefixing notifications of the presence event kind.
+func (c *configuration) presenceEmoji(event string) string {
+	if event == presenceEventLeave {
+		if c.PresenceLeaveEmoji != "" {
+			return strings.TrimSpace(c.PresenceLeaveEmoji)
+		}
+		return defaultPresenceLeaveEmoji
+	}
+	if c.PresenceEnterEmoji != "" {
+		return strings.TrimSpace(c.PresenceEnterEmoji)
+	}
+	return defaultPresenceEnterEmoji
+}
+
+// timestampFooter returns the footer appended to a webhook post made at now, or "" when
+// TimestampFooterTimezone is not set.
+func (c *configuration) timestampFooter(now time.Time) string {
+	if c.footerLocation == nil {
+		return ""
+	}
+	return "\n\n_posted " + now.In(c.footerLocation).Format("15:04 MST") + "_"
+}
+
+// summaryLocation returns the time zone of SummaryTimezone.
+func (c *configuration) summaryLocation() *time.Location {
+	if c.location != nil {
+		return c.location
+	}
+	return time.UTC
+}
+
+// userLookupRetryDelay returns the effective UserLookupRetryDelayMs.
+func (c *configuration) userLookupRetryDelay() time.Duration {
+	if c.UserLookupRetryDelayMs > 0 {
+		return time.Duration(c.UserLookupRetryDelayMs) * time.Millisecond
+	}
+	return defaultUserLookupRetryDelay
+}
+
+// dedupWindow returns the effective DedupWindowSeconds.
+func (c *configuration) dedupWindow() time.Duration {
+	return time.Duration(c.DedupWindowSeconds) * time.Second
+}
+
+// signatureScheme returns the effective SignatureScheme.
+func (c *configuration) signatureScheme() string {
+	if c.SignatureScheme == "" {
+		return signatureSchemeNone
+	}
+	return c.SignatureScheme
+}
+
+// signatureTolerance returns the effective SignatureToleranceSeconds.
+func (c *configuration) signatureTolerance() time.Duration {
+	if c.SignatureToleranceSeconds > 0 {
+		return time.Duration(c.SignatureToleranceSeconds) * time.Second
+	}
+	return defaultSignatureTolerance
+}
+
+// process validates the raw settings and computes the derived, unexported fields.
+func (c *configuration) process() error {
+	if c.SpaceURL != "" && !isHTTPURL(c.SpaceURL) {
+		return errors.Errorf("invalid SpaceURL %q", c.SpaceURL)
+	}
+
+	pathPrefix, err := parsePathPrefix(c.PathPrefix)
+	if err != nil {
+		return err
+	}
+	c.pathPrefix = pathPrefix
+
+	c.location = time.UTC
+	if c.SummaryTimezone != "" {
+		if c.location, err = time.LoadLocation(c.SummaryTimezone); err != nil {
+			return errors.Wrapf(err, "invalid SummaryTimezone %q", c.SummaryTimezone)
+		}
+	}
+	if c.TimestampFooterTimezone != "" {
+		if c.footerLocation, err = time.LoadLocation(c.TimestampFooterTimezone); err != nil {
+			return errors.Wrapf(err, "invalid TimestampFooterTimezone %q", c.TimestampFooterTimezone)
+		}
+	}
+
+	spaces, err := parseSpaces(c.Spaces)
+	if err != nil {
+		return errors.Wrap(err, "invalid Spaces")
+	}
+	c.spaces = spaces
+
+	if c.OviceAPIDeadlineMs < 0 {
+		return errors.New("OviceAPIDeadlineMs must not be negative")
+	}
+	if c.OviceAPIRetryBackoffMs < 0 {
+		return errors.New("OviceAPIRetryBackoffMs must not be negative")
+	}
+	if c.ReceiptURL != "" && !isHTTPURL(c.ReceiptURL) {
+		return errors.Errorf("invalid ReceiptURL %q", c.ReceiptURL)
+	}
+
+	if c.OviceAPIURL != "" {
+		if !isHTTPURL(c.OviceAPIURL) {
+			return errors.Errorf("invalid OviceAPIURL %q", c.OviceAPIURL)
+		}
+		c.oviceClient = newOviceClient(c.OviceAPIURL, c.OviceAPIKey, c.oviceRetryPolicy())
+	}
+
+	if c.MaxMessageLength < 0 {
+		return errors.New("MaxMessageLength must not be negative")
+	}
+	if footer := utf8.RuneCountInString(c.timestampFooter(time.Now())); footer > 0 && c.maxMessageRunes() <= footer {
+		return errors.Errorf("MaxMessageLength must leave room for the %d-character timestamp footer", footer)
+	}
+	if c.MaintenanceIntervalMinutes < 0 {
+		return errors.New("MaintenanceIntervalMinutes must not be negative")
+	}
+	if c.RateLimitPerMinute < 0 {
+		return errors.New("RateLimitPerMinute must not be negative")
+	}
+	if c.ChatRateLimitPerMinute < 0 {
+		return errors.New("ChatRateLimitPerMinute must not be negative")
+	}
+	if c.SpaceRateLimitPerMinute < 0 {
+		return errors.New("SpaceRateLimitPerMinute must not be negative")
+	}
+	if c.MaxConcurrentRequests < 0 {
+		return errors.New("MaxConcurrentRequests must not be negative")
+	}
+	if c.MaxEphemeralRecipients < 0 {
+		return errors.New("MaxEphemeralRecipients must not be negative")
+	}
+	if c.MaxAttachmentSizeMB < 0 {
+		return errors.New("MaxAttachmentSizeMB must not be negative")
+	}
+	if c.trustedProxies, err = parseCIDRs(splitList(c.TrustedProxies)); err != nil {
+		return errors.Wrap(err, "invalid TrustedProxies")
+	}
+	allowedNetworks, err := parseCIDRs(splitList(c.AttachmentAllowedNetworks))
+	if err != nil {
+		return errors.Wrap(err, "invalid AttachmentAllowedNetworks")
+	}
+	c.attachmentClient = newAttachmentHTTPClient(allowedNetworks)
+	if c.MaxAttachmentsPerPost < 0 {
+		return errors.New("MaxAttachmentsPerPost must not be negative")
+	}
+	if c.MaxFilesPerPost < 0 || c.MaxFilesPerPost > maxAttachmentURLs {
+		return errors.Errorf("MaxFilesPerPost must be between 0 and %d", maxAttachmentURLs)
+	}
+	if c.LeaveGraceSeconds < 0 {
+		return errors.New("LeaveGraceSeconds must not be negative")
+	}
+	if c.PresenceCoalesceSeconds < 0 {
+		return errors.New("PresenceCoalesceSeconds must not be negative")
+	}
+	if c.UserLookupRetries < 0 {
+		return errors.New("UserLookupRetries must not be negative")
+	}
+	if c.UserLookupRetries > maxUserLookupRetries {
+		return errors.Errorf("UserLookupRetries must be at most %d", maxUserLookupRetries)
+	}
+	if c.UserLookupRetryDelayMs < 0 {
+		return errors.New("UserLookupRetryDelayMs must not be negative")
+	}
+	if c.PostDeadlineMs < 0 {
+		return errors.New("PostDeadlineMs must not be negative")
+	}
+	if c.DedupWindowSeconds < 0 {
+		return errors.New("DedupWindowSeconds must not be negative")
+	}
+	if c.MaxChatRelayLength < 0 {
+		return errors.New("MaxChatRelayLength must not be negative")
+	}
+	if c.InactivityReminderMinutes < 0 {
+		return errors.New("InactivityReminderMinutes must not be negative")
+	}
+
+	workingHours, err := parseWorkingHours(c.InactivityWorkingHours)
+	if err != nil {
+		return errors.Wrap(err, "invalid InactivityWorkingHours")
+	}
+	c.workingHours = workingHours
+
+	channelTemplates, err := compileChannelTemplates(c.ChannelMessageTemplates)
+	if err != nil {
+		return errors.Wrap(err, "invalid ChannelMessageTemplates")
+	}
+	c.channelTemplates = channelTemplates
+
+	fieldMappings, err := parsePayloadFieldMapping(c.PayloadFieldMapping)
+	if err != nil {
+		return errors.Wrap(err, "invalid PayloadFieldMapping")
+	}
+	c.fieldMappings = fieldMappings
+
+	teamFeedbackChannels, err := parseTeamFeedbackChannels(c.TeamFeedbackChannels)
+	if err != nil {
+		return errors.Wrap(err, "invalid TeamFeedbackChannels")
+	}
+	c.teamFeedbackChannels = teamFeedbackChannels
+
+	keywordReactions, err := parseKeywordReactions(c.ReactionKeywords)
+	if err != nil {
+		return errors.Wrap(err, "invalid ReactionKeywords")
+	}
+	c.keywordReactions = keywordReactions
+
+	if c.PresenceEnterEmoji != "" && strings.TrimSpace(c.PresenceEnterEmoji) == "" {
+		return errors.New("PresenceEnterEmoji must not be blank")
+	}
+	if c.PresenceLeaveEmoji != "" && strings.TrimSpace(c.PresenceLeaveEmoji) == "" {
+		return errors.New("PresenceLeaveEmoji must not be blank")
+	}
+
+	switch c.PresenceDeactivatedUsers {
+	case "", deactivatedUsersPlain, deactivatedUsersSuppress:
+	default:
+		return errors.Errorf("unknown PresenceDeactivatedUsers %q", c.PresenceDeactivatedUsers)
+	}
+
+	switch c.ChatHTMLMode {
+	case "", htmlModeLeave, htmlModeStrip, htmlModeEscape:
+	default:
+		return errors.Errorf("unknown ChatHTMLMode %q", c.ChatHTMLMode)
+	}
+
+	switch c.signatureScheme() {
+	case signatureSchemeNone:
+	case signatureSchemeHMACSimple, signatureSchemeStandardWebhooks:
+		if c.WebhookSecret == "" {
+			return errors.Errorf("WebhookSecret is required for SignatureScheme %q", c.SignatureScheme)
+		}
+	default:
+		return errors.Errorf("unknown SignatureScheme %q", c.SignatureScheme)
+	}
+	if c.ChatPostAsUser && c.signatureScheme() == signatureSchemeNone {
+		return errors.New("ChatPostAsUser requires a SignatureScheme")
+	}
+	// An unsigned request carries no timestamp, so a replay would be accepted once its nonce expired.
+	if c.RequireNonce && c.signatureScheme() == signatureSchemeNone {
+		return errors.New("RequireNonce requires a SignatureScheme")
+	}
+	if c.SignatureToleranceSeconds < 0 {
+		return errors.New("SignatureToleranceSeconds must not be negative")
+	}
+	if c.signingKey, err = parseSigningKey(c.WebhookSecret); err != nil {
+		return errors.Wrap(err, "invalid WebhookSecret")
+	}
+	if c.teamSigningKeys, err = parseTeamSigningKeys(c.TeamWebhookSecrets); err != nil {
+		return errors.Wrap(err, "invalid TeamWebhookSecrets")
+	}
+
+	if err = validateCommandTrigger(c.commandTrigger()); err != nil {
+		return errors.Wrapf(err, "invalid CommandTrigger %q", c.CommandTrigger)
+	}
+
+	c.responseHeaders, c.ignoredResponseHeaders, err = parseResponseHeaders(c.ResponseHeaders)
+	if err != nil {
+		return errors.Wrap(err, "invalid ResponseHeaders")
+	}
+
+	return nil
+}
+
+// parsePathPrefix normalizes a PathPrefix setting, rejecting anything that is not a plain path.
+func parsePathPrefix(prefix string) (string, error) {
+	prefix = strings.Trim(strings.TrimSpace(prefix), "/")
+	if prefix == "" {
+		return "", nil
+	}
+	for _, segment := range strings.Split(prefix, "/") {
+		if segment == "" || segment == "." || segment == ".." || url.PathEscape(segment) != segment {
+			return "", errors.Errorf("invalid PathPrefix %q", prefix)
+		}
+	}
+	return "/" + prefix, nil
+}
+
+// endpointPath returns the path of the plugin endpoint at path, under PathPrefix, as it is
+// reached through /plugins/<id>.
+func (c *configuration) endpointPath(path string) string {
+	return "/plugins/" + root.Manifest.Id + c.pathPrefix + path
+}
+
 // getConfiguration retrieves the active configuration under lock, making it safe to use
 // concurrently. The active configuration may change underneath the client of this method, but
 // the struct returned by this API call is considered immutable.
@@ -77,7 +802,65 @@ func (p *Plugin) OnConfigurationChange() error {
 		return errors.Wrap(err, "failed to load plugin configuration")
 	}
 
+	// Older shapes are upgraded in memory here and stored by OnActivate. A failed step is logged
+	// and the configuration is used as far as it was migrated.
+	changes, err := configuration.migrate()
+	for _, change := range changes {
+		p.API.LogInfo("Migrated plugin configuration", "change", change)
+	}
+	if err != nil {
+		p.API.LogWarn("Failed to migrate plugin configuration", "err", err.Error())
+	}
+
+	if err := configuration.process(); err != nil {
+		return errors.Wrap(err, "failed to process plugin configuration")
+	}
+
+	if err := p.validateRoomChannels(configuration); err != nil {
+		return errors.Wrap(err, "invalid Spaces")
+	}
+
+	for _, name := range configuration.ignoredResponseHeaders {
+		p.API.LogWarn("Ignoring protected header in ResponseHeaders", "header", name)
+	}
+
+	messageTemplate, err := compileMessageTemplate(configuration.MessageTemplate)
+	if err != nil {
+		return errors.Wrap(err, "invalid MessageTemplate")
+	}
+
 	p.setConfiguration(configuration)
+	p.setMessageTemplate(messageTemplate)
+
+	// Bots of newly configured spaces and a changed command trigger are applied right away once
+	// the plugin is active; otherwise OnActivate takes care of them.
+	if p.botUserID != "" {
+		if err = p.ensureSpaceBots(); err != nil {
+			return err
+		}
+	}
+	if p.registeredTrigger != "" {
+		if err = p.registerCommands(); err != nil {
+			return errors.Wrap(err, "failed to register commands")
+		}
+	}
 
 	return nil
 }
+
+// isHTTPURL reports whether raw is an absolute http or https URL.
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// splitList splits a comma or newline separated setting into its trimmed, non-empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// debugEchoResponse shows how a webhook payload was understood, without posting it.
+type debugEchoResponse struct {
+	Body      *RequestBody `json:"body"`
+	ChannelID string       `json:"channel_id,omitempty"`
+	Warnings  []string     `json:"warnings,omitempty"`
+}
+
+// handleDebugEcho decodes a webhook payload and answers with it re-encoded, the channel it
+// resolves to and the validation errors it would be rejected with, so integrators can check
+// their payloads. It is authenticated like /webhook and answers 404 unless EnableDebugEcho is
+// set.
+func (p *Plugin) handleDebugEcho(w http.ResponseWriter, r *http.Request) {
+	if !p.getConfiguration().EnableDebugEcho {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		p.writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+		p.writeError(w, newHTTPError(http.StatusUnsupportedMediaType, "Content-Type must be application/json"))
+		return
+	}
+
+	data, err := readRequestBody(w, r)
+	if err != nil {
+		p.writeError(w, err)
+		return
+	}
+	if _, err = p.verifySignature(r.Header, data, time.Now()); err != nil {
+		p.writeError(w, err)
+		return
+	}
+
+	var body RequestBody
+	if err = p.decodeWebhookBody(data, &body); err != nil {
+		p.writeError(w, err)
+		return
+	}
+
+	response := &debugEchoResponse{Body: &body}
+	if _, _, err = p.validateRequestBody(&body); err != nil {
+		if !addDebugWarning(response, err) {
+			p.writeError(w, err)
+			return
+		}
+	}
+
+	channelID, err := p.resolveChannelID(&body)
+	if err != nil {
+		if !addDebugWarning(response, err) {
+			p.writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, response)
+		return
+	}
+	response.ChannelID = channelID
+
+	if !p.API.HasPermissionToChannel(p.botUserIDForSpace(body.Space), channelID, model.PermissionCreatePost) {
+		response.Warnings = append(response.Warnings, "the oVice bot is not allowed to post in channel "+channelID+"; add it to the channel first")
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// addDebugWarning records err in response if it is a client error, reporting false for internal
+// failures, which are answered as such.
+func addDebugWarning(response *debugEchoResponse, err error) bool {
+	herr, ok := err.(*httpError)
+	if !ok {
+		return false
+	}
+	response.Warnings = append(response.Warnings, herr.Message)
+	return true
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebugEcho(t *testing.T) {
+	decode := func(t *testing.T, data []byte) map[string]interface{} {
+		t.Helper()
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(data, &response))
+		return response
+	}
+
+	t.Run("echoes the decoded payload", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{EnableDebugEcho: true})
+
+		w := doRequest(p, http.MethodPost, "/debug/echo", `{"channelId":"channel","message":"hi","props":{"ticket":"T-1"}}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		response := decode(t, w.Body.Bytes())
+		body := response["body"].(map[string]interface{})
+		assert.Equal(t, "channel", body["channel_id"])
+		assert.Equal(t, "hi", body["message"])
+		assert.Equal(t, map[string]interface{}{"ticket": "T-1"}, body["props"])
+		assert.Nil(t, response["warnings"])
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("includes the resolved channel", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{EnableDebugEcho: true})
+		api.On("GetChannelByNameForTeamName", "eng", "ovice", false).Return(&model.Channel{Id: "oviceid"}, nil)
+
+		w := doRequest(p, http.MethodPost, "/debug/echo", `{"team_name":"eng","channel_name":"ovice","message":"hi"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "oviceid", decode(t, w.Body.Bytes())["channel_id"])
+	})
+
+	t.Run("reports validation errors as warnings", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{EnableDebugEcho: true})
+		unmock(api, "HasPermissionToChannel")
+		api.On("HasPermissionToChannel", testBotUserID, "channel", model.PermissionCreatePost).Return(false)
+
+		w := doRequest(p, http.MethodPost, "/debug/echo", `{"channel_id":"channel","severity":"loud"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		response := decode(t, w.Body.Bytes())
+		assert.Equal(t, "channel", response["channel_id"])
+		assert.Equal(t, []interface{}{
+			"message is required",
+			"the oVice bot is not allowed to post in channel channel; add it to the channel first",
+		}, response["warnings"])
+	})
+
+	t.Run("reports an unresolvable channel as a warning", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, &configuration{EnableDebugEcho: true})
+
+		w := doRequest(p, http.MethodPost, "/debug/echo", `{"message":"hi"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		response := decode(t, w.Body.Bytes())
+		assert.Nil(t, response["channel_id"])
+		assert.Equal(t, []interface{}{"channel_id or channel_name is required"}, response["warnings"])
+	})
+
+	t.Run("requires authentication", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, &configuration{EnableDebugEcho: true, SignatureScheme: signatureSchemeHMACSimple, WebhookSecret: "secret"})
+		const body = `{"channel_id":"channel","message":"hi"}`
+
+		assert.Equal(t, http.StatusUnauthorized, doRequest(p, http.MethodPost, "/debug/echo", body).Code)
+		assert.Equal(t, http.StatusOK, doSignedRequest(p, "/debug/echo", body, signHMACSimple("secret", body)).Code)
+	})
+
+	t.Run("is not found when disabled", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, nil)
+
+		assert.Equal(t, http.StatusNotFound, doRequest(p, http.MethodPost, "/debug/echo", `{"channel_id":"channel","message":"hi"}`).Code)
+	})
+}
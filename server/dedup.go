@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+// dedupRecord remembers when a message was last posted to a channel.
+type dedupRecord struct {
+	PostedAt  int64 `json:"posted_at"`
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+// dedupKey returns the KV key of the content hash of message in channelID.
+func dedupKey(channelID, message string) string {
+	return hashedKey(dedupKeyPrefix, channelID+"\n"+message)
+}
+
+// claimContent records that message is being posted to channelID at now. It reports false if
+// the same message was already posted there within DedupWindowSeconds, meaning this one is a
+// duplicate. Deduplication is disabled, and every message claimed, when the window is zero.
+func (p *Plugin) claimContent(channelID, message string, now time.Time) (bool, error) {
+	window := p.getConfiguration().dedupWindow()
+	if window <= 0 {
+		return true, nil
+	}
+
+	key := dedupKey(channelID, message)
+	oldValue, appErr := p.API.KVGet(key)
+	if appErr != nil {
+		return false, errors.Wrap(appErr, "failed to get dedup record")
+	}
+
+	nowMillis := now.UnixNano() / int64(time.Millisecond)
+	if oldValue != nil {
+		var record dedupRecord
+		if err := json.Unmarshal(oldValue, &record); err == nil && nowMillis-record.PostedAt < window.Milliseconds() {
+			return false, nil
+		}
+	}
+
+	newValue, err := json.Marshal(&dedupRecord{
+		PostedAt:  nowMillis,
+		ExpiresAt: nowMillis + window.Milliseconds(),
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "failed to encode dedup record")
+	}
+
+	// The compare-and-set loses to a concurrent identical request, which is then the duplicate.
+	ok, appErr := p.API.KVSetWithOptions(key, newValue, model.PluginKVSetOptions{
+		Atomic:          true,
+		OldValue:        oldValue,
+		ExpireInSeconds: int64(window / time.Second),
+	})
+	if appErr != nil {
+		return false, errors.Wrap(appErr, "failed to store dedup record")
+	}
+	return ok, nil
+}
+
+// releaseContent forgets a claim made by claimContent when the message could not be posted, so
+// a retry is not mistaken for a duplicate.
+func (p *Plugin) releaseContent(channelID, message string) {
+	if p.getConfiguration().dedupWindow() <= 0 {
+		return
+	}
+
+	key := dedupKey(channelID, message)
+	if appErr := p.API.KVDelete(key); appErr != nil {
+		p.API.LogWarn("Failed to release dedup record", "key", key, "err", appErr.Error())
+	}
+}
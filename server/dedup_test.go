@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentDedup(t *testing.T) {
+	const body = `{"channel_id":"town","message":"Stand-up in 5 minutes"}`
+
+	t.Run("duplicate within the window is dropped", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DedupWindowSeconds: 60})
+		posts := mockCreatePost(api)
+
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/webhook", body).Code)
+		w := doRequest(p, http.MethodPost, "/webhook", body)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"status":"ok","deduplicated":true}`, w.Body.String())
+		assert.Len(t, *posts, 1)
+
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"other","message":"Stand-up in 5 minutes"}`).Code)
+		assert.Len(t, *posts, 2)
+	})
+
+	t.Run("repeat beyond the window posts again", func(t *testing.T) {
+		p, api, kv := newTestPlugin(t, &configuration{DedupWindowSeconds: 60})
+		posts := mockCreatePost(api)
+
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/webhook", body).Code)
+
+		var record dedupRecord
+		key := dedupKey("town", "Stand-up in 5 minutes")
+		require.NoError(t, json.Unmarshal(kv.get(key), &record))
+		record.PostedAt -= (2 * time.Minute).Milliseconds()
+		kv.data[key], _ = json.Marshal(record)
+
+		w := doRequest(p, http.MethodPost, "/webhook", body)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), "deduplicated")
+		assert.Len(t, *posts, 2)
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		p, api, kv := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+
+		doRequest(p, http.MethodPost, "/webhook", body)
+		doRequest(p, http.MethodPost, "/webhook", body)
+		assert.Len(t, *posts, 2)
+		assert.Empty(t, kv.keys())
+	})
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	// channelMembersPerPage is the page size used when enumerating channel members.
+	channelMembersPerPage = 100
+
+	// defaultMaxEphemeralRecipients applies when MaxEphemeralRecipients is not configured.
+	defaultMaxEphemeralRecipients = 1000
+)
+
+// listChannelMemberIDs returns the IDs of every member of channelID, failing with a validation
+// error once more than limit members have been found.
+func (p *Plugin) listChannelMemberIDs(channelID string, limit int) ([]string, error) {
+	var userIDs []string
+	for page := 0; ; page++ {
+		members, appErr := p.API.GetChannelMembers(channelID, page, channelMembersPerPage)
+		if appErr != nil {
+			return nil, errors.Wrap(appErr, "failed to get channel members")
+		}
+
+		for _, member := range members {
+			userIDs = append(userIDs, member.UserId)
+		}
+		if len(userIDs) > limit {
+			return nil, newValidationError("channel has more than %d members", limit)
+		}
+		if len(members) < channelMembersPerPage {
+			return userIDs, nil
+		}
+	}
+}
+
+// sendEphemeralToMembers shows messages from authorID to every other member of channelID without
+// creating a permanent post, returning the number of recipients.
+func (p *Plugin) sendEphemeralToMembers(authorID, channelID, rootID string, messages []string) (int, error) {
+	userIDs, err := p.listChannelMemberIDs(channelID, p.getConfiguration().maxEphemeralRecipients())
+	if err != nil {
+		return 0, err
+	}
+
+	recipients := 0
+	for _, userID := range userIDs {
+		if userID == authorID {
+			continue
+		}
+		for _, message := range messages {
+			p.API.SendEphemeralPost(userID, &model.Post{
+				UserId:    authorID,
+				ChannelId: channelID,
+				RootId:    rootID,
+				Message:   message,
+			})
+		}
+		recipients++
+	}
+
+	return recipients, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// mockChannelMembers serves count members of channelID (plus the bot) through paged
+// GetChannelMembers calls.
+func mockChannelMembers(api *plugintest.API, channelID string, count int) {
+	members := model.ChannelMembers{{ChannelId: channelID, UserId: testBotUserID}}
+	for i := 0; i < count; i++ {
+		members = append(members, model.ChannelMember{ChannelId: channelID, UserId: fmt.Sprintf("user%d", i)})
+	}
+
+	api.On("GetChannelMembers", channelID, mock.AnythingOfType("int"), channelMembersPerPage).Return(func(_ string, page, perPage int) model.ChannelMembers {
+		start := page * perPage
+		if start >= len(members) {
+			return model.ChannelMembers{}
+		}
+		end := start + perPage
+		if end > len(members) {
+			end = len(members)
+		}
+		return members[start:end]
+	}, nil)
+}
+
+func TestEphemeralToMembers(t *testing.T) {
+	const body = `{"channel_id":"channel","message":"closing in 5 minutes","ephemeral_to_members":true}`
+
+	t.Run("small channel", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockChannelMembers(api, "channel", 3)
+		api.On("SendEphemeralPost", mock.AnythingOfType("string"), postMatcher("channel", "closing in 5 minutes")).Return(&model.Post{})
+
+		w := doRequest(p, http.MethodPost, "/webhook", body)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"recipients":3`)
+		api.AssertNumberOfCalls(t, "SendEphemeralPost", 3)
+		api.AssertNotCalled(t, "SendEphemeralPost", testBotUserID, mock.Anything)
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("pagination across pages", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockChannelMembers(api, "channel", 2*channelMembersPerPage+10)
+		api.On("SendEphemeralPost", mock.AnythingOfType("string"), mock.Anything).Return(&model.Post{})
+
+		w := doRequest(p, http.MethodPost, "/webhook", body)
+		require.Equal(t, http.StatusOK, w.Code)
+		api.AssertNumberOfCalls(t, "GetChannelMembers", 3)
+		api.AssertNumberOfCalls(t, "SendEphemeralPost", 2*channelMembersPerPage+10)
+		api.AssertCalled(t, "SendEphemeralPost", fmt.Sprintf("user%d", 2*channelMembersPerPage+9), mock.Anything)
+	})
+
+	t.Run("member cap", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{MaxEphemeralRecipients: 5})
+		mockChannelMembers(api, "channel", 10)
+
+		w := doRequest(p, http.MethodPost, "/webhook", body)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), "more than 5 members")
+		api.AssertNotCalled(t, "SendEphemeralPost", mock.Anything, mock.Anything)
+	})
+}
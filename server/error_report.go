@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// errorReportInterval is the minimum time between two error reports, so a persistent failure
+// cannot flood ErrorChannelID.
+const errorReportInterval = time.Minute
+
+// errorStatus returns the HTTP status err is reported to the client with.
+func errorStatus(err error) int {
+	if herr, ok := err.(*httpError); ok {
+		return herr.Status
+	}
+	return http.StatusInternalServerError
+}
+
+// reportError posts a summary of a failure to handle source to ErrorChannelID. Only failures the
+// caller cannot fix, answered with a 5xx, are reported, at most once per errorReportInterval;
+// the reports skipped in between are counted in the next one. Failures of requests targeting
+// the error channel itself are never reported there, so a broken error channel cannot loop.
+func (p *Plugin) reportError(source, channelID string, err error, now time.Time) {
+	errorChannelID := p.getConfiguration().ErrorChannelID
+	if errorChannelID == "" || errorStatus(err) < http.StatusInternalServerError || channelID == errorChannelID {
+		return
+	}
+
+	p.errorReportsLock.Lock()
+	if now.Sub(p.lastErrorReport) < errorReportInterval {
+		p.suppressedErrorReports++
+		p.errorReportsLock.Unlock()
+		return
+	}
+	suppressed := p.suppressedErrorReports
+	p.lastErrorReport = now
+	p.suppressedErrorReports = 0
+	p.errorReportsLock.Unlock()
+
+	message := fmt.Sprintf("Failed to handle oVice %s: %s", source, err.Error())
+	if channelID != "" {
+		message += fmt.Sprintf(" (channel `%s`)", channelID)
+	}
+	if suppressed > 0 {
+		message += fmt.Sprintf("\n%d more failures were not reported.", suppressed)
+	}
+
+	if _, appErr := p.createIntegrationPost(&model.Post{
+		UserId:    p.botUserID,
+		ChannelId: errorChannelID,
+		Message:   message,
+	}); appErr != nil {
+		p.API.LogWarn("Failed to report error", "channel_id", errorChannelID, "err", appErr.Error())
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportError(t *testing.T) {
+	t.Run("event failure is reported", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{ErrorChannelID: "ops"})
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/events", `{"event":"enter","user_email":"alice@example.com","space_name":"HQ"}`)
+		require.Equal(t, http.StatusServiceUnavailable, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "ops", (*posts)[0].ChannelId)
+		assert.Equal(t, testBotUserID, (*posts)[0].UserId)
+		assert.Equal(t, "Failed to handle oVice enter event: no channel is configured for presence notifications", (*posts)[0].Message)
+	})
+
+	t.Run("webhook failure is reported", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{ErrorChannelID: "ops"})
+		api.On("CreatePost", postMatcher("channel", "hi")).Return(nil, &model.AppError{Message: "boom"})
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi"}`)
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "ops", (*posts)[0].ChannelId)
+		assert.Contains(t, (*posts)[0].Message, "Failed to handle oVice webhook: failed to create post")
+		assert.Contains(t, (*posts)[0].Message, "(channel `channel`)")
+	})
+
+	t.Run("validation errors are not reported", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{ErrorChannelID: "ops"})
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel"}`)
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("failures in the error channel are not reported there", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{ErrorChannelID: "ops"})
+		api.On("CreatePost", mock.Anything).Return(nil, &model.AppError{Message: "boom"}).Once()
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"ops","message":"hi"}`)
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+		api.AssertNumberOfCalls(t, "CreatePost", 1)
+	})
+
+	t.Run("reports are rate limited", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{ErrorChannelID: "ops"})
+		posts := mockCreatePost(api)
+
+		now := time.Now()
+		failure := errors.New("boom")
+		p.reportError("webhook", "channel", failure, now)
+		p.reportError("webhook", "channel", failure, now.Add(time.Second))
+		p.reportError("webhook", "channel", failure, now.Add(2*time.Second))
+		require.Len(t, *posts, 1)
+
+		p.reportError("webhook", "channel", failure, now.Add(errorReportInterval))
+		require.Len(t, *posts, 2)
+		assert.Contains(t, (*posts)[1].Message, "2 more failures were not reported.")
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+
+		p.reportError("webhook", "channel", errors.New("boom"), time.Now())
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// eventEnvelope is the part shared by every oVice event payload. The remaining fields depend on
+// the event type and are decoded by the matching handler.
+type eventEnvelope struct {
+	Event     string `json:"event"`
+	SpaceName string `json:"space_name"`
+	RoomID    string `json:"room_id"`
+	Origin    string `json:"origin"`
+}
+
+// eventHandler processes the raw payload of a single oVice event type.
+type eventHandler func(p *Plugin, data []byte) error
+
+// eventPayload is the decoded payload of an oVice event, which can check its own fields.
+type eventPayload interface {
+	validate() error
+}
+
+var eventHandlers = map[string]eventHandler{
+	"capacity":         (*Plugin).handleCapacityEvent,
+	"chat":             (*Plugin).handleChatEvent,
+	"knock":            (*Plugin).handleKnockEvent,
+	presenceEventEnter: (*Plugin).handlePresenceEvent,
+	presenceEventLeave: (*Plugin).handlePresenceEvent,
+
+	recordingEventReady: (*Plugin).handleRecordingEvent,
+
+	screenshareEventStart: (*Plugin).handleScreenshareEvent,
+	screenshareEventStop:  (*Plugin).handleScreenshareEvent,
+}
+
+// eventPayloads returns an empty payload for each event type in eventHandlers, so an event can be
+// validated without being handled, as in MaintenanceMode.
+var eventPayloads = map[string]func() eventPayload{
+	"capacity":         func() eventPayload { return &capacityEvent{} },
+	"chat":             func() eventPayload { return &chatEvent{} },
+	"knock":            func() eventPayload { return &knockEvent{} },
+	presenceEventEnter: func() eventPayload { return &presenceEvent{} },
+	presenceEventLeave: func() eventPayload { return &presenceEvent{} },
+
+	recordingEventReady: func() eventPayload { return &recordingEvent{} },
+
+	screenshareEventStart: func() eventPayload { return &presenceEvent{} },
+	screenshareEventStop:  func() eventPayload { return &presenceEvent{} },
+}
+
+// validateEvent decodes the payload of an event of type eventType and checks its fields.
+func validateEvent(eventType string, data []byte) error {
+	payload := eventPayloads[eventType]()
+	if err := decodeEvent(data, payload); err != nil {
+		return err
+	}
+	return payload.validate()
+}
+
+// handleEvents decodes an oVice event and dispatches it to the handler registered for its type.
+func (p *Plugin) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		p.writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	data, err := readRequestBody(w, r)
+	if err != nil {
+		p.writeError(w, err)
+		return
+	}
+	if _, err = p.verifySignature(r.Header, data, time.Now()); err != nil {
+		p.writeError(w, err)
+		return
+	}
+
+	var envelope eventEnvelope
+	if err = json.Unmarshal(data, &envelope); err != nil {
+		p.writeError(w, newHTTPError(http.StatusBadRequest, "invalid JSON payload"))
+		return
+	}
+
+	handler, ok := eventHandlers[strings.ToLower(envelope.Event)]
+	if !ok {
+		p.writeError(w, newValidationError("unsupported event %q", envelope.Event))
+		return
+	}
+
+	if p.isSelfOriginated(envelope.Origin, nil) {
+		p.API.LogDebug("Ignored oVice event originating from this plugin", "event", envelope.Event)
+		writeJSON(w, http.StatusOK, &webhookResponse{Status: "ignored", Ignored: true})
+		return
+	}
+	if p.getConfiguration().MaintenanceMode {
+		if err = validateEvent(strings.ToLower(envelope.Event), data); err != nil {
+			p.writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, &webhookResponse{Status: "accepted", Suppressed: true})
+		return
+	}
+	if err = p.limitSpace(w, envelope.SpaceName); err != nil {
+		p.writeError(w, err)
+		return
+	}
+
+	if err = handler(p, data); err != nil {
+		channelID := p.resolveSpaceChannelID(envelope.SpaceName, envelope.RoomID)
+		p.reportError(strings.ToLower(envelope.Event)+" event", channelID, err, time.Now())
+		p.writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// decodeEvent unmarshals an event payload into v, reporting malformed payloads as a 400.
+func decodeEvent(data []byte, v interface{}) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return newHTTPError(http.StatusBadRequest, "invalid JSON payload")
+	}
+	return nil
+}
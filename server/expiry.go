@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+// postExpiryKey returns the KV key recording when the post postID is deleted.
+func postExpiryKey(postID string) string {
+	return postExpiryKeyPrefix + postID
+}
+
+// parseExpiresAt parses the expires_at of a message, which must be an RFC3339 time after now.
+func parseExpiresAt(value string, now time.Time) (time.Time, error) {
+	expiresAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, newValidationError("expires_at must be an RFC3339 timestamp")
+	}
+	if !expiresAt.After(now) {
+		return time.Time{}, newValidationError("expires_at must be in the future")
+	}
+	return expiresAt, nil
+}
+
+// schedulePostExpiry records that postID is deleted at expiresAt. The record lives in the KV
+// store, so pending expiries survive a restart of the plugin.
+func (p *Plugin) schedulePostExpiry(postID string, expiresAt time.Time) error {
+	data, err := json.Marshal(&expiringRecord{ExpiresAt: model.GetMillisForTime(expiresAt)})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode post expiry")
+	}
+	if appErr := p.API.KVSet(postExpiryKey(postID), data); appErr != nil {
+		return errors.Wrap(appErr, "failed to store post expiry")
+	}
+	return nil
+}
+
+// pruneExpiredPost deletes the post of an expiry record once it is due. The record is kept, and
+// the deletion retried on the next run, unless the post is deleted or already gone.
+func (p *Plugin) pruneExpiredPost(key string, value []byte, now time.Time) bool {
+	if !pruneExpiredRecord(p, key, value, now) {
+		return false
+	}
+
+	postID := strings.TrimPrefix(key, postExpiryKeyPrefix)
+	if appErr := p.API.DeletePost(postID); appErr != nil && appErr.StatusCode != http.StatusNotFound {
+		p.API.LogWarn("Failed to delete expired post", "post_id", postID, "err", appErr.Error())
+		return false
+	}
+	return true
+}
+
+// deleteExpiredPosts deletes the posts whose expiry is due. It runs every
+// inactivityCheckInterval, so a post outlives its expires_at by at most about a minute; KV
+// maintenance prunes the same records as a backstop.
+func (p *Plugin) deleteExpiredPosts(now time.Time) error {
+	keys, err := p.kvListKeys(postExpiryKeyPrefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		value, appErr := p.API.KVGet(key)
+		if appErr != nil {
+			p.API.LogWarn("Failed to read post expiry", "key", key, "err", appErr.Error())
+			continue
+		}
+		if value == nil || !p.pruneExpiredPost(key, value, now) {
+			continue
+		}
+		if appErr = p.API.KVDelete(key); appErr != nil {
+			p.API.LogWarn("Failed to delete post expiry", "key", key, "err", appErr.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostExpiry(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	message := `{"channel_id":"channel","message":"HQ is open for the next hour","expires_at":"` + expiresAt.Format(time.RFC3339) + `"}`
+
+	t.Run("post is deleted at expiry", func(t *testing.T) {
+		p, api, kv := newTestPlugin(t, nil)
+		mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", message)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"status":"ok","post_id":"post0"}`, w.Body.String())
+
+		var record expiringRecord
+		require.NoError(t, json.Unmarshal(kv.data[postExpiryKey("post0")], &record))
+		assert.Equal(t, model.GetMillisForTime(expiresAt), record.ExpiresAt)
+
+		require.NoError(t, p.runMaintenance(expiresAt.Add(-time.Minute)))
+		api.AssertNotCalled(t, "DeletePost", mock.Anything)
+		assert.Contains(t, kv.data, postExpiryKey("post0"))
+
+		api.On("DeletePost", "post0").Return(nil).Once()
+		require.NoError(t, p.runMaintenance(expiresAt))
+		api.AssertCalled(t, "DeletePost", "post0")
+		assert.NotContains(t, kv.data, postExpiryKey("post0"))
+	})
+
+	t.Run("post without expiry is untouched", func(t *testing.T) {
+		p, api, kv := newTestPlugin(t, nil)
+		mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, kv.keys())
+
+		require.NoError(t, p.runMaintenance(expiresAt.Add(24*time.Hour)))
+		api.AssertNotCalled(t, "DeletePost", mock.Anything)
+	})
+
+	t.Run("pending expiries survive a restart", func(t *testing.T) {
+		p, api, kv := newTestPlugin(t, nil)
+		mockCreatePost(api)
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/webhook", message).Code)
+
+		restarted, restartedAPI, restartedKV := newTestPlugin(t, nil)
+		restartedKV.data = kv.data
+		restartedAPI.On("DeletePost", "post0").Return(nil).Once()
+
+		require.NoError(t, restarted.runMaintenance(expiresAt.Add(time.Second)))
+		restartedAPI.AssertCalled(t, "DeletePost", "post0")
+		assert.Empty(t, restartedKV.keys())
+		api.AssertNotCalled(t, "DeletePost", mock.Anything)
+	})
+
+	t.Run("due posts are deleted by the per-minute check", func(t *testing.T) {
+		p, api, kv := newTestPlugin(t, nil)
+		require.NoError(t, p.schedulePostExpiry("post0", expiresAt))
+		require.NoError(t, p.schedulePostExpiry("post1", expiresAt.Add(time.Hour)))
+
+		api.On("DeletePost", "post0").Return(nil).Once()
+		require.NoError(t, p.deleteExpiredPosts(expiresAt))
+		api.AssertCalled(t, "DeletePost", "post0")
+		api.AssertNotCalled(t, "DeletePost", "post1")
+		assert.NotContains(t, kv.data, postExpiryKey("post0"))
+		assert.Contains(t, kv.data, postExpiryKey("post1"))
+	})
+
+	t.Run("failed deletion is retried", func(t *testing.T) {
+		p, api, kv := newTestPlugin(t, nil)
+		require.NoError(t, p.schedulePostExpiry("post0", expiresAt))
+		api.On("DeletePost", "post0").Return(&model.AppError{StatusCode: http.StatusInternalServerError, Message: "boom"}).Once()
+
+		require.NoError(t, p.runMaintenance(expiresAt))
+		assert.Contains(t, kv.data, postExpiryKey("post0"))
+
+		api.On("DeletePost", "post0").Return(&model.AppError{StatusCode: http.StatusNotFound}).Once()
+		require.NoError(t, p.runMaintenance(expiresAt))
+		assert.NotContains(t, kv.data, postExpiryKey("post0"))
+	})
+
+	t.Run("invalid expires_at", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, nil)
+
+		for body, expected := range map[string]string{
+			`{"channel_id":"channel","message":"hi","expires_at":"tomorrow"}`:                                         "expires_at must be an RFC3339 timestamp",
+			`{"channel_id":"channel","message":"hi","expires_at":"2001-01-01T00:00:00Z"}`:                             "expires_at must be in the future",
+			`{"channel_id":"channel","message":"hi","ephemeral_to_members":true,"expires_at":"2999-01-01T00:00:00Z"}`: "expires_at cannot be combined with ephemeral_to_members",
+		} {
+			w := doRequest(p, http.MethodPost, "/webhook", body)
+			assert.Equal(t, http.StatusUnprocessableEntity, w.Code, body)
+			assert.Contains(t, w.Body.String(), expected, body)
+		}
+	})
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+// exportVersion is the version of the blob written by /ovice export. Import rejects blobs of
+// other versions.
+const exportVersion = 1
+
+// configExport holds the KV-backed settings of the plugin that /ovice export carries to another
+// server. Settings stored in the plugin configuration are exported with the server config.
+type configExport struct {
+	Version         int          `json:"version"`
+	Links           []exportLink `json:"links"`
+	MutedChannelIDs []string     `json:"muted_channel_ids"`
+}
+
+// exportLink is the oVice email linked to a Mattermost user.
+type exportLink struct {
+	UserID string `json:"user_id"`
+	Email  string `json:"email"`
+}
+
+// kvListKeys returns every KV key that starts with prefix, sorted.
+func (p *Plugin) kvListKeys(prefix string) ([]string, error) {
+	var matched []string
+	for page := 0; ; page++ {
+		keys, appErr := p.API.KVList(page, kvListPerPage)
+		if appErr != nil {
+			return nil, errors.Wrap(appErr, "failed to list keys")
+		}
+		for _, key := range keys {
+			if strings.HasPrefix(key, prefix) {
+				matched = append(matched, key)
+			}
+		}
+		if len(keys) < kvListPerPage {
+			break
+		}
+	}
+	sort.Strings(matched)
+	return matched, nil
+}
+
+// exportConfig collects the links and channel mutes stored in the KV store.
+func (p *Plugin) exportConfig() (*configExport, error) {
+	export := &configExport{Version: exportVersion, Links: []exportLink{}, MutedChannelIDs: []string{}}
+
+	linkKeys, err := p.kvListKeys(linkKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range linkKeys {
+		userID := strings.TrimPrefix(key, linkKeyPrefix)
+		email, getErr := p.getLinkedEmail(userID)
+		if getErr != nil {
+			return nil, getErr
+		}
+		if email != "" {
+			export.Links = append(export.Links, exportLink{UserID: userID, Email: email})
+		}
+	}
+
+	muteKeys, err := p.kvListKeys(muteKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range muteKeys {
+		export.MutedChannelIDs = append(export.MutedChannelIDs, strings.TrimPrefix(key, muteKeyPrefix))
+	}
+
+	return export, nil
+}
+
+// importConfig restores the entries of export whose user or channel exists on this server,
+// returning the number of links and mutes imported and a reason for every skipped entry.
+func (p *Plugin) importConfig(export *configExport, locale string) (links, mutes int, skipped []string) {
+	for _, link := range export.Links {
+		if !model.IsValidEmail(link.Email) {
+			skipped = append(skipped, translate(locale, "link of user `%s`: `%s` is not a valid email", link.UserID, link.Email))
+			continue
+		}
+		if reason := p.checkExists(p.userExists(link.UserID)); reason != "" {
+			skipped = append(skipped, translate(locale, "link of user `%s`: %s", link.UserID, translate(locale, reason)))
+			continue
+		}
+		if appErr := p.API.KVSet(linkKeyPrefix+link.UserID, []byte(link.Email)); appErr != nil {
+			p.API.LogWarn("Failed to import link", "user_id", link.UserID, "err", appErr.Error())
+			skipped = append(skipped, translate(locale, "link of user `%s`: %s", link.UserID, translate(locale, "failed to store it")))
+			continue
+		}
+		links++
+	}
+
+	for _, channelID := range export.MutedChannelIDs {
+		if reason := p.checkExists(p.channelExists(channelID)); reason != "" {
+			skipped = append(skipped, translate(locale, "muted channel `%s`: %s", channelID, translate(locale, reason)))
+			continue
+		}
+		if appErr := p.API.KVSet(muteKey(channelID), []byte("1")); appErr != nil {
+			p.API.LogWarn("Failed to import channel mute", "channel_id", channelID, "err", appErr.Error())
+			skipped = append(skipped, translate(locale, "muted channel `%s`: %s", channelID, translate(locale, "failed to store it")))
+			continue
+		}
+		mutes++
+	}
+
+	return links, mutes, skipped
+}
+
+// userExists looks up userID, returning the lookup error if any.
+func (p *Plugin) userExists(userID string) *model.AppError {
+	if !model.IsValidId(userID) {
+		return model.NewAppError("userExists", "ovice.import.user_id", nil, "", http.StatusNotFound)
+	}
+	_, appErr := p.API.GetUser(userID)
+	return appErr
+}
+
+// channelExists looks up channelID, returning the lookup error if any.
+func (p *Plugin) channelExists(channelID string) *model.AppError {
+	if !model.IsValidId(channelID) {
+		return model.NewAppError("channelExists", "ovice.import.channel_id", nil, "", http.StatusNotFound)
+	}
+	_, appErr := p.API.GetChannel(channelID)
+	return appErr
+}
+
+// checkExists turns the error of a lookup into the untranslated reason an entry is skipped, or
+// an empty string if the lookup succeeded.
+func (p *Plugin) checkExists(appErr *model.AppError) string {
+	switch {
+	case appErr == nil:
+		return ""
+	case appErr.StatusCode == http.StatusNotFound:
+		return "it does not exist"
+	default:
+		p.API.LogWarn("Failed to look up an imported entry", "err", appErr.Error())
+		return "failed to look it up"
+	}
+}
+
+// executeExportCommand shows a system admin the blob to pass to /ovice import on another server.
+func (p *Plugin) executeExportCommand(args *model.CommandArgs, _ []string, locale string) *model.CommandResponse {
+	if !p.API.HasPermissionTo(args.UserId, model.PermissionManageSystem) {
+		return ephemeralResponse(translate(locale, "Only system admins can export or import the oVice configuration."))
+	}
+
+	export, err := p.exportConfig()
+	if err != nil {
+		p.API.LogWarn("Failed to export configuration", "err", err.Error())
+		return ephemeralResponse(translate(locale, "Failed to export the oVice configuration. Please try again later."))
+	}
+	data, err := json.Marshal(export)
+	if err != nil {
+		p.API.LogWarn("Failed to encode configuration export", "err", err.Error())
+		return ephemeralResponse(translate(locale, "Failed to export the oVice configuration. Please try again later."))
+	}
+
+	trigger := p.getConfiguration().commandTrigger()
+	return ephemeralResponse(translate(locale, "Run `/%s import` followed by this blob on the other server:", trigger) + "\n```json\n" + string(data) + "\n```")
+}
+
+// executeImportCommand restores a blob printed by /ovice export, reporting the entries skipped
+// because their user or channel does not exist here.
+func (p *Plugin) executeImportCommand(args *model.CommandArgs, params []string, locale string) *model.CommandResponse {
+	if !p.API.HasPermissionTo(args.UserId, model.PermissionManageSystem) {
+		return ephemeralResponse(translate(locale, "Only system admins can export or import the oVice configuration."))
+	}
+
+	trigger := p.getConfiguration().commandTrigger()
+	blob := strings.TrimSpace(strings.Join(params, " "))
+	blob = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(blob, "```json"), "```"))
+	if blob == "" {
+		return ephemeralResponse(translate(locale, "Usage: `/%s import <blob>`, with the blob printed by `/%s export`.", trigger, trigger))
+	}
+
+	var export configExport
+	if err := json.Unmarshal([]byte(blob), &export); err != nil {
+		return ephemeralResponse(translate(locale, "The blob is not valid JSON: %s", err.Error()))
+	}
+	if export.Version != exportVersion {
+		return ephemeralResponse(translate(locale, "Blobs of version %d cannot be imported; export the configuration again.", export.Version))
+	}
+
+	links, mutes, skipped := p.importConfig(&export, locale)
+	lines := []string{translate(locale, "Imported %d links and %d muted channels.", links, mutes)}
+	if len(skipped) > 0 {
+		lines = append(lines, translate(locale, "Skipped %d entries:", len(skipped)))
+		for _, reason := range skipped {
+			lines = append(lines, "- "+reason)
+		}
+	}
+	return ephemeralResponse(strings.Join(lines, "\n"))
+}
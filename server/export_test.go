@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImportCommands(t *testing.T) {
+	alice, bob, gone := model.NewId(), model.NewId(), model.NewId()
+	town, deleted := model.NewId(), model.NewId()
+
+	setup := func(t *testing.T, admin bool) (*Plugin, *plugintest.API, *memKV) {
+		p, api, kv := newTestPlugin(t, nil)
+		mockUserLocale(api, "admin", "")
+		api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(admin)
+		return p, api, kv
+	}
+
+	t.Run("export content", func(t *testing.T) {
+		p, _, kv := setup(t, true)
+		kv.data[linkKeyPrefix+alice] = []byte("alice@example.com")
+		kv.data[linkKeyPrefix+bob] = []byte("bob@example.com")
+		kv.data[muteKey(town)] = []byte("1")
+		kv.data[welcomeKey(town)] = []byte("1")
+
+		text := executeCommand(t, p, "admin", "town", "/ovice export")
+		require.True(t, strings.HasPrefix(text, "Run `/ovice import` followed by this blob on the other server:\n```json\n"), text)
+
+		blob := strings.TrimSuffix(strings.SplitN(text, "```json\n", 2)[1], "\n```")
+		var export configExport
+		require.NoError(t, json.Unmarshal([]byte(blob), &export))
+		assert.Equal(t, exportVersion, export.Version)
+		assert.ElementsMatch(t, []exportLink{{UserID: alice, Email: "alice@example.com"}, {UserID: bob, Email: "bob@example.com"}}, export.Links)
+		assert.Equal(t, []string{town}, export.MutedChannelIDs)
+	})
+
+	t.Run("clean import", func(t *testing.T) {
+		p, api, kv := setup(t, true)
+		api.On("GetUser", alice).Return(&model.User{Id: alice}, nil)
+
+		blob := `{"version":1,"links":[{"user_id":"` + alice + `","email":"alice@example.com"}],"muted_channel_ids":["` + town + `"]}`
+		assert.Equal(t, "Imported 1 links and 1 muted channels.", executeCommand(t, p, "admin", "town", "/ovice import ```json\n"+blob+"\n```"))
+		assert.Equal(t, []byte("alice@example.com"), kv.data[linkKeyPrefix+alice])
+		assert.Contains(t, kv.data, muteKey(town))
+	})
+
+	t.Run("import skips invalid entries", func(t *testing.T) {
+		p, api, kv := setup(t, true)
+		api.On("GetUser", alice).Return(&model.User{Id: alice}, nil)
+		api.On("GetUser", gone).Return(nil, &model.AppError{StatusCode: http.StatusNotFound, Message: "not found"})
+		unmock(api, "GetChannel")
+		api.On("GetChannel", town).Return(&model.Channel{Id: town}, nil)
+		api.On("GetChannel", deleted).Return(nil, &model.AppError{StatusCode: http.StatusNotFound, Message: "not found"})
+
+		blob := `{"version":1,"links":[` +
+			`{"user_id":"` + alice + `","email":"alice@example.com"},` +
+			`{"user_id":"` + gone + `","email":"gone@example.com"},` +
+			`{"user_id":"` + bob + `","email":"not an email"}],` +
+			`"muted_channel_ids":["` + town + `","` + deleted + `"]}`
+		assert.Equal(t, strings.Join([]string{
+			"Imported 1 links and 1 muted channels.",
+			"Skipped 3 entries:",
+			"- link of user `" + gone + "`: it does not exist",
+			"- link of user `" + bob + "`: `not an email` is not a valid email",
+			"- muted channel `" + deleted + "`: it does not exist",
+		}, "\n"), executeCommand(t, p, "admin", "town", "/ovice import "+blob))
+
+		assert.Contains(t, kv.data, linkKeyPrefix+alice)
+		assert.NotContains(t, kv.data, linkKeyPrefix+gone)
+		assert.NotContains(t, kv.data, linkKeyPrefix+bob)
+		assert.Contains(t, kv.data, muteKey(town))
+		assert.NotContains(t, kv.data, muteKey(deleted))
+	})
+
+	t.Run("malformed blobs", func(t *testing.T) {
+		p, _, _ := setup(t, true)
+
+		assert.Equal(t, "Usage: `/ovice import <blob>`, with the blob printed by `/ovice export`.", executeCommand(t, p, "admin", "town", "/ovice import"))
+		assert.Contains(t, executeCommand(t, p, "admin", "town", "/ovice import {"), "The blob is not valid JSON")
+		assert.Equal(t, "Blobs of version 2 cannot be imported; export the configuration again.", executeCommand(t, p, "admin", "town", `/ovice import {"version":2}`))
+	})
+
+	t.Run("only system admins", func(t *testing.T) {
+		p, _, kv := setup(t, false)
+		kv.data[linkKeyPrefix+alice] = []byte("alice@example.com")
+
+		assert.Equal(t, "Only system admins can export or import the oVice configuration.", executeCommand(t, p, "admin", "town", "/ovice export"))
+		assert.Equal(t, "Only system admins can export or import the oVice configuration.", executeCommand(t, p, "admin", "town", `/ovice import {"version":1}`))
+	})
+}
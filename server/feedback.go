@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+// parseTeamFeedbackChannels parses the TeamFeedbackChannels setting, a JSON object mapping a
+// team ID to the channel ID its feedback is posted in.
+func parseTeamFeedbackChannels(value string) (map[string]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	var channels map[string]string
+	if err := json.Unmarshal([]byte(value), &channels); err != nil {
+		return nil, errors.Wrap(err, "failed to parse team feedback channels")
+	}
+	for teamID, channelID := range channels {
+		if teamID == "" {
+			return nil, errors.New("a feedback channel has no team id")
+		}
+		if channelID == "" {
+			return nil, errors.Errorf("team %q has an empty feedback channel", teamID)
+		}
+	}
+	return channels, nil
+}
+
+// feedbackChannelID returns the channel feedback sent from teamID is posted in: the channel of
+// the team in TeamFeedbackChannels, or FeedbackChannelID. Empty means feedback is not set up.
+func (c *configuration) feedbackChannelID(teamID string) string {
+	if channelID, ok := c.teamFeedbackChannels[teamID]; ok && teamID != "" {
+		return channelID
+	}
+	return c.FeedbackChannelID
+}
+
+// executeFeedbackCommand posts the user's feedback to the feedback channel of the team the
+// command was run in, noting who sent it and from which channel.
+func (p *Plugin) executeFeedbackCommand(args *model.CommandArgs, params []string, locale string) *model.CommandResponse {
+	text := strings.Join(params, " ")
+	if text == "" {
+		return ephemeralResponse(translate(locale, "Usage: `/%s feedback <message>`", p.getConfiguration().commandTrigger()))
+	}
+
+	channelID := p.getConfiguration().feedbackChannelID(args.TeamId)
+	if channelID == "" {
+		return ephemeralResponse(translate(locale, "Feedback is not set up on this server. Please ask a system admin to configure a feedback channel."))
+	}
+
+	sender := args.UserId
+	if user, appErr := p.API.GetUser(args.UserId); appErr == nil && user.Username != "" {
+		sender = "@" + user.Username
+	}
+	source := args.ChannelId
+	if info, err := p.getChannelInfo(args.ChannelId, time.Now()); err == nil && info.DisplayName != "" {
+		source = "**" + info.DisplayName + "**"
+	}
+
+	if _, appErr := p.createIntegrationPost(&model.Post{
+		UserId:    p.botUserID,
+		ChannelId: channelID,
+		Message:   fmt.Sprintf("Feedback from %s in %s:\n> %s", sender, source, strings.ReplaceAll(text, "\n", "\n> ")),
+	}); appErr != nil {
+		p.API.LogWarn("Failed to post feedback", "channel_id", channelID, "err", appErr.Error())
+		return ephemeralResponse(translate(locale, "Failed to send your feedback. Please try again later."))
+	}
+	return ephemeralResponse(translate(locale, "Thanks, your feedback was sent."))
+}
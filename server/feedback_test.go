@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeedbackCommand(t *testing.T) {
+	config := &configuration{
+		FeedbackChannelID:    "global-feedback",
+		TeamFeedbackChannels: `{"team-eng": "eng-moderation"}`,
+	}
+	setup := func(t *testing.T, config *configuration) (*Plugin, *plugintest.API) {
+		p, api, _ := newTestPlugin(t, config)
+		api.On("GetUser", "alice").Return(&model.User{Id: "alice", Username: "alice"}, nil)
+		unmock(api, "GetChannel")
+		api.On("GetChannel", "town").Return(&model.Channel{Id: "town", DisplayName: "Town Square"}, nil).Maybe()
+		return p, api
+	}
+	feedback := func(t *testing.T, p *Plugin, teamID, command string) string {
+		t.Helper()
+		response, appErr := p.ExecuteCommand(nil, &model.CommandArgs{UserId: "alice", ChannelId: "town", TeamId: teamID, Command: command})
+		require.Nil(t, appErr)
+		return response.Text
+	}
+
+	t.Run("feedback goes to the channel of the team", func(t *testing.T) {
+		p, api := setup(t, config)
+		posts := mockCreatePost(api)
+
+		assert.Equal(t, "Thanks, your feedback was sent.", feedback(t, p, "team-eng", "/ovice feedback The HQ link is broken"))
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "eng-moderation", (*posts)[0].ChannelId)
+		assert.Equal(t, testBotUserID, (*posts)[0].UserId)
+		assert.Equal(t, "Feedback from @alice in **Town Square**:\n> The HQ link is broken", (*posts)[0].Message)
+	})
+
+	t.Run("other teams fall back to the global channel", func(t *testing.T) {
+		p, api := setup(t, config)
+		posts := mockCreatePost(api)
+
+		assert.Equal(t, "Thanks, your feedback was sent.", feedback(t, p, "team-sales", "/ovice feedback hi"))
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "global-feedback", (*posts)[0].ChannelId)
+	})
+
+	t.Run("feedback is rejected without a channel", func(t *testing.T) {
+		p, api := setup(t, &configuration{TeamFeedbackChannels: `{"team-eng": "eng-moderation"}`})
+
+		assert.Contains(t, feedback(t, p, "team-sales", "/ovice feedback hi"), "Feedback is not set up on this server.")
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("message is required", func(t *testing.T) {
+		p, api := setup(t, config)
+
+		assert.Equal(t, "Usage: `/ovice feedback <message>`", feedback(t, p, "team-eng", "/ovice feedback"))
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+}
+
+func TestParseTeamFeedbackChannels(t *testing.T) {
+	channels, err := parseTeamFeedbackChannels(`{"team-eng": "eng-moderation"}`)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"team-eng": "eng-moderation"}, channels)
+
+	for _, value := range []string{`{"team-eng": ""}`, `{"": "eng-moderation"}`, `["eng-moderation"]`} {
+		_, err = parseTeamFeedbackChannels(value)
+		assert.Error(t, err, value)
+	}
+}
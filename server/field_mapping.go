@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// fieldMapping copies the value at a dotted path of a webhook payload, e.g. data.room.id, to a
+// top-level RequestBody field.
+type fieldMapping struct {
+	source []string
+	target string
+}
+
+// parsePayloadFieldMapping parses the PayloadFieldMapping setting, a JSON object mapping a
+// dotted source path to the JSON name of the RequestBody field it fills.
+func parsePayloadFieldMapping(value string) ([]fieldMapping, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	var paths map[string]string
+	if err := json.Unmarshal([]byte(value), &paths); err != nil {
+		return nil, errors.Wrap(err, "failed to parse field mapping")
+	}
+
+	targets := map[string]bool{}
+	for _, name := range requestBodyFields {
+		targets[name] = true
+	}
+
+	mappings := make([]fieldMapping, 0, len(paths))
+	for path, target := range paths {
+		source := strings.Split(path, ".")
+		for _, segment := range source {
+			if segment == "" {
+				return nil, errors.Errorf("invalid source path %q", path)
+			}
+		}
+		if !targets[target] {
+			return nil, errors.Errorf("source path %q maps to unknown field %q", path, target)
+		}
+		mappings = append(mappings, fieldMapping{source: source, target: target})
+	}
+	// Sorting keeps the outcome deterministic when several paths fill the same field.
+	sort.Slice(mappings, func(i, j int) bool {
+		return strings.Join(mappings[i].source, ".") < strings.Join(mappings[j].source, ".")
+	})
+	return mappings, nil
+}
+
+// applyFieldMapping returns data with the value at each source path of mappings copied to its
+// target field. A field sent as such wins over a mapped value, and the first mapped value wins
+// over later ones. The top-level objects the paths read from are then dropped, unless they are
+// RequestBody fields themselves, so StrictJSONFields does not reject them. Data that is not a
+// JSON object is returned as is, for decoding to reject.
+func applyFieldMapping(data []byte, mappings []fieldMapping) []byte {
+	if len(mappings) == 0 {
+		return data
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(data, &payload); err != nil || payload == nil {
+		return data
+	}
+
+	mapped := map[string]interface{}{}
+	for _, mapping := range mappings {
+		if _, ok := mapped[mapping.target]; ok {
+			continue
+		}
+		if value, ok := lookupPath(payload, mapping.source); ok {
+			mapped[mapping.target] = value
+		}
+	}
+	for _, mapping := range mappings {
+		if root := mapping.source[0]; len(mapping.source) > 1 && requestBodyFields[squashFieldName(root)] == "" {
+			delete(payload, root)
+		}
+	}
+	for target, value := range mapped {
+		if _, sent := payload[target]; !sent {
+			payload[target] = value
+		}
+	}
+
+	mappedData, err := json.Marshal(payload)
+	if err != nil {
+		return data
+	}
+	return mappedData
+}
+
+// lookupPath returns the value at path in value, where a numeric segment indexes an array.
+func lookupPath(value interface{}, path []string) (interface{}, bool) {
+	for _, segment := range path {
+		switch current := value.(type) {
+		case map[string]interface{}:
+			next, ok := current[segment]
+			if !ok {
+				return nil, false
+			}
+			value = next
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(current) {
+				return nil, false
+			}
+			value = current[index]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
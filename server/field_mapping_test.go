@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayloadFieldMapping(t *testing.T) {
+	config := &configuration{
+		PayloadFieldMapping: `{"data.text": "message", "data.room.id": "room_id", "data.space": "space"}`,
+		Spaces:              `[{"name": "HQ", "channel_id": "hq", "rooms": {"room-1": "hq-lounge"}}]`,
+		StrictJSONFields:    true,
+	}
+
+	t.Run("remapped payload is posted to the room's channel", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"data": {"text": "Standup in 5", "room": {"id": "room-1"}, "space": "HQ", "tier": "pro"}}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "hq-lounge", (*posts)[0].ChannelId)
+		assert.Equal(t, "Standup in 5", (*posts)[0].Message)
+	})
+
+	t.Run("fields sent as such win", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id": "channel", "message": "sent", "data": {"text": "mapped"}}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "channel", (*posts)[0].ChannelId)
+		assert.Equal(t, "sent", (*posts)[0].Message)
+	})
+
+	t.Run("unmapped room is rejected", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, config)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"data": {"text": "hi", "room": {"id": "room-9"}}}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), `room \"room-9\" is not mapped to a channel`)
+	})
+
+	t.Run("invalid target is rejected", func(t *testing.T) {
+		err := (&configuration{PayloadFieldMapping: `{"data.text": "body"}`}).process()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `source path "data.text" maps to unknown field "body"`)
+	})
+
+	t.Run("invalid source path is rejected", func(t *testing.T) {
+		assert.Error(t, (&configuration{PayloadFieldMapping: `{"data..text": "message"}`}).process())
+	})
+}
+
+func TestLookupPath(t *testing.T) {
+	payload := map[string]interface{}{
+		"data": map[string]interface{}{
+			"items": []interface{}{map[string]interface{}{"text": "first"}},
+		},
+	}
+
+	value, ok := lookupPath(payload, []string{"data", "items", "0", "text"})
+	assert.True(t, ok)
+	assert.Equal(t, "first", value)
+
+	_, ok = lookupPath(payload, []string{"data", "items", "1", "text"})
+	assert.False(t, ok)
+	_, ok = lookupPath(payload, []string{"data", "missing"})
+	assert.False(t, ok)
+}
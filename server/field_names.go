@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// requestBodyFields maps each RequestBody JSON field name, lower-cased with its underscores
+// removed, to the field name itself, so camelCase spellings can be matched to it.
+var requestBodyFields = jsonFieldNames(reflect.TypeOf(RequestBody{}))
+
+// jsonFieldNames indexes the JSON field names of the struct type t by their squashed form.
+func jsonFieldNames(t reflect.Type) map[string]string {
+	names := map[string]string{}
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			names[squashFieldName(name)] = name
+		}
+	}
+	return names
+}
+
+// squashFieldName lower-cases name and drops its underscores, so channel_id, channelId and
+// channelID all become channelid.
+func squashFieldName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
+
+// UnmarshalJSON decodes a RequestBody, also accepting camelCase spellings of its top-level
+// fields, such as channelId for channel_id, for connectors that cannot emit snake_case. When
+// both spellings of a field are present the snake_case one wins. Nested values such as props
+// and attachments are decoded as sent.
+func (b *RequestBody) UnmarshalJSON(data []byte) error {
+	return decodeRequestBody(data, b, false)
+}
+
+// decodeRequestBody decodes data into body like UnmarshalJSON. With strict set, a field
+// RequestBody does not have, at any depth, is an error naming it.
+func decodeRequestBody(data []byte, body *RequestBody, strict bool) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	// Sorting keeps the outcome deterministic when several spellings of a field are sent.
+	sort.Strings(keys)
+
+	normalized := make(map[string]json.RawMessage, len(fields))
+	for _, key := range keys {
+		name, ok := requestBodyFields[squashFieldName(key)]
+		if !ok || name == key {
+			normalized[key] = fields[key]
+			continue
+		}
+		if _, exact := fields[name]; exact {
+			continue
+		}
+		if _, seen := normalized[name]; !seen {
+			normalized[name] = fields[key]
+		}
+	}
+
+	normalizedData, err := json.Marshal(normalized)
+	if err != nil {
+		return err
+	}
+
+	// plainRequestBody has the fields of RequestBody but not its UnmarshalJSON method, so
+	// decoding into it does not recurse.
+	type plainRequestBody RequestBody
+	decoder := json.NewDecoder(bytes.NewReader(normalizedData))
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+	return decoder.Decode((*plainRequestBody)(body))
+}
+
+// unknownFieldError returns the 400 answered for err when it reports a field rejected by
+// StrictJSONFields, describing it as a field of where, or nil for other errors.
+func unknownFieldError(err error, where string) error {
+	// encoding/json has no error type for unknown fields, so its message is matched instead.
+	const prefix = "json: unknown field "
+	if err == nil || !strings.HasPrefix(err.Error(), prefix) {
+		return nil
+	}
+	return newHTTPError(http.StatusBadRequest, "unknown field %s in %s", strings.TrimPrefix(err.Error(), prefix), where)
+}
+
+// decodeWebhookBody decodes the payload of /webhook into body after applying
+// PayloadFieldMapping, rejecting unknown fields with StrictJSONFields set.
+func (p *Plugin) decodeWebhookBody(data []byte, body *RequestBody) error {
+	config := p.getConfiguration()
+	data = applyFieldMapping(data, config.fieldMappings)
+	err := decodeRequestBody(data, body, config.StrictJSONFields)
+	if fieldErr := unknownFieldError(err, "payload"); fieldErr != nil {
+		return fieldErr
+	}
+	if err != nil {
+		return newHTTPError(http.StatusBadRequest, "invalid JSON payload")
+	}
+	return nil
+}
+
+// decodeBatchBody decodes the payload of /webhook/batch into batch, rejecting unknown fields
+// of the batch and of its messages with StrictJSONFields set.
+func (p *Plugin) decodeBatchBody(data []byte, batch *batchRequestBody) error {
+	if !p.getConfiguration().StrictJSONFields {
+		if err := json.Unmarshal(data, batch); err != nil {
+			return newHTTPError(http.StatusBadRequest, "invalid JSON payload")
+		}
+		return nil
+	}
+
+	// Messages shadows the field of the embedded batchRequestBody, so each message is decoded
+	// strictly on its own below.
+	var raw struct {
+		batchRequestBody
+		Messages []json.RawMessage `json:"messages"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&raw)
+	if fieldErr := unknownFieldError(err, "batch"); fieldErr != nil {
+		return fieldErr
+	}
+	if err != nil {
+		return newHTTPError(http.StatusBadRequest, "invalid JSON payload")
+	}
+
+	*batch = raw.batchRequestBody
+	batch.Messages = make([]*RequestBody, len(raw.Messages))
+	for i, message := range raw.Messages {
+		batch.Messages[i] = &RequestBody{}
+		err = decodeRequestBody(message, batch.Messages[i], true)
+		if fieldErr := unknownFieldError(err, fmt.Sprintf("messages[%d]", i)); fieldErr != nil {
+			return fieldErr
+		}
+		if err != nil {
+			return newHTTPError(http.StatusBadRequest, "invalid JSON payload")
+		}
+	}
+	return nil
+}
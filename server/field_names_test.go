@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestBodyFieldNames(t *testing.T) {
+	decode := func(t *testing.T, data string) *RequestBody {
+		var body RequestBody
+		require.NoError(t, json.Unmarshal([]byte(data), &body))
+		return &body
+	}
+
+	t.Run("snake_case", func(t *testing.T) {
+		body := decode(t, `{"channel_id":"town","root_id":"root","message":"hi","reply_broadcast":true}`)
+		assert.Equal(t, &RequestBody{ChannelID: "town", RootID: "root", Message: "hi", ReplyBroadcast: true}, body)
+	})
+
+	t.Run("camelCase", func(t *testing.T) {
+		body := decode(t, `{"channelId":"town","rootId":"root","message":"hi","replyBroadcast":true,"attachmentURLs":["https://example.com/a.png"]}`)
+		assert.Equal(t, &RequestBody{ChannelID: "town", RootID: "root", Message: "hi", ReplyBroadcast: true, AttachmentURLs: []string{"https://example.com/a.png"}}, body)
+	})
+
+	t.Run("snake_case wins when both are present", func(t *testing.T) {
+		body := decode(t, `{"channelId":"camel","channel_id":"snake","message":"hi"}`)
+		assert.Equal(t, "snake", body.ChannelID)
+	})
+
+	t.Run("props keys are kept as sent", func(t *testing.T) {
+		body := decode(t, `{"channel_id":"town","message":"hi","props":{"complianceTag":"ovice"}}`)
+		assert.Equal(t, map[string]interface{}{"complianceTag": "ovice"}, body.Props)
+	})
+
+	t.Run("camelCase webhook request", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channelId":"town","message":"hi"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "town", (*posts)[0].ChannelId)
+	})
+}
+
+func TestStrictJSONFields(t *testing.T) {
+	strict := &configuration{StrictJSONFields: true}
+
+	t.Run("unknown field is rejected in strict mode", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, strict)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","mesage":"hi"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `unknown field \"mesage\" in payload`)
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("unknown nested field is rejected in strict mode", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, strict)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi","attachments":[{"titel":"HQ"}]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `unknown field \"titel\"`)
+	})
+
+	t.Run("camelCase and props are still accepted in strict mode", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, strict)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channelId":"channel","message":"hi","props":{"anything":1}}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "channel", (*posts)[0].ChannelId)
+	})
+
+	t.Run("unknown field of a batch message is rejected in strict mode", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, strict)
+
+		w := doRequest(p, http.MethodPost, "/webhook/batch", `{"messages":[{"channel_id":"channel","message":"hi"},{"channel_id":"channel","message":"hi","urgent":true}]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `unknown field \"urgent\" in messages[1]`)
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+
+		w = doRequest(p, http.MethodPost, "/webhook/batch", `{"messages":[{"channel_id":"channel","message":"hi"}],"dedup":true}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `unknown field \"dedup\" in batch`)
+	})
+
+	t.Run("unknown field is ignored in lenient mode", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi","urgent":true}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "hi", (*posts)[0].Message)
+	})
+}
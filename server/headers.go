@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// protectedResponseHeaders are set by the plugin itself and cannot be overridden through the
+// ResponseHeaders setting.
+var protectedResponseHeaders = map[string]bool{
+	"Content-Type":           true,
+	"Content-Length":         true,
+	"X-Content-Type-Options": true,
+}
+
+// responseHeader is a single header parsed from the ResponseHeaders setting.
+type responseHeader struct {
+	Name  string
+	Value string
+}
+
+// parseResponseHeaders parses one "Name: value" header per line. Protected headers are dropped
+// and returned separately so the caller can report them.
+func parseResponseHeaders(value string) (headers []responseHeader, ignored []string, err error) {
+	for _, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		name := http.CanonicalHeaderKey(strings.TrimSpace(parts[0]))
+		if len(parts) != 2 || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, nil, errors.Errorf("invalid response header %q, expected Name: value", line)
+		}
+
+		if protectedResponseHeaders[name] {
+			ignored = append(ignored, name)
+			continue
+		}
+		headers = append(headers, responseHeader{Name: name, Value: strings.TrimSpace(parts[1])})
+	}
+	return headers, ignored, nil
+}
+
+// setResponseHeaders applies the configured custom headers to w.
+func (p *Plugin) setResponseHeaders(w http.ResponseWriter) {
+	for _, header := range p.getConfiguration().responseHeaders {
+		w.Header().Set(header.Name, header.Value)
+	}
+}
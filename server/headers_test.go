@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseResponseHeaders(t *testing.T) {
+	headers, ignored, err := parseResponseHeaders("x-service: ovice\n\nCache-Control: no-cache, no-store\ncontent-type: text/plain")
+	require.NoError(t, err)
+	assert.Equal(t, []responseHeader{
+		{Name: "X-Service", Value: "ovice"},
+		{Name: "Cache-Control", Value: "no-cache, no-store"},
+	}, headers)
+	assert.Equal(t, []string{"Content-Type"}, ignored)
+
+	_, _, err = parseResponseHeaders("no colon here")
+	assert.Error(t, err)
+}
+
+func TestCustomResponseHeaders(t *testing.T) {
+	p, api, _ := newTestPlugin(t, &configuration{ResponseHeaders: "X-Service: ovice\nContent-Type: text/plain"})
+	mockCreatePost(api)
+
+	t.Run("custom header is applied", func(t *testing.T) {
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi"}`)
+		assert.Equal(t, "ovice", w.Header().Get("X-Service"))
+
+		w = doRequest(p, http.MethodGet, "/", "")
+		assert.Equal(t, "ovice", w.Header().Get("X-Service"))
+	})
+
+	t.Run("protected header is not overridden", func(t *testing.T) {
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi"}`)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	})
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const testBotUserID = "botuserid"
+
+// memKV is an in-memory stand-in for the plugin KV store, wired into a plugintest.API.
+type memKV struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (kv *memKV) get(key string) []byte {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	return kv.data[key]
+}
+
+func (kv *memKV) keys() []string {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	keys := make([]string, 0, len(kv.data))
+	for key := range kv.data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// mockKV backs every KV method of api with a fresh in-memory store.
+func mockKV(api *plugintest.API) *memKV {
+	kv := &memKV{data: map[string][]byte{}}
+
+	api.On("KVGet", mock.AnythingOfType("string")).Return(func(key string) []byte {
+		return kv.get(key)
+	}, nil).Maybe()
+	api.On("KVSet", mock.AnythingOfType("string"), mock.Anything).Return(func(key string, value []byte) *model.AppError {
+		kv.mu.Lock()
+		defer kv.mu.Unlock()
+		kv.data[key] = value
+		return nil
+	}).Maybe()
+	api.On("KVDelete", mock.AnythingOfType("string")).Return(func(key string) *model.AppError {
+		kv.mu.Lock()
+		defer kv.mu.Unlock()
+		delete(kv.data, key)
+		return nil
+	}).Maybe()
+	api.On("KVSetWithOptions", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(func(key string, value []byte, options model.PluginKVSetOptions) bool {
+		kv.mu.Lock()
+		defer kv.mu.Unlock()
+		if options.Atomic && !bytes.Equal(kv.data[key], options.OldValue) {
+			return false
+		}
+		if value == nil {
+			delete(kv.data, key)
+		} else {
+			kv.data[key] = value
+		}
+		return true
+	}, nil).Maybe()
+
+	api.On("KVList", mock.AnythingOfType("int"), mock.AnythingOfType("int")).Return(func(page, perPage int) []string {
+		keys := kv.keys()
+		start := page * perPage
+		if start >= len(keys) {
+			return []string{}
+		}
+		end := start + perPage
+		if end > len(keys) {
+			end = len(keys)
+		}
+		return keys[start:end]
+	}, nil).Maybe()
+
+	return kv
+}
+
+// allowLogs accepts any log call on api so tests only assert on the behavior they care about.
+func allowLogs(api *plugintest.API) {
+	for _, level := range []string{"LogDebug", "LogInfo", "LogWarn", "LogError"} {
+		for pairs := 0; pairs <= 8; pairs++ {
+			args := []interface{}{mock.AnythingOfType("string")}
+			for i := 0; i < pairs*2; i++ {
+				args = append(args, mock.Anything)
+			}
+			api.On(level, args...).Maybe()
+		}
+	}
+}
+
+// newTestPlugin returns a plugin with the given configuration, backed by a mock API with an
+// in-memory KV store and permissive logging.
+func newTestPlugin(t *testing.T, config *configuration) (*Plugin, *plugintest.API, *memKV) {
+	t.Helper()
+
+	api := &plugintest.API{}
+	t.Cleanup(func() { api.AssertExpectations(t) })
+	kv := mockKV(api)
+	allowLogs(api)
+	api.On("HasPermissionToChannel", testBotUserID, mock.AnythingOfType("string"), model.PermissionCreatePost).Return(true).Maybe()
+	api.On("GetChannel", mock.AnythingOfType("string")).Return(func(channelID string) *model.Channel {
+		return &model.Channel{Id: channelID}
+	}, nil).Maybe()
+
+	p := &Plugin{botUserID: testBotUserID}
+	p.SetAPI(api)
+	if config == nil {
+		config = &configuration{}
+	}
+	require.NoError(t, config.process())
+	p.setConfiguration(config)
+
+	return p, api, kv
+}
+
+// doRequest serves a request against p and returns the recorded response.
+func doRequest(p *Plugin, method, path, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	p.ServeHTTP(nil, w, r)
+	return w
+}
+
+// unmock removes every expectation registered on api for method, so a test can replace a
+// default set up by newTestPlugin.
+func unmock(api *plugintest.API, method string) {
+	calls := api.ExpectedCalls[:0]
+	for _, call := range api.ExpectedCalls {
+		if call.Method != method {
+			calls = append(calls, call)
+		}
+	}
+	api.ExpectedCalls = calls
+}
+
+// mockSiteURL makes api report siteURL as the server's SiteURL.
+func mockSiteURL(api *plugintest.API, siteURL string) {
+	api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: model.NewString(siteURL)}})
+}
+
+// postMatcher matches a *model.Post created in channelID whose message contains substr.
+func postMatcher(channelID, substr string) interface{} {
+	return mock.MatchedBy(func(post *model.Post) bool {
+		return post.ChannelId == channelID && strings.Contains(post.Message, substr)
+	})
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+const (
+	htmlModeLeave  = "leave"
+	htmlModeStrip  = "strip"
+	htmlModeEscape = "escape"
+)
+
+var (
+	// htmlTagPattern matches HTML tags and comments. A tag must start with a letter right after
+	// the "<", so comparisons such as "a < b" or "1<2 and 3>2" are not mistaken for tags.
+	htmlTagPattern = regexp.MustCompile(`<!--[\s\S]*?-->|</?[a-zA-Z][a-zA-Z0-9-]*(?:\s[^<>]*)?/?>`)
+
+	// htmlBreakPattern matches the tags that end a line when HTML is stripped.
+	htmlBreakPattern = regexp.MustCompile(`(?i)<br\s*/?>|</(?:p|div|li|h[1-6])\s*>`)
+)
+
+// sanitizeHTML applies mode to the HTML tags in text. Strip removes them, keeping line breaks
+// and decoding entities such as &amp;; escape encodes them so they show as typed; leave, like an
+// empty mode, returns text unchanged.
+func sanitizeHTML(text, mode string) string {
+	switch mode {
+	case htmlModeStrip:
+		text = htmlBreakPattern.ReplaceAllString(text, "\n")
+		text = htmlTagPattern.ReplaceAllString(text, "")
+		return strings.TrimSpace(html.UnescapeString(text))
+	case htmlModeEscape:
+		return htmlTagPattern.ReplaceAllStringFunc(text, html.EscapeString)
+	default:
+		return text
+	}
+}
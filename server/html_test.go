@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitizeHTML(t *testing.T) {
+	t.Run("strip", func(t *testing.T) {
+		assert.Equal(t, "Meeting at 3pm in HQ", sanitizeHTML(`<p>Meeting at <b>3pm</b> in <a href="https://hq.ovice.in">HQ</a></p>`, htmlModeStrip))
+		assert.Equal(t, "line one\nline two", sanitizeHTML("line one<br/>line two", htmlModeStrip))
+		assert.Equal(t, "Q&A at 3pm", sanitizeHTML("<!-- note -->Q&amp;A at 3pm", htmlModeStrip))
+	})
+
+	t.Run("escape", func(t *testing.T) {
+		assert.Equal(t, "&lt;b&gt;bold&lt;/b&gt; & plain", sanitizeHTML("<b>bold</b> & plain", htmlModeEscape))
+		assert.Equal(t, `&lt;img src=&#34;x.png&#34;/&gt;`, sanitizeHTML(`<img src="x.png"/>`, htmlModeEscape))
+	})
+
+	t.Run("leave", func(t *testing.T) {
+		assert.Equal(t, "<b>bold</b>", sanitizeHTML("<b>bold</b>", htmlModeLeave))
+		assert.Equal(t, "<b>bold</b>", sanitizeHTML("<b>bold</b>", ""))
+	})
+
+	t.Run("comparisons are not tags", func(t *testing.T) {
+		for _, text := range []string{"a < b > c", "1<2 and 3>2", "x <= y", "->", "<3 you"} {
+			assert.Equal(t, text, sanitizeHTML(text, htmlModeStrip), text)
+			assert.Equal(t, text, sanitizeHTML(text, htmlModeEscape), text)
+		}
+	})
+}
+
+func TestChatHTMLMode(t *testing.T) {
+	const event = `{"event":"chat","user_name":"Alice","space_name":"HQ","message":"<b>lunch</b> if a < b"}`
+
+	for mode, expected := range map[string]string{
+		htmlModeStrip:  "Alice in **HQ**: lunch if a < b",
+		htmlModeEscape: "Alice in **HQ**: &lt;b&gt;lunch&lt;/b&gt; if a < b",
+		htmlModeLeave:  "Alice in **HQ**: <b>lunch</b> if a < b",
+	} {
+		t.Run(mode, func(t *testing.T) {
+			p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town", ChatHTMLMode: mode})
+			posts := mockCreatePost(api)
+
+			require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", event).Code)
+			require.Len(t, *posts, 1)
+			assert.Equal(t, expected, (*posts)[0].Message)
+		})
+	}
+
+	t.Run("unknown mode", func(t *testing.T) {
+		assert.Error(t, (&configuration{ChatHTMLMode: "sanitize"}).process())
+	})
+}
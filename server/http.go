@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// maxRequestBodyBytes caps how much of a request body the plugin is willing to read.
+const maxRequestBodyBytes = 1 << 20
+
+// httpError is an error that carries the HTTP status it should be reported with.
+type httpError struct {
+	Status  int
+	Message string
+
+	// Field is the path of the payload field the error is about, e.g. attachments[1].color.
+	// Empty for errors about the payload as a whole.
+	Field string
+}
+
+func (e *httpError) Error() string {
+	return e.Message
+}
+
+func newHTTPError(status int, format string, args ...interface{}) *httpError {
+	return &httpError{Status: status, Message: fmt.Sprintf(format, args...)}
+}
+
+// newValidationError reports a syntactically valid payload that breaks a business rule, which
+// is answered with 422 so clients can tell it apart from malformed JSON (400).
+func newValidationError(format string, args ...interface{}) *httpError {
+	return newHTTPError(http.StatusUnprocessableEntity, format, args...)
+}
+
+// readRequestBody reads the body of r, capped at maxRequestBodyBytes.
+func readRequestBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, "failed to read request body")
+	}
+	return data, nil
+}
+
+// sourceIP returns the client IP of r. X-Forwarded-For is only honored when the request comes
+// from one of the TrustedProxies, since anyone else can set it; the client is then the last hop
+// not added by a trusted proxy.
+func (p *Plugin) sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	trusted := p.getConfiguration().trustedProxies
+	isTrusted := func(address string) bool {
+		ip := net.ParseIP(address)
+		for _, network := range trusted {
+			if ip != nil && network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	forwarded := r.Header.Get("X-Forwarded-For")
+	if forwarded == "" || !isTrusted(host) {
+		return host
+	}
+
+	hops := strings.Split(forwarded, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if !isTrusted(hop) || i == 0 {
+			return hop
+		}
+	}
+	return host
+}
+
+// writeJSON writes v as the JSON body of a response with the given status.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeMethodNotAllowed rejects a request made with a method other than allowed.
+func (p *Plugin) writeMethodNotAllowed(w http.ResponseWriter, allowed string) {
+	w.Header().Set("Allow", allowed)
+	p.writeError(w, newHTTPError(http.StatusMethodNotAllowed, "only %s is supported on this endpoint", allowed))
+}
+
+// writeError reports err to the client. Errors that are not an *httpError are logged and hidden
+// behind a generic 500 so internal details never leak to the caller.
+func (p *Plugin) writeError(w http.ResponseWriter, err error) {
+	herr, ok := err.(*httpError)
+	if !ok {
+		p.API.LogError("Failed to handle request", "err", err.Error())
+		herr = newHTTPError(http.StatusInternalServerError, "internal error")
+	}
+
+	response := map[string]string{"error": herr.Message}
+	if herr.Field != "" {
+		response["field"] = herr.Field
+	}
+	writeJSON(w, herr.Status, response)
+}
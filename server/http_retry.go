@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// defaultOviceRetryBackoff applies when OviceAPIRetryBackoffMs is not configured.
+const defaultOviceRetryBackoff = 500 * time.Millisecond
+
+// retryPolicy controls how an outbound HTTP request is retried after a network error, a 429 or
+// a 5xx response.
+type retryPolicy struct {
+	// Deadline is how long after the first attempt a request may keep being retried; each
+	// attempt is bounded by it too. Zero, the zero value, does not retry.
+	Deadline time.Duration
+
+	// Backoff is the first pause between attempts, doubled after each retry. A Retry-After from
+	// the server replaces it. Zero does not retry.
+	Backoff time.Duration
+
+	// sleep replaces time.Sleep when waiting to retry. Nil uses time.Sleep.
+	sleep func(time.Duration)
+}
+
+// do sends the request built by newRequest with client, retrying it while the policy's deadline
+// allows. The last response or error is returned once no retry is left; a returned response
+// carries an open body, and closing it releases the request's context.
+func (r retryPolicy) do(client *http.Client, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	backoff := r.Backoff
+	start := time.Now()
+	for {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		cancel := func() {}
+		if r.Deadline > 0 {
+			var ctx context.Context
+			ctx, cancel = context.WithDeadline(req.Context(), start.Add(r.Deadline))
+			req = req.WithContext(ctx)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			cancel()
+		} else {
+			resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+		}
+		if err == nil && resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < http.StatusInternalServerError {
+			return resp, nil
+		}
+
+		wait := backoff
+		if resp != nil {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok && retryAfter > 0 {
+				wait = retryAfter
+			}
+		}
+		if wait <= 0 || wait > r.Deadline-time.Since(start) {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		backoff *= 2
+
+		if r.sleep != nil {
+			r.sleep(wait)
+		} else {
+			time.Sleep(wait)
+		}
+	}
+}
+
+// cancelBody cancels the context of its request once the response body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the body and cancels the request's context.
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if wait := at.Sub(now); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// oviceRetryPolicy returns the retry policy of requests to the oVice API and of delivery
+// receipts.
+func (c *configuration) oviceRetryPolicy() retryPolicy {
+	policy := retryPolicy{
+		Deadline: time.Duration(c.OviceAPIDeadlineMs) * time.Millisecond,
+		Backoff:  defaultOviceRetryBackoff,
+	}
+	if c.OviceAPIRetryBackoffMs > 0 {
+		policy.Backoff = time.Duration(c.OviceAPIRetryBackoffMs) * time.Millisecond
+	}
+	return policy
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOviceClientRetry(t *testing.T) {
+	// newClient returns a client for server whose retries record their waits instead of
+	// sleeping.
+	newClient := func(server *httptest.Server, deadline time.Duration) (*oviceClient, *[]time.Duration) {
+		var waits []time.Duration
+		client := newOviceClient(server.URL, "", retryPolicy{
+			Deadline: deadline,
+			Backoff:  100 * time.Millisecond,
+			sleep:    func(d time.Duration) { waits = append(waits, d) },
+		})
+		return client, &waits
+	}
+
+	t.Run("5xx then 200 succeeds", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte(`{"thumbnail_url":"https://cdn.example.com/hq.png"}`))
+		}))
+		defer server.Close()
+		client, waits := newClient(server, time.Second)
+
+		thumbnail, err := client.GetSpaceThumbnail("HQ")
+		require.NoError(t, err)
+		assert.Equal(t, "https://cdn.example.com/hq.png", thumbnail)
+		assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}, *waits)
+	})
+
+	t.Run("Retry-After is respected", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				w.Header().Set("Retry-After", "2")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			_, _ = w.Write([]byte(`{"thumbnail_url":"https://cdn.example.com/hq.png"}`))
+		}))
+		defer server.Close()
+		client, waits := newClient(server, 5*time.Second)
+
+		_, err := client.GetSpaceThumbnail("HQ")
+		require.NoError(t, err)
+		assert.Equal(t, []time.Duration{2 * time.Second}, *waits)
+	})
+
+	t.Run("gives up once the deadline is used up", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+		client, waits := newClient(server, 350*time.Millisecond)
+
+		_, err := client.GetSpaceThumbnail("HQ")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "returned 502")
+		assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}, *waits, "a 400ms wait would exceed the deadline")
+		assert.EqualValues(t, 3, atomic.LoadInt32(&calls))
+	})
+
+	t.Run("deadline counts from the first attempt", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			time.Sleep(100 * time.Millisecond)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+		client, waits := newClient(server, 150*time.Millisecond)
+
+		_, err := client.GetSpaceThumbnail("HQ")
+		require.Error(t, err)
+		assert.Empty(t, *waits, "a 100ms wait would exceed what the slow attempt left of the deadline")
+		assert.EqualValues(t, 1, atomic.LoadInt32(&calls))
+	})
+
+	t.Run("a slow attempt is cut off at the deadline", func(t *testing.T) {
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}))
+		defer server.Close()
+		defer close(release)
+		client, _ := newClient(server, 100*time.Millisecond)
+
+		start := time.Now()
+		_, err := client.GetSpaceThumbnail("HQ")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "context deadline exceeded")
+		assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	})
+
+	t.Run("POST requests are not retried", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+		client, waits := newClient(server, time.Second)
+
+		require.Error(t, client.AcceptKnock("HQ", "Bob", "alice@example.com"))
+		assert.EqualValues(t, 1, atomic.LoadInt32(&calls))
+		assert.Empty(t, *waits)
+	})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	wait, ok := parseRetryAfter("3", now)
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, wait)
+
+	wait, ok = parseRetryAfter(now.Add(90*time.Second).Format(http.TimeFormat), now)
+	assert.True(t, ok)
+	assert.Equal(t, 90*time.Second, wait)
+
+	for _, value := range []string{"", "soon", "-1"} {
+		_, ok = parseRetryAfter(value, now)
+		assert.False(t, ok, value)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// defaultLocale is used when a user's locale has no translations.
+const defaultLocale = "en"
+
+// translations maps a locale to the translation of each English message. Messages are keyed by
+// their English format string, so an untranslated message simply falls back to English.
+var translations = map[string]map[string]string{
+	"ja": {
+		"Available commands:":   "利用可能なコマンド:",
+		"Unknown command `%s`.": "不明なコマンド `%s` です。",
+		"Language `%s` is not supported, so this reply uses `%s`. Supported languages: %s.":      "言語 `%s` はサポートされていないため、`%s` で返信します。サポートされている言語: %s。",
+		"Show the oVice email and space linked to your account":                                  "アカウントにリンクされた oVice のメールアドレスとスペースを表示します",
+		"Show how long an oVice space has been active, e.g. `uptime HQ`":                         "oVice スペースがアクティブになってからの時間を表示します(例: `uptime HQ`)",
+		"Show the link to join an oVice space, e.g. `join HQ`":                                   "oVice スペースに参加するためのリンクを表示します(例: `join HQ`)",
+		"Failed to look up your oVice link. Please try again later.":                             "oVice のリンクを確認できませんでした。しばらくしてからもう一度お試しください。",
+		"Failed to look up your account. Please try again later.":                                "アカウントを確認できませんでした。しばらくしてからもう一度お試しください。",
+		"Your account is linked to the oVice email **%s**.":                                      "あなたのアカウントは oVice のメールアドレス **%s** にリンクされています。",
+		"Your account is not linked to an oVice email, so your Mattermost email **%s** is used.": "あなたのアカウントは oVice のメールアドレスにリンクされていないため、Mattermost のメールアドレス **%s** を使用します。",
+		"Your oVice space: %s":                                 "あなたの oVice スペース: %s",
+		"No oVice space is configured.":                        "oVice スペースが設定されていません。",
+		"Join the oVice space: %s":                             "oVice スペースに参加: %s",
+		"Join **%s**: %s":                                      "**%s** に参加: %s",
+		"Failed to look up the space. Please try again later.": "スペースを確認できませんでした。しばらくしてからもう一度お試しください。",
+		"The space has no active session.":                     "スペースにアクティブなセッションはありません。",
+		"The space **%s** has no active session.":              "スペース **%s** にアクティブなセッションはありません。",
+		"The space has been active for %s.":                    "スペースは %s 前からアクティブです。",
+		"The space **%s** has been active for %s.":             "スペース **%s** は %s 前からアクティブです。",
+		"Show a chart of an oVice space's occupancy over the last day, e.g. `chart HQ`":           "oVice スペースの過去1日の在室人数をグラフで表示します(例: `chart HQ`)",
+		"Not enough occupancy data yet to draw a chart.":                                          "グラフを描くための在室データがまだ足りません。",
+		"Failed to post the occupancy chart. Please try again later.":                             "在室人数のグラフを投稿できませんでした。しばらくしてからもう一度お試しください。",
+		"Post the daily summary of an oVice space and start its counters over, e.g. `summary HQ`": "oVice スペースの日次サマリーを投稿し、集計をリセットします(例: `summary HQ`)",
+		"Daily summary of the space for %s:":                                                      "%s のスペースの日次サマリー:",
+		"Daily summary of **%s** for %s:":                                                         "%[2]s の **%[1]s** の日次サマリー:",
+		"- Joins: %d":                                                                             "- 入室数: %d",
+		"- Unique visitors: %d":                                                                   "- ユニーク訪問者数: %d",
+		"- Peak occupancy: %d":                                                                    "- 最大在室人数: %d",
+		"- Active time: %s":                                                                       "- アクティブ時間: %s",
+		"Export the oVice links and channel mutes of this server (system admins only)":            "このサーバーの oVice のリンクとチャンネルのミュートをエクスポートします(システム管理者のみ)",
+		"Import oVice links and channel mutes exported from another server (system admins only)":  "別のサーバーからエクスポートした oVice のリンクとチャンネルのミュートをインポートします(システム管理者のみ)",
+		"Only system admins can export or import the oVice configuration.":                        "oVice の設定をエクスポート・インポートできるのはシステム管理者のみです。",
+		"Failed to export the oVice configuration. Please try again later.":                       "oVice の設定をエクスポートできませんでした。しばらくしてからもう一度お試しください。",
+		"Run `/%s import` followed by this blob on the other server:":                             "別のサーバーで `/%s import` に続けてこのデータを実行してください:",
+		"Usage: `/%s import <blob>`, with the blob printed by `/%s export`.":                      "使い方: `/%s import <データ>`(データは `/%s export` の出力です)",
+		"The blob is not valid JSON: %s":                                                          "データが正しい JSON ではありません: %s",
+		"Blobs of version %d cannot be imported; export the configuration again.":                 "バージョン %d のデータはインポートできません。もう一度エクスポートしてください。",
+		"Imported %d links and %d muted channels.":                                                "%d 件のリンクと %d 件のミュートされたチャンネルをインポートしました。",
+		"Skipped %d entries:":                                                                     "%d 件をスキップしました:",
+		"link of user `%s`: `%s` is not a valid email":                                            "ユーザー `%s` のリンク: `%s` は正しいメールアドレスではありません",
+		"link of user `%s`: %s":                                                                   "ユーザー `%s` のリンク: %s",
+		"muted channel `%s`: %s":                                                                  "ミュートされたチャンネル `%s`: %s",
+		"it does not exist":                                                                       "存在しません",
+		"failed to look it up":                                                                    "確認できませんでした",
+		"failed to store it":                                                                      "保存できませんでした",
+		"You are sending chat messages in the oVice space too quickly, so some of them were not relayed to Mattermost.": "oVice スペースでのチャットの送信が速すぎるため、一部のメッセージは Mattermost に転送されませんでした。",
+		"You are sending chat messages in **%s** too quickly, so some of them were not relayed to Mattermost.":          "**%s** でのチャットの送信が速すぎるため、一部のメッセージは Mattermost に転送されませんでした。",
+		"Post a yes/no poll to the channel, e.g. `poll Should we keep the space open?`":                                 "チャンネルに賛否の投票を投稿します(例: `poll スペースを開けたままにしますか?`)",
+		"Usage: `/%s poll <question>`":                     "使い方: `/%s poll <質問>`",
+		"Failed to post the poll. Please try again later.": "投票を投稿できませんでした。しばらくしてからもう一度お試しください。",
+		"Preview the presence notification of a user in this channel, e.g. `simulate enter @alice HQ` (system admins only)": "このチャンネルでユーザーの入退室通知をプレビューします(例: `simulate enter @alice HQ`、システム管理者のみ)",
+		"Only system admins can simulate presence events.":                                                                  "入退室イベントをシミュレートできるのはシステム管理者のみです。",
+		"Usage: `/%s simulate enter|leave @user [space]`":                                                                   "使い方: `/%s simulate enter|leave @ユーザー [スペース]`",
+		"User @%s does not exist.":                                                                                          "ユーザー @%s は存在しません。",
+		"Failed to look up the user. Please try again later.":                                                               "ユーザーを確認できませんでした。しばらくしてからもう一度お試しください。",
+		"@%s is deactivated, so their presence would not be announced.":                                                     "@%s は無効化されているため、入退室は通知されません。",
+		"Failed to post the simulated event. Please try again later.":                                                       "シミュレートしたイベントを投稿できませんでした。しばらくしてからもう一度お試しください。",
+		"Send feedback to the moderators of this team, e.g. `feedback The HQ link is broken`":                               "このチームのモデレーターにフィードバックを送ります(例: `feedback HQ のリンクが壊れています`)",
+		"Usage: `/%s feedback <message>`":                                                                                   "使い方: `/%s feedback <メッセージ>`",
+		"Feedback is not set up on this server. Please ask a system admin to configure a feedback channel.":                 "このサーバーではフィードバックが設定されていません。システム管理者にフィードバックチャンネルの設定を依頼してください。",
+		"Failed to send your feedback. Please try again later.":                                                             "フィードバックを送信できませんでした。しばらくしてからもう一度お試しください。",
+		"Thanks, your feedback was sent.":                                                                                   "フィードバックを送信しました。ありがとうございます。",
+		"You are not allowed to run `/%s %s`. Please ask a system admin for access.":                                        "`/%s %s` を実行する権限がありません。システム管理者に依頼してください。",
+		"Posted.":              "投稿しました。",
+		"Posted: %s":           "投稿しました: %s",
+		"Posted to **%s**.":    "**%s** に投稿しました。",
+		"Posted to **%s**: %s": "**%s** に投稿しました: %s",
+		"Yes: %d · No: %d":     "はい: %d · いいえ: %d",
+		"Yes":                  "はい",
+		"No":                   "いいえ",
+		"Failed to record your vote. Please try again.":                 "投票を記録できませんでした。もう一度お試しください。",
+		"Failed to post the daily summary. Please try again later.":     "日次サマリーを投稿できませんでした。しばらくしてからもう一度お試しください。",
+		"Occupancy of the space over the last 24 hours, peaking at %d.": "過去24時間のスペースの在室人数(最大 %d 人)。",
+		"Occupancy of **%s** over the last 24 hours, peaking at %d.":    "過去24時間の **%s** の在室人数(最大 %d 人)。",
+		"Mute oVice presence and chat notifications in this channel":    "このチャンネルの oVice の在室・チャット通知をミュートします",
+		"Unmute oVice presence and chat notifications in this channel":  "このチャンネルの oVice の在室・チャット通知のミュートを解除します",
+		"Failed to update your token. Please try again later.":          "トークンを更新できませんでした。しばらくしてからもう一度お試しください。",
+		"Your personal token was revoked.":                              "個人用トークンを無効にしました。",
+		"Your personal token is `%s`. Keep it secret: it lets any app send you direct messages from the oVice bot. Running this command again replaces it, and `/%s token revoke` revokes it.": "個人用トークンは `%s` です。このトークンがあればどのアプリからでも oVice ボットからあなたにダイレクトメッセージを送れるので、他人に知られないようにしてください。このコマンドをもう一度実行すると新しいトークンに置き換わり、`/%s token revoke` で無効にできます。",
+		"Get a personal token that lets your apps send you direct messages from the bot, or `token revoke` it":                                                                                 "アプリからボット経由で自分にダイレクトメッセージを送るための個人用トークンを発行し、`token revoke` で無効にします",
+		"Check how many of a list of oVice emails match a Mattermost account (system admins only)":                                                                                             "oVice のメールアドレスの一覧のうち、Mattermost のアカウントと一致するものの数を確認します(システム管理者のみ)",
+		"Only system admins can check the oVice email mapping.":                                                                                                                                "oVice のメールアドレスの対応を確認できるのはシステム管理者だけです。",
+		"Usage: `/%s check-mapping <emails>`, with one email per line.":                                                                                                                        "使い方: `/%s check-mapping <メールアドレス>`(1 行に 1 つ)",
+		"At most %d emails can be checked at once.":                                                                                                                                            "一度に確認できるメールアドレスは %d 件までです。",
+		"Failed to look up the emails. Please try again later.":                                                                                                                                "メールアドレスを確認できませんでした。しばらくしてからもう一度お試しください。",
+		"%d of %d emails match a Mattermost account.":                                                                                                                                          "%[2]d 件中 %[1]d 件のメールアドレスが Mattermost のアカウントと一致しました。",
+		"Unmatched emails:": "一致しなかったメールアドレス:",
+		"…and %d more.":     "…ほか %d 件",
+		"Only channel admins can mute or unmute oVice notifications.":        "oVice の通知をミュート・解除できるのはチャンネル管理者だけです。",
+		"Failed to update the channel. Please try again later.":              "チャンネルを更新できませんでした。しばらくしてからもう一度お試しください。",
+		"oVice presence and chat notifications are muted in this channel.":   "このチャンネルの oVice の在室・チャット通知をミュートしました。",
+		"oVice presence and chat notifications are unmuted in this channel.": "このチャンネルの oVice の在室・チャット通知のミュートを解除しました。",
+	},
+}
+
+// translate formats the translation of message for locale, falling back to English.
+func translate(locale, message string, args ...interface{}) string {
+	if translated, ok := translations[locale][message]; ok {
+		message = translated
+	}
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
+
+// supportedLocale maps a locale such as "ja" or "ja-JP" onto one the plugin has translations
+// for, reporting false if there is none.
+func supportedLocale(locale string) (string, bool) {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if locale == defaultLocale {
+		return locale, true
+	}
+	if _, ok := translations[locale]; ok {
+		return locale, true
+	}
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		return supportedLocale(locale[:i])
+	}
+	return "", false
+}
+
+// supportedLocales lists every locale the plugin can reply in.
+func supportedLocales() []string {
+	locales := []string{defaultLocale}
+	for locale := range translations {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// resolveUserLocale returns the supported locale closest to the user's Mattermost language.
+func (p *Plugin) resolveUserLocale(userID string) string {
+	user, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		p.API.LogDebug("Failed to get user locale", "user_id", userID, "err", appErr.Error())
+		return defaultLocale
+	}
+	if locale, ok := supportedLocale(user.Locale); ok {
+		return locale
+	}
+	return defaultLocale
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	// idempotencyKeyHeader lets a client retry a request without creating a duplicate post.
+	idempotencyKeyHeader = "Idempotency-Key"
+
+	// deliveryAttemptHeader is set by oVice to the 1-based attempt number of a delivery.
+	deliveryAttemptHeader = "X-Ovice-Delivery-Attempt"
+
+	// idempotencyTTL is how long the result of a processed request is remembered.
+	idempotencyTTL = 24 * time.Hour
+
+	// idempotencyPendingTTL is how long a claimed key holds off retries when the request that
+	// claimed it never finishes, e.g. because the plugin restarted mid-request.
+	idempotencyPendingTTL = 5 * time.Minute
+)
+
+// parseDeliveryAttempt returns the delivery attempt reported by oVice, treating a missing or
+// malformed header as the first attempt.
+func parseDeliveryAttempt(value string) int {
+	attempt, err := strconv.Atoi(value)
+	if err != nil || attempt < 1 {
+		return 1
+	}
+	return attempt
+}
+
+// idempotencyRecord is the result of a processed request, stored under its idempotency key.
+type idempotencyRecord struct {
+	Response *webhookResponse `json:"response"`
+
+	// Batch is the result of a category request, which posts once per channel. Response is nil
+	// in its record.
+	Batch *batchResponse `json:"batch,omitempty"`
+
+	// Pending marks a key claimed by a request that is still being processed. Its Response is
+	// nil until the request finishes.
+	Pending bool `json:"pending,omitempty"`
+
+	// BodyHash is the hash of the request body, so a key reused for a different request can be
+	// told apart from a retry. Records stored before it was introduced have none.
+	BodyHash  string `json:"body_hash,omitempty"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// hashRequestBody returns the hash of a request body stored in an idempotencyRecord.
+func hashRequestBody(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// claimIdempotencyKey atomically claims an idempotency key for the request being processed,
+// returning nil if it was claimed, or the cached record if the key was already processed.
+// Replaying the key with a body other than the one it was first used with is a client bug,
+// reported as a 409, as is replaying it while the first request is still being processed.
+func (p *Plugin) claimIdempotencyKey(key, bodyHash string) (*idempotencyRecord, error) {
+	pending, err := json.Marshal(&idempotencyRecord{
+		Pending:   true,
+		BodyHash:  bodyHash,
+		ExpiresAt: model.GetMillisForTime(time.Now().Add(idempotencyPendingTTL)),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode idempotency record")
+	}
+
+	kvKey := hashedKey(idempotencyKeyPrefix, key)
+	for attempt := 0; attempt < kvUpdateAttempts; attempt++ {
+		claimed, appErr := p.API.KVSetWithOptions(kvKey, pending, model.PluginKVSetOptions{
+			Atomic:          true,
+			OldValue:        nil,
+			ExpireInSeconds: int64(idempotencyPendingTTL / time.Second),
+		})
+		if appErr != nil {
+			return nil, errors.Wrap(appErr, "failed to claim idempotency key")
+		}
+		if claimed {
+			return nil, nil
+		}
+
+		data, appErr := p.API.KVGet(kvKey)
+		if appErr != nil {
+			return nil, errors.Wrap(appErr, "failed to get idempotency record")
+		}
+		if data == nil {
+			// The record expired or was released since the claim failed; claim it again.
+			continue
+		}
+
+		var record idempotencyRecord
+		if err = json.Unmarshal(data, &record); err != nil {
+			return nil, errors.Wrap(err, "failed to decode idempotency record")
+		}
+		if record.BodyHash != "" && record.BodyHash != bodyHash {
+			return nil, newHTTPError(http.StatusConflict, "Idempotency-Key %q was already used with a different request body", key)
+		}
+		if record.Pending {
+			return nil, newHTTPError(http.StatusConflict, "a request with Idempotency-Key %q is still being processed", key)
+		}
+		return &record, nil
+	}
+	return nil, errors.Errorf("failed to claim idempotency key after %d attempts", kvUpdateAttempts)
+}
+
+// writeCachedResponse answers a retried request with the result stored for its idempotency key.
+func writeCachedResponse(w http.ResponseWriter, record *idempotencyRecord) {
+	if record.Batch != nil {
+		writeJSON(w, record.Batch.status(), record.Batch)
+		return
+	}
+	writeJSON(w, http.StatusOK, record.Response)
+}
+
+// releaseIdempotencyKey gives up the claim on a key whose request did not produce a response
+// worth caching, so a retry is processed again.
+func (p *Plugin) releaseIdempotencyKey(key string) {
+	if appErr := p.API.KVDelete(hashedKey(idempotencyKeyPrefix, key)); appErr != nil {
+		p.API.LogWarn("Failed to release idempotency key", "idempotency_key", key, "err", appErr.Error())
+	}
+}
+
+// storeIdempotentResponse remembers the result of a successfully processed request, its
+// Response or Batch, under the key it claimed.
+func (p *Plugin) storeIdempotentResponse(key string, record *idempotencyRecord) error {
+	record.ExpiresAt = model.GetMillisForTime(time.Now().Add(idempotencyTTL))
+	data, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode idempotency record")
+	}
+
+	if _, appErr := p.API.KVSetWithOptions(hashedKey(idempotencyKeyPrefix, key), data, model.PluginKVSetOptions{
+		ExpireInSeconds: int64(idempotencyTTL / time.Second),
+	}); appErr != nil {
+		return errors.Wrap(appErr, "failed to store idempotency record")
+	}
+	return nil
+}
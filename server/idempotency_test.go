@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDeliveryAttempt(t *testing.T) {
+	assert.Equal(t, 1, parseDeliveryAttempt(""))
+	assert.Equal(t, 1, parseDeliveryAttempt("zero"))
+	assert.Equal(t, 1, parseDeliveryAttempt("0"))
+	assert.Equal(t, 3, parseDeliveryAttempt("3"))
+}
+
+func TestWebhookDeliveryAttempts(t *testing.T) {
+	const body = `{"channel_id":"channel","message":"hello"}`
+
+	sendBody := func(p *Plugin, key, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set(idempotencyKeyHeader, key)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, r)
+		return w
+	}
+	send := func(p *Plugin, attempt string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set(idempotencyKeyHeader, "delivery-1")
+		r.Header.Set(deliveryAttemptHeader, attempt)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, r)
+		return w
+	}
+
+	t.Run("first attempt posts and caches the result", func(t *testing.T) {
+		p, api, kv := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+
+		w := send(p, "1")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, *posts, 1)
+		assert.NotNil(t, kv.get(hashedKey(idempotencyKeyPrefix, "delivery-1")))
+	})
+
+	t.Run("retry of a processed key returns the cached result", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+
+		first := send(p, "1")
+		retry := send(p, "2")
+		require.Equal(t, http.StatusOK, retry.Code)
+		assert.Len(t, *posts, 1)
+		assert.JSONEq(t, first.Body.String(), retry.Body.String())
+	})
+
+	t.Run("key reused with a different body is a conflict", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+
+		require.Equal(t, http.StatusOK, sendBody(p, "delivery-1", body).Code)
+		w := sendBody(p, "delivery-1", `{"channel_id":"channel","message":"goodbye"}`)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), "different request body")
+		assert.Len(t, *posts, 1)
+	})
+
+	t.Run("key still being processed is a conflict", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		claimed, err := p.claimIdempotencyKey("delivery-1", hashRequestBody([]byte(body)))
+		require.NoError(t, err)
+		require.Nil(t, claimed)
+
+		w := send(p, "2")
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), "still being processed")
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("failed request releases its key", func(t *testing.T) {
+		p, api, kv := newTestPlugin(t, nil)
+		api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(nil, &model.AppError{StatusCode: http.StatusBadRequest, Message: "boom"}).Once()
+		posts := mockCreatePost(api)
+
+		require.NotEqual(t, http.StatusOK, send(p, "1").Code)
+		assert.Nil(t, kv.get(hashedKey(idempotencyKeyPrefix, "delivery-1")))
+
+		require.Equal(t, http.StatusOK, send(p, "2").Code)
+		assert.Len(t, *posts, 1)
+	})
+
+	t.Run("fresh key posts again", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+
+		require.Equal(t, http.StatusOK, sendBody(p, "delivery-1", body).Code)
+		require.Equal(t, http.StatusOK, sendBody(p, "delivery-2", `{"channel_id":"channel","message":"goodbye"}`).Code)
+		assert.Len(t, *posts, 2)
+	})
+}
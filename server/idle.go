@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+// inactivityCheckInterval is how often empty spaces are checked against
+// InactivityReminderMinutes.
+const inactivityCheckInterval = time.Minute
+
+// idleSpace records since when a space has been empty and whether the reminder for this empty
+// spell was posted. It is deleted as soon as someone enters the space.
+type idleSpace struct {
+	SpaceName  string `json:"space_name"`
+	EmptySince int64  `json:"empty_since"`
+	Reminded   bool   `json:"reminded,omitempty"`
+}
+
+// workingHours is a daily window given in minutes after midnight, start inclusive and end
+// exclusive.
+type workingHours struct {
+	start, end int
+}
+
+// parseWorkingHours parses a window such as "09:00-18:00". Empty means no window.
+func parseWorkingHours(value string) (*workingHours, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(value, "-")
+	if len(parts) != 2 {
+		return nil, errors.Errorf("%q is not of the form HH:MM-HH:MM", value)
+	}
+	start, err := parseClock(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseClock(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	if start >= end {
+		return nil, errors.Errorf("%q must end after it starts", value)
+	}
+	return &workingHours{start: start, end: end}, nil
+}
+
+// parseClock parses a time of day such as "09:30" into minutes after midnight. "24:00" is
+// accepted as the end of the day.
+func parseClock(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return 0, errors.Errorf("invalid time of day %q", value)
+	}
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, errors.Errorf("invalid time of day %q", value)
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil || hours < 0 || minutes < 0 || minutes > 59 || hours*60+minutes > 24*60 {
+		return 0, errors.Errorf("invalid time of day %q", value)
+	}
+	return hours*60 + minutes, nil
+}
+
+// windowStart returns when the window containing now began, reporting false if now is outside
+// the window. A nil window covers the whole day and began at the zero time.
+func (w *workingHours) windowStart(now time.Time) (time.Time, bool) {
+	if w == nil {
+		return time.Time{}, true
+	}
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	minute := now.Hour()*60 + now.Minute()
+	if minute < w.start || minute >= w.end {
+		return time.Time{}, false
+	}
+	return midnight.Add(time.Duration(w.start) * time.Minute), true
+}
+
+// idleKey returns the KV key of the idle record of the named space.
+func idleKey(spaceName string) string {
+	return hashedKey(idleKeyPrefix, strings.ToLower(spaceName))
+}
+
+// trackIdle starts the idle record of a space that just emptied, or clears it once the space
+// has occupants again so the next empty spell can be reminded about.
+func (p *Plugin) trackIdle(spaceName string, occupants int, now time.Time) error {
+	if occupants > 0 {
+		if appErr := p.API.KVDelete(idleKey(spaceName)); appErr != nil {
+			return errors.Wrap(appErr, "failed to clear idle space")
+		}
+		return nil
+	}
+	if p.getConfiguration().InactivityReminderMinutes == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(idleSpace{SpaceName: spaceName, EmptySince: now.UnixNano() / int64(time.Millisecond)})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode idle space")
+	}
+	if appErr := p.API.KVSet(idleKey(spaceName), data); appErr != nil {
+		return errors.Wrap(appErr, "failed to store idle space")
+	}
+	return nil
+}
+
+// checkInactivity posts a reminder for every space that has been empty for
+// InactivityReminderMinutes of the current InactivityWorkingHours window. Each empty spell is
+// reminded about once.
+func (p *Plugin) checkInactivity(now time.Time) error {
+	config := p.getConfiguration()
+	if config.InactivityReminderMinutes == 0 {
+		return nil
+	}
+	windowStart, ok := config.workingHours.windowStart(now.In(config.summaryLocation()))
+	if !ok {
+		return nil
+	}
+	threshold := time.Duration(config.InactivityReminderMinutes) * time.Minute
+
+	keys, err := p.kvListKeys(idleKeyPrefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		data, appErr := p.API.KVGet(key)
+		if appErr != nil {
+			p.API.LogWarn("Failed to get idle space", "key", key, "err", appErr.Error())
+			continue
+		}
+		if data == nil {
+			continue
+		}
+		var idle idleSpace
+		if err = json.Unmarshal(data, &idle); err != nil {
+			p.API.LogWarn("Failed to decode idle space", "key", key, "err", err.Error())
+			continue
+		}
+		if idle.Reminded {
+			continue
+		}
+
+		// Only the empty time within the current window counts, so a space left empty overnight
+		// is not reminded about the moment working hours begin.
+		emptySince := time.Unix(0, idle.EmptySince*int64(time.Millisecond))
+		if emptySince.Before(windowStart) {
+			emptySince = windowStart
+		}
+		if now.Sub(emptySince) < threshold {
+			continue
+		}
+
+		if err = p.postInactivityReminder(&idle, now); err != nil {
+			p.API.LogWarn("Failed to post inactivity reminder", "space_name", idle.SpaceName, "err", err.Error())
+			continue
+		}
+
+		// The record is only marked if it still describes the same empty spell.
+		idle.Reminded = true
+		reminded, err := json.Marshal(idle)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode idle space")
+		}
+		if _, appErr = p.API.KVSetWithOptions(key, reminded, model.PluginKVSetOptions{Atomic: true, OldValue: data}); appErr != nil {
+			p.API.LogWarn("Failed to mark idle space as reminded", "key", key, "err", appErr.Error())
+		}
+	}
+	return nil
+}
+
+// postInactivityReminder nudges the channel of an empty space to join it.
+func (p *Plugin) postInactivityReminder(idle *idleSpace, now time.Time) error {
+	channelID := p.resolveSpaceChannelID(idle.SpaceName, "")
+	if channelID == "" {
+		return errors.New("no channel is configured for the space")
+	}
+
+	space := "the oVice space"
+	if idle.SpaceName != "" {
+		space = "**" + idle.SpaceName + "**"
+	}
+	minutes := int(now.Sub(time.Unix(0, idle.EmptySince*int64(time.Millisecond))) / time.Minute)
+	message := fmt.Sprintf("Nobody has been in %s for %d minutes. Why not jump in?", space, minutes)
+	if url := p.resolveSpaceURL(idle.SpaceName); url != "" {
+		message += "\n— [Join the space](" + url + ")"
+	}
+
+	if _, appErr := p.createPost(&model.Post{
+		UserId:    p.botUserIDForSpace(idle.SpaceName),
+		ChannelId: channelID,
+		Message:   message,
+	}); appErr != nil {
+		return errors.Wrap(appErr, "failed to create inactivity reminder")
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInactivityReminder(t *testing.T) {
+	config := &configuration{
+		DefaultChannelID:          "town",
+		SpaceURL:                  "https://example.ovice.in",
+		InactivityReminderMinutes: 30,
+	}
+	start := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	enter := &presenceEvent{Event: presenceEventEnter, UserName: "Alice", SpaceName: "HQ"}
+	leave := &presenceEvent{Event: presenceEventLeave, UserName: "Alice", SpaceName: "HQ"}
+
+	t.Run("reminds once the space has been empty past the threshold", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		posts := mockCreatePost(api)
+		require.NoError(t, p.trackOccupancy(enter, start))
+		require.NoError(t, p.trackOccupancy(leave, start))
+
+		require.NoError(t, p.checkInactivity(start.Add(29*time.Minute)))
+		assert.Empty(t, *posts)
+
+		require.NoError(t, p.checkInactivity(start.Add(30*time.Minute)))
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "town", (*posts)[0].ChannelId)
+		assert.Equal(t, testBotUserID, (*posts)[0].UserId)
+		assert.Equal(t, "Nobody has been in **HQ** for 30 minutes. Why not jump in?\n— [Join the space](https://example.ovice.in)", (*posts)[0].Message)
+	})
+
+	t.Run("does not repeat while the space stays empty", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		posts := mockCreatePost(api)
+		require.NoError(t, p.trackOccupancy(enter, start))
+		require.NoError(t, p.trackOccupancy(leave, start))
+
+		require.NoError(t, p.checkInactivity(start.Add(30*time.Minute)))
+		require.NoError(t, p.checkInactivity(start.Add(time.Hour)))
+		require.NoError(t, p.checkInactivity(start.Add(5*time.Hour)))
+		assert.Len(t, *posts, 1)
+	})
+
+	t.Run("resets once someone enters and the space empties again", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		posts := mockCreatePost(api)
+		require.NoError(t, p.trackOccupancy(enter, start))
+		require.NoError(t, p.trackOccupancy(leave, start))
+		require.NoError(t, p.checkInactivity(start.Add(30*time.Minute)))
+		require.Len(t, *posts, 1)
+
+		require.NoError(t, p.trackOccupancy(enter, start.Add(time.Hour)))
+		require.NoError(t, p.checkInactivity(start.Add(2*time.Hour)))
+		assert.Len(t, *posts, 1, "an occupied space is not reminded about")
+
+		require.NoError(t, p.trackOccupancy(leave, start.Add(2*time.Hour)))
+		require.NoError(t, p.checkInactivity(start.Add(2*time.Hour+29*time.Minute)))
+		assert.Len(t, *posts, 1)
+		require.NoError(t, p.checkInactivity(start.Add(2*time.Hour+30*time.Minute)))
+		assert.Len(t, *posts, 2)
+	})
+
+	t.Run("only empty time within working hours counts", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{
+			DefaultChannelID:          "town",
+			InactivityReminderMinutes: 30,
+			InactivityWorkingHours:    "09:00-18:00",
+			SummaryTimezone:           "Asia/Tokyo",
+		})
+		posts := mockCreatePost(api)
+		tokyo, err := time.LoadLocation("Asia/Tokyo")
+		require.NoError(t, err)
+		evening := time.Date(2022, 3, 1, 17, 50, 0, 0, tokyo)
+		require.NoError(t, p.trackOccupancy(enter, evening))
+		require.NoError(t, p.trackOccupancy(leave, evening))
+
+		require.NoError(t, p.checkInactivity(evening.Add(time.Hour)))
+		assert.Empty(t, *posts, "no reminder outside working hours")
+
+		morning := time.Date(2022, 3, 2, 9, 0, 0, 0, tokyo)
+		require.NoError(t, p.checkInactivity(morning.Add(29*time.Minute)))
+		assert.Empty(t, *posts)
+		require.NoError(t, p.checkInactivity(morning.Add(30*time.Minute)))
+		assert.Len(t, *posts, 1)
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		p, api, kv := newTestPlugin(t, &configuration{DefaultChannelID: "town"})
+		require.NoError(t, p.trackOccupancy(enter, start))
+		require.NoError(t, p.trackOccupancy(leave, start))
+
+		require.NoError(t, p.checkInactivity(start.Add(24*time.Hour)))
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+		assert.NotContains(t, kv.data, idleKey("HQ"))
+	})
+}
+
+func TestParseWorkingHours(t *testing.T) {
+	hours, err := parseWorkingHours("09:00-17:30")
+	require.NoError(t, err)
+	assert.Equal(t, &workingHours{start: 9 * 60, end: 17*60 + 30}, hours)
+
+	hours, err = parseWorkingHours("")
+	require.NoError(t, err)
+	assert.Nil(t, hours)
+
+	for _, value := range []string{"9-17", "18:00-09:00", "09:00-25:00", "09:60-10:00", "09:00"} {
+		_, err = parseWorkingHours(value)
+		assert.Error(t, err, value)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import "github.com/mattermost/mattermost-server/v6/model"
+
+const (
+	// fromWebhookProp marks a post as made by an integration, which Mattermost shows with a BOT
+	// tag and search clients can filter on.
+	fromWebhookProp = "from_webhook"
+
+	// fromBotProp marks a post as made by a bot.
+	fromBotProp = "from_bot"
+)
+
+// markIntegrationPost sets the props MarkIntegrationPosts and MarkPostsFromBot ask for on post.
+func (p *Plugin) markIntegrationPost(post *model.Post) {
+	config := p.getConfiguration()
+	if config.MarkIntegrationPosts {
+		post.AddProp(fromWebhookProp, "true")
+	}
+	if config.MarkPostsFromBot {
+		post.AddProp(fromBotProp, "true")
+	}
+}
+
+// createIntegrationPost marks post as an integration post and creates it, so every post of the
+// plugin can be told apart from those of people.
+func (p *Plugin) createIntegrationPost(post *model.Post) (*model.Post, *model.AppError) {
+	p.markIntegrationPost(post)
+	return p.API.CreatePost(post)
+}
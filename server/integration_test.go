@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarkIntegrationPosts(t *testing.T) {
+	config := &configuration{DefaultChannelID: "town", MarkIntegrationPosts: true, MarkPostsFromBot: true}
+
+	for name, tc := range map[string]struct {
+		path string
+		body string
+	}{
+		"webhook":  {"/webhook", `{"channel_id":"channel","message":"hi"}`},
+		"split":    {"/webhook", `{"channel_id":"channel","message":"` + "0123456789abcdef" + `","split":true}`},
+		"presence": {"/events", `{"event":"enter","user_email":"alice@example.com","space_name":"HQ"}`},
+		"chat":     {"/events", `{"event":"chat","user_name":"Alice","space_name":"HQ","message":"hi"}`},
+	} {
+		t.Run(name, func(t *testing.T) {
+			config := *config
+			if name == "split" {
+				config.MaxMessageLength = 10
+			}
+			p, api, _ := newTestPlugin(t, &config)
+			if name == "presence" {
+				api.On("GetUserByEmail", "alice@example.com").Return(&model.User{Id: "alice", Username: "alice"}, nil)
+				mockSiteURL(api, "")
+			}
+			posts := mockCreatePost(api)
+
+			w := doRequest(p, http.MethodPost, tc.path, tc.body)
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			require.NotEmpty(t, *posts)
+			for _, post := range *posts {
+				assert.Equal(t, "true", post.GetProp(fromWebhookProp))
+				assert.Equal(t, "true", post.GetProp(fromBotProp))
+			}
+		})
+	}
+
+	t.Run("coalesced presence", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		posts := mockCreatePost(api)
+
+		p.postPresenceBatch(&presenceBatch{
+			channelID: "town",
+			authorID:  testBotUserID,
+			spaceName: "HQ",
+			events: []*presenceEvent{
+				{Event: presenceEventEnter, UserName: "Alice", SpaceName: "HQ"},
+				{Event: presenceEventEnter, UserName: "Bob", SpaceName: "HQ"},
+			},
+			users: []*model.User{nil, nil},
+		})
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "true", (*posts)[0].GetProp(fromWebhookProp))
+	})
+
+	t.Run("posts are unmarked by default", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town"})
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/events", `{"event":"chat","user_name":"Alice","space_name":"HQ","message":"hi"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Nil(t, (*posts)[0].GetProp(fromWebhookProp))
+		assert.Nil(t, (*posts)[0].GetProp(fromBotProp))
+	})
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// joinLinkTTL is how long a signed join link stays valid after it is minted.
+const joinLinkTTL = 10 * time.Minute
+
+// joinClaims is the payload of a signed join link: who it was minted for, which space it opens
+// and until when.
+type joinClaims struct {
+	UserID    string `json:"uid"`
+	SpaceName string `json:"space,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// signJoinToken returns claims encoded and signed with key as "<payload>.<signature>".
+func signJoinToken(key []byte, claims *joinClaims) (string, error) {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode join claims")
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(joinTokenMAC(key, payload)), nil
+}
+
+// parseJoinToken verifies a token made by signJoinToken and returns its claims, rejecting
+// tampered and expired tokens.
+func parseJoinToken(key []byte, token string, now time.Time) (*joinClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, newHTTPError(http.StatusBadRequest, "malformed join token")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, joinTokenMAC(key, parts[0])) {
+		return nil, newHTTPError(http.StatusForbidden, "invalid join token")
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, "malformed join token")
+	}
+	var claims joinClaims
+	if err = json.Unmarshal(data, &claims); err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, "malformed join token")
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, newHTTPError(http.StatusGone, "join link has expired")
+	}
+	return &claims, nil
+}
+
+func joinTokenMAC(key []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// mintJoinURL returns a signed link that lets userID into the named space for joinLinkTTL, or an
+// empty string when JoinLinkSecret or the server's SiteURL is not configured.
+func (p *Plugin) mintJoinURL(userID, spaceName string, now time.Time) (string, error) {
+	config := p.getConfiguration()
+	if config.JoinLinkSecret == "" {
+		return "", nil
+	}
+	siteURL := p.API.GetConfig().ServiceSettings.SiteURL
+	if siteURL == nil || *siteURL == "" {
+		return "", nil
+	}
+
+	token, err := signJoinToken([]byte(config.JoinLinkSecret), &joinClaims{
+		UserID:    userID,
+		SpaceName: spaceName,
+		ExpiresAt: now.Add(joinLinkTTL).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(*siteURL, "/") + config.endpointPath("/join/verify") + "?token=" + url.QueryEscape(token), nil
+}
+
+// handleJoinVerify redirects the user a valid signed join link was minted for to the space it
+// opens. The link only works in that user's logged-in session, so a forwarded link is refused.
+func (p *Plugin) handleJoinVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		p.writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		p.writeError(w, newHTTPError(http.StatusUnauthorized, "not authorized"))
+		return
+	}
+
+	config := p.getConfiguration()
+	if config.JoinLinkSecret == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	claims, err := parseJoinToken([]byte(config.JoinLinkSecret), r.URL.Query().Get("token"), time.Now())
+	if err != nil {
+		p.writeError(w, err)
+		return
+	}
+	if claims.UserID != userID {
+		p.writeError(w, newHTTPError(http.StatusForbidden, "this join link was issued to another user"))
+		return
+	}
+
+	spaceURL := p.resolveSpaceURL(claims.SpaceName)
+	if spaceURL == "" {
+		p.writeError(w, newHTTPError(http.StatusNotFound, "the space of this join link is no longer configured"))
+		return
+	}
+
+	p.API.LogInfo("Verified oVice join link", "user_id", claims.UserID, "space_name", claims.SpaceName)
+	http.Redirect(w, r, spaceURL, http.StatusFound)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	root "github.com/mattermost/mattermost-plugin-starter-template"
+)
+
+func TestJoinLink(t *testing.T) {
+	config := &configuration{SpaceURL: "https://hq.ovice.in", Spaces: `[{"name":"Lab","url":"https://lab.ovice.in"}]`, JoinLinkSecret: "secret"}
+
+	mintedToken := func(t *testing.T, text string) string {
+		t.Helper()
+		link := text[strings.Index(text, "https://"):]
+		u, err := url.Parse(link)
+		require.NoError(t, err)
+		assert.Equal(t, "/plugins/"+root.Manifest.Id+"/join/verify", u.Path)
+		return u.Query().Get("token")
+	}
+	verify := func(p *Plugin, token, userID string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/join/verify?token="+url.QueryEscape(token), nil)
+		if userID != "" {
+			r.Header.Set("Mattermost-User-ID", userID)
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, r)
+		return w
+	}
+
+	t.Run("join mints a signed link", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		mockUserLocale(api, "alice", "")
+		mockSiteURL(api, "https://chat.example.com")
+
+		text := executeCommand(t, p, "alice", "channel", "/ovice join Lab")
+		require.True(t, strings.HasPrefix(text, "Join **Lab**: https://chat.example.com/plugins/"), text)
+
+		claims, err := parseJoinToken([]byte("secret"), mintedToken(t, text), time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, "alice", claims.UserID)
+		assert.Equal(t, "Lab", claims.SpaceName)
+	})
+
+	t.Run("valid link redirects to the space", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, config)
+		token, err := signJoinToken([]byte("secret"), &joinClaims{UserID: "alice", SpaceName: "Lab", ExpiresAt: time.Now().Add(joinLinkTTL).Unix()})
+		require.NoError(t, err)
+
+		w := verify(p, token, "alice")
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "https://lab.ovice.in", w.Header().Get("Location"))
+	})
+
+	t.Run("expired link", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, config)
+		token, err := signJoinToken([]byte("secret"), &joinClaims{UserID: "alice", ExpiresAt: time.Now().Add(-time.Second).Unix()})
+		require.NoError(t, err)
+
+		w := verify(p, token, "alice")
+		assert.Equal(t, http.StatusGone, w.Code)
+	})
+
+	t.Run("tampered link", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, config)
+		token, err := signJoinToken([]byte("other secret"), &joinClaims{UserID: "alice", ExpiresAt: time.Now().Add(joinLinkTTL).Unix()})
+		require.NoError(t, err)
+
+		w := verify(p, token, "alice")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		valid, err := signJoinToken([]byte("secret"), &joinClaims{UserID: "alice", ExpiresAt: time.Now().Add(joinLinkTTL).Unix()})
+		require.NoError(t, err)
+		forged, err := signJoinToken([]byte("secret"), &joinClaims{UserID: "mallory", ExpiresAt: time.Now().Add(joinLinkTTL).Unix()})
+		require.NoError(t, err)
+		spliced := strings.Split(forged, ".")[0] + "." + strings.Split(valid, ".")[1]
+
+		w = verify(p, spliced, "alice")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("link of another user", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, config)
+		token, err := signJoinToken([]byte("secret"), &joinClaims{UserID: "alice", SpaceName: "Lab", ExpiresAt: time.Now().Add(joinLinkTTL).Unix()})
+		require.NoError(t, err)
+
+		w := verify(p, token, "mallory")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Empty(t, w.Header().Get("Location"))
+
+		assert.Equal(t, http.StatusUnauthorized, verify(p, token, "").Code)
+	})
+
+	t.Run("plain link without a secret", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{SpaceURL: "https://hq.ovice.in"})
+		mockUserLocale(api, "alice", "")
+
+		assert.Equal(t, "Join the oVice space: https://hq.ovice.in", executeCommand(t, p, "alice", "channel", "/ovice join"))
+		assert.Equal(t, http.StatusNotFound, verify(p, "x", "alice").Code)
+	})
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	knockActionAccept = "accept"
+	knockActionIgnore = "ignore"
+)
+
+// knockEvent is sent by oVice when someone asks to be let into a space by a specific user.
+type knockEvent struct {
+	TargetEmail string `json:"target_email"`
+	FromName    string `json:"from_name"`
+	SpaceName   string `json:"space_name"`
+}
+
+// validate checks the fields a knock event requires.
+func (e *knockEvent) validate() error {
+	if e.TargetEmail == "" || e.FromName == "" || e.SpaceName == "" {
+		return newValidationError("target_email, from_name and space_name are required")
+	}
+	return nil
+}
+
+// handleKnockEvent DMs the knocked-on user an interactive message to accept or ignore the knock.
+func (p *Plugin) handleKnockEvent(data []byte) error {
+	var event knockEvent
+	if err := decodeEvent(data, &event); err != nil {
+		return err
+	}
+	if err := event.validate(); err != nil {
+		return err
+	}
+
+	user, appErr := p.API.GetUserByEmail(event.TargetEmail)
+	if appErr != nil {
+		return newHTTPError(http.StatusNotFound, "no Mattermost user found for target_email")
+	}
+
+	actionContext := map[string]interface{}{
+		"target_user_id": user.Id,
+		"target_email":   event.TargetEmail,
+		"from_name":      event.FromName,
+		"space_name":     event.SpaceName,
+	}
+	knockAction := func(id, name, style string) *model.PostAction {
+		context := map[string]interface{}{"action": id}
+		for key, value := range actionContext {
+			context[key] = value
+		}
+		return &model.PostAction{
+			Id:    id,
+			Name:  name,
+			Type:  model.PostActionTypeButton,
+			Style: style,
+			Integration: &model.PostActionIntegration{
+				URL:     p.getConfiguration().endpointPath("/actions/knock"),
+				Context: context,
+			},
+		}
+	}
+
+	post := &model.Post{}
+	model.ParseSlackAttachment(post, []*model.SlackAttachment{{
+		Text: fmt.Sprintf("**%s** is knocking on your door in **%s**.", event.FromName, event.SpaceName),
+		Actions: []*model.PostAction{
+			knockAction(knockActionAccept, "Accept", "primary"),
+			knockAction(knockActionIgnore, "Ignore", "default"),
+		},
+	}})
+
+	if _, err := p.sendDirectPost(user.Id, post); err != nil {
+		return err
+	}
+	return nil
+}
+
+// handleKnockAction handles the Accept and Ignore buttons of a knock DM. The knock is read from
+// the stored post rather than the request, which the client controls, and the post must be a DM
+// from the bot to the answering user.
+func (p *Plugin) handleKnockAction(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		p.writeError(w, newHTTPError(http.StatusUnauthorized, "not authorized"))
+		return
+	}
+
+	var request model.PostActionIntegrationRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes)).Decode(&request); err != nil {
+		p.writeError(w, newHTTPError(http.StatusBadRequest, "invalid JSON payload"))
+		return
+	}
+
+	action, _ := request.Context["action"].(string)
+	knockContext, err := p.storedKnockContext(request.PostId, userID, action)
+	if err != nil {
+		p.writeError(w, err)
+		return
+	}
+	contextString := func(key string) string {
+		value, _ := knockContext[key].(string)
+		return value
+	}
+	if contextString("target_user_id") != userID {
+		p.writeError(w, newHTTPError(http.StatusForbidden, "only the knocked-on user can answer a knock"))
+		return
+	}
+
+	fromName, spaceName := contextString("from_name"), contextString("space_name")
+	var message string
+	switch action {
+	case knockActionAccept:
+		if err := p.acceptKnock(spaceName, fromName, contextString("target_email")); err != nil {
+			p.API.LogWarn("Failed to accept oVice knock", "space_name", spaceName, "err", err.Error())
+			writeJSON(w, http.StatusOK, &model.PostActionIntegrationResponse{
+				EphemeralText: fmt.Sprintf("Failed to let **%s** in. Please try again.", fromName),
+			})
+			return
+		}
+		message = fmt.Sprintf("You let **%s** into **%s**.", fromName, spaceName)
+	case knockActionIgnore:
+		message = fmt.Sprintf("You ignored the knock from **%s** in **%s**.", fromName, spaceName)
+	default:
+		p.writeError(w, newValidationError("unknown knock action"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &model.PostActionIntegrationResponse{
+		Update: &model.Post{Id: request.PostId, Message: message},
+	})
+}
+
+// storedKnockContext returns the context of the action button of the knock DM postID, which must
+// have been sent by the bot to userID.
+func (p *Plugin) storedKnockContext(postID, userID, action string) (map[string]interface{}, error) {
+	post, appErr := p.API.GetPost(postID)
+	if appErr != nil {
+		return nil, newHTTPError(http.StatusNotFound, "knock not found")
+	}
+	if post.UserId != p.botUserID {
+		return nil, newHTTPError(http.StatusForbidden, "only the knocked-on user can answer a knock")
+	}
+	channel, appErr := p.API.GetChannel(post.ChannelId)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get knock channel")
+	}
+	if channel.Type != model.ChannelTypeDirect || channel.Name != model.GetDMNameFromIds(p.botUserID, userID) {
+		return nil, newHTTPError(http.StatusForbidden, "only the knocked-on user can answer a knock")
+	}
+
+	for _, attachment := range post.Attachments() {
+		for _, postAction := range attachment.Actions {
+			if postAction.Id == action && postAction.Integration != nil {
+				return postAction.Integration.Context, nil
+			}
+		}
+	}
+	return nil, newValidationError("unknown knock action")
+}
+
+// acceptKnock asks oVice to let fromName into the space.
+func (p *Plugin) acceptKnock(spaceName, fromName, targetEmail string) error {
+	client := p.getConfiguration().oviceClient
+	if client == nil {
+		return errors.New("the oVice API is not configured")
+	}
+	return client.AcceptKnock(spaceName, fromName, targetEmail)
+}
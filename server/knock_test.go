@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKnockEvent(t *testing.T) {
+	const knock = `{"event":"knock","target_email":"alice@example.com","from_name":"Bob","space_name":"HQ"}`
+
+	t.Run("target is DMed accept and ignore buttons", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		api.On("GetUserByEmail", "alice@example.com").Return(&model.User{Id: "alice"}, nil)
+		api.On("GetDirectChannel", testBotUserID, "alice").Return(&model.Channel{Id: "dm"}, nil)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/events", knock)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		require.Len(t, *posts, 1)
+		post := (*posts)[0]
+		assert.Equal(t, "dm", post.ChannelId)
+		attachments := post.Attachments()
+		require.Len(t, attachments, 1)
+		assert.Contains(t, attachments[0].Text, "**Bob** is knocking")
+		require.Len(t, attachments[0].Actions, 2)
+		assert.Equal(t, knockActionAccept, attachments[0].Actions[0].Integration.Context["action"])
+		assert.Equal(t, "alice", attachments[0].Actions[0].Integration.Context["target_user_id"])
+		assert.Equal(t, knockActionIgnore, attachments[0].Actions[1].Integration.Context["action"])
+	})
+
+	t.Run("unresolved target", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		api.On("GetUserByEmail", "alice@example.com").Return(nil, &model.AppError{Message: "not found"})
+
+		w := doRequest(p, http.MethodPost, "/events", knock)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		api.AssertNotCalled(t, "CreatePost")
+	})
+}
+
+func TestKnockAction(t *testing.T) {
+	knockContext := func(action string) map[string]interface{} {
+		return map[string]interface{}{
+			"action":         action,
+			"target_user_id": "alice",
+			"target_email":   "alice@example.com",
+			"from_name":      "Bob",
+			"space_name":     "HQ",
+		}
+	}
+	// mockKnockPost stores the knock DM the bot sent alice as knockpost.
+	mockKnockPost := func(api *plugintest.API) {
+		post := &model.Post{Id: "knockpost", UserId: testBotUserID, ChannelId: "alicedm"}
+		var actions []*model.PostAction
+		for _, action := range []string{knockActionAccept, knockActionIgnore} {
+			actions = append(actions, &model.PostAction{
+				Id:          action,
+				Integration: &model.PostActionIntegration{Context: knockContext(action)},
+			})
+		}
+		model.ParseSlackAttachment(post, []*model.SlackAttachment{{Actions: actions}})
+		api.On("GetPost", "knockpost").Return(post, nil)
+		unmock(api, "GetChannel")
+		api.On("GetChannel", "alicedm").Return(&model.Channel{
+			Id:   "alicedm",
+			Type: model.ChannelTypeDirect,
+			Name: model.GetDMNameFromIds(testBotUserID, "alice"),
+		}, nil)
+	}
+	sendAction := func(p *Plugin, userID string, context map[string]interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(&model.PostActionIntegrationRequest{
+			UserId:  userID,
+			PostId:  "knockpost",
+			Context: context,
+		})
+		r := httptest.NewRequest(http.MethodPost, "/actions/knock", strings.NewReader(string(data)))
+		r.Header.Set("Mattermost-User-ID", userID)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, r)
+		return w
+	}
+	actionRequest := func(p *Plugin, api *plugintest.API, userID, action string) *httptest.ResponseRecorder {
+		mockKnockPost(api)
+		return sendAction(p, userID, knockContext(action))
+	}
+
+	t.Run("accept calls the oVice API", func(t *testing.T) {
+		var received map[string]string
+		var authorization string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/knocks/accept", r.URL.Path)
+			authorization = r.Header.Get("Authorization")
+			body, _ := ioutil.ReadAll(r.Body)
+			_ = json.Unmarshal(body, &received)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		p, api, _ := newTestPlugin(t, &configuration{OviceAPIURL: server.URL, OviceAPIKey: "key"})
+		w := actionRequest(p, api, "alice", knockActionAccept)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		assert.Equal(t, "Bearer key", authorization)
+		assert.Equal(t, map[string]string{"space_name": "HQ", "from_name": "Bob", "target_email": "alice@example.com"}, received)
+
+		var response model.PostActionIntegrationResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.NotNil(t, response.Update)
+		assert.Equal(t, "You let **Bob** into **HQ**.", response.Update.Message)
+	})
+
+	t.Run("failed accept reports an ephemeral error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		p, api, _ := newTestPlugin(t, &configuration{OviceAPIURL: server.URL})
+		w := actionRequest(p, api, "alice", knockActionAccept)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "Failed to let **Bob** in")
+	})
+
+	t.Run("ignore does not call the oVice API", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		w := actionRequest(p, api, "alice", knockActionIgnore)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "You ignored the knock from **Bob**")
+	})
+
+	t.Run("only the target can answer", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		w := actionRequest(p, api, "mallory", knockActionAccept)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("forged context is ignored for the stored knock", func(t *testing.T) {
+		var received map[string]string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			_ = json.Unmarshal(body, &received)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		p, api, _ := newTestPlugin(t, &configuration{OviceAPIURL: server.URL})
+		mockKnockPost(api)
+		forged := knockContext(knockActionAccept)
+		forged["target_email"] = "ceo@example.com"
+		forged["space_name"] = "Vault"
+		w := sendAction(p, "alice", forged)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, map[string]string{"space_name": "HQ", "from_name": "Bob", "target_email": "alice@example.com"}, received)
+	})
+
+	t.Run("forged context naming the caller is rejected", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockKnockPost(api)
+		forged := knockContext(knockActionAccept)
+		forged["target_user_id"] = "mallory"
+		w := sendAction(p, "mallory", forged)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("post not sent by the bot is rejected", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		api.On("GetPost", "knockpost").Return(&model.Post{Id: "knockpost", UserId: "mallory", ChannelId: "alicedm"}, nil)
+		w := sendAction(p, "alice", knockContext(knockActionAccept))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
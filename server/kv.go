@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+// KV keys are namespaced by a short prefix per record type so they can be told apart when
+// listing the store. Free-form identifiers are hashed to stay within the key length limit.
+const (
+	capacityAlertKeyPrefix  = "capfull_"
+	dedupKeyPrefix          = "dedup_"
+	idempotencyKeyPrefix    = "idem_"
+	idleKeyPrefix           = "idle_"
+	linkKeyPrefix           = "link_"
+	pendingLeaveKeyPrefix   = "leave_"
+	muteKeyPrefix           = "mute_"
+	nonceKeyPrefix          = "nonce_"
+	occupancyKeyPrefix      = "occupancy_"
+	occupancyPostKeyPrefix  = "occpost_"
+	pollKeyPrefix           = "poll_"
+	postExpiryKeyPrefix     = "expiry_"
+	screenshareKeyPrefix    = "share_"
+	sessionKeyPrefix        = "session_"
+	summaryKeyPrefix        = "summary_"
+	userTokenKeyPrefix      = "token_"
+	userTokenOwnerKeyPrefix = "tokenowner_"
+	welcomeKeyPrefix        = "welcome_"
+)
+
+// hashedKey builds a KV key from prefix and an arbitrary identifier such as a space name.
+func hashedKey(prefix, id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return prefix + hex.EncodeToString(sum[:12])
+}
+
+// kvSetIfAbsent stores value under key only if the key does not exist yet, reporting whether
+// the value was stored.
+func (p *Plugin) kvSetIfAbsent(key string, value []byte) (bool, error) {
+	ok, appErr := p.API.KVSetWithOptions(key, value, model.PluginKVSetOptions{Atomic: true, OldValue: nil})
+	if appErr != nil {
+		return false, errors.Wrapf(appErr, "failed to set key %s", key)
+	}
+	return ok, nil
+}
+
+// kvUpdateAttempts bounds how often kvUpdate retries when concurrent writers race on a key.
+const kvUpdateAttempts = 5
+
+// kvUpdate atomically replaces the value under key with update(oldValue), retrying when the
+// value changes concurrently. oldValue is nil if the key does not exist. update returns nil to
+// delete the key, or oldValue itself to leave it untouched.
+func (p *Plugin) kvUpdate(key string, update func(oldValue []byte) ([]byte, error)) error {
+	for attempt := 0; attempt < kvUpdateAttempts; attempt++ {
+		oldValue, appErr := p.API.KVGet(key)
+		if appErr != nil {
+			return errors.Wrapf(appErr, "failed to get key %s", key)
+		}
+
+		newValue, err := update(oldValue)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(newValue, oldValue) {
+			return nil
+		}
+
+		ok, appErr := p.API.KVSetWithOptions(key, newValue, model.PluginKVSetOptions{Atomic: true, OldValue: oldValue})
+		if appErr != nil {
+			return errors.Wrapf(appErr, "failed to set key %s", key)
+		}
+		if ok {
+			return nil
+		}
+	}
+
+	return errors.Errorf("key %s kept changing concurrently", key)
+}
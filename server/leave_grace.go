@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+// pendingLeave is a leave announcement held back for LeaveGraceSeconds, in case the user
+// re-enters the space in the meantime.
+type pendingLeave struct {
+	Post  *model.Post `json:"post"`
+	DueAt int64       `json:"due_at"`
+}
+
+// pendingLeaveKey returns the KV key of the pending leave of the user of event in its space.
+func pendingLeaveKey(event *presenceEvent) string {
+	user := event.UserEmail
+	if user == "" {
+		user = event.UserName
+	}
+	return hashedKey(pendingLeaveKeyPrefix, strings.ToLower(event.SpaceName)+"\n"+strings.ToLower(user))
+}
+
+// deferLeave stores the announcement post of the leave event and posts it once grace has
+// passed, unless cancelPendingLeave claims it first. A later leave of the same user replaces
+// the pending one and restarts the grace period.
+func (p *Plugin) deferLeave(event *presenceEvent, post *model.Post, grace time.Duration, now time.Time) error {
+	key := pendingLeaveKey(event)
+	data, err := json.Marshal(&pendingLeave{Post: post, DueAt: now.Add(grace).UnixNano() / int64(time.Millisecond)})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode pending leave")
+	}
+	if appErr := p.API.KVSet(key, data); appErr != nil {
+		return errors.Wrap(appErr, "failed to store pending leave")
+	}
+
+	p.pendingLeavesLock.Lock()
+	defer p.pendingLeavesLock.Unlock()
+	if p.pendingLeaves == nil {
+		p.pendingLeaves = map[string]*time.Timer{}
+	}
+	if timer, ok := p.pendingLeaves[key]; ok {
+		timer.Stop()
+	}
+	p.pendingLeaves[key] = time.AfterFunc(grace, func() {
+		p.pendingLeavesLock.Lock()
+		delete(p.pendingLeaves, key)
+		p.pendingLeavesLock.Unlock()
+
+		if _, err := p.flushPendingLeave(key, time.Now()); err != nil {
+			p.API.LogWarn("Failed to post pending leave", "key", key, "err", err.Error())
+		}
+	})
+	return nil
+}
+
+// cancelPendingLeave drops the pending leave of the user of the enter event, reporting whether
+// there was one. Claiming the record atomically means a re-enter racing with the end of the
+// grace period either cancels the leave or sees it posted, never both.
+func (p *Plugin) cancelPendingLeave(event *presenceEvent) (bool, error) {
+	key := pendingLeaveKey(event)
+	data, appErr := p.API.KVGet(key)
+	if appErr != nil {
+		return false, errors.Wrap(appErr, "failed to get pending leave")
+	}
+	if data == nil {
+		return false, nil
+	}
+	claimed, appErr := p.API.KVSetWithOptions(key, nil, model.PluginKVSetOptions{Atomic: true, OldValue: data})
+	if appErr != nil {
+		return false, errors.Wrap(appErr, "failed to cancel pending leave")
+	}
+	return claimed, nil
+}
+
+// flushPendingLeave posts the pending leave stored under key if its grace period is over at
+// now, reporting whether it was posted. A leave that another caller claimed first is left to
+// it.
+func (p *Plugin) flushPendingLeave(key string, now time.Time) (bool, error) {
+	data, appErr := p.API.KVGet(key)
+	if appErr != nil {
+		return false, errors.Wrap(appErr, "failed to get pending leave")
+	}
+	if data == nil {
+		return false, nil
+	}
+	var pending pendingLeave
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return false, errors.Wrap(err, "failed to decode pending leave")
+	}
+	if pending.DueAt > now.UnixNano()/int64(time.Millisecond) {
+		return false, nil
+	}
+
+	claimed, appErr := p.API.KVSetWithOptions(key, nil, model.PluginKVSetOptions{Atomic: true, OldValue: data})
+	if appErr != nil {
+		return false, errors.Wrap(appErr, "failed to claim pending leave")
+	}
+	if !claimed || pending.Post == nil {
+		return false, nil
+	}
+	if _, appErr = p.createIntegrationPost(pending.Post); appErr != nil {
+		return false, errors.Wrap(appErr, "failed to create presence post")
+	}
+	return true, nil
+}
+
+// flushDueLeaves posts every pending leave whose grace period is over at now, including those
+// whose timer was lost when the plugin restarted.
+func (p *Plugin) flushDueLeaves(now time.Time) error {
+	keys, err := p.kvListKeys(pendingLeaveKeyPrefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if _, err = p.flushPendingLeave(key, now); err != nil {
+			p.API.LogWarn("Failed to post pending leave", "key", key, "err", err.Error())
+		}
+	}
+	return nil
+}
+
+// stopPendingLeaves stops the grace timers. The pending leaves stay in the KV store, for
+// flushDueLeaves to post once the plugin runs again.
+func (p *Plugin) stopPendingLeaves() {
+	p.pendingLeavesLock.Lock()
+	defer p.pendingLeavesLock.Unlock()
+	for key, timer := range p.pendingLeaves {
+		timer.Stop()
+		delete(p.pendingLeaves, key)
+	}
+}
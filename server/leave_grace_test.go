@@ -0,0 +1,148 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeaveGracePeriod(t *testing.T) {
+	const (
+		enter = `{"event":"enter","user_email":"alice@example.com","space_name":"HQ"}`
+		leave = `{"event":"leave","user_email":"alice@example.com","space_name":"HQ"}`
+	)
+	setup := func(t *testing.T, grace int) (*Plugin, *plugintest.API, *memKV) {
+		p, api, kv := newTestPlugin(t, &configuration{DefaultChannelID: "town", LeaveGraceSeconds: grace})
+		t.Cleanup(p.stopPendingLeaves)
+		api.On("GetUserByEmail", "alice@example.com").Return(&model.User{Id: "alice", Username: "alice"}, nil)
+		mockSiteURL(api, "")
+		return p, api, kv
+	}
+	// countPosts counts the posts created through api, safe for posts made by timers.
+	countPosts := func(api *plugintest.API) func() int {
+		var lock sync.Mutex
+		count := 0
+		api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(func(post *model.Post) *model.Post {
+			lock.Lock()
+			defer lock.Unlock()
+			count++
+			return post
+		}, nil).Maybe()
+		return func() int {
+			lock.Lock()
+			defer lock.Unlock()
+			return count
+		}
+	}
+	pendingKey := pendingLeaveKey(&presenceEvent{UserEmail: "alice@example.com", SpaceName: "HQ"})
+
+	t.Run("quick rejoin cancels the leave", func(t *testing.T) {
+		p, api, kv := setup(t, 60)
+
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", leave).Code)
+		assert.NotNil(t, kv.get(pendingKey))
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", enter).Code)
+
+		assert.Nil(t, kv.get(pendingKey))
+		require.NoError(t, p.flushDueLeaves(time.Now().Add(2*time.Minute)))
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("genuine leave is posted after the grace period", func(t *testing.T) {
+		p, api, kv := setup(t, 1)
+		posted := make(chan *model.Post, 2)
+		api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(func(post *model.Post) *model.Post {
+			posted <- post
+			return post
+		}, nil)
+
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", leave).Code)
+		select {
+		case post := <-posted:
+			t.Fatalf("leave was posted right away: %q", post.Message)
+		case <-time.After(500 * time.Millisecond):
+		}
+
+		select {
+		case post := <-posted:
+			assert.Equal(t, "town", post.ChannelId)
+			assert.Equal(t, ":red_circle: @alice left **HQ**.", post.Message)
+		case <-time.After(5 * time.Second):
+			t.Fatal("leave was not posted after the grace period")
+		}
+		assert.Nil(t, kv.get(pendingKey))
+
+		// An enter after the grace period is announced as usual.
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", enter).Code)
+		assert.Equal(t, ":large_green_circle: @alice entered **HQ**.", (<-posted).Message)
+	})
+
+	t.Run("leave is not posted before it is due", func(t *testing.T) {
+		p, api, _ := setup(t, 60)
+		posts := countPosts(api)
+
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", leave).Code)
+		require.NoError(t, p.flushDueLeaves(time.Now()))
+		assert.Equal(t, 0, posts())
+
+		require.NoError(t, p.flushDueLeaves(time.Now().Add(2*time.Minute)))
+		assert.Equal(t, 1, posts())
+	})
+
+	t.Run("rejoin racing the grace period ends in exactly one outcome", func(t *testing.T) {
+		for i := 0; i < 20; i++ {
+			p, api, _ := setup(t, 60)
+			posts := countPosts(api)
+			require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", leave).Code)
+
+			var (
+				wg       sync.WaitGroup
+				posted   bool
+				canceled bool
+			)
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				var err error
+				posted, err = p.flushPendingLeave(pendingKey, time.Now().Add(2*time.Minute))
+				assert.NoError(t, err)
+			}()
+			go func() {
+				defer wg.Done()
+				var err error
+				canceled, err = p.cancelPendingLeave(&presenceEvent{UserEmail: "alice@example.com", SpaceName: "HQ"})
+				assert.NoError(t, err)
+			}()
+			wg.Wait()
+
+			assert.NotEqual(t, posted, canceled, "the leave is either posted or canceled")
+			assert.Equal(t, posted, posts() == 1)
+		}
+	})
+
+	t.Run("concurrent events leave a single pending leave", func(t *testing.T) {
+		p, api, kv := setup(t, 60)
+		posts := countPosts(api)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", leave).Code)
+			}()
+		}
+		wg.Wait()
+
+		require.NoError(t, p.flushDueLeaves(time.Now().Add(2*time.Minute)))
+		assert.Equal(t, 1, posts())
+		assert.Nil(t, kv.get(pendingKey))
+	})
+}
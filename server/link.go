@@ -0,0 +1,15 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+)
+
+// getLinkedEmail returns the oVice email linked to a Mattermost user, or an empty string if the
+// user has not linked one.
+func (p *Plugin) getLinkedEmail(userID string) (string, error) {
+	data, appErr := p.API.KVGet(linkKeyPrefix + userID)
+	if appErr != nil {
+		return "", errors.Wrap(appErr, "failed to get linked email")
+	}
+	return string(data), nil
+}
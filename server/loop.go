@@ -0,0 +1,26 @@
+package main
+
+// originProp is the post prop carrying the origin marker of the posts made for webhook messages
+// while SuppressSelfOriginated is on.
+const originProp = "ovice_origin"
+
+// originMarker identifies this plugin as the origin of a post or receipt. It is tied to the bot
+// so that two servers relaying to each other still tell their own messages apart.
+func (p *Plugin) originMarker() string {
+	return "mattermost:" + p.botUserID
+}
+
+// isSelfOriginated reports whether a payload claiming origin or carrying props came from this
+// plugin, i.e. one of its own posts or receipts was fed back into oVice and returned as a new
+// message. It is always false unless SuppressSelfOriginated is on.
+func (p *Plugin) isSelfOriginated(origin string, props map[string]interface{}) bool {
+	if !p.getConfiguration().SuppressSelfOriginated {
+		return false
+	}
+	marker := p.originMarker()
+	if origin == marker {
+		return true
+	}
+	value, ok := props[originProp].(string)
+	return ok && value == marker
+}
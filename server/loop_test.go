@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuppressSelfOriginated(t *testing.T) {
+	const marker = "mattermost:" + testBotUserID
+	config := &configuration{SuppressSelfOriginated: true}
+
+	t.Run("webhook with our origin is ignored", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi","origin":"`+marker+`"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"status":"ignored","ignored":true}`, w.Body.String())
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("webhook echoing our post props is ignored", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi","props":{"ovice_origin":"`+marker+`"}}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"status":"ignored","ignored":true}`, w.Body.String())
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("batch message with our origin is ignored", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook/batch", `{"messages":[
+			{"channel_id":"channel","message":"echo","origin":"`+marker+`"},
+			{"channel_id":"channel","message":"external"}
+		]}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "external", (*posts)[0].Message)
+
+		var response batchResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "ignored", response.Results[0].Status)
+		assert.Equal(t, "ok", response.Results[1].Status)
+	})
+
+	t.Run("external webhook is posted with our origin", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi","origin":"mattermost:otherbot"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, marker, (*posts)[0].GetProp(originProp))
+	})
+
+	t.Run("origin is not checked when disabled", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{})
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi","origin":"`+marker+`"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Nil(t, (*posts)[0].GetProp(originProp))
+	})
+
+	t.Run("event with our origin is ignored", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{SuppressSelfOriginated: true, CapacityAlertUsernames: "alice"})
+
+		w := doRequest(p, http.MethodPost, "/events", `{"event":"capacity","current":10,"max":10,"space_name":"HQ","origin":"`+marker+`"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"status":"ignored","ignored":true}`, w.Body.String())
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("external event is processed", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{SuppressSelfOriginated: true, CapacityAlertUsernames: "alice"})
+		api.On("GetUserByUsername", "alice").Return(&model.User{Id: "alice"}, nil)
+		api.On("GetDirectChannel", testBotUserID, "alice").Return(&model.Channel{Id: "dm-alice"}, nil)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/events", `{"event":"capacity","current":10,"max":10,"space_name":"HQ"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, *posts, 1)
+	})
+
+	t.Run("receipt carries our origin", func(t *testing.T) {
+		receipts := make(chan deliveryReceipt, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var receipt deliveryReceipt
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&receipt))
+			receipts <- receipt
+		}))
+		defer server.Close()
+
+		p, api, _ := newTestPlugin(t, &configuration{SuppressSelfOriginated: true, ReceiptURL: server.URL})
+		mockCreatePost(api)
+
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi","event_id":"evt-1"}`).Code)
+		select {
+		case receipt := <-receipts:
+			assert.Equal(t, marker, receipt.Origin)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no receipt was delivered")
+		}
+	})
+}
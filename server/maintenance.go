@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultMaintenanceInterval applies when MaintenanceIntervalMinutes is not configured.
+	defaultMaintenanceInterval = time.Hour
+
+	// kvListPerPage is the page size used when listing KV keys.
+	kvListPerPage = 100
+)
+
+// expiringRecord is the part shared by KV records that carry their own expiry.
+type expiringRecord struct {
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+// kvPruner reports whether the record stored under key should be deleted.
+type kvPruner func(p *Plugin, key string, value []byte, now time.Time) bool
+
+// kvPruners maps a key prefix to the policy deciding when records under it are removed. Keys
+// with no matching prefix are never pruned.
+var kvPruners = map[string]kvPruner{
+	idempotencyKeyPrefix: pruneExpiredRecord,
+	dedupKeyPrefix:       pruneExpiredRecord,
+	nonceKeyPrefix:       pruneExpiredRecord,
+	linkKeyPrefix:        (*Plugin).pruneOrphanedLink,
+	postExpiryKeyPrefix:  (*Plugin).pruneExpiredPost,
+	pollKeyPrefix:        (*Plugin).pruneDeletedPoll,
+}
+
+// pruneExpiredRecord removes records whose expires_at is in the past.
+func pruneExpiredRecord(_ *Plugin, _ string, value []byte, now time.Time) bool {
+	var record expiringRecord
+	if err := json.Unmarshal(value, &record); err != nil {
+		return false
+	}
+	return record.ExpiresAt > 0 && record.ExpiresAt <= now.UnixNano()/int64(time.Millisecond)
+}
+
+// pruneOrphanedLink removes link mappings of users that no longer exist. Any other lookup
+// failure keeps the mapping, so a transient error never deletes a live link.
+func (p *Plugin) pruneOrphanedLink(key string, _ []byte, _ time.Time) bool {
+	_, appErr := p.API.GetUser(strings.TrimPrefix(key, linkKeyPrefix))
+	return appErr != nil && appErr.StatusCode == http.StatusNotFound
+}
+
+// startMaintenance runs runMaintenance periodically, and checkInactivity, flushDueLeaves and
+// deleteExpiredPosts every inactivityCheckInterval, until stopMaintenance is called.
+func (p *Plugin) startMaintenance() {
+	p.maintenanceStop = make(chan struct{})
+	p.maintenanceDone = make(chan struct{})
+
+	go func(stop <-chan struct{}, done chan<- struct{}) {
+		defer close(done)
+		inactivity := time.NewTicker(inactivityCheckInterval)
+		defer inactivity.Stop()
+		maintenance := time.After(p.getConfiguration().maintenanceInterval())
+		for {
+			select {
+			case <-stop:
+				return
+			case <-inactivity.C:
+				if err := p.checkInactivity(time.Now()); err != nil {
+					p.API.LogWarn("Failed to check space inactivity", "err", err.Error())
+				}
+				if err := p.flushDueLeaves(time.Now()); err != nil {
+					p.API.LogWarn("Failed to post pending leaves", "err", err.Error())
+				}
+				if err := p.deleteExpiredPosts(time.Now()); err != nil {
+					p.API.LogWarn("Failed to delete expired posts", "err", err.Error())
+				}
+			case <-maintenance:
+				if err := p.runMaintenance(time.Now()); err != nil {
+					p.API.LogWarn("Failed to run KV maintenance", "err", err.Error())
+				}
+				maintenance = time.After(p.getConfiguration().maintenanceInterval())
+			}
+		}
+	}(p.maintenanceStop, p.maintenanceDone)
+}
+
+// stopMaintenance stops the maintenance goroutine and waits for it to exit.
+func (p *Plugin) stopMaintenance() {
+	if p.maintenanceStop == nil {
+		return
+	}
+	close(p.maintenanceStop)
+	<-p.maintenanceDone
+	p.maintenanceStop = nil
+}
+
+// runMaintenance deletes every KV record that its prefix's pruner considers expired or
+// orphaned. All pages are listed before anything is deleted so deletions cannot shift pages.
+func (p *Plugin) runMaintenance(now time.Time) error {
+	var stale []string
+	for page := 0; ; page++ {
+		keys, appErr := p.API.KVList(page, kvListPerPage)
+		if appErr != nil {
+			return errors.Wrap(appErr, "failed to list keys")
+		}
+
+		for _, key := range keys {
+			prune := prunerForKey(key)
+			if prune == nil {
+				continue
+			}
+
+			value, getErr := p.API.KVGet(key)
+			if getErr != nil {
+				p.API.LogWarn("Failed to get key during maintenance", "key", key, "err", getErr.Error())
+				continue
+			}
+			if value != nil && prune(p, key, value, now) {
+				stale = append(stale, key)
+			}
+		}
+
+		if len(keys) < kvListPerPage {
+			break
+		}
+	}
+
+	for _, key := range stale {
+		if appErr := p.API.KVDelete(key); appErr != nil {
+			p.API.LogWarn("Failed to delete stale key", "key", key, "err", appErr.Error())
+		}
+	}
+	if len(stale) > 0 {
+		p.API.LogDebug("Pruned stale KV records", "count", len(stale))
+	}
+
+	return nil
+}
+
+func prunerForKey(key string) kvPruner {
+	for prefix, prune := range kvPruners {
+		if strings.HasPrefix(key, prefix) {
+			return prune
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunMaintenance(t *testing.T) {
+	now := time.Now()
+	record := func(expiresAt time.Time) []byte {
+		data, _ := json.Marshal(&idempotencyRecord{Response: &webhookResponse{Status: "ok"}, ExpiresAt: model.GetMillisForTime(expiresAt)})
+		return data
+	}
+
+	t.Run("prunes an expired key and keeps a fresh one", func(t *testing.T) {
+		p, _, kv := newTestPlugin(t, nil)
+		kv.data[idempotencyKeyPrefix+"old"] = record(now.Add(-time.Minute))
+		kv.data[idempotencyKeyPrefix+"new"] = record(now.Add(time.Minute))
+		kv.data[capacityAlertKeyPrefix+"hq"] = []byte("1")
+
+		require.NoError(t, p.runMaintenance(now))
+		assert.Equal(t, []string{capacityAlertKeyPrefix + "hq", idempotencyKeyPrefix + "new"}, kv.keys())
+	})
+
+	t.Run("keeps live mappings and prunes orphaned ones", func(t *testing.T) {
+		p, api, kv := newTestPlugin(t, nil)
+		kv.data[linkKeyPrefix+"alice"] = []byte("alice@ovice.example")
+		kv.data[linkKeyPrefix+"gone"] = []byte("gone@ovice.example")
+		kv.data[linkKeyPrefix+"flaky"] = []byte("flaky@ovice.example")
+		api.On("GetUser", "alice").Return(&model.User{Id: "alice"}, nil)
+		api.On("GetUser", "gone").Return(nil, &model.AppError{StatusCode: http.StatusNotFound})
+		api.On("GetUser", "flaky").Return(nil, &model.AppError{StatusCode: http.StatusInternalServerError})
+
+		require.NoError(t, p.runMaintenance(now))
+		assert.Equal(t, []string{linkKeyPrefix + "alice", linkKeyPrefix + "flaky"}, kv.keys())
+	})
+
+	t.Run("pages over many keys", func(t *testing.T) {
+		p, api, kv := newTestPlugin(t, nil)
+		total := kvListPerPage*2 + 5
+		for i := 0; i < total; i++ {
+			kv.data[fmt.Sprintf("%s%03d", idempotencyKeyPrefix, i)] = record(now.Add(-time.Minute))
+		}
+
+		require.NoError(t, p.runMaintenance(now))
+		assert.Empty(t, kv.keys())
+		api.AssertNumberOfCalls(t, "KVList", 3)
+		api.AssertNumberOfCalls(t, "KVDelete", total)
+	})
+}
+
+func TestMaintenanceLifecycle(t *testing.T) {
+	p, _, _ := newTestPlugin(t, nil)
+
+	p.startMaintenance()
+	p.stopMaintenance()
+	assert.Nil(t, p.maintenanceStop)
+}
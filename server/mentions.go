@@ -0,0 +1,140 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// maxGroupMentionMembers caps the members a group mention is expanded to in
+// mentionedUserIDs, so mentioning a huge group does not page through all of it.
+const maxGroupMentionMembers = 1000
+
+// mentionPattern matches an @token that is not part of a word or email address. The token may
+// end in dots that belong to the sentence rather than the username, which are trimmed later.
+var mentionPattern = regexp.MustCompile(`(^|[^\w@.\-])@([a-zA-Z0-9._\-]+)`)
+
+// specialMentions notify a whole channel and are left to Mattermost.
+var specialMentions = map[string]bool{"all": true, "channel": true, "here": true}
+
+// mentionTarget is what an @token names: a user, a group or one of specialMentions. All are
+// unset for a token that names nothing.
+type mentionTarget struct {
+	user    *model.User
+	group   *model.Group
+	special bool
+}
+
+// exists reports whether the token names anything.
+func (t *mentionTarget) exists() bool {
+	return t.user != nil || t.group != nil || t.special
+}
+
+// mentionResolver looks up the targets of @tokens, each name at most once.
+type mentionResolver struct {
+	p       *Plugin
+	targets map[string]*mentionTarget
+}
+
+func (p *Plugin) newMentionResolver() *mentionResolver {
+	return &mentionResolver{p: p, targets: map[string]*mentionTarget{}}
+}
+
+// resolve returns the target of the @token name, looking up users before groups.
+func (r *mentionResolver) resolve(name string) *mentionTarget {
+	name = strings.ToLower(name)
+	if target, seen := r.targets[name]; seen {
+		return target
+	}
+
+	target := &mentionTarget{special: specialMentions[name]}
+	if !target.special {
+		if user, appErr := r.p.API.GetUserByUsername(name); appErr == nil {
+			target.user = user
+		} else if group, appErr := r.p.API.GetGroupByName(name); appErr == nil {
+			target.group = group
+		}
+	}
+	r.targets[name] = target
+	return target
+}
+
+// splitMention splits a mentionPattern match into the character before the @, the mentioned
+// name and the trailing dots that end the sentence rather than the name.
+func splitMention(match string) (prefix, name, suffix string) {
+	groups := mentionPattern.FindStringSubmatch(match)
+	prefix, name = groups[1], groups[2]
+	trimmed := strings.TrimRight(name, ".")
+	return prefix, trimmed, name[len(trimmed):]
+}
+
+// resolveMentions keeps each @token of message that names an existing user or group as a
+// mention, and turns the others into code spans so they render as plain text instead of
+// looking like a mention of, say, a channel called lunch.
+func (p *Plugin) resolveMentions(message string) string {
+	resolver := p.newMentionResolver()
+	return mentionPattern.ReplaceAllStringFunc(message, func(match string) string {
+		prefix, name, suffix := splitMention(match)
+		if name == "" || resolver.resolve(name).exists() {
+			return match
+		}
+		return prefix + "`@" + name + "`" + suffix
+	})
+}
+
+// mentionedUserIDs returns the IDs of the users mentioned in message, in order of first
+// mention. A group mention counts every member of the group, up to maxGroupMentionMembers;
+// channel-wide mentions such as @here are left out since who they notify depends on who is
+// online.
+func (p *Plugin) mentionedUserIDs(message string) []string {
+	resolver := p.newMentionResolver()
+	var ids []string
+	seen := map[string]bool{}
+	add := func(id string) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	for _, match := range mentionPattern.FindAllString(message, -1) {
+		_, name, _ := splitMention(match)
+		if name == "" {
+			continue
+		}
+		target := resolver.resolve(name)
+		switch {
+		case target.user != nil:
+			add(target.user.Id)
+		case target.group != nil:
+			for _, id := range p.groupMemberIDs(target.group.Id) {
+				add(id)
+			}
+		}
+	}
+	return ids
+}
+
+// groupMemberIDs returns the IDs of up to maxGroupMentionMembers members of the group. A failed
+// lookup is logged and ends the list early.
+func (p *Plugin) groupMemberIDs(groupID string) []string {
+	const perPage = 200
+	var ids []string
+	for page := 0; len(ids) < maxGroupMentionMembers; page++ {
+		users, appErr := p.API.GetGroupMemberUsers(groupID, page, perPage)
+		if appErr != nil {
+			p.API.LogWarn("Failed to get group members", "group_id", groupID, "err", appErr.Error())
+			break
+		}
+		for _, user := range users {
+			if len(ids) < maxGroupMentionMembers {
+				ids = append(ids, user.Id)
+			}
+		}
+		if len(users) < perPage {
+			break
+		}
+	}
+	return ids
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveMentions(t *testing.T) {
+	mockDirectory := func(api *plugintest.API) {
+		api.On("GetUserByUsername", "alice").Return(&model.User{Id: "alice", Username: "alice"}, nil).Maybe()
+		api.On("GetUserByUsername", mock.AnythingOfType("string")).Return(nil, &model.AppError{Message: "not found"})
+		api.On("GetGroupByName", "design").Return(&model.Group{Id: "design", Name: model.NewString("design")}, nil).Maybe()
+		api.On("GetGroupByName", mock.AnythingOfType("string")).Return(nil, &model.AppError{Message: "not found"})
+	}
+
+	t.Run("users and groups stay mentions", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockDirectory(api)
+
+		assert.Equal(t, "@alice and @design, see you.", p.resolveMentions("@alice and @design, see you."))
+		assert.Equal(t, "Ping @alice.", p.resolveMentions("Ping @alice."))
+	})
+
+	t.Run("unresolved tokens become plain text", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockDirectory(api)
+
+		assert.Equal(t, "Join `@lunch` with @alice.", p.resolveMentions("Join @lunch with @alice."))
+		assert.Equal(t, "Mail alice@example.com", p.resolveMentions("Mail alice@example.com"))
+		assert.Equal(t, "@here", p.resolveMentions("@here"))
+	})
+
+	t.Run("flag on", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockDirectory(api)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"@alice @lunch","resolve_mentions":true}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "@alice `@lunch`", (*posts)[0].Message)
+	})
+
+	t.Run("flag off passes through", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"@alice @lunch"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "@alice @lunch", (*posts)[0].Message)
+		api.AssertNotCalled(t, "GetUserByUsername", mock.Anything)
+	})
+}
+
+func TestReportMentions(t *testing.T) {
+	mockDirectory := func(api *plugintest.API) {
+		api.On("GetUserByUsername", "alice").Return(&model.User{Id: "alice", Username: "alice"}, nil).Maybe()
+		api.On("GetUserByUsername", "bob").Return(&model.User{Id: "bob", Username: "bob"}, nil).Maybe()
+		api.On("GetUserByUsername", mock.AnythingOfType("string")).Return(nil, &model.AppError{Message: "not found"})
+		api.On("GetGroupByName", "design").Return(&model.Group{Id: "designid", Name: model.NewString("design")}, nil).Maybe()
+		api.On("GetGroupByName", mock.AnythingOfType("string")).Return(nil, &model.AppError{Message: "not found"})
+		api.On("GetGroupMemberUsers", "designid", 0, 200).Return([]*model.User{{Id: "bob"}, {Id: "carol"}}, nil).Maybe()
+	}
+	mentioned := func(t *testing.T, p *Plugin, message string) []string {
+		t.Helper()
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"`+message+`","report_mentions":true}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response webhookResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.MentionedUserIDs
+	}
+
+	t.Run("mentioned users are reported", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockDirectory(api)
+		mockCreatePost(api)
+
+		assert.Equal(t, []string{"alice", "bob"}, mentioned(t, p, "@alice and @bob, then @alice again. @lunch?"))
+	})
+
+	t.Run("nothing is reported without mentions", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockDirectory(api)
+		mockCreatePost(api)
+
+		assert.Empty(t, mentioned(t, p, "Mail alice@example.com about @lunch"))
+	})
+
+	t.Run("group mentions count their members once", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockDirectory(api)
+		mockCreatePost(api)
+
+		assert.Equal(t, []string{"bob", "carol", "alice"}, mentioned(t, p, "@design and @alice and @bob. @here"))
+	})
+
+	t.Run("mentions are not looked up unless requested", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"@alice"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), "mentioned_user_ids")
+		api.AssertNotCalled(t, "GetUserByUsername", mock.Anything)
+	})
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync/atomic"
+)
+
+// maxMetricsStatus bounds the status codes counted individually; HTTP codes are three digits.
+const maxMetricsStatus = 600
+
+// requestMetrics counts the posts made for webhook messages and the outcome of webhook and event
+// requests. Every field is updated with sync/atomic so requests never contend on a lock.
+type requestMetrics struct {
+	posts          int64
+	errors         int64
+	rejections     int64
+	rateLimitDrops int64
+	statusCodes    [maxMetricsStatus]int64
+}
+
+// metricsSnapshot is the JSON form of requestMetrics served at /metrics.json.
+type metricsSnapshot struct {
+	Posts          int64            `json:"posts"`
+	Errors         int64            `json:"errors"`
+	Rejections     int64            `json:"rejections"`
+	RateLimitDrops int64            `json:"rate_limit_drops"`
+	StatusCodes    map[string]int64 `json:"status_codes"`
+}
+
+// recordPost counts a post created for a webhook message.
+func (m *requestMetrics) recordPost() {
+	atomic.AddInt64(&m.posts, 1)
+}
+
+// recordStatus counts a response: 429 as a rate-limit drop, other 4xx as a rejection and 5xx
+// as an error.
+func (m *requestMetrics) recordStatus(status int) {
+	if status > 0 && status < maxMetricsStatus {
+		atomic.AddInt64(&m.statusCodes[status], 1)
+	}
+	switch {
+	case status == http.StatusTooManyRequests:
+		atomic.AddInt64(&m.rateLimitDrops, 1)
+	case status >= 500:
+		atomic.AddInt64(&m.errors, 1)
+	case status >= 400:
+		atomic.AddInt64(&m.rejections, 1)
+	}
+}
+
+// snapshot reads the current value of every counter. Status codes never seen are left out.
+func (m *requestMetrics) snapshot() *metricsSnapshot {
+	snapshot := &metricsSnapshot{
+		Posts:          atomic.LoadInt64(&m.posts),
+		Errors:         atomic.LoadInt64(&m.errors),
+		Rejections:     atomic.LoadInt64(&m.rejections),
+		RateLimitDrops: atomic.LoadInt64(&m.rateLimitDrops),
+		StatusCodes:    map[string]int64{},
+	}
+	for status := range m.statusCodes {
+		if count := atomic.LoadInt64(&m.statusCodes[status]); count > 0 {
+			snapshot.StatusCodes[strconv.Itoa(status)] = count
+		}
+	}
+	return snapshot
+}
+
+// recordRequest runs handler and counts the status it answered with.
+func (p *Plugin) recordRequest(w http.ResponseWriter, r *http.Request, handler http.HandlerFunc) {
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	handler(recorder, r)
+	p.metrics.recordStatus(recorder.status)
+}
+
+// handleMetrics serves the request counters in the Prometheus text format. It answers 404
+// unless EnableMetrics is set.
+func (p *Plugin) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	snapshot, ok := p.metricsSnapshot(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeCounter := func(name, help string, value int64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, value)
+	}
+	writeCounter("ovice_posts_total", "Posts created for webhook messages.", snapshot.Posts)
+	writeCounter("ovice_errors_total", "Requests answered with a 5xx status.", snapshot.Errors)
+	writeCounter("ovice_rejections_total", "Requests answered with a 4xx status other than 429.", snapshot.Rejections)
+	writeCounter("ovice_rate_limit_drops_total", "Requests dropped by the rate limit.", snapshot.RateLimitDrops)
+
+	statuses := make([]string, 0, len(snapshot.StatusCodes))
+	for status := range snapshot.StatusCodes {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	fmt.Fprint(w, "# HELP ovice_responses_total Requests answered, by status code.\n# TYPE ovice_responses_total counter\n")
+	for _, status := range statuses {
+		fmt.Fprintf(w, "ovice_responses_total{code=%q} %d\n", status, snapshot.StatusCodes[status])
+	}
+}
+
+// handleMetricsJSON serves the same counters as handleMetrics as a JSON object.
+func (p *Plugin) handleMetricsJSON(w http.ResponseWriter, r *http.Request) {
+	if snapshot, ok := p.metricsSnapshot(w, r); ok {
+		writeJSON(w, http.StatusOK, snapshot)
+	}
+}
+
+// metricsSnapshot checks that metrics may be served for r and reads them, answering the
+// request itself otherwise.
+func (p *Plugin) metricsSnapshot(w http.ResponseWriter, r *http.Request) (*metricsSnapshot, bool) {
+	if !p.getConfiguration().EnableMetrics {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	if r.Method != http.MethodGet {
+		p.writeMethodNotAllowed(w, http.MethodGet)
+		return nil, false
+	}
+	return p.metrics.snapshot(), true
+}
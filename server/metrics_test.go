@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	p, api, _ := newTestPlugin(t, &configuration{EnableMetrics: true, RateLimitPerMinute: 3})
+	mockCreatePost(api)
+
+	require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi"}`).Code)
+	require.Equal(t, http.StatusBadRequest, doRequest(p, http.MethodPost, "/webhook", `{`).Code)
+	require.Equal(t, http.StatusMethodNotAllowed, doRequest(p, http.MethodGet, "/webhook", "").Code)
+	require.Equal(t, http.StatusTooManyRequests, doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi"}`).Code)
+
+	w := doRequest(p, http.MethodGet, "/metrics.json", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{
+		"posts": 1,
+		"errors": 0,
+		"rejections": 2,
+		"rate_limit_drops": 1,
+		"status_codes": {"200": 1, "400": 1, "405": 1, "429": 1}
+	}`, w.Body.String())
+
+	var snapshot metricsSnapshot
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &snapshot))
+
+	t.Run("agrees with the Prometheus output", func(t *testing.T) {
+		w := doRequest(p, http.MethodGet, "/metrics", "")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		samples := map[string]int64{}
+		for _, match := range regexp.MustCompile(`(?m)^(ovice_\w+(?:\{code="\d+"\})?) (\d+)$`).FindAllStringSubmatch(w.Body.String(), -1) {
+			value, err := strconv.ParseInt(match[2], 10, 64)
+			require.NoError(t, err)
+			samples[match[1]] = value
+		}
+
+		expected := map[string]int64{
+			"ovice_posts_total":            snapshot.Posts,
+			"ovice_errors_total":           snapshot.Errors,
+			"ovice_rejections_total":       snapshot.Rejections,
+			"ovice_rate_limit_drops_total": snapshot.RateLimitDrops,
+		}
+		for code, count := range snapshot.StatusCodes {
+			expected[`ovice_responses_total{code="`+code+`"}`] = count
+		}
+		assert.Equal(t, expected, samples)
+		assert.Contains(t, w.Body.String(), "# TYPE ovice_responses_total counter\n")
+	})
+
+	t.Run("metrics requests are not counted", func(t *testing.T) {
+		w := doRequest(p, http.MethodGet, "/metrics.json", "")
+		var again metricsSnapshot
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &again))
+		assert.Equal(t, snapshot, again)
+	})
+
+	t.Run("only GET is supported", func(t *testing.T) {
+		assert.Equal(t, http.StatusMethodNotAllowed, doRequest(p, http.MethodPost, "/metrics.json", "{}").Code)
+	})
+}
+
+func TestMetricsDisabled(t *testing.T) {
+	p, _, _ := newTestPlugin(t, &configuration{})
+
+	assert.Equal(t, http.StatusNotFound, doRequest(p, http.MethodGet, "/metrics", "").Code)
+	assert.Equal(t, http.StatusNotFound, doRequest(p, http.MethodGet, "/metrics.json", "").Code)
+}
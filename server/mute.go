@@ -0,0 +1,55 @@
+package main
+
+import (
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+// muteKey returns the KV key flagging channelID as muted. Channel IDs fit the key length limit
+// as they are.
+func muteKey(channelID string) string {
+	return muteKeyPrefix + channelID
+}
+
+// isChannelMuted reports whether presence and chat notifications are muted in channelID.
+func (p *Plugin) isChannelMuted(channelID string) (bool, error) {
+	data, appErr := p.API.KVGet(muteKey(channelID))
+	if appErr != nil {
+		return false, errors.Wrap(appErr, "failed to get channel mute")
+	}
+	return data != nil, nil
+}
+
+// executeMuteCommand stops presence and chat notifications in the channel the command is run in.
+func (p *Plugin) executeMuteCommand(args *model.CommandArgs, _ []string, locale string) *model.CommandResponse {
+	return p.setChannelMuted(args, true, locale)
+}
+
+// executeUnmuteCommand resumes presence and chat notifications in the channel the command is
+// run in.
+func (p *Plugin) executeUnmuteCommand(args *model.CommandArgs, _ []string, locale string) *model.CommandResponse {
+	return p.setChannelMuted(args, false, locale)
+}
+
+// setChannelMuted mutes or unmutes the channel of args on behalf of a channel admin.
+func (p *Plugin) setChannelMuted(args *model.CommandArgs, muted bool, locale string) *model.CommandResponse {
+	if !p.API.HasPermissionToChannel(args.UserId, args.ChannelId, model.PermissionManageChannelRoles) {
+		return ephemeralResponse(translate(locale, "Only channel admins can mute or unmute oVice notifications."))
+	}
+
+	var appErr *model.AppError
+	if muted {
+		appErr = p.API.KVSet(muteKey(args.ChannelId), []byte("1"))
+	} else {
+		appErr = p.API.KVDelete(muteKey(args.ChannelId))
+	}
+	if appErr != nil {
+		p.API.LogWarn("Failed to update channel mute", "channel_id", args.ChannelId, "err", appErr.Error())
+		return ephemeralResponse(translate(locale, "Failed to update the channel. Please try again later."))
+	}
+
+	if muted {
+		return ephemeralResponse(translate(locale, "oVice presence and chat notifications are muted in this channel."))
+	}
+	return ephemeralResponse(translate(locale, "oVice presence and chat notifications are unmuted in this channel."))
+}
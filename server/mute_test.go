@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMuteCommand(t *testing.T) {
+	const (
+		enter = `{"event":"enter","user_name":"Alice","space_name":"HQ"}`
+		chat  = `{"event":"chat","user_name":"Alice","space_name":"HQ","message":"hello"}`
+	)
+	config := &configuration{DefaultChannelID: "town"}
+
+	t.Run("mute suppresses and unmute restores notifications", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		mockUserLocale(api, "admin", "")
+		api.On("HasPermissionToChannel", "admin", "town", model.PermissionManageChannelRoles).Return(true)
+		posts := mockCreatePost(api)
+
+		assert.Equal(t, "oVice presence and chat notifications are muted in this channel.", executeCommand(t, p, "admin", "town", "/ovice mute"))
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", enter).Code)
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", chat).Code)
+		assert.Empty(t, *posts)
+
+		assert.Equal(t, "oVice presence and chat notifications are unmuted in this channel.", executeCommand(t, p, "admin", "town", "/ovice unmute"))
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", enter).Code)
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", chat).Code)
+		assert.Len(t, *posts, 2)
+	})
+
+	t.Run("other channels are not affected", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		mockUserLocale(api, "admin", "")
+		api.On("HasPermissionToChannel", "admin", "other", model.PermissionManageChannelRoles).Return(true)
+		posts := mockCreatePost(api)
+
+		executeCommand(t, p, "admin", "other", "/ovice mute")
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", enter).Code)
+		assert.Len(t, *posts, 1)
+	})
+
+	t.Run("non-admins are denied", func(t *testing.T) {
+		p, api, kv := newTestPlugin(t, config)
+		mockUserLocale(api, "alice", "")
+		api.On("HasPermissionToChannel", "alice", "town", model.PermissionManageChannelRoles).Return(false)
+
+		assert.Equal(t, "Only channel admins can mute or unmute oVice notifications.", executeCommand(t, p, "alice", "town", "/ovice mute"))
+		assert.Nil(t, kv.get(muteKey("town")))
+		api.AssertNotCalled(t, "KVSet", mock.Anything, mock.Anything)
+	})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	// nonceHeader carries the unique value of a request checked by RequireNonce.
+	nonceHeader = "X-Ovice-Nonce"
+
+	// maxNonceLength bounds the nonces accepted, which callers usually fill with a UUID.
+	maxNonceLength = 128
+)
+
+// nonceKey returns the KV key remembering nonce.
+func nonceKey(nonce string) string {
+	return hashedKey(nonceKeyPrefix, nonce)
+}
+
+// nonceHeaderName returns the header carrying the nonce of a request. Standard Webhooks already
+// signs a unique webhook-id, which serves as the nonce; other schemes use X-Ovice-Nonce.
+func (c *configuration) nonceHeaderName() string {
+	if c.signatureScheme() == signatureSchemeStandardWebhooks {
+		return webhookIDHeader
+	}
+	return nonceHeader
+}
+
+// nonceWindow is how long a nonce is remembered. A signature timestamp is accepted up to the
+// tolerance on either side of now, so a request stays replayable for twice that long; once the
+// nonce is forgotten, the timestamp check rejects the replay instead.
+func (c *configuration) nonceWindow() time.Duration {
+	return 2 * c.signatureTolerance()
+}
+
+// claimNonce records the nonce of a request at now, rejecting a missing nonce with 401 and one
+// already seen within the nonce window with 409.
+func (p *Plugin) claimNonce(header http.Header, now time.Time) error {
+	name := p.getConfiguration().nonceHeaderName()
+	nonce := header.Get(name)
+	if nonce == "" {
+		return newHTTPError(http.StatusUnauthorized, "missing %s header", name)
+	}
+	if len(nonce) > maxNonceLength {
+		return newHTTPError(http.StatusBadRequest, "%s exceeds %d characters", name, maxNonceLength)
+	}
+
+	key := nonceKey(nonce)
+	oldValue, appErr := p.API.KVGet(key)
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to get nonce record")
+	}
+
+	nowMillis := now.UnixNano() / int64(time.Millisecond)
+	if oldValue != nil {
+		var record expiringRecord
+		if err := json.Unmarshal(oldValue, &record); err == nil && nowMillis < record.ExpiresAt {
+			return newHTTPError(http.StatusConflict, "request with this %s was already received", name)
+		}
+	}
+
+	window := p.getConfiguration().nonceWindow()
+	newValue, err := json.Marshal(&expiringRecord{ExpiresAt: nowMillis + window.Milliseconds()})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode nonce record")
+	}
+
+	// The compare-and-set loses to a concurrent request with the same nonce, which is then the
+	// replay.
+	ok, appErr := p.API.KVSetWithOptions(key, newValue, model.PluginKVSetOptions{
+		Atomic:          true,
+		OldValue:        oldValue,
+		ExpireInSeconds: int64(window / time.Second),
+	})
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to store nonce record")
+	}
+	if !ok {
+		return newHTTPError(http.StatusConflict, "request with this %s was already received", name)
+	}
+	return nil
+}
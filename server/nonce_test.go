@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireNonce(t *testing.T) {
+	const body = `{"channel_id":"channel","message":"hi"}`
+	config := &configuration{RequireNonce: true, SignatureScheme: signatureSchemeHMACSimple, WebhookSecret: "secret", SignatureToleranceSeconds: 60}
+	withNonce := func(nonce string) http.Header {
+		return signHMACSimpleNonce("secret", nonce, time.Now(), body)
+	}
+
+	t.Run("fresh nonces are accepted", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		posts := mockCreatePost(api)
+
+		assert.Equal(t, http.StatusOK, doSignedRequest(p, "/webhook", body, withNonce("n-1")).Code)
+		assert.Equal(t, http.StatusOK, doSignedRequest(p, "/webhook", body, withNonce("n-2")).Code)
+		assert.Len(t, *posts, 2)
+	})
+
+	t.Run("replayed nonce is rejected", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		posts := mockCreatePost(api)
+
+		require.Equal(t, http.StatusOK, doSignedRequest(p, "/webhook", body, withNonce("n-1")).Code)
+		w := doSignedRequest(p, "/webhook", body, withNonce("n-1"))
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), "already received")
+		assert.Len(t, *posts, 1)
+	})
+
+	t.Run("nonce is accepted again once the window passed", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, config)
+		now := time.Now()
+
+		require.NoError(t, p.claimNonce(withNonce("n-1"), now))
+		assert.Error(t, p.claimNonce(withNonce("n-1"), now.Add(119*time.Second)))
+		assert.NoError(t, p.claimNonce(withNonce("n-1"), now.Add(2*time.Minute)))
+	})
+
+	t.Run("missing nonce is rejected", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, config)
+
+		header := withNonce("n-1")
+		header.Del(nonceHeader)
+		assert.Equal(t, http.StatusUnauthorized, doSignedRequest(p, "/webhook", body, header).Code)
+	})
+
+	t.Run("nonces require a signature scheme", func(t *testing.T) {
+		assert.EqualError(t, (&configuration{RequireNonce: true}).process(), "RequireNonce requires a SignatureScheme")
+	})
+
+	t.Run("forged request does not use up the nonce", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{RequireNonce: true, SignatureScheme: signatureSchemeHMACSimple, WebhookSecret: "secret"})
+		mockCreatePost(api)
+
+		forged := signHMACSimpleNonce("guess", "n-1", time.Now(), body)
+		require.Equal(t, http.StatusUnauthorized, doSignedRequest(p, "/webhook", body, forged).Code)
+
+		signed := signHMACSimpleNonce("secret", "n-1", time.Now(), body)
+		assert.Equal(t, http.StatusOK, doSignedRequest(p, "/webhook", body, signed).Code)
+	})
+
+	t.Run("hmac-simple replay with a fresh nonce is rejected", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{RequireNonce: true, SignatureScheme: signatureSchemeHMACSimple, WebhookSecret: "secret"})
+		posts := mockCreatePost(api)
+
+		captured := signHMACSimpleNonce("secret", "n-1", time.Now(), body)
+		require.Equal(t, http.StatusOK, doSignedRequest(p, "/webhook", body, captured).Code)
+
+		captured.Set(nonceHeader, "n-2")
+		assert.Equal(t, http.StatusUnauthorized, doSignedRequest(p, "/webhook", body, captured).Code)
+		assert.Len(t, *posts, 1)
+	})
+
+	t.Run("hmac-simple request outside the tolerance is rejected", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, &configuration{RequireNonce: true, SignatureScheme: signatureSchemeHMACSimple, WebhookSecret: "secret"})
+
+		stale := signHMACSimpleNonce("secret", "n-1", time.Now().Add(-time.Hour), body)
+		assert.Equal(t, http.StatusUnauthorized, doSignedRequest(p, "/webhook", body, stale).Code)
+	})
+
+	t.Run("standard-webhooks replay with a fresh nonce is rejected", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{RequireNonce: true, SignatureScheme: signatureSchemeStandardWebhooks, WebhookSecret: testWebhookSecret})
+		posts := mockCreatePost(api)
+
+		captured := signStandardWebhook(t, testWebhookSecret, "msg_1", time.Now(), body)
+		captured.Set(nonceHeader, "n-1")
+		require.Equal(t, http.StatusOK, doSignedRequest(p, "/webhook", body, captured).Code)
+
+		captured.Set(nonceHeader, "n-2")
+		assert.Equal(t, http.StatusConflict, doSignedRequest(p, "/webhook", body, captured).Code)
+		assert.Len(t, *posts, 1)
+	})
+
+	t.Run("nonces are not required by default", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockCreatePost(api)
+
+		assert.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/webhook", body).Code)
+		assert.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/webhook", body).Code)
+	})
+}
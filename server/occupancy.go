@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	// occupancyHistory is how far back occupancy samples are kept and charted.
+	occupancyHistory = 24 * time.Hour
+
+	// maxOccupancySamples caps the samples kept per space so a busy space cannot grow its
+	// record without bound.
+	maxOccupancySamples = 1000
+
+	// occupancyChartBuckets is the number of bars in an occupancy chart, one per hour.
+	occupancyChartBuckets = 24
+
+	occupancyChartWidth  = 480
+	occupancyChartHeight = 200
+)
+
+var (
+	occupancyChartBackground = color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	occupancyChartBar        = color.RGBA{R: 0x1c, G: 0x58, B: 0xd9, A: 0xff}
+	occupancyChartAxis       = color.RGBA{R: 0x66, G: 0x66, B: 0x66, A: 0xff}
+	occupancyChartGrid       = color.RGBA{R: 0xe6, G: 0xe6, B: 0xe6, A: 0xff}
+)
+
+// occupancySample is the number of users in a space at a point in time.
+type occupancySample struct {
+	At    int64 `json:"at"`
+	Count int   `json:"count"`
+}
+
+// occupancyKey returns the KV key of the occupancy samples of the named space.
+func occupancyKey(spaceName string) string {
+	return hashedKey(occupancyKeyPrefix, strings.ToLower(spaceName))
+}
+
+// recordOccupancy appends a sample of count users in the named space at now, dropping samples
+// older than occupancyHistory.
+func (p *Plugin) recordOccupancy(spaceName string, count int, now time.Time) error {
+	nowMillis := now.UnixNano() / int64(time.Millisecond)
+	cutoff := nowMillis - occupancyHistory.Milliseconds()
+
+	return p.kvUpdate(occupancyKey(spaceName), func(oldValue []byte) ([]byte, error) {
+		var samples []occupancySample
+		if oldValue != nil {
+			if err := json.Unmarshal(oldValue, &samples); err != nil {
+				return nil, errors.Wrap(err, "failed to decode occupancy samples")
+			}
+		}
+
+		// The newest sample before the cutoff is kept so the chart knows the occupancy at the
+		// start of the window.
+		first := 0
+		for first+1 < len(samples) && samples[first+1].At <= cutoff {
+			first++
+		}
+		samples = append(samples[first:], occupancySample{At: nowMillis, Count: count})
+		if len(samples) > maxOccupancySamples {
+			samples = samples[len(samples)-maxOccupancySamples:]
+		}
+
+		data, err := json.Marshal(samples)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to encode occupancy samples")
+		}
+		return data, nil
+	})
+}
+
+// getOccupancy returns the occupancy samples of the named space, oldest first.
+func (p *Plugin) getOccupancy(spaceName string) ([]occupancySample, error) {
+	data, appErr := p.API.KVGet(occupancyKey(spaceName))
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get occupancy samples")
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	var samples []occupancySample
+	if err := json.Unmarshal(data, &samples); err != nil {
+		return nil, errors.Wrap(err, "failed to decode occupancy samples")
+	}
+	return samples, nil
+}
+
+// occupancyBuckets returns the peak occupancy of each hour of the occupancyHistory before now,
+// oldest first. Occupancy carries over from the last sample until the next one.
+func occupancyBuckets(samples []occupancySample, now time.Time) []int {
+	buckets := make([]int, occupancyChartBuckets)
+	bucketMillis := (occupancyHistory / occupancyChartBuckets).Milliseconds()
+	start := now.UnixNano()/int64(time.Millisecond) - occupancyHistory.Milliseconds()
+
+	current, next := 0, 0
+	for i := range buckets {
+		bucketStart := start + int64(i)*bucketMillis
+		bucketEnd := bucketStart + bucketMillis
+
+		for next < len(samples) && samples[next].At <= bucketStart {
+			current = samples[next].Count
+			next++
+		}
+		// The last bucket also takes samples recorded in the same millisecond as now.
+		last := i == len(buckets)-1
+		peak := current
+		for next < len(samples) && (samples[next].At < bucketEnd || last) {
+			current = samples[next].Count
+			if current > peak {
+				peak = current
+			}
+			next++
+		}
+		buckets[i] = peak
+	}
+	return buckets
+}
+
+// renderOccupancyChart draws buckets as a PNG bar chart scaled to the highest bucket. The y axis
+// is labelled with the user count and the x axis with the hours before now.
+func renderOccupancyChart(buckets []int) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, occupancyChartWidth, occupancyChartHeight))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: occupancyChartBackground}, image.Point{}, draw.Src)
+
+	const (
+		left   = 36
+		right  = occupancyChartWidth - 10
+		top    = 10
+		margin = 4
+	)
+	baseline := occupancyChartHeight - chartLabelHeight - 3*margin
+	axis := &image.Uniform{C: occupancyChartAxis}
+
+	peak := 0
+	for _, count := range buckets {
+		if count > peak {
+			peak = count
+		}
+	}
+
+	// The y axis is labelled at zero, half the peak and the peak, with a grid line across.
+	ticks := []int{0}
+	if peak > 1 {
+		ticks = append(ticks, peak/2)
+	}
+	if peak > 0 && peak != peak/2 {
+		ticks = append(ticks, peak)
+	}
+	for _, tick := range ticks {
+		y := baseline
+		if peak > 0 {
+			y -= tick * (baseline - top) / peak
+		}
+		if tick > 0 {
+			draw.Draw(img, image.Rect(left, y, right, y+1), &image.Uniform{C: occupancyChartGrid}, image.Point{}, draw.Src)
+		}
+		label := strconv.Itoa(tick)
+		drawChartLabel(img, label, left-margin-chartLabelWidth(label), y-chartLabelHeight/2, occupancyChartAxis)
+	}
+
+	slot := (right - left) / len(buckets)
+	if peak > 0 {
+		for i, count := range buckets {
+			height := count * (baseline - top) / peak
+			barLeft := left + i*slot + slot/8
+			bar := image.Rect(barLeft, baseline-height, barLeft+slot*3/4, baseline)
+			draw.Draw(img, bar, &image.Uniform{C: occupancyChartBar}, image.Point{}, draw.Src)
+		}
+	}
+
+	draw.Draw(img, image.Rect(left, baseline, right, baseline+1), axis, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(left, top, left+1, baseline), axis, image.Point{}, draw.Src)
+
+	// The x axis is labelled every six buckets, counting the hours back from now.
+	for i := 0; i <= len(buckets); i += 6 {
+		x := left + i*slot
+		draw.Draw(img, image.Rect(x, baseline, x+1, baseline+margin), axis, image.Point{}, draw.Src)
+		label := "now"
+		if i < len(buckets) {
+			label = "-" + strconv.Itoa(len(buckets)-i) + "h"
+		}
+		drawChartLabel(img, label, x-chartLabelWidth(label)/2, baseline+2*margin, occupancyChartAxis)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, errors.Wrap(err, "failed to encode occupancy chart")
+	}
+	return buf.Bytes(), nil
+}
+
+// executeChartCommand posts a chart of a space's occupancy over the last day to the channel and
+// confirms it to the user.
+func (p *Plugin) executeChartCommand(args *model.CommandArgs, params []string, locale string) *model.CommandResponse {
+	spaceName := strings.Join(params, " ")
+
+	samples, err := p.getOccupancy(spaceName)
+	if err != nil {
+		p.API.LogWarn("Failed to get occupancy samples", "space_name", spaceName, "err", err.Error())
+		return ephemeralResponse(translate(locale, "Failed to look up the space. Please try again later."))
+	}
+	if len(samples) < 2 {
+		return ephemeralResponse(translate(locale, "Not enough occupancy data yet to draw a chart."))
+	}
+
+	buckets := occupancyBuckets(samples, time.Now())
+	peak := 0
+	for _, count := range buckets {
+		if count > peak {
+			peak = count
+		}
+	}
+
+	chart, err := renderOccupancyChart(buckets)
+	if err != nil {
+		p.API.LogWarn("Failed to render occupancy chart", "space_name", spaceName, "err", err.Error())
+		return ephemeralResponse(translate(locale, "Failed to post the occupancy chart. Please try again later."))
+	}
+
+	fileInfo, appErr := p.API.UploadFile(chart, args.ChannelId, "occupancy.png")
+	if appErr != nil {
+		p.API.LogWarn("Failed to upload occupancy chart", "channel_id", args.ChannelId, "err", appErr.Error())
+		return ephemeralResponse(translate(locale, "Failed to post the occupancy chart. Please try again later."))
+	}
+
+	message := translate(locale, "Occupancy of the space over the last 24 hours, peaking at %d.", peak)
+	if spaceName != "" {
+		message = translate(locale, "Occupancy of **%s** over the last 24 hours, peaking at %d.", spaceName, peak)
+	}
+	created, appErr := p.createIntegrationPost(&model.Post{
+		UserId:    p.botUserIDForSpace(spaceName),
+		ChannelId: args.ChannelId,
+		RootId:    args.RootId,
+		Message:   message,
+		FileIds:   model.StringArray{fileInfo.Id},
+	})
+	if appErr != nil {
+		p.API.LogWarn("Failed to post occupancy chart", "channel_id", args.ChannelId, "err", appErr.Error())
+		return ephemeralResponse(translate(locale, "Failed to post the occupancy chart. Please try again later."))
+	}
+
+	return p.postedResponse(args, created, locale)
+}
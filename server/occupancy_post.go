@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+// occupancyPostKey returns the KV key of the ID of the running occupancy post of the named
+// space. Space names are matched case-insensitively.
+func occupancyPostKey(spaceName string) string {
+	return hashedKey(occupancyPostKeyPrefix, strings.ToLower(spaceName))
+}
+
+// renderOccupancyPost formats the running occupancy post of a space with occupants users.
+func renderOccupancyPost(spaceName string, occupants int) string {
+	space := "the oVice space"
+	if spaceName != "" {
+		space = "**" + spaceName + "**"
+	}
+	switch occupants {
+	case 0:
+		return fmt.Sprintf(":busts_in_silhouette: Nobody is in %s.", space)
+	case 1:
+		return fmt.Sprintf(":busts_in_silhouette: 1 person is in %s.", space)
+	default:
+		return fmt.Sprintf(":busts_in_silhouette: %d people are in %s.", occupants, space)
+	}
+}
+
+// updateOccupancyPost edits the running occupancy post of the named space to show occupants. A
+// new post is made when there is none yet, it was deleted, or, with
+// OccupancyPostRepostOnReplies set, it has replies and is likely buried in a thread nobody
+// follows.
+func (p *Plugin) updateOccupancyPost(spaceName string, occupants int) error {
+	config := p.getConfiguration()
+	if !config.OccupancyPost {
+		return nil
+	}
+	channelID := p.resolveSpaceChannelID(spaceName, "")
+	if channelID == "" {
+		return nil
+	}
+	message := renderOccupancyPost(spaceName, occupants)
+	key := occupancyPostKey(spaceName)
+
+	postID, appErr := p.API.KVGet(key)
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to get occupancy post")
+	}
+	if postID != nil {
+		existing, getErr := p.API.GetPost(string(postID))
+		switch {
+		case getErr != nil || existing.DeleteAt != 0 || existing.ChannelId != channelID:
+		case config.OccupancyPostRepostOnReplies && existing.ReplyCount > 0:
+			p.API.LogDebug("Reposting occupancy post that has replies", "post_id", existing.Id)
+		default:
+			updated := existing.Clone()
+			updated.Message = message
+			if _, appErr = p.API.UpdatePost(updated); appErr != nil {
+				return errors.Wrap(appErr, "failed to update occupancy post")
+			}
+			return nil
+		}
+	}
+
+	created, appErr := p.createIntegrationPost(&model.Post{
+		UserId:    p.botUserIDForSpace(spaceName),
+		ChannelId: channelID,
+		Message:   message,
+	})
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to create occupancy post")
+	}
+	if appErr = p.API.KVSet(key, []byte(created.Id)); appErr != nil {
+		return errors.Wrap(appErr, "failed to store occupancy post")
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOccupancyPost(t *testing.T) {
+	config := &configuration{DefaultChannelID: "town", OccupancyPost: true, OccupancyPostRepostOnReplies: true}
+	// withPost stores existing as the running occupancy post of HQ.
+	withPost := func(t *testing.T, config *configuration, existing *model.Post) (*Plugin, *plugintest.API, *memKV) {
+		p, api, kv := newTestPlugin(t, config)
+		kv.data[occupancyPostKey("HQ")] = []byte(existing.Id)
+		api.On("GetPost", existing.Id).Return(existing, nil)
+		return p, api, kv
+	}
+
+	t.Run("first update creates the post", func(t *testing.T) {
+		p, api, kv := newTestPlugin(t, config)
+		posts := mockCreatePost(api)
+
+		require.NoError(t, p.updateOccupancyPost("HQ", 1))
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "town", (*posts)[0].ChannelId)
+		assert.Equal(t, ":busts_in_silhouette: 1 person is in **HQ**.", (*posts)[0].Message)
+		assert.Equal(t, "post0", string(kv.get(occupancyPostKey("HQ"))))
+	})
+
+	t.Run("post without replies is edited", func(t *testing.T) {
+		p, api, _ := withPost(t, config, &model.Post{Id: "running", ChannelId: "town", Message: "old"})
+		var updated *model.Post
+		api.On("UpdatePost", mock.AnythingOfType("*model.Post")).Return(func(post *model.Post) *model.Post {
+			updated = post
+			return post
+		}, nil)
+
+		require.NoError(t, p.updateOccupancyPost("HQ", 3))
+		require.NotNil(t, updated)
+		assert.Equal(t, "running", updated.Id)
+		assert.Equal(t, ":busts_in_silhouette: 3 people are in **HQ**.", updated.Message)
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("space name case does not matter", func(t *testing.T) {
+		p, api, _ := withPost(t, config, &model.Post{Id: "running", ChannelId: "town", Message: "old"})
+		api.On("UpdatePost", mock.AnythingOfType("*model.Post")).Return(func(post *model.Post) *model.Post {
+			return post
+		}, nil).Once()
+
+		require.NoError(t, p.updateOccupancyPost("hq", 2))
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("post with replies is replaced by a fresh one", func(t *testing.T) {
+		p, api, kv := withPost(t, config, &model.Post{Id: "running", ChannelId: "town", ReplyCount: 2})
+		posts := mockCreatePost(api)
+
+		require.NoError(t, p.updateOccupancyPost("HQ", 0))
+		require.Len(t, *posts, 1)
+		assert.Equal(t, ":busts_in_silhouette: Nobody is in **HQ**.", (*posts)[0].Message)
+		assert.Equal(t, "post0", string(kv.get(occupancyPostKey("HQ"))))
+		api.AssertNotCalled(t, "UpdatePost", mock.Anything)
+	})
+
+	t.Run("post with replies is edited when reposting is off", func(t *testing.T) {
+		config := *config
+		config.OccupancyPostRepostOnReplies = false
+		p, api, _ := withPost(t, &config, &model.Post{Id: "running", ChannelId: "town", ReplyCount: 2})
+		api.On("UpdatePost", mock.AnythingOfType("*model.Post")).Return(&model.Post{Id: "running"}, nil)
+
+		require.NoError(t, p.updateOccupancyPost("HQ", 2))
+		api.AssertNumberOfCalls(t, "UpdatePost", 1)
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("deleted post is replaced", func(t *testing.T) {
+		p, api, _ := withPost(t, config, &model.Post{Id: "running", ChannelId: "town", DeleteAt: 1})
+		posts := mockCreatePost(api)
+
+		require.NoError(t, p.updateOccupancyPost("HQ", 1))
+		assert.Len(t, *posts, 1)
+	})
+
+	t.Run("nothing is posted when disabled", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town"})
+
+		require.NoError(t, p.updateOccupancyPost("HQ", 1))
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOccupancyBuckets(t *testing.T) {
+	now := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	at := func(hoursAgo float64) int64 {
+		return now.Add(-time.Duration(hoursAgo*float64(time.Hour))).UnixNano() / int64(time.Millisecond)
+	}
+
+	buckets := occupancyBuckets([]occupancySample{
+		{At: at(30), Count: 1},
+		{At: at(3.5), Count: 4},
+		{At: at(3.2), Count: 2},
+		{At: at(1.5), Count: 0},
+	}, now)
+
+	require.Len(t, buckets, occupancyChartBuckets)
+	assert.Equal(t, 1, buckets[0])
+	assert.Equal(t, 1, buckets[19])
+	assert.Equal(t, 4, buckets[20])
+	assert.Equal(t, 2, buckets[21])
+	assert.Equal(t, 2, buckets[22])
+	assert.Equal(t, 0, buckets[23])
+}
+
+func TestRenderOccupancyChart(t *testing.T) {
+	chart, err := renderOccupancyChart([]int{0, 2, 4, 6, 8, 10, 8, 6, 4, 2, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1})
+	require.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(chart))
+	require.NoError(t, err)
+
+	// inked reports whether any pixel of the rectangle is drawn in the axis color.
+	inked := func(rect image.Rectangle) bool {
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				if color.RGBAModel.Convert(img.At(x, y)) == occupancyChartAxis {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	assert.True(t, inked(image.Rect(0, 0, 30, occupancyChartHeight)), "the y axis is labelled")
+	assert.True(t, inked(image.Rect(0, occupancyChartHeight-chartLabelHeight, occupancyChartWidth, occupancyChartHeight)), "the x axis is labelled")
+}
+
+func TestRecordOccupancy(t *testing.T) {
+	p, _, kv := newTestPlugin(t, nil)
+	now := time.Now()
+
+	require.NoError(t, p.recordOccupancy("HQ", 1, now.Add(-30*time.Hour)))
+	require.NoError(t, p.recordOccupancy("HQ", 2, now.Add(-26*time.Hour)))
+	require.NoError(t, p.recordOccupancy("HQ", 3, now))
+
+	var samples []occupancySample
+	require.NoError(t, json.Unmarshal(kv.get(occupancyKey("hq")), &samples))
+	require.Len(t, samples, 2, "only the newest sample before the window is kept")
+	assert.Equal(t, 2, samples[0].Count)
+	assert.Equal(t, 3, samples[1].Count)
+}
+
+func TestChartCommand(t *testing.T) {
+	t.Run("posts a chart of sample data", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town"})
+		mockUserLocale(api, "alice", "")
+		api.On("GetUserByEmail", mock.AnythingOfType("string")).Return(nil, &model.AppError{Message: "not found"})
+		posts := mockCreatePost(api)
+
+		for _, event := range []string{
+			`{"event":"enter","user_email":"alice@example.com","space_name":"HQ"}`,
+			`{"event":"enter","user_email":"bob@example.com","space_name":"HQ"}`,
+			`{"event":"leave","user_email":"alice@example.com","space_name":"HQ"}`,
+		} {
+			require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", event).Code)
+		}
+
+		var chart []byte
+		api.On("UploadFile", mock.Anything, "chat", "occupancy.png").Run(func(args mock.Arguments) {
+			chart = args.Get(0).([]byte)
+		}).Return(&model.FileInfo{Id: "chart"}, nil).Once()
+
+		mockSiteURL(api, "")
+		assert.Equal(t, "Posted.", executeCommand(t, p, "alice", "chat", "/ovice chart HQ"))
+
+		img, err := png.Decode(bytes.NewReader(chart))
+		require.NoError(t, err)
+		assert.Equal(t, occupancyChartWidth, img.Bounds().Dx())
+
+		require.Len(t, *posts, 4)
+		chartPost := (*posts)[3]
+		assert.Equal(t, "chat", chartPost.ChannelId)
+		assert.Equal(t, model.StringArray{"chart"}, chartPost.FileIds)
+		assert.Equal(t, "Occupancy of **HQ** over the last 24 hours, peaking at 2.", chartPost.Message)
+	})
+
+	t.Run("not enough data yet", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockUserLocale(api, "alice", "")
+		require.NoError(t, p.recordOccupancy("HQ", 1, time.Now()))
+
+		assert.Equal(t, "Not enough occupancy data yet to draw a chart.", executeCommand(t, p, "alice", "chat", "/ovice chart HQ"))
+		assert.Equal(t, "Not enough occupancy data yet to draw a chart.", executeCommand(t, p, "alice", "chat", "/ovice chart Lab"))
+		api.AssertNotCalled(t, "UploadFile", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
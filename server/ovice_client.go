@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// oviceClientTimeout bounds every request made to the oVice API.
+const oviceClientTimeout = 10 * time.Second
+
+// oviceClient calls the oVice API on behalf of the plugin.
+type oviceClient struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+
+	// retry applies to GET requests, which are safe to repeat.
+	retry retryPolicy
+}
+
+func newOviceClient(baseURL, apiKey string, retry retryPolicy) *oviceClient {
+	return &oviceClient{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		apiKey:     apiKey,
+		httpClient: &http.Client{Timeout: oviceClientTimeout},
+		retry:      retry,
+	}
+}
+
+// do sends a request with an optional JSON body to path and decodes a JSON response into out
+// when out is not nil. Only GET requests are retried.
+func (c *oviceClient) do(method, path string, body, out interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return errors.Wrap(err, "failed to encode request body")
+		}
+	}
+
+	retry := retryPolicy{}
+	if method == http.MethodGet {
+		retry = c.retry
+	}
+	resp, err := retry.do(c.httpClient, func() (*http.Request, error) {
+		var reader io.Reader
+		if data != nil {
+			reader = bytes.NewReader(data)
+		}
+		req, reqErr := http.NewRequest(method, c.baseURL+path, reader)
+		if reqErr != nil {
+			return nil, errors.Wrap(reqErr, "failed to build request")
+		}
+		if data != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if c.apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+c.apiKey)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to call oVice API %s %s", method, path)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.Errorf("oVice API %s %s returned %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	if out != nil {
+		if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return errors.Wrap(err, "failed to decode oVice API response")
+		}
+	}
+	return nil
+}
+
+// AcceptKnock lets the user who knocked into the space.
+func (c *oviceClient) AcceptKnock(spaceName, fromName, targetEmail string) error {
+	return c.do(http.MethodPost, "/knocks/accept", map[string]string{
+		"space_name":   spaceName,
+		"from_name":    fromName,
+		"target_email": targetEmail,
+	}, nil)
+}
+
+// spaceThumbnailResponse is returned by the oVice API for a space's thumbnail.
+type spaceThumbnailResponse struct {
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
+// GetSpaceThumbnail returns the URL of the current thumbnail image of the space.
+func (c *oviceClient) GetSpaceThumbnail(spaceName string) (string, error) {
+	var response spaceThumbnailResponse
+	if err := c.do(http.MethodGet, "/spaces/thumbnail?space_name="+url.QueryEscape(spaceName), nil, &response); err != nil {
+		return "", err
+	}
+	return response.ThumbnailURL, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// plainTextFallbackNote ends a post that was reposted without its attachments and props.
+const plainTextFallbackNote = "_(Posted as plain text because the server rejected the attachments of this message.)_"
+
+// isAttachmentRejection reports whether appErr rejected a post because of its attachments or
+// props, which the server reports as a 400 with the post validation error of its props.
+func isAttachmentRejection(appErr *model.AppError) bool {
+	if appErr.StatusCode != http.StatusBadRequest {
+		return false
+	}
+	return strings.Contains(appErr.Id, "props") || strings.Contains(appErr.Id, "attachment")
+}
+
+// plainTextFallback returns post without its attachments and props, with the text of each
+// attachment added to the message, followed by plainTextFallbackNote. The origin marker is kept
+// so the fallback is still recognized by SuppressSelfOriginated.
+func plainTextFallback(post *model.Post) *model.Post {
+	lines := []string{}
+	if post.Message != "" {
+		lines = append(lines, post.Message)
+	}
+	for _, attachment := range post.Attachments() {
+		text := attachment.Fallback
+		if text == "" {
+			text = attachment.Text
+		}
+		if text == "" {
+			text = attachment.Title
+		}
+		if text != "" {
+			lines = append(lines, text)
+		}
+	}
+	lines = append(lines, plainTextFallbackNote)
+
+	fallback := &model.Post{
+		UserId:    post.UserId,
+		ChannelId: post.ChannelId,
+		RootId:    post.RootId,
+		Message:   strings.Join(lines, "\n\n"),
+		FileIds:   post.FileIds,
+	}
+	if origin := post.GetProp(originProp); origin != nil {
+		fallback.AddProp(originProp, origin)
+	}
+	return fallback
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlainTextFallback(t *testing.T) {
+	const message = `{"channel_id":"channel","message":"HQ opens at 9","attachments":[{"title":"HQ","text":"Floor plan attached"}]}`
+	propsErr := model.NewAppError("CreatePost", "model.post.is_valid.props.app_error", nil, "", http.StatusBadRequest)
+
+	// rejectFirst fails the first CreatePost with appErr and records the posts created after.
+	rejectFirst := func(api *plugintest.API, appErr *model.AppError) *[]*model.Post {
+		var posts []*model.Post
+		api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(nil, appErr).Once()
+		api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(func(post *model.Post) *model.Post {
+			posts = append(posts, post)
+			return &model.Post{Id: "fallback"}
+		}, nil).Maybe()
+		return &posts
+	}
+
+	t.Run("rejected attachments are reposted as plain text", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{PlainTextFallback: true})
+		posts := rejectFirst(api, propsErr)
+
+		w := doRequest(p, http.MethodPost, "/webhook", message)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		require.Len(t, *posts, 1)
+		post := (*posts)[0]
+		assert.Equal(t, "HQ opens at 9\n\nFloor plan attached\n\n"+plainTextFallbackNote, post.Message)
+		assert.Empty(t, post.Attachments())
+		assert.Empty(t, post.GetProps())
+
+		var response webhookResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "partial", response.Status)
+		assert.True(t, response.PlainTextFallback)
+		assert.Equal(t, "fallback", response.PostID)
+	})
+
+	t.Run("other failures are not retried", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{PlainTextFallback: true})
+		posts := rejectFirst(api, model.NewAppError("CreatePost", "app.post.save.app_error", nil, "", http.StatusInternalServerError))
+
+		w := doRequest(p, http.MethodPost, "/webhook", message)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Empty(t, *posts)
+	})
+
+	t.Run("disabled fails the message", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{})
+		posts := rejectFirst(api, propsErr)
+
+		w := doRequest(p, http.MethodPost, "/webhook", message)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Empty(t, *posts)
+	})
+}
@@ -3,9 +3,13 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"strings"
 	"sync"
+	"text/template"
+	"time"
 
 	"github.com/mattermost/mattermost-server/v6/plugin"
+	"github.com/pkg/errors"
 )
 
 // Plugin implements the interface expected by the Mattermost server to communicate between the server and plugin processes.
@@ -18,11 +22,189 @@ type Plugin struct {
 	// configuration is the active plugin configuration. Consult getConfiguration and
 	// setConfiguration for usage.
 	configuration *configuration
+
+	// messageTemplateLock synchronizes access to messageTemplate.
+	messageTemplateLock sync.RWMutex
+
+	// messageTemplate is compiled from the MessageTemplate setting whenever the configuration
+	// changes, so requests never compile or see a broken template.
+	messageTemplate *template.Template
+
+	// maintenanceStop and maintenanceDone control the KV maintenance goroutine.
+	maintenanceStop chan struct{}
+	maintenanceDone chan struct{}
+
+	// botUserID is the user ID of the shared bot that authors posts made by the plugin.
+	botUserID string
+
+	// spaceBotsLock synchronizes access to spaceBotIDs.
+	spaceBotsLock sync.RWMutex
+
+	// spaceBotIDs maps the bot username of each space that has its own bot to the bot's user ID.
+	spaceBotIDs map[string]string
+
+	// presenceBatchesLock synchronizes access to presenceBatches.
+	presenceBatchesLock sync.Mutex
+
+	// presenceBatches holds the presence events waiting to be announced together, keyed by
+	// presenceBatchKey.
+	presenceBatches map[string]*presenceBatch
+
+	// pendingLeavesLock synchronizes access to pendingLeaves.
+	pendingLeavesLock sync.Mutex
+
+	// pendingLeaves holds the timer posting each leave held back for LeaveGraceSeconds, keyed by
+	// pendingLeaveKey.
+	pendingLeaves map[string]*time.Timer
+
+	// channelInfoLock synchronizes access to channelInfo.
+	channelInfoLock sync.Mutex
+
+	// channelInfo caches the names reported for recently posted-to channels, keyed by channel ID.
+	channelInfo map[string]*channelInfo
+
+	// thumbnailsLock synchronizes access to thumbnails.
+	thumbnailsLock sync.Mutex
+
+	// thumbnails caches the thumbnail URL of recently announced spaces, keyed by lower-cased
+	// space name.
+	thumbnails map[string]*cachedThumbnail
+
+	// errorReportsLock synchronizes access to lastErrorReport and suppressedErrorReports.
+	errorReportsLock sync.Mutex
+
+	// lastErrorReport is when a failure was last reported to ErrorChannelID, and
+	// suppressedErrorReports how many failures were not reported since then.
+	lastErrorReport        time.Time
+	suppressedErrorReports int
+
+	// inFlightLock synchronizes access to inFlight, the number of webhook and event requests
+	// being handled.
+	inFlightLock sync.Mutex
+	inFlight     int
+
+	// ipRateLimiter tracks the RateLimitPerMinute budget of each source IP.
+	ipRateLimiter rateLimiter
+
+	// chatRateLimiter tracks the ChatRateLimitPerMinute budget of each chat sender, and
+	// chatWarningLimiter how recently each was warned about exceeding it.
+	chatRateLimiter    rateLimiter
+	chatWarningLimiter rateLimiter
+
+	// spaceRateLimiter tracks the events budget of each space, keyed by lower-cased space name.
+	spaceRateLimiter rateLimiter
+
+	// metrics counts the outcome of the requests handled through limitRequest.
+	metrics requestMetrics
+
+	// registeredTrigger is the slash command trigger currently registered with the server.
+	registeredTrigger string
+
+	// sleeper replaces time.Sleep when waiting to retry a failed post. Nil uses time.Sleep.
+	sleeper func(time.Duration)
+
+	// spanExporter receives trace spans when EnableTracing is on. Nil logs them.
+	spanExporter spanExporter
 }
 
-// ServeHTTP demonstrates a plugin that handles HTTP requests by greeting the world.
+// OnActivate ensures the plugin bots exist and registers the /ovice command before any hook or
+// request can use them, stores the configuration if it was migrated, then starts the KV
+// maintenance goroutine.
+func (p *Plugin) OnActivate() error {
+	botUserID, err := p.ensureBot(botUsername, botDisplayName)
+	if err != nil {
+		return errors.Wrap(err, "failed to ensure bot")
+	}
+	p.botUserID = botUserID
+
+	if err = p.ensureSpaceBots(); err != nil {
+		return err
+	}
+
+	if err = p.registerCommands(); err != nil {
+		return errors.Wrap(err, "failed to register commands")
+	}
+
+	if err = p.storeMigratedConfiguration(); err != nil {
+		p.API.LogWarn("Failed to store migrated plugin configuration", "err", err.Error())
+	}
+
+	p.startMaintenance()
+
+	return nil
+}
+
+// OnDeactivate stops the background work started in OnActivate and posts any presence
+// announcements still waiting to be coalesced. Leaves within their grace period are kept for
+// the next activation.
+func (p *Plugin) OnDeactivate() error {
+	p.stopMaintenance()
+	p.stopPendingLeaves()
+	p.flushPresenceBatches()
+	return nil
+}
+
+// ServeHTTP routes the webhook endpoints exposed to oVice. Every endpoint lives under the
+// configured PathPrefix.
 func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "Hello, world!")
+	p.setResponseHeaders(w)
+
+	path, ok := trimPathPrefix(r.URL.Path, p.getConfiguration().pathPrefix)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch path {
+	case "/":
+		fmt.Fprint(w, "Hello, world!")
+	case "/webhook":
+		p.limitRequest(w, r, p.handleWebhook)
+	case "/webhook/batch":
+		p.limitRequest(w, r, p.handleWebhookBatch)
+	case "/debug/echo":
+		p.limitRequest(w, r, p.handleDebugEcho)
+	case "/events":
+		p.limitRequest(w, r, p.handleEvents)
+	case "/actions/knock":
+		p.handleKnockAction(w, r)
+	case "/actions/poll":
+		p.handlePollAction(w, r)
+	case "/me/notify":
+		p.limitRequest(w, r, p.handleNotify)
+	case "/metrics":
+		p.handleMetrics(w, r)
+	case "/metrics.json":
+		p.handleMetricsJSON(w, r)
+	case "/join/verify":
+		p.handleJoinVerify(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// limitRequest applies the per-IP rate limit and then the concurrency limit to handler, counting
+// the response in the request metrics.
+func (p *Plugin) limitRequest(w http.ResponseWriter, r *http.Request, handler http.HandlerFunc) {
+	p.recordRequest(w, r, func(w http.ResponseWriter, r *http.Request) {
+		p.limitRate(w, r, func(w http.ResponseWriter, r *http.Request) {
+			p.limitConcurrency(w, r, handler)
+		})
+	})
+}
+
+// trimPathPrefix returns path relative to prefix, reporting false if path is not under prefix.
+func trimPathPrefix(path, prefix string) (string, bool) {
+	if prefix == "" {
+		return path, true
+	}
+	if path == prefix {
+		return "/", true
+	}
+	if !strings.HasPrefix(path, prefix+"/") {
+		return "", false
+	}
+	return strings.TrimPrefix(path, prefix), true
 }
 
 // See https://developers.mattermost.com/extend/plugins/server/reference/
@@ -7,6 +7,9 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	root "github.com/mattermost/mattermost-plugin-starter-template"
 )
 
 func TestServeHTTP(t *testing.T) {
@@ -26,3 +29,35 @@ func TestServeHTTP(t *testing.T) {
 
 	assert.Equal("Hello, world!", bodyString)
 }
+
+func TestPathPrefix(t *testing.T) {
+	t.Run("endpoints live under a custom prefix", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{PathPrefix: "/ovice/"})
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/ovice/webhook", `{"channel_id":"channel","message":"hi"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, *posts, 1)
+
+		assert.Equal(t, "Hello, world!", doRequest(p, http.MethodGet, "/ovice", "").Body.String())
+		assert.Equal(t, http.StatusNotFound, doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi"}`).Code)
+		assert.Equal(t, http.StatusNotFound, doRequest(p, http.MethodPost, "/oviceevents", `{}`).Code)
+		assert.Equal(t, "/plugins/"+root.Manifest.Id+"/ovice/actions/knock", p.getConfiguration().endpointPath("/actions/knock"))
+	})
+
+	t.Run("default serves from the root", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{PathPrefix: "/"})
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, *posts, 1)
+		assert.Equal(t, "/plugins/"+root.Manifest.Id+"/actions/knock", p.getConfiguration().endpointPath("/actions/knock"))
+	})
+
+	t.Run("invalid prefix is rejected", func(t *testing.T) {
+		for _, prefix := range []string{"/a//b", "/../x", "/with space", "/q?x=1"} {
+			assert.Error(t, (&configuration{PathPrefix: prefix}).process(), prefix)
+		}
+	})
+}
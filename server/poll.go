@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	pollChoiceYes = "yes"
+	pollChoiceNo  = "no"
+
+	// pollQuestionProp and pollLocaleProp hold the question and locale of a poll post, so votes
+	// are checked against the stored post rather than what the client sends.
+	pollQuestionProp = "ovice_poll_question"
+	pollLocaleProp   = "ovice_poll_locale"
+)
+
+// pollRecord holds the votes cast on a poll, keyed by user ID. Each user has one vote, which
+// they can change.
+type pollRecord struct {
+	Votes map[string]string `json:"votes"`
+}
+
+// pollKey returns the KV key of the votes of the poll posted as postID. Post IDs fit the key
+// length limit as they are.
+func pollKey(postID string) string {
+	return pollKeyPrefix + postID
+}
+
+// pruneDeletedPoll removes the votes of polls whose post no longer exists or was deleted. Any
+// other lookup failure keeps the votes.
+func (p *Plugin) pruneDeletedPoll(key string, _ []byte, _ time.Time) bool {
+	post, appErr := p.API.GetPost(strings.TrimPrefix(key, pollKeyPrefix))
+	if appErr != nil {
+		return appErr.StatusCode == http.StatusNotFound
+	}
+	return post.DeleteAt > 0
+}
+
+// tally counts the yes and no votes of the poll.
+func (r *pollRecord) tally() (yes, no int) {
+	for _, choice := range r.Votes {
+		if choice == pollChoiceYes {
+			yes++
+		} else {
+			no++
+		}
+	}
+	return yes, no
+}
+
+// buildPollPost renders question with its current tally and the Yes and No buttons.
+func (p *Plugin) buildPollPost(question, locale string, yes, no int) *model.Post {
+	pollAction := func(choice, name, style string) *model.PostAction {
+		return &model.PostAction{
+			Id:    choice,
+			Name:  name,
+			Type:  model.PostActionTypeButton,
+			Style: style,
+			Integration: &model.PostActionIntegration{
+				URL: p.getConfiguration().endpointPath("/actions/poll"),
+				Context: map[string]interface{}{
+					"choice": choice,
+				},
+			},
+		}
+	}
+
+	post := &model.Post{}
+	model.ParseSlackAttachment(post, []*model.SlackAttachment{{
+		Fallback: question,
+		Text:     "**" + question + "**\n" + translate(locale, "Yes: %d · No: %d", yes, no),
+		Actions: []*model.PostAction{
+			pollAction(pollChoiceYes, translate(locale, "Yes"), "primary"),
+			pollAction(pollChoiceNo, translate(locale, "No"), "default"),
+		},
+	}})
+	post.AddProp(pollQuestionProp, question)
+	post.AddProp(pollLocaleProp, locale)
+	return post
+}
+
+// executePollCommand posts a yes/no poll on the question to the channel and confirms it to the
+// user.
+func (p *Plugin) executePollCommand(args *model.CommandArgs, params []string, locale string) *model.CommandResponse {
+	question := strings.Join(params, " ")
+	if question == "" {
+		return ephemeralResponse(translate(locale, "Usage: `/%s poll <question>`", p.getConfiguration().commandTrigger()))
+	}
+
+	post := p.buildPollPost(question, locale, 0, 0)
+	post.UserId = p.botUserID
+	post.ChannelId = args.ChannelId
+	post.RootId = args.RootId
+	created, appErr := p.createIntegrationPost(post)
+	if appErr != nil {
+		p.API.LogWarn("Failed to post poll", "channel_id", args.ChannelId, "err", appErr.Error())
+		return ephemeralResponse(translate(locale, "Failed to post the poll. Please try again later."))
+	}
+	return p.postedResponse(args, created, locale)
+}
+
+// castPollVote records choice as the vote of userID on the poll posted as postID, replacing any
+// earlier vote of theirs, and returns the new tally.
+func (p *Plugin) castPollVote(postID, userID, choice string) (yes, no int, err error) {
+	err = p.kvUpdate(pollKey(postID), func(oldValue []byte) ([]byte, error) {
+		record := &pollRecord{}
+		if oldValue != nil {
+			if decodeErr := json.Unmarshal(oldValue, record); decodeErr != nil {
+				return nil, errors.Wrap(decodeErr, "failed to decode poll votes")
+			}
+		}
+		if record.Votes == nil {
+			record.Votes = map[string]string{}
+		}
+		record.Votes[userID] = choice
+		yes, no = record.tally()
+
+		data, encodeErr := json.Marshal(record)
+		if encodeErr != nil {
+			return nil, errors.Wrap(encodeErr, "failed to encode poll votes")
+		}
+		return data, nil
+	})
+	return yes, no, err
+}
+
+// handlePollAction handles the Yes and No buttons of a poll, updating the poll with the new
+// tally. The poll is read from the stored post, and the voter must be able to read its channel.
+func (p *Plugin) handlePollAction(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		p.writeError(w, newHTTPError(http.StatusUnauthorized, "not authorized"))
+		return
+	}
+
+	var request model.PostActionIntegrationRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes)).Decode(&request); err != nil {
+		p.writeError(w, newHTTPError(http.StatusBadRequest, "invalid JSON payload"))
+		return
+	}
+
+	choice, _ := request.Context["choice"].(string)
+	if choice != pollChoiceYes && choice != pollChoiceNo {
+		p.writeError(w, newValidationError("unknown poll choice"))
+		return
+	}
+	if request.PostId == "" {
+		p.writeError(w, newValidationError("post_id is required"))
+		return
+	}
+	poll, appErr := p.API.GetPost(request.PostId)
+	if appErr != nil {
+		p.writeError(w, newHTTPError(http.StatusNotFound, "poll not found"))
+		return
+	}
+	question, _ := poll.GetProp(pollQuestionProp).(string)
+	locale, _ := poll.GetProp(pollLocaleProp).(string)
+	if poll.UserId != p.botUserID || question == "" {
+		p.writeError(w, newHTTPError(http.StatusNotFound, "poll not found"))
+		return
+	}
+	if !p.API.HasPermissionToChannel(userID, poll.ChannelId, model.PermissionReadChannel) {
+		p.writeError(w, newHTTPError(http.StatusForbidden, "only channel members can vote"))
+		return
+	}
+
+	yes, no, err := p.castPollVote(request.PostId, userID, choice)
+	if err != nil {
+		p.API.LogWarn("Failed to record poll vote", "post_id", request.PostId, "err", err.Error())
+		writeJSON(w, http.StatusOK, &model.PostActionIntegrationResponse{
+			EphemeralText: translate(locale, "Failed to record your vote. Please try again."),
+		})
+		return
+	}
+
+	update := p.buildPollPost(question, locale, yes, no)
+	update.Id = request.PostId
+	writeJSON(w, http.StatusOK, &model.PostActionIntegrationResponse{Update: update})
+}
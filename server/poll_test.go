@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPollCommand(t *testing.T) {
+	t.Run("posts the question with yes and no buttons", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockUserLocale(api, "alice", "")
+		posts := mockCreatePost(api)
+
+		mockSiteURL(api, "")
+
+		assert.Equal(t, "Posted.", executeCommand(t, p, "alice", "town", "/ovice poll Should we keep the space open?"))
+		require.Len(t, *posts, 1)
+		assert.Equal(t, testBotUserID, (*posts)[0].UserId)
+		attachments := (*posts)[0].Attachments()
+		require.Len(t, attachments, 1)
+		assert.Equal(t, "**Should we keep the space open?**\nYes: 0 · No: 0", attachments[0].Text)
+		require.Len(t, attachments[0].Actions, 2)
+		assert.Equal(t, "/plugins/com.mattermost.plugin-starter-template/actions/poll", attachments[0].Actions[0].Integration.URL)
+		assert.Equal(t, pollChoiceYes, attachments[0].Actions[0].Integration.Context["choice"])
+		assert.Equal(t, pollChoiceNo, attachments[0].Actions[1].Integration.Context["choice"])
+	})
+
+	t.Run("requires a question", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockUserLocale(api, "alice", "")
+
+		assert.Equal(t, "Usage: `/ovice poll <question>`", executeCommand(t, p, "alice", "town", "/ovice poll"))
+	})
+}
+
+func TestPollAction(t *testing.T) {
+	vote := func(p *Plugin, userID, choice string) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(&model.PostActionIntegrationRequest{
+			UserId:    userID,
+			PostId:    "pollpost",
+			ChannelId: "town",
+			Context:   map[string]interface{}{"choice": choice},
+		})
+		r := httptest.NewRequest(http.MethodPost, "/actions/poll", strings.NewReader(string(data)))
+		r.Header.Set("Mattermost-User-ID", userID)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, r)
+		return w
+	}
+	tallyOf := func(t *testing.T, w *httptest.ResponseRecorder) string {
+		require.Equal(t, http.StatusOK, w.Code)
+		var response model.PostActionIntegrationResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.NotNil(t, response.Update)
+		assert.Equal(t, "pollpost", response.Update.Id)
+		attachments := response.Update.Attachments()
+		require.Len(t, attachments, 1)
+		return strings.TrimPrefix(attachments[0].Text, "**Keep it open?**\n")
+	}
+	// mockPoll stores the poll on "Keep it open?" posted by the bot in channelID as pollpost.
+	mockPoll := func(p *Plugin, api *plugintest.API, channelID string) {
+		post := p.buildPollPost("Keep it open?", "en", 0, 0)
+		post.Id = "pollpost"
+		post.UserId = testBotUserID
+		post.ChannelId = channelID
+		api.On("GetPost", "pollpost").Return(post, nil).Maybe()
+	}
+	setup := func(t *testing.T) *Plugin {
+		p, api, _ := newTestPlugin(t, nil)
+		mockPoll(p, api, "town")
+		api.On("HasPermissionToChannel", mock.AnythingOfType("string"), "town", model.PermissionReadChannel).Return(true).Maybe()
+		return p
+	}
+
+	t.Run("casting a vote", func(t *testing.T) {
+		p := setup(t)
+
+		assert.Equal(t, "Yes: 1 · No: 0", tallyOf(t, vote(p, "alice", pollChoiceYes)))
+		assert.Equal(t, "Yes: 1 · No: 1", tallyOf(t, vote(p, "bob", pollChoiceNo)))
+	})
+
+	t.Run("changing a vote", func(t *testing.T) {
+		p := setup(t)
+
+		assert.Equal(t, "Yes: 1 · No: 0", tallyOf(t, vote(p, "alice", pollChoiceYes)))
+		assert.Equal(t, "Yes: 0 · No: 1", tallyOf(t, vote(p, "alice", pollChoiceNo)))
+		assert.Equal(t, "Yes: 0 · No: 1", tallyOf(t, vote(p, "alice", pollChoiceNo)))
+	})
+
+	t.Run("concurrent votes are all counted", func(t *testing.T) {
+		p := setup(t)
+
+		const voters = 8
+		var wg sync.WaitGroup
+		for i := 0; i < voters; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				choice := pollChoiceYes
+				if i%2 == 1 {
+					choice = pollChoiceNo
+				}
+				assert.Equal(t, http.StatusOK, vote(p, fmt.Sprintf("user%d", i), choice).Code)
+			}(i)
+		}
+		wg.Wait()
+
+		assert.Equal(t, "Yes: 4 · No: 5", tallyOf(t, vote(p, "late", pollChoiceNo)))
+	})
+
+	t.Run("non-members cannot vote", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockPoll(p, api, "town")
+		api.On("HasPermissionToChannel", "mallory", "town", model.PermissionReadChannel).Return(false)
+
+		assert.Equal(t, http.StatusForbidden, vote(p, "mallory", pollChoiceYes).Code)
+	})
+
+	t.Run("permission is checked on the channel of the poll", func(t *testing.T) {
+		p, api, kv := newTestPlugin(t, nil)
+		mockPoll(p, api, "secret")
+		api.On("HasPermissionToChannel", "mallory", "secret", model.PermissionReadChannel).Return(false)
+
+		assert.Equal(t, http.StatusForbidden, vote(p, "mallory", pollChoiceYes).Code)
+		assert.Empty(t, kv.keys())
+	})
+
+	t.Run("post that is not a poll is rejected", func(t *testing.T) {
+		p, api, kv := newTestPlugin(t, nil)
+		api.On("GetPost", "pollpost").Return(&model.Post{Id: "pollpost", UserId: testBotUserID, ChannelId: "town"}, nil)
+
+		assert.Equal(t, http.StatusNotFound, vote(p, "alice", pollChoiceYes).Code)
+		assert.Empty(t, kv.keys())
+	})
+
+	t.Run("votes of deleted polls are pruned", func(t *testing.T) {
+		p, api, kv := newTestPlugin(t, nil)
+		kv.data[pollKey("live")] = []byte(`{"votes":{}}`)
+		kv.data[pollKey("deleted")] = []byte(`{"votes":{}}`)
+		kv.data[pollKey("gone")] = []byte(`{"votes":{}}`)
+		api.On("GetPost", "live").Return(&model.Post{Id: "live"}, nil)
+		api.On("GetPost", "deleted").Return(&model.Post{Id: "deleted", DeleteAt: 1}, nil)
+		api.On("GetPost", "gone").Return(nil, &model.AppError{StatusCode: http.StatusNotFound})
+
+		require.NoError(t, p.runMaintenance(time.Now()))
+		assert.Equal(t, []string{pollKey("live")}, kv.keys())
+	})
+
+	t.Run("unknown choice", func(t *testing.T) {
+		p := setup(t)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, vote(p, "alice", "maybe").Code)
+	})
+}
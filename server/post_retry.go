@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+const (
+	// postRetryBackoff is the pause before retrying a failed post when the server gives no
+	// Retry-After.
+	postRetryBackoff = time.Second
+
+	// maxPostRetryAfter caps how long a Retry-After from the server may delay a retry, so a bogus
+	// value cannot stall a request.
+	maxPostRetryAfter = 30 * time.Second
+)
+
+// retryAfterPattern finds the Retry-After a rate-limited server reports in an AppError's detailed
+// error, e.g. "Retry-After: 3".
+var retryAfterPattern = regexp.MustCompile(`(?i)retry[-_ ]after[:= ]+([0-9]+(?:\.[0-9]+)?)`)
+
+// createPost creates post, retrying rate-limited and server failures until PostDeadlineMs after
+// the first attempt. Each retry waits for the Retry-After the server asked for, capped at
+// maxPostRetryAfter, or postRetryBackoff otherwise.
+//
+// A server failure may come after the post was saved, so the post carries a pending post ID:
+// the server answers a retry of a saved post with that post instead of creating it again.
+func (p *Plugin) createPost(post *model.Post) (*model.Post, *model.AppError) {
+	p.markIntegrationPost(post)
+	if post.PendingPostId == "" {
+		post.PendingPostId = model.NewId()
+	}
+	deadline := time.Duration(p.getConfiguration().PostDeadlineMs) * time.Millisecond
+	start := time.Now()
+	for {
+		created, appErr := p.API.CreatePost(post)
+		if appErr == nil || !isRetryablePostError(appErr) {
+			return created, appErr
+		}
+
+		wait := postRetryBackoff
+		if retryAfter, ok := retryAfterFromAppError(appErr); ok {
+			wait = retryAfter
+			if wait > maxPostRetryAfter {
+				wait = maxPostRetryAfter
+			}
+		}
+		if wait > deadline-time.Since(start) {
+			return nil, appErr
+		}
+
+		p.API.LogWarn("Retrying failed post", "channel_id", post.ChannelId, "wait", wait.String(), "err", appErr.Error())
+		p.sleep(wait)
+	}
+}
+
+// isRetryablePostError reports whether a failed CreatePost may succeed if tried again.
+func isRetryablePostError(appErr *model.AppError) bool {
+	return appErr.StatusCode == http.StatusTooManyRequests || appErr.StatusCode >= http.StatusInternalServerError
+}
+
+// retryAfterFromAppError returns the Retry-After, in seconds, of a rate-limited AppError.
+func retryAfterFromAppError(appErr *model.AppError) (time.Duration, bool) {
+	if appErr.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	match := retryAfterPattern.FindStringSubmatch(appErr.DetailedError)
+	if match == nil {
+		return 0, false
+	}
+	seconds, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(seconds * float64(time.Second)), true
+}
+
+// sleep pauses for d, through sleeper when it is set.
+func (p *Plugin) sleep(d time.Duration) {
+	if p.sleeper != nil {
+		p.sleeper(d)
+		return
+	}
+	time.Sleep(d)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreatePostRetry(t *testing.T) {
+	rateLimited := func(details string) *model.AppError {
+		return model.NewAppError("CreatePost", "api.context.rate_limit", nil, details, http.StatusTooManyRequests)
+	}
+	setup := func(t *testing.T, deadlineMs int, failures ...*model.AppError) (*Plugin, *[]time.Duration) {
+		p, api, _ := newTestPlugin(t, &configuration{PostDeadlineMs: deadlineMs})
+		for _, appErr := range failures {
+			api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(nil, appErr).Once()
+		}
+		mockCreatePost(api)
+
+		var waits []time.Duration
+		p.sleeper = func(d time.Duration) { waits = append(waits, d) }
+		return p, &waits
+	}
+	post := func() *model.Post { return &model.Post{UserId: testBotUserID, ChannelId: "town", Message: "hi"} }
+
+	t.Run("waits for the server's Retry-After", func(t *testing.T) {
+		p, waits := setup(t, 10000, rateLimited("Retry-After: 3"))
+
+		created, appErr := p.createPost(post())
+		require.Nil(t, appErr)
+		assert.Equal(t, "post0", created.Id)
+		assert.Equal(t, []time.Duration{3 * time.Second}, *waits)
+	})
+
+	t.Run("fractional Retry-After", func(t *testing.T) {
+		p, waits := setup(t, 10000, rateLimited("too many requests, retry_after=1.5"))
+
+		_, appErr := p.createPost(post())
+		require.Nil(t, appErr)
+		assert.Equal(t, []time.Duration{1500 * time.Millisecond}, *waits)
+	})
+
+	t.Run("Retry-After is capped", func(t *testing.T) {
+		p, waits := setup(t, 60000, rateLimited("Retry-After: 120"))
+
+		_, appErr := p.createPost(post())
+		require.Nil(t, appErr)
+		assert.Equal(t, []time.Duration{maxPostRetryAfter}, *waits)
+	})
+
+	t.Run("default backoff without Retry-After", func(t *testing.T) {
+		p, waits := setup(t, 10000, rateLimited(""), model.NewAppError("CreatePost", "app.post.save.app_error", nil, "", http.StatusInternalServerError))
+
+		_, appErr := p.createPost(post())
+		require.Nil(t, appErr)
+		assert.Equal(t, []time.Duration{postRetryBackoff, postRetryBackoff}, *waits)
+	})
+
+	t.Run("gives up at the deadline", func(t *testing.T) {
+		p, waits := setup(t, 2000, rateLimited("Retry-After: 1"), rateLimited("Retry-After: 3"))
+
+		_, appErr := p.createPost(post())
+		require.NotNil(t, appErr)
+		assert.Equal(t, http.StatusTooManyRequests, appErr.StatusCode)
+		assert.Equal(t, []time.Duration{time.Second}, *waits)
+	})
+
+	t.Run("no retries without a deadline", func(t *testing.T) {
+		p, waits := setup(t, 0, rateLimited("Retry-After: 1"))
+
+		_, appErr := p.createPost(post())
+		require.NotNil(t, appErr)
+		assert.Empty(t, *waits)
+	})
+
+	t.Run("retries carry the same pending post ID", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{PostDeadlineMs: 10000})
+		var pendingIDs []string
+		api.On("CreatePost", mock.AnythingOfType("*model.Post")).Run(func(args mock.Arguments) {
+			pendingIDs = append(pendingIDs, args.Get(0).(*model.Post).PendingPostId)
+		}).Return(nil, model.NewAppError("CreatePost", "app.post.save.app_error", nil, "", http.StatusInternalServerError)).Once()
+		mockCreatePost(api)
+		p.sleeper = func(time.Duration) {}
+
+		created, appErr := p.createPost(post())
+		require.Nil(t, appErr)
+		require.Len(t, pendingIDs, 1)
+		assert.NotEmpty(t, pendingIDs[0])
+		assert.Equal(t, pendingIDs[0], created.PendingPostId)
+	})
+
+	t.Run("deadline counts from the first attempt", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{PostDeadlineMs: 3000})
+		api.On("CreatePost", mock.AnythingOfType("*model.Post")).Run(func(mock.Arguments) {
+			time.Sleep(50 * time.Millisecond)
+		}).Return(nil, rateLimited("Retry-After: 3")).Once()
+		var waits []time.Duration
+		p.sleeper = func(d time.Duration) { waits = append(waits, d) }
+
+		_, appErr := p.createPost(post())
+		require.NotNil(t, appErr)
+		assert.Empty(t, waits)
+	})
+
+	t.Run("client errors are not retried", func(t *testing.T) {
+		p, waits := setup(t, 10000, model.NewAppError("CreatePost", "api.post.create_post.root_id.app_error", nil, "", http.StatusBadRequest))
+
+		_, appErr := p.createPost(post())
+		require.NotNil(t, appErr)
+		assert.Equal(t, http.StatusBadRequest, appErr.StatusCode)
+		assert.Empty(t, *waits)
+	})
+}
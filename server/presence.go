@@ -0,0 +1,306 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	presenceEventEnter = "enter"
+	presenceEventLeave = "leave"
+
+	// defaultPresenceEnterEmoji and defaultPresenceLeaveEmoji prefix presence notifications
+	// unless PresenceEnterEmoji or PresenceLeaveEmoji is set.
+	defaultPresenceEnterEmoji = ":large_green_circle:"
+	defaultPresenceLeaveEmoji = ":red_circle:"
+
+	// maxUserLookupRetries bounds UserLookupRetries so a missing user cannot stall an event for long.
+	maxUserLookupRetries = 5
+
+	// defaultUserLookupRetryDelay applies when UserLookupRetryDelayMs is not configured.
+	defaultUserLookupRetryDelay = 500 * time.Millisecond
+
+	// deactivatedUsersPlain and deactivatedUsersSuppress are the PresenceDeactivatedUsers modes.
+	deactivatedUsersPlain    = "plain"
+	deactivatedUsersSuppress = "suppress"
+)
+
+// presenceEvent is sent by oVice when a user enters or leaves a space.
+type presenceEvent struct {
+	Event     string `json:"event"`
+	UserEmail string `json:"user_email"`
+	UserName  string `json:"user_name"`
+	SpaceName string `json:"space_name"`
+
+	// RoomID identifies the room of the space the event happened in, if any.
+	RoomID string `json:"room_id"`
+}
+
+// validate checks the fields a presence or screen share event requires.
+func (e *presenceEvent) validate() error {
+	if e.UserEmail == "" && e.UserName == "" {
+		return newValidationError("user_email or user_name is required")
+	}
+	return nil
+}
+
+// handlePresenceEvent announces a user entering or leaving a space in the space's channel.
+func (p *Plugin) handlePresenceEvent(data []byte) error {
+	var event presenceEvent
+	if err := decodeEvent(data, &event); err != nil {
+		return err
+	}
+	event.Event = strings.ToLower(event.Event)
+	if err := event.validate(); err != nil {
+		return err
+	}
+
+	channelID := p.resolveSpaceChannelID(event.SpaceName, event.RoomID)
+	if channelID == "" {
+		return newHTTPError(http.StatusServiceUnavailable, "no channel is configured for presence notifications")
+	}
+
+	muted, err := p.isChannelMuted(channelID)
+	if err != nil {
+		return err
+	}
+
+	// The event is tracked before the user lookup, which may wait and retry, so a leave
+	// handled in the meantime is seen by the PresenceRequireOccupant check.
+	if err = p.trackOccupancy(&event, time.Now()); err != nil {
+		p.API.LogWarn("Failed to track space occupancy", "space_name", event.SpaceName, "err", err.Error())
+	}
+
+	user, active := p.resolvePresenceUser(&event)
+	announce, err := p.isPresenceAnnounced(user)
+	if err != nil {
+		return err
+	}
+
+	authorID := p.botUserIDForSpace(event.SpaceName)
+	config := p.getConfiguration()
+	window := config.presenceCoalesceWindow()
+	grace := config.leaveGracePeriod()
+
+	rejoined := false
+	if event.Event == presenceEventEnter && grace > 0 {
+		if rejoined, err = p.cancelPendingLeave(&event); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case muted:
+		p.API.LogDebug("Ignoring presence in a muted channel", "channel_id", channelID)
+	case !active:
+		p.API.LogDebug("Ignoring presence of a deactivated user", "user_email", event.UserEmail)
+	case !announce:
+		p.API.LogDebug("Ignoring presence of a user outside the presence team", "user_email", event.UserEmail)
+	case rejoined:
+		p.API.LogDebug("Ignoring re-enter within the leave grace period", "space_name", event.SpaceName)
+	case event.Event == presenceEventLeave && grace > 0:
+		post := p.buildPresencePost(user, p.renderPresenceMessage(&event, user))
+		post.UserId = authorID
+		post.ChannelId = channelID
+		return p.deferLeave(&event, post, grace, time.Now())
+	case window > 0:
+		p.queuePresence(channelID, authorID, &event, user, window)
+	case !p.isPresenceCurrent(&event):
+		p.API.LogDebug("Ignoring enter of a user who already left", "space_name", event.SpaceName)
+	default:
+		post := p.buildPresencePost(user, p.renderPresenceMessage(&event, user))
+		if event.Event == presenceEventEnter && p.getConfiguration().PresenceThumbnail {
+			p.addSpaceThumbnail(post, event.SpaceName)
+		}
+		post.UserId = authorID
+		post.ChannelId = channelID
+
+		if _, appErr := p.createIntegrationPost(post); appErr != nil {
+			return errors.Wrap(appErr, "failed to create presence post")
+		}
+	}
+
+	return nil
+}
+
+// isPresenceCurrent reports whether event is still worth announcing. With
+// PresenceRequireOccupant set, an enter is only announced while the user is still among the
+// tracked occupants of the space. Leaves are always current, and so is an enter whose
+// occupancy cannot be looked up.
+func (p *Plugin) isPresenceCurrent(event *presenceEvent) bool {
+	if event.Event != presenceEventEnter || !p.getConfiguration().PresenceRequireOccupant {
+		return true
+	}
+	present, err := p.isStillPresent(event)
+	if err != nil {
+		p.API.LogWarn("Failed to check space occupants", "space_name", event.SpaceName, "err", err.Error())
+		return true
+	}
+	return present
+}
+
+// isPresenceAnnounced reports whether the presence of user is announced. With PresenceTeam set,
+// only members of that team are; users not matched to a Mattermost account follow
+// PresenceAnnounceUnresolved.
+func (p *Plugin) isPresenceAnnounced(user *model.User) (bool, error) {
+	config := p.getConfiguration()
+	if config.PresenceTeam == "" {
+		return true, nil
+	}
+	if user == nil {
+		return config.PresenceAnnounceUnresolved, nil
+	}
+
+	team, appErr := p.API.GetTeamByName(config.PresenceTeam)
+	if appErr != nil {
+		return false, errors.Wrap(appErr, "failed to get presence team")
+	}
+	member, appErr := p.API.GetTeamMember(team.Id, user.Id)
+	if appErr != nil {
+		if appErr.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, errors.Wrap(appErr, "failed to get presence team member")
+	}
+	return member.DeleteAt == 0, nil
+}
+
+// buildPresencePost shows message next to the user's avatar when the user is resolved and the
+// server has a SiteURL to build the avatar URL from, and as plain text otherwise.
+func (p *Plugin) buildPresencePost(user *model.User, message string) *model.Post {
+	post := &model.Post{}
+
+	iconURL := p.profileImageURL(user)
+	if iconURL == "" {
+		post.Message = message
+		return post
+	}
+
+	model.ParseSlackAttachment(post, []*model.SlackAttachment{{
+		Fallback:   message,
+		AuthorName: user.GetDisplayName(model.ShowFullName),
+		AuthorIcon: iconURL,
+		Text:       message,
+	}})
+	return post
+}
+
+// profileImageURL returns the URL of user's avatar, or an empty string if user is nil or the
+// server has no SiteURL configured.
+func (p *Plugin) profileImageURL(user *model.User) string {
+	if user == nil {
+		return ""
+	}
+	siteURL := p.API.GetConfig().ServiceSettings.SiteURL
+	if siteURL == nil || *siteURL == "" {
+		return ""
+	}
+	return strings.TrimSuffix(*siteURL, "/") + "/api/v4/users/" + user.Id + "/image"
+}
+
+// renderPresenceMessage formats the announcement for event, mentioning user when the oVice user
+// was resolved to one.
+func (p *Plugin) renderPresenceMessage(event *presenceEvent, user *model.User) string {
+	name := presenceDisplayName(event, user)
+	space := event.SpaceName
+	if space == "" {
+		space = "the oVice space"
+	} else {
+		space = "**" + space + "**"
+	}
+
+	emoji := p.getConfiguration().presenceEmoji(event.Event)
+	if event.Event == presenceEventLeave {
+		return fmt.Sprintf("%s %s left %s.", emoji, name, space)
+	}
+
+	message := fmt.Sprintf("%s %s entered %s.", emoji, name, space)
+	if p.getConfiguration().PresenceJoinLink {
+		if url := p.resolveSpaceURL(event.SpaceName); url != "" {
+			message += "\n— [Join the space](" + url + ")"
+		}
+	}
+	return message
+}
+
+// resolvePresenceUser returns the Mattermost user matching the event's email, or nil. A
+// deactivated user is never returned, so they are not mentioned: with PresenceDeactivatedUsers
+// set to "suppress" it reports false, and otherwise event falls back to the user's display
+// name.
+func (p *Plugin) resolvePresenceUser(event *presenceEvent) (*model.User, bool) {
+	if event.UserEmail == "" {
+		return nil, true
+	}
+	user := p.lookupUserByEmail(event.UserEmail)
+	if user == nil || user.DeleteAt == 0 {
+		return user, true
+	}
+
+	if p.getConfiguration().PresenceDeactivatedUsers == deactivatedUsersSuppress {
+		return nil, false
+	}
+	if event.UserName == "" {
+		event.UserName = user.GetDisplayName(model.ShowFullName)
+	}
+	return nil, true
+}
+
+// lookupUserByEmail returns the user with email, or nil. A failed lookup is retried
+// UserLookupRetries times, since oVice may report a user before their newly provisioned account
+// can be queried.
+func (p *Plugin) lookupUserByEmail(email string) *model.User {
+	config := p.getConfiguration()
+	for attempt := 0; ; attempt++ {
+		user, appErr := p.API.GetUserByEmail(email)
+		if appErr == nil {
+			return user
+		}
+		if attempt >= config.UserLookupRetries {
+			return nil
+		}
+		time.Sleep(config.userLookupRetryDelay())
+	}
+}
+
+// presenceDisplayName returns an @-mention for user, falling back to the name reported by oVice.
+func presenceDisplayName(event *presenceEvent, user *model.User) string {
+	if user != nil {
+		return "@" + user.Username
+	}
+	if event.UserName != "" {
+		return event.UserName
+	}
+	return event.UserEmail
+}
+
+// resolveSpaceURL returns the URL users should open to join the named space, or an empty string
+// when none is configured.
+func (p *Plugin) resolveSpaceURL(spaceName string) string {
+	config := p.getConfiguration()
+	if space := config.space(spaceName); space != nil && space.URL != "" {
+		return space.URL
+	}
+	return config.SpaceURL
+}
+
+// resolveSpaceChannelID returns the channel events in a room of the named space are announced
+// in: the room's channel, else the space's, else DefaultChannelID.
+func (p *Plugin) resolveSpaceChannelID(spaceName, roomID string) string {
+	config := p.getConfiguration()
+	space := config.space(spaceName)
+	if space == nil {
+		return config.DefaultChannelID
+	}
+	if channelID := space.Rooms[roomID]; roomID != "" && channelID != "" {
+		return channelID
+	}
+	if space.ChannelID != "" {
+		return space.ChannelID
+	}
+	return config.DefaultChannelID
+}
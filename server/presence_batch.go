@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// presenceBatch collects presence events for one space and channel during the coalescing
+// window so they can be announced in a single post.
+type presenceBatch struct {
+	channelID string
+	authorID  string
+	spaceName string
+	events    []*presenceEvent
+	users     []*model.User
+	timer     *time.Timer
+}
+
+// presenceBatchKey identifies the batch of events of spaceName announced in channelID.
+func presenceBatchKey(channelID, spaceName string) string {
+	return channelID + "\n" + strings.ToLower(spaceName)
+}
+
+// queuePresence adds event to the batch of its channel and space, starting the batch and its
+// flush timer if this is the first event of the window.
+func (p *Plugin) queuePresence(channelID, authorID string, event *presenceEvent, user *model.User, window time.Duration) {
+	key := presenceBatchKey(channelID, event.SpaceName)
+
+	p.presenceBatchesLock.Lock()
+	defer p.presenceBatchesLock.Unlock()
+
+	if p.presenceBatches == nil {
+		p.presenceBatches = map[string]*presenceBatch{}
+	}
+	batch, ok := p.presenceBatches[key]
+	if !ok {
+		batch = &presenceBatch{channelID: channelID, authorID: authorID, spaceName: event.SpaceName}
+		batch.timer = time.AfterFunc(window, func() { p.flushPresenceBatch(key) })
+		p.presenceBatches[key] = batch
+	}
+	batch.events = append(batch.events, event)
+	batch.users = append(batch.users, user)
+}
+
+// flushPresenceBatch posts the batch stored under key, if it has not been flushed already.
+func (p *Plugin) flushPresenceBatch(key string) {
+	p.presenceBatchesLock.Lock()
+	batch, ok := p.presenceBatches[key]
+	delete(p.presenceBatches, key)
+	p.presenceBatchesLock.Unlock()
+
+	if ok {
+		p.postPresenceBatch(batch)
+	}
+}
+
+// flushPresenceBatches posts every pending batch right away, so no announcement is lost when
+// the plugin shuts down.
+func (p *Plugin) flushPresenceBatches() {
+	p.presenceBatchesLock.Lock()
+	batches := p.presenceBatches
+	p.presenceBatches = nil
+	p.presenceBatchesLock.Unlock()
+
+	for _, batch := range batches {
+		batch.timer.Stop()
+		p.postPresenceBatch(batch)
+	}
+}
+
+// postPresenceBatch announces batch, as a regular presence post when it holds a single event.
+// Enters that are no longer current are dropped first, and nothing is posted if no event is
+// left.
+func (p *Plugin) postPresenceBatch(batch *presenceBatch) {
+	current := &presenceBatch{channelID: batch.channelID, authorID: batch.authorID, spaceName: batch.spaceName}
+	for i, event := range batch.events {
+		if p.isPresenceCurrent(event) {
+			current.events = append(current.events, event)
+			current.users = append(current.users, batch.users[i])
+		}
+	}
+	if len(current.events) == 0 {
+		return
+	}
+	batch = current
+
+	var post *model.Post
+	if len(batch.events) == 1 {
+		post = p.buildPresencePost(batch.users[0], p.renderPresenceMessage(batch.events[0], batch.users[0]))
+		if batch.events[0].Event == presenceEventEnter && p.getConfiguration().PresenceThumbnail {
+			p.addSpaceThumbnail(post, batch.spaceName)
+		}
+	} else {
+		post = &model.Post{Message: p.renderPresenceBatchMessage(batch)}
+	}
+	post.UserId = batch.authorID
+	post.ChannelId = batch.channelID
+
+	if _, appErr := p.createIntegrationPost(post); appErr != nil {
+		p.API.LogWarn("Failed to create coalesced presence post", "channel_id", batch.channelID, "err", appErr.Error())
+	}
+}
+
+// renderPresenceBatchMessage summarizes the enters and leaves of batch, e.g.
+// "3 people entered **HQ**: @alice, @bob, Carol."
+func (p *Plugin) renderPresenceBatchMessage(batch *presenceBatch) string {
+	var entered, left []string
+	for i, event := range batch.events {
+		name := presenceDisplayName(event, batch.users[i])
+		if event.Event == presenceEventLeave {
+			left = append(left, name)
+		} else {
+			entered = append(entered, name)
+		}
+	}
+
+	space := "the oVice space"
+	if batch.spaceName != "" {
+		space = "**" + batch.spaceName + "**"
+	}
+	config := p.getConfiguration()
+	summarize := func(event, verb string, names []string) string {
+		emoji := config.presenceEmoji(event)
+		if len(names) == 1 {
+			return fmt.Sprintf("%s %s %s %s.", emoji, names[0], verb, space)
+		}
+		return fmt.Sprintf("%s %d people %s %s: %s.", emoji, len(names), verb, space, strings.Join(names, ", "))
+	}
+
+	var lines []string
+	if len(entered) > 0 {
+		lines = append(lines, summarize(presenceEventEnter, "entered", entered))
+	}
+	if len(left) > 0 {
+		lines = append(lines, summarize(presenceEventLeave, "left", left))
+	}
+
+	message := strings.Join(lines, "\n")
+	if len(entered) > 0 && config.PresenceJoinLink {
+		if url := p.resolveSpaceURL(batch.spaceName); url != "" {
+			message += "\n— [Join the space](" + url + ")"
+		}
+	}
+	return message
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPresenceCoalescing(t *testing.T) {
+	enter := func(email, name string) string {
+		return `{"event":"enter","user_email":"` + email + `","user_name":"` + name + `","space_name":"HQ"}`
+	}
+	setup := func(t *testing.T, window int) (*Plugin, chan *model.Post) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town", PresenceCoalesceSeconds: window})
+		api.On("GetUserByEmail", "alice@example.com").Return(&model.User{Id: "alice", Username: "alice"}, nil).Maybe()
+		api.On("GetUserByEmail", mock.AnythingOfType("string")).Return(nil, &model.AppError{Message: "not found"})
+		api.On("GetConfig").Return(&model.Config{}).Maybe()
+
+		posts := make(chan *model.Post, 10)
+		api.On("CreatePost", mock.AnythingOfType("*model.Post")).Run(func(args mock.Arguments) {
+			posts <- args.Get(0).(*model.Post)
+		}).Return(&model.Post{Id: "post"}, nil)
+		return p, posts
+	}
+	nextPost := func(t *testing.T, posts chan *model.Post) *model.Post {
+		t.Helper()
+		select {
+		case post := <-posts:
+			return post
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "no post was created")
+			return nil
+		}
+	}
+
+	t.Run("enters within the window coalesce into one post", func(t *testing.T) {
+		p, posts := setup(t, 1)
+
+		for _, body := range []string{
+			enter("alice@example.com", "Alice"),
+			enter("bob@example.com", "Bob"),
+			enter("carol@example.com", "Carol"),
+		} {
+			require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", body).Code)
+		}
+		assert.Empty(t, posts)
+
+		post := nextPost(t, posts)
+		assert.Equal(t, "town", post.ChannelId)
+		assert.Equal(t, ":large_green_circle: 3 people entered **HQ**: @alice, Bob, Carol.", post.Message)
+
+		t.Run("a lone enter after the window posts singly", func(t *testing.T) {
+			require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", enter("dave@example.com", "Dave")).Code)
+
+			assert.Equal(t, ":large_green_circle: Dave entered **HQ**.", nextPost(t, posts).Message)
+			assert.Empty(t, posts)
+		})
+	})
+
+	t.Run("pending events are flushed on shutdown", func(t *testing.T) {
+		p, posts := setup(t, 3600)
+
+		doRequest(p, http.MethodPost, "/events", enter("bob@example.com", "Bob"))
+		doRequest(p, http.MethodPost, "/events", `{"event":"leave","user_name":"Carol","space_name":"HQ"}`)
+		assert.Empty(t, posts)
+
+		require.NoError(t, p.OnDeactivate())
+		assert.Equal(t, ":large_green_circle: Bob entered **HQ**.\n:red_circle: Carol left **HQ**.", nextPost(t, posts).Message)
+	})
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPresenceEvent(t *testing.T) {
+	const enter = `{"event":"enter","user_email":"alice@example.com","user_name":"Alice","space_name":"HQ"}`
+
+	t.Run("enter mentions the resolved user", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town"})
+		api.On("GetUserByEmail", "alice@example.com").Return(&model.User{Id: "alice", Username: "alice"}, nil)
+		mockSiteURL(api, "")
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/events", enter)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "town", (*posts)[0].ChannelId)
+		assert.Equal(t, ":large_green_circle: @alice entered **HQ**.", (*posts)[0].Message)
+	})
+
+	t.Run("leave falls back to the oVice name", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town"})
+		api.On("GetUserByEmail", "alice@example.com").Return(nil, &model.AppError{Message: "not found"})
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/events", `{"event":"leave","user_email":"alice@example.com","user_name":"Alice","space_name":"HQ"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, ":red_circle: Alice left **HQ**.", (*posts)[0].Message)
+	})
+
+	t.Run("join link footer when a space URL is configured", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town", SpaceURL: "https://hq.ovice.in", PresenceJoinLink: true})
+		api.On("GetUserByEmail", "alice@example.com").Return(&model.User{Id: "alice", Username: "alice"}, nil)
+		mockSiteURL(api, "")
+		posts := mockCreatePost(api)
+
+		doRequest(p, http.MethodPost, "/events", enter)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, ":large_green_circle: @alice entered **HQ**.\n— [Join the space](https://hq.ovice.in)", (*posts)[0].Message)
+	})
+
+	t.Run("no join link footer without a space URL", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town", PresenceJoinLink: true})
+		api.On("GetUserByEmail", "alice@example.com").Return(&model.User{Id: "alice", Username: "alice"}, nil)
+		mockSiteURL(api, "")
+		posts := mockCreatePost(api)
+
+		doRequest(p, http.MethodPost, "/events", enter)
+		require.Len(t, *posts, 1)
+		assert.NotContains(t, (*posts)[0].Message, "Join the space")
+	})
+}
+
+func TestPresenceAvatar(t *testing.T) {
+	const enter = `{"event":"enter","user_email":"alice@example.com","user_name":"Alice","space_name":"HQ"}`
+	alice := &model.User{Id: "alice", Username: "alice", FirstName: "Alice", LastName: "Liddell"}
+
+	t.Run("attachment with avatar", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town"})
+		api.On("GetUserByEmail", "alice@example.com").Return(alice, nil)
+		mockSiteURL(api, "https://chat.example.com/")
+		posts := mockCreatePost(api)
+
+		doRequest(p, http.MethodPost, "/events", enter)
+		require.Len(t, *posts, 1)
+		assert.Empty(t, (*posts)[0].Message)
+		attachments := (*posts)[0].Attachments()
+		require.Len(t, attachments, 1)
+		assert.Equal(t, "https://chat.example.com/api/v4/users/alice/image", attachments[0].AuthorIcon)
+		assert.Equal(t, "Alice Liddell", attachments[0].AuthorName)
+		assert.Equal(t, ":large_green_circle: @alice entered **HQ**.", attachments[0].Text)
+		assert.Equal(t, ":large_green_circle: @alice entered **HQ**.", attachments[0].Fallback)
+	})
+
+	t.Run("unresolved user falls back to plain text", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town"})
+		api.On("GetUserByEmail", "alice@example.com").Return(nil, &model.AppError{Message: "not found"})
+		posts := mockCreatePost(api)
+
+		doRequest(p, http.MethodPost, "/events", enter)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, ":large_green_circle: Alice entered **HQ**.", (*posts)[0].Message)
+		assert.Empty(t, (*posts)[0].Attachments())
+	})
+
+	t.Run("empty SiteURL falls back to plain text", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town"})
+		api.On("GetUserByEmail", "alice@example.com").Return(alice, nil)
+		mockSiteURL(api, "")
+		posts := mockCreatePost(api)
+
+		doRequest(p, http.MethodPost, "/events", enter)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, ":large_green_circle: @alice entered **HQ**.", (*posts)[0].Message)
+		assert.Empty(t, (*posts)[0].Attachments())
+	})
+}
+
+func TestPresenceUserLookupRetry(t *testing.T) {
+	const enter = `{"event":"enter","user_email":"alice@example.com","user_name":"Alice","space_name":"HQ"}`
+	config := &configuration{DefaultChannelID: "town", UserLookupRetries: 2, UserLookupRetryDelayMs: 1}
+
+	t.Run("resolves on retry", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		api.On("GetUserByEmail", "alice@example.com").Return(nil, &model.AppError{Message: "not found"}).Once()
+		api.On("GetUserByEmail", "alice@example.com").Return(&model.User{Id: "alice", Username: "alice"}, nil).Once()
+		mockSiteURL(api, "")
+		posts := mockCreatePost(api)
+
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", enter).Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, ":large_green_circle: @alice entered **HQ**.", (*posts)[0].Message)
+		api.AssertNumberOfCalls(t, "GetUserByEmail", 2)
+	})
+
+	t.Run("gives up after the last retry", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		api.On("GetUserByEmail", "alice@example.com").Return(nil, &model.AppError{Message: "not found"})
+		posts := mockCreatePost(api)
+
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", enter).Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, ":large_green_circle: Alice entered **HQ**.", (*posts)[0].Message)
+		api.AssertNumberOfCalls(t, "GetUserByEmail", 3)
+	})
+
+	t.Run("no retry by default", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town"})
+		api.On("GetUserByEmail", "alice@example.com").Return(nil, &model.AppError{Message: "not found"})
+		mockCreatePost(api)
+
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", enter).Code)
+		api.AssertNumberOfCalls(t, "GetUserByEmail", 1)
+	})
+}
+
+func TestPresenceTeam(t *testing.T) {
+	const enter = `{"event":"enter","user_email":"alice@example.com","user_name":"Alice","space_name":"HQ"}`
+	config := &configuration{DefaultChannelID: "town", PresenceTeam: "eng"}
+	alice := &model.User{Id: "alice", Username: "alice"}
+
+	t.Run("team member is announced", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		api.On("GetUserByEmail", "alice@example.com").Return(alice, nil)
+		api.On("GetTeamByName", "eng").Return(&model.Team{Id: "engid", Name: "eng"}, nil)
+		api.On("GetTeamMember", "engid", "alice").Return(&model.TeamMember{TeamId: "engid", UserId: "alice"}, nil)
+		mockSiteURL(api, "")
+		posts := mockCreatePost(api)
+
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", enter).Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, ":large_green_circle: @alice entered **HQ**.", (*posts)[0].Message)
+	})
+
+	t.Run("user outside the team is ignored", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		api.On("GetUserByEmail", "alice@example.com").Return(alice, nil)
+		api.On("GetTeamByName", "eng").Return(&model.Team{Id: "engid", Name: "eng"}, nil)
+		api.On("GetTeamMember", "engid", "alice").Return(nil, &model.AppError{Message: "not found", StatusCode: http.StatusNotFound})
+
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", enter).Code)
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+
+		session, err := p.getSpaceSession("HQ")
+		require.NoError(t, err)
+		require.NotNil(t, session)
+		assert.Equal(t, 1, session.Occupants)
+	})
+
+	t.Run("unresolved user is ignored by default", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		api.On("GetUserByEmail", "alice@example.com").Return(nil, &model.AppError{Message: "not found"})
+
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", enter).Code)
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+		api.AssertNotCalled(t, "GetTeamMember", mock.Anything, mock.Anything)
+	})
+
+	t.Run("unresolved user is announced when configured", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town", PresenceTeam: "eng", PresenceAnnounceUnresolved: true})
+		api.On("GetUserByEmail", "alice@example.com").Return(nil, &model.AppError{Message: "not found"})
+		posts := mockCreatePost(api)
+
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", enter).Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, ":large_green_circle: Alice entered **HQ**.", (*posts)[0].Message)
+	})
+}
+
+func TestPresenceRequireOccupant(t *testing.T) {
+	const enter = `{"event":"enter","user_email":"alice@example.com","user_name":"Alice","space_name":"HQ"}`
+	config := &configuration{DefaultChannelID: "town", PresenceRequireOccupant: true}
+
+	// leaveDuringLookup handles alice leaving while her enter waits on the user lookup.
+	leaveDuringLookup := func(p *Plugin, api *plugintest.API) {
+		api.On("GetUserByEmail", "alice@example.com").Run(func(mock.Arguments) {
+			leave := &presenceEvent{Event: presenceEventLeave, UserEmail: "alice@example.com", SpaceName: "HQ"}
+			require.NoError(t, p.trackOccupancy(leave, time.Now()))
+		}).Return(&model.User{Id: "alice", Username: "alice"}, nil)
+	}
+
+	t.Run("user still in the space is announced", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		api.On("GetUserByEmail", "alice@example.com").Return(&model.User{Id: "alice", Username: "alice"}, nil)
+		mockSiteURL(api, "")
+		posts := mockCreatePost(api)
+
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", enter).Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, ":large_green_circle: @alice entered **HQ**.", (*posts)[0].Message)
+	})
+
+	t.Run("user who already left is not announced", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		leaveDuringLookup(p, api)
+
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", enter).Code)
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("coalesced enter of a user who left is dropped", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		posts := mockCreatePost(api)
+		bob := &presenceEvent{Event: presenceEventEnter, UserName: "Bob", SpaceName: "HQ"}
+		carol := &presenceEvent{Event: presenceEventEnter, UserName: "Carol", SpaceName: "HQ"}
+		require.NoError(t, p.trackOccupancy(carol, time.Now()))
+
+		p.postPresenceBatch(&presenceBatch{
+			channelID: "town",
+			authorID:  testBotUserID,
+			spaceName: "HQ",
+			events:    []*presenceEvent{bob, carol},
+			users:     []*model.User{nil, nil},
+		})
+		require.Len(t, *posts, 1)
+		assert.Equal(t, ":large_green_circle: Carol entered **HQ**.", (*posts)[0].Message)
+
+		p.postPresenceBatch(&presenceBatch{channelID: "town", authorID: testBotUserID, spaceName: "HQ", events: []*presenceEvent{bob}, users: []*model.User{nil}})
+		assert.Len(t, *posts, 1)
+	})
+
+	t.Run("user who already left is announced when disabled", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town"})
+		leaveDuringLookup(p, api)
+		mockSiteURL(api, "")
+		posts := mockCreatePost(api)
+
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", enter).Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, ":large_green_circle: @alice entered **HQ**.", (*posts)[0].Message)
+	})
+}
+
+func TestPresenceEmoji(t *testing.T) {
+	config := &configuration{DefaultChannelID: "town", PresenceEnterEmoji: "🟢", PresenceLeaveEmoji: " :wave: "}
+
+	t.Run("custom emojis prefix enters and leaves", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		api.On("GetUserByEmail", "alice@example.com").Return(nil, &model.AppError{Message: "not found"})
+		posts := mockCreatePost(api)
+
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", `{"event":"enter","user_email":"alice@example.com","user_name":"Alice","space_name":"HQ"}`).Code)
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", `{"event":"leave","user_email":"alice@example.com","user_name":"Alice","space_name":"HQ"}`).Code)
+		require.Len(t, *posts, 2)
+		assert.Equal(t, "🟢 Alice entered **HQ**.", (*posts)[0].Message)
+		assert.Equal(t, ":wave: Alice left **HQ**.", (*posts)[1].Message)
+	})
+
+	t.Run("defaults apply when unset", func(t *testing.T) {
+		config := &configuration{}
+		assert.Equal(t, defaultPresenceEnterEmoji, config.presenceEmoji(presenceEventEnter))
+		assert.Equal(t, defaultPresenceLeaveEmoji, config.presenceEmoji(presenceEventLeave))
+	})
+
+	t.Run("blank emojis are rejected", func(t *testing.T) {
+		assert.Error(t, (&configuration{PresenceEnterEmoji: " "}).process())
+		assert.Error(t, (&configuration{PresenceLeaveEmoji: "\t"}).process())
+	})
+}
+
+func TestPresenceDeactivatedUsers(t *testing.T) {
+	const enter = `{"event":"enter","user_email":"alice@example.com","space_name":"HQ"}`
+	deactivated := &model.User{Id: "alice", Username: "alice", FirstName: "Alice", LastName: "Smith", DeleteAt: 1}
+
+	t.Run("deactivated user is suppressed", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town", PresenceDeactivatedUsers: "suppress"})
+		api.On("GetUserByEmail", "alice@example.com").Return(deactivated, nil)
+
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", enter).Code)
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("deactivated user is posted as plain text", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town"})
+		api.On("GetUserByEmail", "alice@example.com").Return(deactivated, nil)
+		posts := mockCreatePost(api)
+
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", enter).Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, ":large_green_circle: Alice Smith entered **HQ**.", (*posts)[0].Message)
+	})
+
+	t.Run("active user is mentioned", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town", PresenceDeactivatedUsers: "suppress"})
+		api.On("GetUserByEmail", "alice@example.com").Return(&model.User{Id: "alice", Username: "alice"}, nil)
+		mockSiteURL(api, "")
+		posts := mockCreatePost(api)
+
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", enter).Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, ":large_green_circle: @alice entered **HQ**.", (*posts)[0].Message)
+	})
+
+	t.Run("unknown mode is rejected", func(t *testing.T) {
+		assert.Error(t, (&configuration{PresenceDeactivatedUsers: "mention"}).process())
+	})
+}
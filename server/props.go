@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxCustomProps and maxCustomPropKeyRunes bound the props of a webhook message.
+	maxCustomProps        = 20
+	maxCustomPropKeyRunes = 64
+)
+
+// protectedProps are post props Mattermost or this plugin give a meaning to, which a webhook
+// message may only set when listed in AllowedProtectedProps.
+var protectedProps = map[string]bool{
+	"attachments":             true,
+	"disable_group_highlight": true,
+	"from_bot":                true,
+	"from_plugin":             true,
+	"from_webhook":            true,
+	"override_icon_emoji":     true,
+	"override_icon_url":       true,
+	"override_username":       true,
+	"webhook_display_name":    true,
+	broadcastRootIDProp:       true,
+	quickRepliesProp:          true,
+	unsafeLinksProp:           true,
+}
+
+// validateCustomProps checks that props only holds scalar values under keys the message may set.
+func (c *configuration) validateCustomProps(props map[string]interface{}) error {
+	if len(props) > maxCustomProps {
+		return newValidationError("at most %d props are allowed", maxCustomProps)
+	}
+
+	allowed := map[string]bool{}
+	for _, key := range splitList(c.AllowedProtectedProps) {
+		allowed[key] = true
+	}
+
+	for key, value := range props {
+		if key == "" || utf8.RuneCountInString(key) > maxCustomPropKeyRunes {
+			return newValidationError("prop keys must be 1 to %d characters", maxCustomPropKeyRunes)
+		}
+		if (protectedProps[key] || strings.HasPrefix(key, "ovice_")) && !allowed[key] {
+			return newValidationError("props.%s is reserved and cannot be set", key)
+		}
+		switch value.(type) {
+		case string, float64, bool:
+		default:
+			return newValidationError("props.%s must be a string, number or boolean", key)
+		}
+	}
+
+	if username, ok := props["override_username"].(string); ok && !c.isOverrideUsernameAllowed(username) {
+		return newHTTPError(http.StatusForbidden, "props.override_username %q is not an allowed override username", username)
+	}
+	return nil
+}
+
+// isOverrideUsernameAllowed reports whether username is in AllowedOverrideUsernames, ignoring
+// case so "admin" cannot stand in for a disallowed "Admin". An empty list allows any name.
+func (c *configuration) isOverrideUsernameAllowed(username string) bool {
+	allowed := splitList(c.AllowedOverrideUsernames)
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, name := range allowed {
+		if strings.EqualFold(name, strings.TrimSpace(username)) {
+			return true
+		}
+	}
+	return false
+}
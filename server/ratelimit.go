@@ -0,0 +1,136 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimitPruneInterval is how often buckets that have refilled completely are forgotten.
+const rateLimitPruneInterval = time.Minute
+
+// tokenBucket holds the tokens left to a single caller at the time it was last updated.
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// rateLimiter is a set of token buckets keyed by caller, each allowing limit requests per
+// minute with bursts of up to limit. The zero value is ready to use.
+type rateLimiter struct {
+	lock       sync.Mutex
+	buckets    map[string]*tokenBucket
+	lastPruned time.Time
+}
+
+// rateLimitResult is the state of a caller's bucket after asking for a token.
+type rateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+
+	// Reset is how long until the bucket is full again, and RetryAfter how long until the next
+	// token is available when the request was not allowed.
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// allow takes a token from the bucket of key, refilled at limit tokens per minute.
+func (l *rateLimiter) allow(key string, limit int, now time.Time) *rateLimitResult {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	capacity := float64(limit)
+	perToken := time.Minute / time.Duration(limit)
+
+	if now.Sub(l.lastPruned) >= rateLimitPruneInterval {
+		for k, bucket := range l.buckets {
+			if now.Sub(bucket.updated) >= time.Minute {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastPruned = now
+	}
+
+	if l.buckets == nil {
+		l.buckets = map[string]*tokenBucket{}
+	}
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: capacity, updated: now}
+		l.buckets[key] = bucket
+	}
+	if elapsed := now.Sub(bucket.updated); elapsed > 0 {
+		bucket.tokens = math.Min(capacity, bucket.tokens+float64(elapsed)/float64(perToken))
+		bucket.updated = now
+	}
+
+	result := &rateLimitResult{Limit: limit}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - bucket.tokens) * float64(perToken))
+	}
+	result.Remaining = int(bucket.tokens)
+	result.Reset = time.Duration((capacity - bucket.tokens) * float64(perToken))
+	return result
+}
+
+// size returns the number of buckets currently tracked.
+func (l *rateLimiter) size() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return len(l.buckets)
+}
+
+// ceilSeconds rounds d up to whole seconds, for headers expressed in seconds.
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// writeRateLimitHeaders reports the caller's rate-limit state on a response.
+func writeRateLimitHeaders(w http.ResponseWriter, result *rateLimitResult) {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+}
+
+// limitSpace takes a token from the event budget of the named space, answering with a 429 scoped
+// to the space once it is used up. The budget of one space never affects another.
+func (p *Plugin) limitSpace(w http.ResponseWriter, spaceName string) error {
+	limit := p.getConfiguration().spaceRateLimit(spaceName)
+	if limit <= 0 {
+		return nil
+	}
+
+	result := p.spaceRateLimiter.allow(strings.ToLower(spaceName), limit, time.Now())
+	if !result.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+		return newHTTPError(http.StatusTooManyRequests, "rate limit exceeded for space %q, retry later", spaceName)
+	}
+	return nil
+}
+
+// limitRate runs handler if the source IP of r has requests left under RateLimitPerMinute,
+// answering 429 otherwise. Both report the caller's rate-limit state in headers.
+func (p *Plugin) limitRate(w http.ResponseWriter, r *http.Request, handler http.HandlerFunc) {
+	limit := p.getConfiguration().RateLimitPerMinute
+	if limit <= 0 {
+		handler(w, r)
+		return
+	}
+
+	result := p.ipRateLimiter.allow(p.sourceIP(r), limit, time.Now())
+	writeRateLimitHeaders(w, result)
+	if !result.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+		p.writeError(w, newHTTPError(http.StatusTooManyRequests, "rate limit exceeded, retry later"))
+		return
+	}
+
+	handler(w, r)
+}
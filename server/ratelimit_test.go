@@ -0,0 +1,153 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	t.Run("tokens refill over time", func(t *testing.T) {
+		var limiter rateLimiter
+		now := time.Now()
+
+		for i := 2; i >= 0; i-- {
+			result := limiter.allow("ip", 3, now)
+			require.True(t, result.Allowed)
+			assert.Equal(t, i, result.Remaining)
+		}
+		result := limiter.allow("ip", 3, now)
+		assert.False(t, result.Allowed)
+		assert.Equal(t, 20*time.Second, result.RetryAfter)
+		assert.Equal(t, time.Minute, result.Reset)
+
+		result = limiter.allow("ip", 3, now.Add(20*time.Second))
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 0, result.Remaining)
+
+		result = limiter.allow("ip", 3, now.Add(2*time.Minute))
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 2, result.Remaining)
+		assert.Equal(t, 20*time.Second, result.Reset)
+	})
+
+	t.Run("idle buckets are pruned", func(t *testing.T) {
+		var limiter rateLimiter
+		now := time.Now()
+
+		limiter.allow("a", 3, now)
+		limiter.allow("b", 3, now)
+		assert.Equal(t, 2, limiter.size())
+
+		limiter.allow("c", 3, now.Add(rateLimitPruneInterval))
+		assert.Equal(t, 1, limiter.size())
+	})
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	forwardedFor := func(ips string) http.Header {
+		header := http.Header{}
+		header.Set("X-Forwarded-For", ips)
+		return header
+	}
+
+	t.Run("headers count down to a 429", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{RateLimitPerMinute: 2})
+		mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"one"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+		assert.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+		assert.Equal(t, "30", w.Header().Get("X-RateLimit-Reset"))
+
+		w = doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"two"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+
+		w = doRequest(p, http.MethodPost, "/events", `{"event":"enter","user_name":"Alice"}`)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+		assert.Equal(t, "60", w.Header().Get("X-RateLimit-Reset"))
+		assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	})
+
+	t.Run("spoofed X-Forwarded-For does not get a fresh bucket", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{RateLimitPerMinute: 1})
+		mockCreatePost(api)
+
+		body := `{"channel_id":"channel","message":"one"}`
+		require.Equal(t, http.StatusOK, doSignedRequest(p, "/webhook", body, forwardedFor("203.0.113.1")).Code)
+		assert.Equal(t, http.StatusTooManyRequests, doSignedRequest(p, "/webhook", body, forwardedFor("203.0.113.2")).Code)
+	})
+
+	t.Run("trusted proxy forwards the client IP", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{RateLimitPerMinute: 1, TrustedProxies: "192.0.2.0/24"})
+		mockCreatePost(api)
+
+		body := `{"channel_id":"channel","message":"one"}`
+		require.Equal(t, http.StatusOK, doSignedRequest(p, "/webhook", body, forwardedFor("203.0.113.1")).Code)
+		require.Equal(t, http.StatusOK, doSignedRequest(p, "/webhook", body, forwardedFor("203.0.113.2")).Code)
+		// A client prepending its own hop is still attributed to the address the proxy saw.
+		assert.Equal(t, http.StatusTooManyRequests, doSignedRequest(p, "/webhook", body, forwardedFor("198.51.100.9, 203.0.113.2")).Code)
+	})
+
+	t.Run("no headers without a limit", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"one"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("X-RateLimit-Limit"))
+	})
+}
+
+func TestSpaceRateLimit(t *testing.T) {
+	leave := func(space string) string {
+		return `{"event":"leave","user_name":"Alice","space_name":"` + space + `"}`
+	}
+	config := &configuration{
+		DefaultChannelID:        "town",
+		SpaceRateLimitPerMinute: 3,
+		Spaces:                  `[{"name":"HQ","rate_limit_per_minute":2},{"name":"Annex"}]`,
+	}
+
+	t.Run("a space over its limit does not affect another", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		mockCreatePost(api)
+
+		for i := 0; i < 2; i++ {
+			require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", leave("HQ")).Code)
+		}
+		w := doRequest(p, http.MethodPost, "/events", leave("hq"))
+		require.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Contains(t, w.Body.String(), `rate limit exceeded for space \"hq\"`)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+		assert.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", leave("Annex")).Code)
+	})
+
+	t.Run("a space without its own limit uses the global default", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		mockCreatePost(api)
+
+		for _, space := range []string{"Annex", "Lobby"} {
+			for i := 0; i < 3; i++ {
+				require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", leave(space)).Code, space)
+			}
+			assert.Equal(t, http.StatusTooManyRequests, doRequest(p, http.MethodPost, "/events", leave(space)).Code, space)
+		}
+	})
+
+	t.Run("no limit by default", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town"})
+		mockCreatePost(api)
+
+		for i := 0; i < 10; i++ {
+			require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", leave("HQ")).Code)
+		}
+	})
+}
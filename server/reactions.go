@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+// keywordReaction is a single keyword→emoji rule parsed from the ReactionKeywords setting.
+type keywordReaction struct {
+	Keyword   string
+	EmojiName string
+}
+
+// parseKeywordReactions parses a list of keyword=emoji pairs such as "launch=tada, ship=rocket".
+// Keywords are lowercased so matching is case-insensitive, and emoji colons are optional.
+func parseKeywordReactions(value string) ([]keywordReaction, error) {
+	var reactions []keywordReaction
+	for _, item := range splitList(value) {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid keyword reaction %q, expected keyword=emoji", item)
+		}
+
+		keyword := strings.ToLower(strings.TrimSpace(parts[0]))
+		emojiName := strings.Trim(strings.TrimSpace(parts[1]), ":")
+		if keyword == "" || emojiName == "" {
+			return nil, errors.Errorf("invalid keyword reaction %q, expected keyword=emoji", item)
+		}
+
+		reactions = append(reactions, keywordReaction{Keyword: keyword, EmojiName: emojiName})
+	}
+	return reactions, nil
+}
+
+// addKeywordReactions reacts to post with the emoji of every configured keyword it contains.
+// Failures are logged rather than returned since the post itself has already been created.
+func (p *Plugin) addKeywordReactions(post *model.Post) {
+	message := strings.ToLower(post.Message)
+	added := map[string]bool{}
+
+	for _, reaction := range p.getConfiguration().keywordReactions {
+		if added[reaction.EmojiName] || !strings.Contains(message, reaction.Keyword) {
+			continue
+		}
+		added[reaction.EmojiName] = true
+
+		if _, appErr := p.API.AddReaction(&model.Reaction{
+			UserId:    post.UserId,
+			PostId:    post.Id,
+			EmojiName: reaction.EmojiName,
+		}); appErr != nil {
+			p.API.LogWarn("Failed to add keyword reaction", "post_id", post.Id, "emoji", reaction.EmojiName, "err", appErr.Error())
+		}
+	}
+}
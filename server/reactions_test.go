@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKeywordReactions(t *testing.T) {
+	reactions, err := parseKeywordReactions("Launch=:tada:, ship = rocket")
+	require.NoError(t, err)
+	assert.Equal(t, []keywordReaction{
+		{Keyword: "launch", EmojiName: "tada"},
+		{Keyword: "ship", EmojiName: "rocket"},
+	}, reactions)
+
+	_, err = parseKeywordReactions("launch")
+	assert.Error(t, err)
+}
+
+func TestKeywordReactions(t *testing.T) {
+	config := &configuration{ReactionKeywords: "launch=tada, ship=rocket, release=tada"}
+
+	setup := func(t *testing.T, message string) (*Plugin, *plugintest.API) {
+		p, api, _ := newTestPlugin(t, config)
+		api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(&model.Post{Id: "post", UserId: testBotUserID, Message: message}, nil)
+		return p, api
+	}
+	reactionMatcher := func(emojiName string) interface{} {
+		return mock.MatchedBy(func(r *model.Reaction) bool {
+			return r.PostId == "post" && r.UserId == testBotUserID && r.EmojiName == emojiName
+		})
+	}
+
+	t.Run("single match", func(t *testing.T) {
+		p, api := setup(t, "We LAUNCH today")
+		api.On("AddReaction", reactionMatcher("tada")).Return(&model.Reaction{}, nil).Once()
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"We LAUNCH today"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("multiple matches", func(t *testing.T) {
+		p, api := setup(t, "Launch and ship the release")
+		api.On("AddReaction", reactionMatcher("tada")).Return(&model.Reaction{}, nil).Once()
+		api.On("AddReaction", reactionMatcher("rocket")).Return(&model.Reaction{}, nil).Once()
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"Launch and ship the release"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		p, api := setup(t, "Nothing to see")
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"Nothing to see"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		api.AssertNotCalled(t, "AddReaction", mock.Anything)
+	})
+}
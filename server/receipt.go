@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// receiptTimeout bounds each attempt to deliver a receipt.
+	receiptTimeout = 5 * time.Second
+
+	receiptStatusDelivered = "delivered"
+)
+
+// receiptClient sends delivery receipts to ReceiptURL.
+var receiptClient = &http.Client{Timeout: receiptTimeout}
+
+// deliveryReceipt is posted to ReceiptURL once a webhook message was posted.
+type deliveryReceipt struct {
+	EventID string `json:"event_id"`
+	PostID  string `json:"post_id"`
+	Status  string `json:"status"`
+
+	// Origin is set while SuppressSelfOriginated is on, so a receipt fed back as a webhook is
+	// recognized and ignored.
+	Origin string `json:"origin,omitempty"`
+}
+
+// receiptEventID returns the event ID a receipt for body reports: its EventID, or else the
+// Idempotency-Key of the request.
+func receiptEventID(body *RequestBody, idempotencyKey string) string {
+	if body.EventID != "" {
+		return body.EventID
+	}
+	return idempotencyKey
+}
+
+// sendReceipt reports the post created for the webhook event eventID to ReceiptURL in the
+// background, so the webhook response never waits on it. A receipt that cannot be delivered is
+// only logged.
+func (p *Plugin) sendReceipt(eventID, postID string) {
+	config := p.getConfiguration()
+	receiptURL := config.ReceiptURL
+	if receiptURL == "" {
+		return
+	}
+	var origin string
+	if config.SuppressSelfOriginated {
+		origin = p.originMarker()
+	}
+
+	go func() {
+		receipt := &deliveryReceipt{EventID: eventID, PostID: postID, Status: receiptStatusDelivered, Origin: origin}
+		if err := p.deliverReceipt(receiptURL, receipt); err != nil {
+			p.API.LogWarn("Failed to deliver webhook receipt", "event_id", eventID, "post_id", postID, "err", err.Error())
+		}
+	}()
+}
+
+// deliverReceipt posts receipt to receiptURL, retrying it like a request to the oVice API.
+func (p *Plugin) deliverReceipt(receiptURL string, receipt *deliveryReceipt) error {
+	data, err := json.Marshal(receipt)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode receipt")
+	}
+
+	retry := p.getConfiguration().oviceRetryPolicy()
+	retry.sleep = p.sleep
+	resp, err := retry.do(receiptClient, func() (*http.Request, error) {
+		req, reqErr := http.NewRequest(http.MethodPost, receiptURL, bytes.NewReader(data))
+		if reqErr != nil {
+			return nil, errors.Wrap(reqErr, "failed to build receipt request")
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to send receipt")
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("receipt URL returned %d", resp.StatusCode)
+	}
+	return nil
+}
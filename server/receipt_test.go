@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeliveryReceipt(t *testing.T) {
+	webhook := func(p *Plugin, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set(idempotencyKeyHeader, "key-1")
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, r)
+		return w
+	}
+
+	t.Run("receipt is posted after the message", func(t *testing.T) {
+		receipts := make(chan deliveryReceipt, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+			var receipt deliveryReceipt
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&receipt))
+			receipts <- receipt
+		}))
+		defer server.Close()
+
+		p, api, _ := newTestPlugin(t, &configuration{ReceiptURL: server.URL})
+		mockCreatePost(api)
+
+		require.Equal(t, http.StatusOK, webhook(p, `{"channel_id":"channel","message":"hi","event_id":"evt-1"}`).Code)
+		select {
+		case receipt := <-receipts:
+			assert.Equal(t, deliveryReceipt{EventID: "evt-1", PostID: "post0", Status: "delivered"}, receipt)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no receipt was delivered")
+		}
+	})
+
+	t.Run("event id falls back to the idempotency key", func(t *testing.T) {
+		receipts := make(chan deliveryReceipt, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var receipt deliveryReceipt
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&receipt))
+			receipts <- receipt
+		}))
+		defer server.Close()
+
+		p, api, _ := newTestPlugin(t, &configuration{ReceiptURL: server.URL})
+		mockCreatePost(api)
+
+		require.Equal(t, http.StatusOK, webhook(p, `{"channel_id":"channel","message":"hi"}`).Code)
+		select {
+		case receipt := <-receipts:
+			assert.Equal(t, "key-1", receipt.EventID)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no receipt was delivered")
+		}
+	})
+
+	t.Run("failing receipt is retried and logged", func(t *testing.T) {
+		attempts := make(chan struct{}, 3)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts <- struct{}{}
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		p, api, _ := newTestPlugin(t, &configuration{ReceiptURL: server.URL, OviceAPIDeadlineMs: 1500})
+		p.sleeper = func(time.Duration) {}
+		mockCreatePost(api)
+		logged := make(chan string, 1)
+		unmock(api, "LogWarn")
+		api.On("LogWarn", "Failed to deliver webhook receipt", "event_id", "evt-1", "post_id", "post0", "err", mock.AnythingOfType("string")).Run(func(args mock.Arguments) {
+			logged <- args.String(6)
+		})
+
+		w := webhook(p, `{"channel_id":"channel","message":"hi","event_id":"evt-1"}`)
+		require.Equal(t, http.StatusOK, w.Code, "the post succeeds regardless of the receipt")
+		select {
+		case err := <-logged:
+			assert.Equal(t, "receipt URL returned 502", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("the failed receipt was not logged")
+		}
+		assert.Len(t, attempts, 3, "retried after 500ms and 1s of backoff")
+	})
+
+	t.Run("no receipt once ReceiptURL is cleared", func(t *testing.T) {
+		called := make(chan struct{}, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called <- struct{}{}
+		}))
+		defer server.Close()
+
+		p, api, _ := newTestPlugin(t, &configuration{ReceiptURL: server.URL})
+		mockCreatePost(api)
+		p.setConfiguration(&configuration{})
+
+		require.Equal(t, http.StatusOK, webhook(p, `{"channel_id":"channel","message":"hi","event_id":"evt-1"}`).Code)
+		select {
+		case <-called:
+			t.Fatal("a receipt was sent")
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+}
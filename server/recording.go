@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+const recordingEventReady = "recording_ready"
+
+// recordingEvent is sent by oVice once the recording of a session can be downloaded.
+type recordingEvent struct {
+	SpaceName       string `json:"space_name"`
+	RoomID          string `json:"room_id"`
+	DownloadURL     string `json:"download_url"`
+	DurationSeconds *int   `json:"duration_seconds"`
+}
+
+// validate checks the fields a recording event requires.
+func (e *recordingEvent) validate() error {
+	if e.DownloadURL == "" {
+		return newValidationError("download_url is required")
+	}
+	if u, err := url.Parse(e.DownloadURL); err != nil || u.Scheme != "https" || u.Host == "" {
+		return newValidationError("download_url must be an https URL")
+	}
+	if e.DurationSeconds != nil && *e.DurationSeconds < 0 {
+		return newValidationError("duration_seconds must not be negative")
+	}
+	return nil
+}
+
+// handleRecordingEvent posts a link to a finished recording in the space's channel.
+func (p *Plugin) handleRecordingEvent(data []byte) error {
+	var event recordingEvent
+	if err := decodeEvent(data, &event); err != nil {
+		return err
+	}
+	if err := event.validate(); err != nil {
+		return err
+	}
+
+	channelID := p.resolveSpaceChannelID(event.SpaceName, event.RoomID)
+	if channelID == "" {
+		return newHTTPError(http.StatusServiceUnavailable, "no channel is configured for recording notifications")
+	}
+
+	if _, appErr := p.createIntegrationPost(&model.Post{
+		UserId:    p.botUserIDForSpace(event.SpaceName),
+		ChannelId: channelID,
+		Message:   renderRecordingMessage(&event),
+	}); appErr != nil {
+		return errors.Wrap(appErr, "failed to create recording post")
+	}
+	return nil
+}
+
+// renderRecordingMessage formats the announcement of a finished recording.
+func renderRecordingMessage(event *recordingEvent) string {
+	space := "the oVice space"
+	if event.SpaceName != "" {
+		space = "**" + event.SpaceName + "**"
+	}
+
+	message := fmt.Sprintf("A recording of %s is ready", space)
+	if event.DurationSeconds != nil {
+		message += fmt.Sprintf(" (%s)", formatRecordingDuration(time.Duration(*event.DurationSeconds)*time.Second))
+	}
+	return message + ": [Download the recording](" + event.DownloadURL + ")"
+}
+
+// formatRecordingDuration renders d as e.g. "1h 5m", "5m 30s" or "30s".
+func formatRecordingDuration(d time.Duration) string {
+	hours, minutes, seconds := int(d/time.Hour), int(d%time.Hour/time.Minute), int(d%time.Minute/time.Second)
+	switch {
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	case minutes > 0:
+		return fmt.Sprintf("%dm %ds", minutes, seconds)
+	default:
+		return fmt.Sprintf("%ds", seconds)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatRecordingDuration(t *testing.T) {
+	assert.Equal(t, "45s", formatRecordingDuration(45*time.Second))
+	assert.Equal(t, "5m 30s", formatRecordingDuration(5*time.Minute+30*time.Second))
+	assert.Equal(t, "1h 5m", formatRecordingDuration(time.Hour+5*time.Minute+12*time.Second))
+}
+
+func TestRecordingEvent(t *testing.T) {
+	t.Run("posts the download link", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town"})
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/events", `{"event":"recording_ready","space_name":"HQ","download_url":"https://hq.ovice.in/recordings/1.mp4","duration_seconds":3900}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "town", (*posts)[0].ChannelId)
+		assert.Equal(t, "A recording of **HQ** is ready (1h 5m): [Download the recording](https://hq.ovice.in/recordings/1.mp4)", (*posts)[0].Message)
+	})
+
+	t.Run("duration is optional", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town"})
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/events", `{"event":"recording_ready","download_url":"https://hq.ovice.in/recordings/1.mp4"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "A recording of the oVice space is ready: [Download the recording](https://hq.ovice.in/recordings/1.mp4)", (*posts)[0].Message)
+	})
+
+	t.Run("invalid events are rejected", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town"})
+
+		for body, message := range map[string]string{
+			`{"event":"recording_ready","space_name":"HQ","download_url":"http://hq.ovice.in/recordings/1.mp4"}`:                        "download_url must be an https URL",
+			`{"event":"recording_ready","space_name":"HQ","download_url":"https:///1.mp4"}`:                                             "download_url must be an https URL",
+			`{"event":"recording_ready","space_name":"HQ"}`:                                                                             "download_url is required",
+			`{"event":"recording_ready","space_name":"HQ","download_url":"https://hq.ovice.in/recordings/1.mp4","duration_seconds":-1}`: "duration_seconds must not be negative",
+		} {
+			w := doRequest(p, http.MethodPost, "/events", body)
+			assert.Equal(t, http.StatusUnprocessableEntity, w.Code, body)
+			assert.Contains(t, w.Body.String(), message, body)
+		}
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	screenshareEventStart = "screenshare_start"
+	screenshareEventStop  = "screenshare_stop"
+
+	// screenshareTTL bounds how long a start announcement is remembered, in case the stop event
+	// never arrives.
+	screenshareTTL = 24 * time.Hour
+)
+
+// handleScreenshareEvent announces a user starting to share their screen in a space. When
+// NotifyScreenshareStop is set, the announcement is updated once the share stops; otherwise
+// stop events are dropped.
+func (p *Plugin) handleScreenshareEvent(data []byte) error {
+	var event presenceEvent
+	if err := decodeEvent(data, &event); err != nil {
+		return err
+	}
+	event.Event = strings.ToLower(event.Event)
+	if err := event.validate(); err != nil {
+		return err
+	}
+
+	key := screenshareKey(&event)
+	if event.Event == screenshareEventStop && !p.getConfiguration().NotifyScreenshareStop {
+		if appErr := p.API.KVDelete(key); appErr != nil {
+			return errors.Wrap(appErr, "failed to clear screen share")
+		}
+		return nil
+	}
+
+	channelID := p.resolveSpaceChannelID(event.SpaceName, event.RoomID)
+	if channelID == "" {
+		return newHTTPError(http.StatusServiceUnavailable, "no channel is configured for screen share notifications")
+	}
+
+	user, active := p.resolvePresenceUser(&event)
+	if !active {
+		p.API.LogDebug("Ignoring screen share of a deactivated user", "user_email", event.UserEmail)
+		return nil
+	}
+	post := p.buildPresencePost(user, p.renderScreenshareMessage(&event, user))
+
+	if event.Event == screenshareEventStop {
+		return p.updateScreensharePost(key, channelID, event.SpaceName, post)
+	}
+
+	post.UserId = p.botUserIDForSpace(event.SpaceName)
+	post.ChannelId = channelID
+	created, appErr := p.createIntegrationPost(post)
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to create screen share post")
+	}
+	if _, appErr = p.API.KVSetWithOptions(key, []byte(created.Id), model.PluginKVSetOptions{
+		ExpireInSeconds: int64(screenshareTTL / time.Second),
+	}); appErr != nil {
+		p.API.LogWarn("Failed to store screen share post", "post_id", created.Id, "err", appErr.Error())
+	}
+
+	return nil
+}
+
+// updateScreensharePost replaces the start announcement stored under key with post, or creates
+// post if the announcement is unknown or gone.
+func (p *Plugin) updateScreensharePost(key, channelID, spaceName string, post *model.Post) error {
+	postID, appErr := p.API.KVGet(key)
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to get screen share post")
+	}
+	if appErr = p.API.KVDelete(key); appErr != nil {
+		return errors.Wrap(appErr, "failed to clear screen share")
+	}
+
+	if postID != nil {
+		if existing, getErr := p.API.GetPost(string(postID)); getErr == nil {
+			updated := existing.Clone()
+			updated.Message = post.Message
+			updated.SetProps(post.GetProps())
+			p.markIntegrationPost(updated)
+			if _, appErr = p.API.UpdatePost(updated); appErr != nil {
+				return errors.Wrap(appErr, "failed to update screen share post")
+			}
+			return nil
+		}
+	}
+
+	post.UserId = p.botUserIDForSpace(spaceName)
+	post.ChannelId = channelID
+	if _, appErr = p.createIntegrationPost(post); appErr != nil {
+		return errors.Wrap(appErr, "failed to create screen share post")
+	}
+	return nil
+}
+
+// renderScreenshareMessage formats the announcement for a screen share event.
+func (p *Plugin) renderScreenshareMessage(event *presenceEvent, user *model.User) string {
+	name := presenceDisplayName(event, user)
+	space := event.SpaceName
+	if space == "" {
+		space = "the oVice space"
+	} else {
+		space = "**" + space + "**"
+	}
+
+	if event.Event == screenshareEventStop {
+		return fmt.Sprintf("%s stopped sharing their screen in %s.", name, space)
+	}
+
+	message := fmt.Sprintf("%s started sharing their screen in %s.", name, space)
+	if url := p.resolveSpaceURL(event.SpaceName); url != "" {
+		message += "\n— [Join the space](" + url + ")"
+	}
+	return message
+}
+
+// screenshareKey returns the KV key tracking the announcement of a user's screen share.
+func screenshareKey(event *presenceEvent) string {
+	sharer := event.UserEmail
+	if sharer == "" {
+		sharer = event.UserName
+	}
+	return hashedKey(screenshareKeyPrefix, strings.ToLower(event.SpaceName)+"\n"+strings.ToLower(sharer))
+}
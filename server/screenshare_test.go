@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScreenshareEvent(t *testing.T) {
+	const (
+		start = `{"event":"screenshare_start","user_email":"alice@example.com","space_name":"HQ"}`
+		stop  = `{"event":"screenshare_stop","user_email":"alice@example.com","space_name":"HQ"}`
+	)
+	setup := func(t *testing.T, config *configuration) (*Plugin, *memKV, *[]*model.Post) {
+		p, api, kv := newTestPlugin(t, config)
+		api.On("GetUserByEmail", "alice@example.com").Return(&model.User{Id: "alice", Username: "alice"}, nil)
+		mockSiteURL(api, "")
+		return p, kv, mockCreatePost(api)
+	}
+
+	t.Run("start notification", func(t *testing.T) {
+		p, kv, posts := setup(t, &configuration{DefaultChannelID: "town", SpaceURL: "https://hq.ovice.in"})
+
+		w := doRequest(p, http.MethodPost, "/events", start)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "town", (*posts)[0].ChannelId)
+		assert.Equal(t, "@alice started sharing their screen in **HQ**.\n— [Join the space](https://hq.ovice.in)", (*posts)[0].Message)
+		assert.Equal(t, []byte("post0"), kv.get(screenshareKey(&presenceEvent{UserEmail: "alice@example.com", SpaceName: "HQ"})))
+	})
+
+	t.Run("stop is suppressed by default", func(t *testing.T) {
+		p, kv, posts := setup(t, &configuration{DefaultChannelID: "town"})
+
+		doRequest(p, http.MethodPost, "/events", start)
+		w := doRequest(p, http.MethodPost, "/events", stop)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, *posts, 1)
+		assert.Nil(t, kv.get(screenshareKey(&presenceEvent{UserEmail: "alice@example.com", SpaceName: "HQ"})))
+	})
+
+	t.Run("enabled stop updates the start notification", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town", NotifyScreenshareStop: true})
+		api.On("GetUserByEmail", "alice@example.com").Return(&model.User{Id: "alice", Username: "alice"}, nil)
+		mockSiteURL(api, "")
+		posts := mockCreatePost(api)
+
+		doRequest(p, http.MethodPost, "/events", start)
+		require.Len(t, *posts, 1)
+		api.On("GetPost", "post0").Return((*posts)[0], nil)
+		api.On("UpdatePost", mock.MatchedBy(func(post *model.Post) bool {
+			return post.Id == "post0" && post.Message == "@alice stopped sharing their screen in **HQ**."
+		})).Return(&model.Post{Id: "post0"}, nil).Once()
+
+		w := doRequest(p, http.MethodPost, "/events", stop)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, *posts, 1)
+	})
+
+	t.Run("enabled stop without a known start posts anew", func(t *testing.T) {
+		p, _, posts := setup(t, &configuration{DefaultChannelID: "town", NotifyScreenshareStop: true})
+
+		w := doRequest(p, http.MethodPost, "/events", stop)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "@alice stopped sharing their screen in **HQ**.", (*posts)[0].Message)
+	})
+}
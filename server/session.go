@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+// spaceSession tracks an occupied stretch of a space, from the first user entering until the
+// last one leaves.
+type spaceSession struct {
+	StartedAt int64 `json:"started_at"`
+
+	// Occupants is the number of users in Present, so a repeated enter or a leave of someone
+	// who never entered does not skew it.
+	Occupants int `json:"occupants"`
+
+	// Present holds the presenceVisitor of each user in the space.
+	Present []string `json:"present,omitempty"`
+}
+
+// maxSessionPresent caps spaceSession.Present, and so the occupants counted, in case leave
+// events go missing.
+const maxSessionPresent = 2000
+
+// isPresent reports whether visitor is in session.Present.
+func (session *spaceSession) isPresent(visitor string) bool {
+	for _, present := range session.Present {
+		if present == visitor {
+			return true
+		}
+	}
+	return false
+}
+
+// setPresent adds visitor to or removes it from session.Present.
+func (session *spaceSession) setPresent(visitor string, present bool) {
+	if present {
+		if !session.isPresent(visitor) && len(session.Present) < maxSessionPresent {
+			session.Present = append(session.Present, visitor)
+		}
+		return
+	}
+	for i, other := range session.Present {
+		if other == visitor {
+			session.Present = append(session.Present[:i], session.Present[i+1:]...)
+			return
+		}
+	}
+}
+
+// sessionKey returns the KV key of the session of the named space.
+func sessionKey(spaceName string) string {
+	return hashedKey(sessionKeyPrefix, strings.ToLower(spaceName))
+}
+
+// trackOccupancy updates the session of the event's space, starting it on the first enter and
+// clearing it once the space empties, and records the event in the occupancy history, running
+// occupancy post and daily stats of the space.
+func (p *Plugin) trackOccupancy(event *presenceEvent, now time.Time) error {
+	occupants := -1
+	err := p.kvUpdate(sessionKey(event.SpaceName), func(oldValue []byte) ([]byte, error) {
+		var session spaceSession
+		if oldValue != nil {
+			if err := json.Unmarshal(oldValue, &session); err != nil {
+				return nil, errors.Wrap(err, "failed to decode space session")
+			}
+		}
+
+		switch event.Event {
+		case presenceEventEnter:
+			if len(session.Present) == 0 {
+				session.StartedAt = now.UnixNano() / int64(time.Millisecond)
+			}
+			session.setPresent(presenceVisitor(event), true)
+		case presenceEventLeave:
+			session.setPresent(presenceVisitor(event), false)
+		default:
+			return oldValue, nil
+		}
+		session.Occupants = len(session.Present)
+
+		occupants = session.Occupants
+		if session.Occupants <= 0 {
+			occupants = 0
+			return nil, nil
+		}
+		data, err := json.Marshal(session)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to encode space session")
+		}
+		return data, nil
+	})
+	if err != nil || occupants < 0 {
+		return err
+	}
+
+	if err = p.recordOccupancy(event.SpaceName, occupants, now); err != nil {
+		return err
+	}
+	if err = p.updateOccupancyPost(event.SpaceName, occupants); err != nil {
+		return err
+	}
+	if err = p.trackIdle(event.SpaceName, occupants, now); err != nil {
+		return err
+	}
+	return p.recordDailyStats(event, occupants, now)
+}
+
+// getSpaceSession returns the active session of the named space, or nil if it is empty.
+func (p *Plugin) getSpaceSession(spaceName string) (*spaceSession, error) {
+	data, appErr := p.API.KVGet(sessionKey(spaceName))
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get space session")
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	var session spaceSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, errors.Wrap(err, "failed to decode space session")
+	}
+	return &session, nil
+}
+
+// isStillPresent reports whether the user of event is in the tracked occupants of its space.
+func (p *Plugin) isStillPresent(event *presenceEvent) (bool, error) {
+	session, err := p.getSpaceSession(event.SpaceName)
+	if err != nil || session == nil {
+		return false, err
+	}
+	return session.isPresent(presenceVisitor(event)), nil
+}
+
+// executeUptimeCommand reports how long a space has been occupied. The space name is optional
+// when only one space is in use.
+func (p *Plugin) executeUptimeCommand(_ *model.CommandArgs, params []string, locale string) *model.CommandResponse {
+	spaceName := strings.Join(params, " ")
+
+	session, err := p.getSpaceSession(spaceName)
+	if err != nil {
+		p.API.LogWarn("Failed to get space session", "space_name", spaceName, "err", err.Error())
+		return ephemeralResponse(translate(locale, "Failed to look up the space. Please try again later."))
+	}
+
+	switch {
+	case session == nil && spaceName == "":
+		return ephemeralResponse(translate(locale, "The space has no active session."))
+	case session == nil:
+		return ephemeralResponse(translate(locale, "The space **%s** has no active session.", spaceName))
+	}
+
+	active := formatUptime(time.Since(time.Unix(0, session.StartedAt*int64(time.Millisecond))))
+	if spaceName == "" {
+		return ephemeralResponse(translate(locale, "The space has been active for %s.", active))
+	}
+	return ephemeralResponse(translate(locale, "The space **%s** has been active for %s.", spaceName, active))
+}
+
+// formatUptime renders d as hours and minutes, e.g. "1h 30m".
+func formatUptime(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	return fmt.Sprintf("%dh %dm", int(d/time.Hour), int(d%time.Hour/time.Minute))
+}
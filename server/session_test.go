@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatUptime(t *testing.T) {
+	assert.Equal(t, "0h 0m", formatUptime(30*time.Second))
+	assert.Equal(t, "1h 30m", formatUptime(90*time.Minute))
+	assert.Equal(t, "26h 5m", formatUptime(26*time.Hour+5*time.Minute))
+}
+
+func TestSpaceSession(t *testing.T) {
+	presence := func(event, email string) string {
+		return `{"event":"` + event + `","user_email":"` + email + `","space_name":"HQ"}`
+	}
+	setup := func(t *testing.T) (*Plugin, *plugintest.API, *memKV) {
+		p, api, kv := newTestPlugin(t, &configuration{DefaultChannelID: "town"})
+		api.On("GetUserByEmail", mock.AnythingOfType("string")).Return(nil, &model.AppError{Message: "not found"})
+		mockCreatePost(api)
+		return p, api, kv
+	}
+
+	t.Run("uptime after a simulated duration", func(t *testing.T) {
+		p, api, kv := setup(t)
+		mockUserLocale(api, "alice", "")
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", presence("enter", "alice@example.com")).Code)
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", presence("enter", "bob@example.com")).Code)
+
+		var session spaceSession
+		require.NoError(t, json.Unmarshal(kv.get(sessionKey("HQ")), &session))
+		assert.Equal(t, 2, session.Occupants)
+
+		session.StartedAt = time.Now().Add(-(90*time.Minute + 10*time.Second)).UnixNano() / int64(time.Millisecond)
+		kv.data[sessionKey("HQ")], _ = json.Marshal(session)
+
+		assert.Equal(t, "The space **HQ** has been active for 1h 30m.", executeCommand(t, p, "alice", "channel", "/ovice uptime HQ"))
+		assert.Equal(t, "The space **hq** has been active for 1h 30m.", executeCommand(t, p, "alice", "channel", "/ovice uptime hq"))
+	})
+
+	t.Run("session clears once the space empties", func(t *testing.T) {
+		p, _, kv := setup(t)
+		doRequest(p, http.MethodPost, "/events", presence("enter", "alice@example.com"))
+		doRequest(p, http.MethodPost, "/events", presence("enter", "bob@example.com"))
+		doRequest(p, http.MethodPost, "/events", presence("leave", "alice@example.com"))
+		assert.NotNil(t, kv.get(sessionKey("HQ")))
+
+		doRequest(p, http.MethodPost, "/events", presence("leave", "bob@example.com"))
+		assert.Nil(t, kv.get(sessionKey("HQ")))
+	})
+
+	t.Run("repeated enter is counted once", func(t *testing.T) {
+		p, _, kv := setup(t)
+		doRequest(p, http.MethodPost, "/events", presence("enter", "alice@example.com"))
+		doRequest(p, http.MethodPost, "/events", presence("enter", "alice@example.com"))
+		doRequest(p, http.MethodPost, "/events", presence("leave", "carol@example.com"))
+
+		var session spaceSession
+		require.NoError(t, json.Unmarshal(kv.get(sessionKey("HQ")), &session))
+		assert.Equal(t, 1, session.Occupants)
+
+		doRequest(p, http.MethodPost, "/events", presence("leave", "alice@example.com"))
+		assert.Nil(t, kv.get(sessionKey("HQ")))
+	})
+
+	t.Run("no active session", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockUserLocale(api, "alice", "")
+
+		assert.Equal(t, "The space **HQ** has no active session.", executeCommand(t, p, "alice", "channel", "/ovice uptime HQ"))
+	})
+}
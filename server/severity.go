@@ -0,0 +1,38 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// severityColors maps the severity of a webhook message to the color of the attachment it is
+// posted as.
+var severityColors = map[string]string{
+	"info":     "#3db887",
+	"warning":  "#ffbc1f",
+	"critical": "#d24b4e",
+}
+
+// severityColor returns the attachment color of severity, which is empty for a plain post.
+func severityColor(severity string) (string, error) {
+	if severity == "" {
+		return "", nil
+	}
+	color, ok := severityColors[strings.ToLower(severity)]
+	if !ok {
+		severities := make([]string, 0, len(severityColors))
+		for name := range severityColors {
+			severities = append(severities, name)
+		}
+		sort.Strings(severities)
+		return "", newValidationError("severity must be one of %s", strings.Join(severities, ", "))
+	}
+	return color, nil
+}
+
+// severityAttachment shows message as an attachment in the color of its severity.
+func severityAttachment(color, message string) *model.SlackAttachment {
+	return &model.SlackAttachment{Color: color, Text: message, Fallback: message}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessMessageSeverity(t *testing.T) {
+	for severity, color := range map[string]string{
+		"info":     "#3db887",
+		"warning":  "#ffbc1f",
+		"critical": "#d24b4e",
+		"Critical": "#d24b4e",
+	} {
+		t.Run(severity, func(t *testing.T) {
+			p, api, _ := newTestPlugin(t, nil)
+			posts := mockCreatePost(api)
+
+			w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"HQ is full","severity":"`+severity+`"}`)
+			require.Equal(t, http.StatusOK, w.Code)
+			require.Len(t, *posts, 1)
+			assert.Empty(t, (*posts)[0].Message)
+			attachments := (*posts)[0].Attachments()
+			require.Len(t, attachments, 1)
+			assert.Equal(t, color, attachments[0].Color)
+			assert.Equal(t, "HQ is full", attachments[0].Text)
+			assert.Equal(t, "HQ is full", attachments[0].Fallback)
+		})
+	}
+
+	t.Run("severity attachment comes before the message attachments", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"HQ is full","severity":"warning","attachments":[{"title":"HQ"}]}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		attachments := (*posts)[0].Attachments()
+		require.Len(t, attachments, 2)
+		assert.Equal(t, "#ffbc1f", attachments[0].Color)
+		assert.Equal(t, "HQ", attachments[1].Title)
+	})
+
+	t.Run("plain post without severity", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"HQ is open"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "HQ is open", (*posts)[0].Message)
+		assert.Empty(t, (*posts)[0].Attachments())
+		assert.Nil(t, (*posts)[0].GetProp("attachments"))
+	})
+
+	t.Run("invalid severity is rejected", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, nil)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"HQ is full","severity":"urgent"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), "severity must be one of critical, info, warning")
+	})
+
+	t.Run("severity cannot be ephemeral", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, nil)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"HQ is full","severity":"info","ephemeral_to_members":true}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	})
+}
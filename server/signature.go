@@ -0,0 +1,244 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	signatureSchemeNone             = "none"
+	signatureSchemeHMACSimple       = "hmac-simple"
+	signatureSchemeStandardWebhooks = "standard-webhooks"
+
+	// teamHeader names the team whose TeamWebhookSecrets entry signs the request.
+	teamHeader = "X-Ovice-Team"
+
+	// hmacSignatureHeader carries the hex HMAC-SHA256 of the body for the hmac-simple scheme.
+	hmacSignatureHeader = "X-Ovice-Signature"
+
+	// hmacTimestampHeader carries the Unix time of an hmac-simple request when RequireNonce is
+	// set, signed together with the nonce.
+	hmacTimestampHeader = "X-Ovice-Timestamp"
+
+	// Headers defined by the Standard Webhooks specification.
+	webhookIDHeader        = "webhook-id"
+	webhookTimestampHeader = "webhook-timestamp"
+	webhookSignatureHeader = "webhook-signature"
+
+	// defaultSignatureTolerance applies when SignatureToleranceSeconds is not configured.
+	defaultSignatureTolerance = 5 * time.Minute
+)
+
+// parseSigningKey returns the key used to verify signatures. Standard Webhooks secrets are
+// conventionally base64 with a "whsec_" prefix; any other secret is used as-is.
+func parseSigningKey(secret string) ([]byte, error) {
+	if !strings.HasPrefix(secret, "whsec_") {
+		return []byte(secret), nil
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, "whsec_"))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid whsec_ secret")
+	}
+	return key, nil
+}
+
+// parseTeamSigningKeys parses the team=secret pairs of TeamWebhookSecrets, such as
+// "eng=s3cret, sales=whsec_...".
+func parseTeamSigningKeys(value string) (map[string][]byte, error) {
+	keys := map[string][]byte{}
+	for _, item := range splitList(value) {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, errors.New("expected team=secret pairs")
+		}
+
+		team := strings.ToLower(strings.TrimSpace(parts[0]))
+		key, err := parseSigningKey(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid secret of team %q", team)
+		}
+		keys[team] = key
+	}
+	return keys, nil
+}
+
+// verifySignature authenticates a webhook request according to the configured scheme, then
+// with RequireNonce set rejects replays of it. The nonce is part of the signed material, so a
+// captured request cannot be replayed under a fresh one. It returns the lower-cased name of the
+// team whose TeamWebhookSecrets entry verified the request, or "" if none did.
+func (p *Plugin) verifySignature(header http.Header, body []byte, now time.Time) (string, error) {
+	config := p.getConfiguration()
+	signingTeam := ""
+	if config.signatureScheme() != signatureSchemeNone {
+		key, team, err := p.signingKeyForTeam(header.Get(teamHeader))
+		if err != nil {
+			return "", err
+		}
+		if config.signatureScheme() == signatureSchemeHMACSimple {
+			if config.RequireNonce {
+				err = verifyHMACSimpleNonce(key, header, body, config.signatureTolerance(), now)
+			} else {
+				err = verifyHMACSimple(key, header.Get(hmacSignatureHeader), nil, body)
+			}
+		} else {
+			err = verifyStandardWebhook(key, header, body, config.signatureTolerance(), now)
+		}
+		if err != nil {
+			return "", err
+		}
+		signingTeam = team
+	}
+
+	// The nonce is only claimed for authentic requests, so forged ones cannot use it up.
+	if config.RequireNonce {
+		if err := p.claimNonce(header, now); err != nil {
+			return "", err
+		}
+	}
+	return signingTeam, nil
+}
+
+// signingKeyForTeam returns the key verifying requests of the named team, and the lower-cased
+// team name if the key is its TeamWebhookSecrets entry. A team without one, or no team at all,
+// is verified with the WebhookSecret key. A team that does not exist is rejected with 401.
+func (p *Plugin) signingKeyForTeam(team string) ([]byte, string, error) {
+	config := p.getConfiguration()
+	team = strings.ToLower(strings.TrimSpace(team))
+	if team == "" {
+		return config.signingKey, "", nil
+	}
+	if key, ok := config.teamSigningKeys[team]; ok {
+		return key, team, nil
+	}
+
+	if _, appErr := p.API.GetTeamByName(team); appErr != nil {
+		if appErr.StatusCode == http.StatusNotFound {
+			return nil, "", newHTTPError(http.StatusUnauthorized, "unknown team %q", team)
+		}
+		return nil, "", errors.Wrap(appErr, "failed to get team")
+	}
+	return config.signingKey, "", nil
+}
+
+// authorizeChannelTeam keeps requests within the team that signed them. A request verified
+// with a team's TeamWebhookSecrets entry may only post to channels of that team, and one
+// verified with WebhookSecret not to channels of a team that has its own secret. Direct and
+// group messages belong to no team, so only WebhookSecret may post to them.
+func (p *Plugin) authorizeChannelTeam(channelID, signingTeam string) error {
+	config := p.getConfiguration()
+	if config.signatureScheme() == signatureSchemeNone || len(config.teamSigningKeys) == 0 {
+		return nil
+	}
+
+	channel, appErr := p.API.GetChannel(channelID)
+	if appErr != nil {
+		if appErr.StatusCode == http.StatusNotFound {
+			return newHTTPError(http.StatusNotFound, "channel %s not found", channelID)
+		}
+		return errors.Wrap(appErr, "failed to get channel")
+	}
+	if channel.TeamId == "" {
+		if signingTeam != "" {
+			return newHTTPError(http.StatusForbidden, "a team webhook secret cannot post to direct or group messages")
+		}
+		return nil
+	}
+
+	team, appErr := p.API.GetTeam(channel.TeamId)
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to get team of channel")
+	}
+	teamName := strings.ToLower(team.Name)
+	if signingTeam != "" && teamName != signingTeam {
+		return newHTTPError(http.StatusForbidden, "channel %s does not belong to team %q", channelID, signingTeam)
+	}
+	if _, ok := config.teamSigningKeys[teamName]; ok && signingTeam == "" {
+		return newHTTPError(http.StatusForbidden, "channel %s belongs to team %q, which requires its team webhook secret", channelID, teamName)
+	}
+	return nil
+}
+
+// verifyHMACSimple checks a hex HMAC-SHA256 of prefix followed by body, optionally prefixed with
+// "sha256=".
+func verifyHMACSimple(key []byte, signature string, prefix, body []byte) error {
+	expected, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil || len(expected) == 0 {
+		return newHTTPError(http.StatusUnauthorized, "missing or malformed signature")
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(prefix)
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return newHTTPError(http.StatusUnauthorized, "invalid signature")
+	}
+	return nil
+}
+
+// verifyHMACSimpleNonce checks an hmac-simple signature over "timestamp.nonce.body", with the
+// X-Ovice-Timestamp required to be within tolerance of now.
+func verifyHMACSimpleNonce(key []byte, header http.Header, body []byte, tolerance time.Duration, now time.Time) error {
+	timestamp := header.Get(hmacTimestampHeader)
+	if timestamp == "" {
+		return newHTTPError(http.StatusUnauthorized, "missing %s header", hmacTimestampHeader)
+	}
+	if err := checkSignatureTimestamp(timestamp, tolerance, now); err != nil {
+		return err
+	}
+	prefix := timestamp + "." + header.Get(nonceHeader) + "."
+	return verifyHMACSimple(key, header.Get(hmacSignatureHeader), []byte(prefix), body)
+}
+
+// checkSignatureTimestamp rejects a signature timestamp, in Unix seconds, that is further than
+// tolerance from now.
+func checkSignatureTimestamp(timestamp string, tolerance time.Duration, now time.Time) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return newHTTPError(http.StatusUnauthorized, "malformed webhook timestamp")
+	}
+	if delta := now.Sub(time.Unix(seconds, 0)); delta > tolerance || delta < -tolerance {
+		return newHTTPError(http.StatusUnauthorized, "webhook timestamp is outside the allowed tolerance")
+	}
+	return nil
+}
+
+// verifyStandardWebhook implements Standard Webhooks verification: a base64 HMAC-SHA256 over
+// "id.timestamp.body", sent as one or more space-separated "v1,<signature>" entries, with the
+// timestamp required to be within tolerance of now to prevent replays.
+func verifyStandardWebhook(key []byte, header http.Header, body []byte, tolerance time.Duration, now time.Time) error {
+	id := header.Get(webhookIDHeader)
+	timestamp := header.Get(webhookTimestampHeader)
+	signatures := header.Get(webhookSignatureHeader)
+	if id == "" || timestamp == "" || signatures == "" {
+		return newHTTPError(http.StatusUnauthorized, "missing webhook signature headers")
+	}
+
+	if err := checkSignatureTimestamp(timestamp, tolerance, now); err != nil {
+		return err
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id + "." + timestamp + "."))
+	mac.Write(body)
+	expected := mac.Sum(nil)
+
+	for _, entry := range strings.Fields(signatures) {
+		parts := strings.SplitN(entry, ",", 2)
+		if len(parts) != 2 || parts[0] != "v1" {
+			continue
+		}
+		signature, decodeErr := base64.StdEncoding.DecodeString(parts[1])
+		if decodeErr == nil && hmac.Equal(signature, expected) {
+			return nil
+		}
+	}
+	return newHTTPError(http.StatusUnauthorized, "invalid signature")
+}
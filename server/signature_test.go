@@ -0,0 +1,257 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const testWebhookSecret = "whsec_MfKQ9r8GKYqrTwjUPD8ILPZIo2LaLaSw"
+
+// signStandardWebhook returns the Standard Webhooks headers for body sent at timestamp.
+func signStandardWebhook(t *testing.T, secret, id string, timestamp time.Time, body string) http.Header {
+	t.Helper()
+
+	key, err := parseSigningKey(secret)
+	require.NoError(t, err)
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id + "." + ts + "." + body))
+
+	header := http.Header{}
+	header.Set(webhookIDHeader, id)
+	header.Set(webhookTimestampHeader, ts)
+	header.Set(webhookSignatureHeader, "v1,bm90IHRoaXMgb25l v1,"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	return header
+}
+
+func signHMACSimple(secret, body string) http.Header {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	header := http.Header{}
+	header.Set(hmacSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	return header
+}
+
+// signHMACSimpleNonce returns the hmac-simple headers for body sent at timestamp with nonce, as
+// required with RequireNonce.
+func signHMACSimpleNonce(secret, nonce string, timestamp time.Time, body string) http.Header {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "." + nonce + "." + body))
+	header := http.Header{}
+	header.Set(hmacSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	header.Set(hmacTimestampHeader, ts)
+	header.Set(nonceHeader, nonce)
+	return header
+}
+
+// doSignedRequest posts body to path with extra headers.
+func doSignedRequest(p *Plugin, path, body string, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	p.ServeHTTP(nil, w, r)
+	return w
+}
+
+func TestStandardWebhookSignature(t *testing.T) {
+	const body = `{"channel_id":"channel","message":"hi"}`
+	config := &configuration{SignatureScheme: signatureSchemeStandardWebhooks, WebhookSecret: testWebhookSecret}
+
+	t.Run("valid signature", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		posts := mockCreatePost(api)
+
+		w := doSignedRequest(p, "/webhook", body, signStandardWebhook(t, testWebhookSecret, "msg_1", time.Now(), body))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, *posts, 1)
+	})
+
+	t.Run("tampered body", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, config)
+
+		w := doSignedRequest(p, "/webhook", `{"channel_id":"other","message":"hi"}`, signStandardWebhook(t, testWebhookSecret, "msg_1", time.Now(), body))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("expired timestamp", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, config)
+
+		w := doSignedRequest(p, "/webhook", body, signStandardWebhook(t, testWebhookSecret, "msg_1", time.Now().Add(-6*time.Minute), body))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "tolerance")
+	})
+
+	t.Run("configurable tolerance", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{SignatureScheme: signatureSchemeStandardWebhooks, WebhookSecret: testWebhookSecret, SignatureToleranceSeconds: 600})
+		mockCreatePost(api)
+
+		w := doSignedRequest(p, "/webhook", body, signStandardWebhook(t, testWebhookSecret, "msg_1", time.Now().Add(-6*time.Minute), body))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
+
+func TestSignatureSchemeSelection(t *testing.T) {
+	const body = `{"event":"capacity","current":1,"max":10,"space_name":"HQ"}`
+	const secret = "s3cret"
+
+	t.Run("none accepts unsigned requests", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, nil)
+		assert.Equal(t, http.StatusOK, doSignedRequest(p, "/events", body, nil).Code)
+	})
+
+	t.Run("hmac-simple", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, &configuration{SignatureScheme: signatureSchemeHMACSimple, WebhookSecret: secret})
+		assert.Equal(t, http.StatusOK, doSignedRequest(p, "/events", body, signHMACSimple(secret, body)).Code)
+		assert.Equal(t, http.StatusUnauthorized, doSignedRequest(p, "/events", body, nil).Code)
+		assert.Equal(t, http.StatusUnauthorized, doSignedRequest(p, "/events", body, signStandardWebhook(t, secret, "msg_1", time.Now(), body)).Code)
+	})
+
+	t.Run("standard-webhooks rejects an hmac-simple signature", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, &configuration{SignatureScheme: signatureSchemeStandardWebhooks, WebhookSecret: secret})
+		assert.Equal(t, http.StatusUnauthorized, doSignedRequest(p, "/events", body, signHMACSimple(secret, body)).Code)
+		assert.Equal(t, http.StatusOK, doSignedRequest(p, "/events", body, signStandardWebhook(t, secret, "msg_1", time.Now(), body)).Code)
+	})
+
+	t.Run("invalid configuration", func(t *testing.T) {
+		assert.Error(t, (&configuration{SignatureScheme: "bespoke", WebhookSecret: secret}).process())
+		assert.Error(t, (&configuration{SignatureScheme: signatureSchemeHMACSimple}).process())
+		assert.Error(t, (&configuration{SignatureScheme: signatureSchemeStandardWebhooks, WebhookSecret: "whsec_!!"}).process())
+	})
+}
+
+func TestTeamWebhookSecrets(t *testing.T) {
+	const body = `{"channel_id":"channel","message":"hi"}`
+	config := &configuration{
+		SignatureScheme:    signatureSchemeHMACSimple,
+		WebhookSecret:      "global",
+		TeamWebhookSecrets: "eng=eng-secret\nSales = sales-secret",
+	}
+	withTeam := func(header http.Header, team string) http.Header {
+		header.Set(teamHeader, team)
+		return header
+	}
+	// setup gives every team a channel named after it, plus the direct channel "dm".
+	setup := func(t *testing.T) (*Plugin, *plugintest.API) {
+		p, api, _ := newTestPlugin(t, config)
+		unmock(api, "GetChannel")
+		for _, team := range []*model.Team{{Id: "engid", Name: "eng"}, {Id: "salesid", Name: "Sales"}, {Id: "supportid", Name: "support"}} {
+			api.On("GetChannel", team.Id+"-channel").Return(&model.Channel{Id: team.Id + "-channel", TeamId: team.Id, Type: model.ChannelTypeOpen}, nil).Maybe()
+			api.On("GetTeam", team.Id).Return(team, nil).Maybe()
+		}
+		api.On("GetChannel", "dm").Return(&model.Channel{Id: "dm", Type: model.ChannelTypeDirect}, nil).Maybe()
+		api.On("GetTeamByName", "support").Return(&model.Team{Id: "supportid", Name: "support"}, nil).Maybe()
+		return p, api
+	}
+	to := func(channelID string) string {
+		return `{"channel_id":"` + channelID + `","message":"hi"}`
+	}
+	send := func(p *Plugin, channelID, secret, team string) int {
+		body := to(channelID)
+		header := signHMACSimple(secret, body)
+		if team != "" {
+			header = withTeam(header, team)
+		}
+		return doSignedRequest(p, "/webhook", body, header).Code
+	}
+
+	t.Run("team secret verifies its team", func(t *testing.T) {
+		p, api := setup(t)
+		mockCreatePost(api)
+
+		assert.Equal(t, http.StatusOK, send(p, "engid-channel", "eng-secret", "eng"))
+		assert.Equal(t, http.StatusOK, send(p, "salesid-channel", "sales-secret", "sales"))
+		assert.Equal(t, http.StatusUnauthorized, send(p, "engid-channel", "global", "eng"))
+		assert.Equal(t, http.StatusUnauthorized, send(p, "engid-channel", "sales-secret", "eng"))
+	})
+
+	t.Run("team secret is rejected for channels of other teams", func(t *testing.T) {
+		p, api := setup(t)
+
+		w := doSignedRequest(p, "/webhook", to("salesid-channel"), withTeam(signHMACSimple("eng-secret", to("salesid-channel")), "eng"))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), `does not belong to team \"eng\"`)
+		assert.Equal(t, http.StatusForbidden, send(p, "supportid-channel", "eng-secret", "eng"))
+		assert.Equal(t, http.StatusForbidden, send(p, "dm", "eng-secret", "eng"))
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("batch messages stay within the signing team", func(t *testing.T) {
+		p, api := setup(t)
+		posts := mockCreatePost(api)
+
+		batch := `{"messages":[{"channel_id":"engid-channel","message":"one"},{"channel_id":"salesid-channel","message":"two"}]}`
+		w := doSignedRequest(p, "/webhook/batch", batch, withTeam(signHMACSimple("eng-secret", batch), "eng"))
+		assert.Equal(t, http.StatusMultiStatus, w.Code)
+		assert.Contains(t, w.Body.String(), "does not belong to team")
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "engid-channel", (*posts)[0].ChannelId)
+	})
+
+	t.Run("category channels stay within the signing team", func(t *testing.T) {
+		p, api := setup(t)
+		const adminID = "adminuseridadminuseridabcd"
+		api.On("GetTeamByName", "Sales").Return(&model.Team{Id: "salesid", Name: "Sales"}, nil)
+		api.On("GetChannelSidebarCategories", adminID, "salesid").Return(&model.OrderedSidebarCategories{
+			Categories: model.SidebarCategoriesWithChannels{
+				{SidebarCategory: model.SidebarCategory{Id: "announcements"}, Channels: []string{"salesid-channel"}},
+			},
+		}, nil)
+
+		category := `{"category":"announcements","category_user_id":"` + adminID + `","team_name":"Sales","message":"hi"}`
+		w := doSignedRequest(p, "/webhook", category, withTeam(signHMACSimple("eng-secret", category), "eng"))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("global secret is rejected for teams with their own secret", func(t *testing.T) {
+		p, api := setup(t)
+
+		assert.Equal(t, http.StatusForbidden, send(p, "engid-channel", "global", ""))
+		assert.Equal(t, http.StatusForbidden, send(p, "salesid-channel", "global", "support"))
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("global secret verifies requests without a team secret", func(t *testing.T) {
+		p, api := setup(t)
+		mockCreatePost(api)
+
+		assert.Equal(t, http.StatusOK, send(p, "supportid-channel", "global", ""))
+		assert.Equal(t, http.StatusOK, send(p, "supportid-channel", "global", "support"))
+		assert.Equal(t, http.StatusOK, send(p, "dm", "global", ""))
+		assert.Equal(t, http.StatusUnauthorized, doSignedRequest(p, "/webhook", body, signHMACSimple("eng-secret", body)).Code)
+	})
+
+	t.Run("unknown team is rejected", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		api.On("GetTeamByName", "nowhere").Return(nil, &model.AppError{Message: "not found", StatusCode: http.StatusNotFound})
+
+		w := doSignedRequest(p, "/webhook", body, withTeam(signHMACSimple("global", body), "nowhere"))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), `unknown team \"nowhere\"`)
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("malformed pairs are rejected", func(t *testing.T) {
+		assert.Error(t, (&configuration{TeamWebhookSecrets: "eng"}).process())
+		assert.Error(t, (&configuration{TeamWebhookSecrets: "=secret"}).process())
+		assert.Error(t, (&configuration{TeamWebhookSecrets: "eng=whsec_!!"}).process())
+	})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+const (
+	// simulationProp marks a post made by /ovice simulate.
+	simulationProp = "ovice_simulation"
+
+	// simulationLabel starts the message of a simulated presence notification.
+	simulationLabel = "**[Simulation]**"
+)
+
+// executeSimulateCommand lets a system admin preview a presence notification: the named user is
+// resolved and announced the way a real enter or leave event would be, but in the current
+// channel, marked as a simulation and without touching the space's occupancy.
+func (p *Plugin) executeSimulateCommand(args *model.CommandArgs, params []string, locale string) *model.CommandResponse {
+	if !p.API.HasPermissionTo(args.UserId, model.PermissionManageSystem) {
+		return ephemeralResponse(translate(locale, "Only system admins can simulate presence events."))
+	}
+	if len(params) < 2 || (!strings.EqualFold(params[0], presenceEventEnter) && !strings.EqualFold(params[0], presenceEventLeave)) {
+		return ephemeralResponse(translate(locale, "Usage: `/%s simulate enter|leave @user [space]`", p.getConfiguration().commandTrigger()))
+	}
+
+	username := strings.TrimPrefix(params[1], "@")
+	target, appErr := p.API.GetUserByUsername(username)
+	if appErr != nil {
+		if appErr.StatusCode == http.StatusNotFound {
+			return ephemeralResponse(translate(locale, "User @%s does not exist.", username))
+		}
+		p.API.LogWarn("Failed to get user to simulate", "username", username, "err", appErr.Error())
+		return ephemeralResponse(translate(locale, "Failed to look up the user. Please try again later."))
+	}
+
+	event := &presenceEvent{
+		Event:     strings.ToLower(params[0]),
+		UserEmail: target.Email,
+		UserName:  target.GetDisplayName(model.ShowFullName),
+		SpaceName: strings.Join(params[2:], " "),
+	}
+	user, active := p.resolvePresenceUser(event)
+	if !active {
+		return ephemeralResponse(translate(locale, "@%s is deactivated, so their presence would not be announced.", username))
+	}
+
+	post := p.buildPresencePost(user, simulationLabel+" "+p.renderPresenceMessage(event, user))
+	if event.Event == presenceEventEnter && p.getConfiguration().PresenceThumbnail {
+		p.addSpaceThumbnail(post, event.SpaceName)
+	}
+	post.AddProp(simulationProp, true)
+	post.UserId = p.botUserIDForSpace(event.SpaceName)
+	post.ChannelId = args.ChannelId
+	post.RootId = args.RootId
+
+	created, appErr := p.createIntegrationPost(post)
+	if appErr != nil {
+		p.API.LogWarn("Failed to post simulated presence", "channel_id", args.ChannelId, "err", appErr.Error())
+		return ephemeralResponse(translate(locale, "Failed to post the simulated event. Please try again later."))
+	}
+	return p.postedResponse(args, created, locale)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimulateCommand(t *testing.T) {
+	alice := &model.User{Id: "alice", Username: "alice", Email: "alice@example.com", FirstName: "Alice"}
+	setup := func(t *testing.T) (*Plugin, *plugintest.API) {
+		p, api, kv := newTestPlugin(t, &configuration{DefaultChannelID: "town", PresenceJoinLink: true, SpaceURL: "https://hq.ovice.in"})
+		t.Cleanup(func() {
+			assert.NotContains(t, kv.data, sessionKey("HQ"), "a simulation does not change occupancy")
+		})
+		api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true).Maybe()
+		api.On("GetUserByUsername", "alice").Return(alice, nil).Maybe()
+		api.On("GetUserByEmail", "alice@example.com").Return(alice, nil).Maybe()
+		return p, api
+	}
+	// posting mocks what a simulation by the admin needs to be posted.
+	posting := func(api *plugintest.API) *[]*model.Post {
+		mockUserLocale(api, "admin", "")
+		mockSiteURL(api, "")
+		return mockCreatePost(api)
+	}
+
+	t.Run("simulate enter", func(t *testing.T) {
+		p, api := setup(t)
+		posts := posting(api)
+
+		assert.Equal(t, "Posted.", executeCommand(t, p, "admin", "ops", "/ovice simulate enter @alice HQ"))
+		require.Len(t, *posts, 1)
+		post := (*posts)[0]
+		assert.Equal(t, "ops", post.ChannelId, "posted in the current channel, not the space's")
+		assert.Equal(t, testBotUserID, post.UserId)
+		assert.Equal(t, "**[Simulation]** :large_green_circle: @alice entered **HQ**.\n— [Join the space](https://hq.ovice.in)", post.Message)
+		assert.Equal(t, true, post.GetProp(simulationProp))
+	})
+
+	t.Run("simulate leave", func(t *testing.T) {
+		p, api := setup(t)
+		posts := posting(api)
+
+		assert.Equal(t, "Posted.", executeCommand(t, p, "admin", "ops", "/ovice simulate leave alice"))
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "**[Simulation]** :red_circle: @alice left the oVice space.", (*posts)[0].Message)
+	})
+
+	t.Run("non-admins are denied", func(t *testing.T) {
+		p, api := setup(t)
+		mockUserLocale(api, "bob", "")
+		api.On("HasPermissionTo", "bob", model.PermissionManageSystem).Return(false)
+
+		assert.Equal(t, "Only system admins can simulate presence events.", executeCommand(t, p, "bob", "ops", "/ovice simulate enter @alice"))
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("usage and unknown users", func(t *testing.T) {
+		p, api := setup(t)
+		mockUserLocale(api, "admin", "")
+		api.On("GetUserByUsername", "nobody").Return(nil, &model.AppError{Message: "not found", StatusCode: http.StatusNotFound})
+
+		assert.Equal(t, "Usage: `/ovice simulate enter|leave @user [space]`", executeCommand(t, p, "admin", "ops", "/ovice simulate wave @alice"))
+		assert.Equal(t, "User @nobody does not exist.", executeCommand(t, p, "admin", "ops", "/ovice simulate enter @nobody"))
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// attachmentHexColor matches the #rgb and #rrggbb colors of a message attachment.
+var attachmentHexColor = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// attachmentNamedColors are the color names Mattermost accepts besides hex colors.
+var attachmentNamedColors = map[string]bool{"good": true, "warning": true, "danger": true}
+
+// validateAttachments checks each attachment against the message attachment rules, returning a
+// 400 naming the path of the first offending field, such as attachments[1].color.
+func validateAttachments(attachments []*model.SlackAttachment) error {
+	for i, attachment := range attachments {
+		path := fmt.Sprintf("attachments[%d]", i)
+		if attachment == nil {
+			return newFieldError(path, "must be an object")
+		}
+		if attachment.Fallback == "" && attachment.Text == "" && attachment.Title == "" {
+			return newFieldError(path+".fallback", "is required when the attachment has no text or title")
+		}
+		if attachment.Color != "" && !attachmentNamedColors[attachment.Color] && !attachmentHexColor.MatchString(attachment.Color) {
+			return newFieldError(path+".color", "must be a hex color such as #1c58d9, or good, warning or danger")
+		}
+
+		urls := []struct{ name, value string }{
+			{"author_link", attachment.AuthorLink},
+			{"author_icon", attachment.AuthorIcon},
+			{"title_link", attachment.TitleLink},
+			{"image_url", attachment.ImageURL},
+			{"thumb_url", attachment.ThumbURL},
+			{"footer_icon", attachment.FooterIcon},
+		}
+		for _, u := range urls {
+			if u.value != "" && !isHTTPURL(u.value) {
+				return newFieldError(path+"."+u.name, "must be an http or https URL")
+			}
+		}
+
+		for j, field := range attachment.Fields {
+			fieldPath := fmt.Sprintf("%s.fields[%d]", path, j)
+			if field == nil {
+				return newFieldError(fieldPath, "must be an object")
+			}
+			if field.Title == "" {
+				return newFieldError(fieldPath+".title", "is required")
+			}
+		}
+	}
+	return nil
+}
+
+// newFieldError returns the 400 answered for a payload whose field at path is invalid.
+func newFieldError(path, format string, args ...interface{}) *httpError {
+	herr := newHTTPError(http.StatusBadRequest, path+" "+format, args...)
+	herr.Field = path
+	return herr
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateAttachments(t *testing.T) {
+	for name, tc := range map[string]struct {
+		attachments string
+		field       string
+		err         string
+	}{
+		"bad color at an index": {
+			attachments: `[{"title":"HQ","color":"good"},{"title":"Annex","color":"blue"}]`,
+			field:       "attachments[1].color",
+			err:         "attachments[1].color must be a hex color such as #1c58d9, or good, warning or danger",
+		},
+		"missing fallback": {
+			attachments: `[{"title":"HQ"},{"image_url":"https://hq.ovice.in/banner.png"}]`,
+			field:       "attachments[1].fallback",
+			err:         "attachments[1].fallback is required when the attachment has no text or title",
+		},
+		"null attachment": {
+			attachments: `[null]`,
+			field:       "attachments[0]",
+			err:         "attachments[0] must be an object",
+		},
+		"bad url": {
+			attachments: `[{"title":"HQ","title_link":"javascript:alert(1)"}]`,
+			field:       "attachments[0].title_link",
+			err:         "attachments[0].title_link must be an http or https URL",
+		},
+		"field without title": {
+			attachments: `[{"text":"Agenda","fields":[{"title":"Room","value":"HQ"},{"value":"10:00"}]}]`,
+			field:       "attachments[0].fields[1].title",
+			err:         "attachments[0].fields[1].title is required",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			p, api, _ := newTestPlugin(t, &configuration{})
+
+			w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi","attachments":`+tc.attachments+`}`)
+			require.Equal(t, http.StatusBadRequest, w.Code)
+			assert.JSONEq(t, `{"error":"`+tc.err+`","field":"`+tc.field+`"}`, w.Body.String())
+			api.AssertNotCalled(t, "CreatePost", mock.Anything)
+		})
+	}
+
+	t.Run("valid attachments are posted", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{})
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi","attachments":[
+			{"fallback":"HQ banner","color":"#1c58d9","image_url":"https://hq.ovice.in/banner.png"},
+			{"title":"Annex","title_link":"https://annex.ovice.in","color":"#abc","fields":[{"title":"Room","value":"Annex","short":true}]},
+			{"text":"Agenda","color":"danger"}
+		]}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Len(t, (*posts)[0].Attachments(), 3)
+	})
+
+	t.Run("batch reports the field of the failed message", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{})
+		mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook/batch", `{"messages":[
+			{"channel_id":"channel","message":"one"},
+			{"channel_id":"channel","message":"two","attachments":[{"title":"HQ","color":"#12345"}]}
+		]}`)
+		require.Equal(t, http.StatusMultiStatus, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"attachments[0].color"`)
+	})
+}
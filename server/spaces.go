@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// spaceConfig describes one oVice space in the Spaces setting.
+type spaceConfig struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+
+	// ChannelID is where the space's events are announced, defaulting to DefaultChannelID.
+	ChannelID string `json:"channel_id"`
+
+	// Rooms maps the ID of a room in the space to the channel its events are announced in,
+	// overriding ChannelID.
+	Rooms map[string]string `json:"rooms"`
+
+	// BotUsername, if set, gives the space its own bot identity instead of the shared bot.
+	BotUsername    string `json:"bot_username"`
+	BotDisplayName string `json:"bot_display_name"`
+
+	// RateLimitPerMinute caps how many events of the space are handled per minute, overriding
+	// SpaceRateLimitPerMinute.
+	RateLimitPerMinute int `json:"rate_limit_per_minute"`
+}
+
+// parseSpaces parses the Spaces setting, a JSON array of spaceConfig.
+func parseSpaces(value string) ([]spaceConfig, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	var spaces []spaceConfig
+	if err := json.Unmarshal([]byte(value), &spaces); err != nil {
+		return nil, errors.Wrap(err, "failed to parse spaces")
+	}
+
+	seen := map[string]bool{}
+	for i, space := range spaces {
+		if space.Name == "" {
+			return nil, errors.Errorf("space %d has no name", i)
+		}
+		if seen[strings.ToLower(space.Name)] {
+			return nil, errors.Errorf("space %q is configured more than once", space.Name)
+		}
+		seen[strings.ToLower(space.Name)] = true
+
+		if space.URL != "" && !isHTTPURL(space.URL) {
+			return nil, errors.Errorf("space %q has an invalid url %q", space.Name, space.URL)
+		}
+		for roomID, channelID := range space.Rooms {
+			if roomID == "" || channelID == "" {
+				return nil, errors.Errorf("space %q has a room without an id or channel", space.Name)
+			}
+		}
+		if space.RateLimitPerMinute < 0 {
+			return nil, errors.Errorf("space %q has a negative rate_limit_per_minute", space.Name)
+		}
+		if space.BotUsername != "" && space.BotDisplayName == "" {
+			spaces[i].BotDisplayName = space.BotUsername
+		}
+	}
+	return spaces, nil
+}
+
+// space returns the configured space with the given name, ignoring case, or nil.
+func (c *configuration) space(name string) *spaceConfig {
+	for i := range c.spaces {
+		if strings.EqualFold(c.spaces[i].Name, name) {
+			return &c.spaces[i]
+		}
+	}
+	return nil
+}
+
+// spaceRateLimit returns the events per minute allowed for the named space: its own
+// rate_limit_per_minute, else SpaceRateLimitPerMinute. Zero means no limit.
+func (c *configuration) spaceRateLimit(name string) int {
+	if space := c.space(name); space != nil && space.RateLimitPerMinute > 0 {
+		return space.RateLimitPerMinute
+	}
+	return c.SpaceRateLimitPerMinute
+}
+
+// validateRoomChannels checks that every channel a room is mapped to exists.
+func (p *Plugin) validateRoomChannels(config *configuration) error {
+	for _, space := range config.spaces {
+		for roomID, channelID := range space.Rooms {
+			if _, appErr := p.API.GetChannel(channelID); appErr != nil {
+				return errors.Wrapf(appErr, "room %q of space %q is mapped to unknown channel %q", roomID, space.Name, channelID)
+			}
+		}
+	}
+	return nil
+}
+
+// ensureSpaceBots ensures the bot of every space that defines one and records their user IDs.
+func (p *Plugin) ensureSpaceBots() error {
+	botIDs := map[string]string{}
+	for _, space := range p.getConfiguration().spaces {
+		if space.BotUsername == "" || botIDs[space.BotUsername] != "" {
+			continue
+		}
+		botUserID, err := p.ensureBot(space.BotUsername, space.BotDisplayName)
+		if err != nil {
+			return errors.Wrapf(err, "failed to ensure bot for space %q", space.Name)
+		}
+		botIDs[space.BotUsername] = botUserID
+	}
+
+	p.spaceBotsLock.Lock()
+	defer p.spaceBotsLock.Unlock()
+	p.spaceBotIDs = botIDs
+
+	return nil
+}
+
+// botUserIDForSpace returns the user ID of the bot that posts for the named space, falling back
+// to the shared bot when the space defines none.
+func (p *Plugin) botUserIDForSpace(spaceName string) string {
+	space := p.getConfiguration().space(spaceName)
+	if space == nil || space.BotUsername == "" {
+		return p.botUserID
+	}
+
+	p.spaceBotsLock.RLock()
+	defer p.spaceBotsLock.RUnlock()
+	if botUserID := p.spaceBotIDs[space.BotUsername]; botUserID != "" {
+		return botUserID
+	}
+	return p.botUserID
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSpaces(t *testing.T) {
+	spaces, err := parseSpaces(`[{"name":"HQ","url":"https://hq.ovice.in","bot_username":"ovice-hq"}]`)
+	require.NoError(t, err)
+	require.Len(t, spaces, 1)
+	assert.Equal(t, "ovice-hq", spaces[0].BotDisplayName)
+
+	_, err = parseSpaces(`[{"name":"HQ"},{"name":"hq"}]`)
+	assert.Error(t, err)
+
+	_, err = parseSpaces(`[{"url":"https://hq.ovice.in"}]`)
+	assert.Error(t, err)
+}
+
+func TestSpaceBots(t *testing.T) {
+	const spaces = `[{"name":"HQ","channel_id":"hq-channel","bot_username":"ovice-hq"},{"name":"Lab"}]`
+
+	t.Run("webhook posts as the space bot", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{Spaces: spaces})
+		p.spaceBotIDs = map[string]string{"ovice-hq": "hqbotid"}
+		api.On("HasPermissionToChannel", "hqbotid", "town", model.PermissionCreatePost).Return(true)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"town","message":"hello","space":"hq"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "hqbotid", (*posts)[0].UserId)
+	})
+
+	t.Run("space without a bot uses the shared bot", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{Spaces: spaces})
+		p.spaceBotIDs = map[string]string{"ovice-hq": "hqbotid"}
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"town","message":"hello","space":"Lab"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, testBotUserID, (*posts)[0].UserId)
+	})
+
+	t.Run("unknown space is rejected", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, &configuration{Spaces: spaces})
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"town","message":"hello","space":"Annex"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	})
+
+	t.Run("presence posts as the space bot in the space channel", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town", Spaces: spaces})
+		p.spaceBotIDs = map[string]string{"ovice-hq": "hqbotid"}
+		api.On("GetUserByEmail", "alice@example.com").Return(nil, &model.AppError{Message: "not found"})
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/events", `{"event":"enter","user_email":"alice@example.com","user_name":"Alice","space_name":"HQ"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "hqbotid", (*posts)[0].UserId)
+		assert.Equal(t, "hq-channel", (*posts)[0].ChannelId)
+	})
+
+	t.Run("activation ensures every space bot", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{Spaces: spaces})
+		p.botUserID = ""
+		api.On("GetUserByUsername", botUsername).Return(&model.User{Id: testBotUserID, IsBot: true}, nil)
+		api.On("GetBot", testBotUserID, true).Return(&model.Bot{UserId: testBotUserID, DisplayName: botDisplayName, Description: botDescription}, nil)
+		api.On("GetUserByUsername", "ovice-hq").Return(nil, &model.AppError{Message: "not found"})
+		api.On("CreateBot", mock.MatchedBy(func(bot *model.Bot) bool {
+			return bot.Username == "ovice-hq"
+		})).Return(&model.Bot{UserId: "hqbotid"}, nil).Once()
+		api.On("RegisterCommand", mock.Anything).Return(nil)
+		api.On("LoadPluginConfiguration", mock.Anything).Run(func(args mock.Arguments) {
+			args.Get(0).(*configuration).ConfigVersion = currentConfigVersion
+		}).Return(nil)
+
+		require.NoError(t, p.OnActivate())
+		defer func() { _ = p.OnDeactivate() }()
+
+		assert.Equal(t, testBotUserID, p.botUserID)
+		assert.Equal(t, "hqbotid", p.botUserIDForSpace("HQ"))
+		assert.Equal(t, testBotUserID, p.botUserIDForSpace("Lab"))
+	})
+}
+
+func TestRoomChannels(t *testing.T) {
+	const spaces = `[{"name":"HQ","channel_id":"hq-channel","rooms":{"lounge":"lounge-channel"}}]`
+	enter := func(roomID string) string {
+		return `{"event":"enter","user_name":"Alice","space_name":"HQ","room_id":"` + roomID + `"}`
+	}
+
+	t.Run("matched room is routed to its channel", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town", Spaces: spaces})
+		posts := mockCreatePost(api)
+
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", enter("lounge")).Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "lounge-channel", (*posts)[0].ChannelId)
+	})
+
+	t.Run("other rooms fall back to the space channel", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town", Spaces: spaces})
+		posts := mockCreatePost(api)
+
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", enter("kitchen")).Code)
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", enter("")).Code)
+		require.Len(t, *posts, 2)
+		assert.Equal(t, "hq-channel", (*posts)[0].ChannelId)
+		assert.Equal(t, "hq-channel", (*posts)[1].ChannelId)
+	})
+
+	t.Run("unknown room channel is rejected", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		api.On("LoadPluginConfiguration", mock.Anything).Run(func(args mock.Arguments) {
+			args.Get(0).(*configuration).Spaces = spaces
+		}).Return(nil)
+		unmock(api, "GetChannel")
+		api.On("GetChannel", "lounge-channel").Return(nil, &model.AppError{Message: "not found"})
+
+		assert.Error(t, p.OnConfigurationChange())
+		assert.Empty(t, p.getConfiguration().spaces)
+	})
+
+	t.Run("existing room channel is accepted", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		api.On("LoadPluginConfiguration", mock.Anything).Run(func(args mock.Arguments) {
+			args.Get(0).(*configuration).Spaces = spaces
+		}).Return(nil)
+		unmock(api, "GetChannel")
+		api.On("GetChannel", "lounge-channel").Return(&model.Channel{Id: "lounge-channel"}, nil)
+
+		require.NoError(t, p.OnConfigurationChange())
+		assert.Len(t, p.getConfiguration().spaces, 1)
+	})
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+// maxSummaryVisitors caps the visitors remembered per day so a busy space cannot grow its
+// record without bound. Visitors beyond it are not counted as unique.
+const maxSummaryVisitors = 2000
+
+// dailyStats accumulates the presence of a space over one day in SummaryTimezone.
+type dailyStats struct {
+	// Day is the date the stats cover, as YYYY-MM-DD.
+	Day string `json:"day"`
+
+	Joins int `json:"joins"`
+
+	// Visitors holds a hash of each visitor's oVice email or name.
+	Visitors []string `json:"visitors"`
+
+	Peak int `json:"peak"`
+
+	// Occupants is the current number of users in the space, and OccupiedSince when it last
+	// became occupied, or zero while it is empty.
+	Occupants     int   `json:"occupants"`
+	OccupiedSince int64 `json:"occupied_since"`
+
+	// ActiveMillis is how long the space was occupied during Day, excluding the current
+	// occupied stretch.
+	ActiveMillis int64 `json:"active_ms"`
+}
+
+// summaryKey returns the KV key of the daily stats of the named space.
+func summaryKey(spaceName string) string {
+	return hashedKey(summaryKeyPrefix, strings.ToLower(spaceName))
+}
+
+// presenceVisitor identifies the user of event in dailyStats.Visitors and spaceSession.Present.
+func presenceVisitor(event *presenceEvent) string {
+	visitor := event.UserEmail
+	if visitor == "" {
+		visitor = event.UserName
+	}
+	sum := sha256.Sum256([]byte(strings.ToLower(visitor)))
+	return hex.EncodeToString(sum[:12])
+}
+
+// startOfDay returns midnight of the day of now, in the location of now.
+func startOfDay(now time.Time) time.Time {
+	year, month, day := now.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, now.Location())
+}
+
+// rollOver starts the stats over if they cover an earlier day than now, keeping the current
+// occupancy. An occupied stretch spanning midnight counts from midnight on the new day.
+func (s *dailyStats) rollOver(now time.Time) {
+	day := now.Format("2006-01-02")
+	if s.Day == day {
+		return
+	}
+	*s = dailyStats{Day: day, Peak: s.Occupants, Occupants: s.Occupants}
+	if s.Occupants > 0 {
+		s.OccupiedSince = model.GetMillisForTime(startOfDay(now))
+	}
+}
+
+// record updates the stats for event, after which the space has occupants users.
+func (s *dailyStats) record(event *presenceEvent, occupants int, now time.Time) {
+	s.rollOver(now)
+	nowMillis := model.GetMillisForTime(now)
+
+	if event.Event == presenceEventEnter {
+		s.Joins++
+		visitor := presenceVisitor(event)
+		known := false
+		for _, v := range s.Visitors {
+			if v == visitor {
+				known = true
+				break
+			}
+		}
+		if !known && len(s.Visitors) < maxSummaryVisitors {
+			s.Visitors = append(s.Visitors, visitor)
+		}
+	}
+
+	switch {
+	case s.Occupants == 0 && occupants > 0:
+		s.OccupiedSince = nowMillis
+	case s.Occupants > 0 && occupants == 0:
+		s.ActiveMillis += nowMillis - s.OccupiedSince
+		s.OccupiedSince = 0
+	}
+	s.Occupants = occupants
+	if occupants > s.Peak {
+		s.Peak = occupants
+	}
+}
+
+// activeTime returns how long the space was occupied during the day up to now.
+func (s *dailyStats) activeTime(now time.Time) time.Duration {
+	active := s.ActiveMillis
+	if s.Occupants > 0 {
+		active += model.GetMillisForTime(now) - s.OccupiedSince
+	}
+	return time.Duration(active) * time.Millisecond
+}
+
+// recordDailyStats adds a presence event to the daily stats of its space.
+func (p *Plugin) recordDailyStats(event *presenceEvent, occupants int, now time.Time) error {
+	now = now.In(p.getConfiguration().summaryLocation())
+	return p.kvUpdate(summaryKey(event.SpaceName), func(oldValue []byte) ([]byte, error) {
+		stats, err := decodeDailyStats(oldValue)
+		if err != nil {
+			return nil, err
+		}
+		stats.record(event, occupants, now)
+		return encodeDailyStats(stats)
+	})
+}
+
+// resetDailyStats starts the stats of the named space over from now, keeping the current
+// occupancy.
+func (p *Plugin) resetDailyStats(spaceName string, now time.Time) error {
+	return p.kvUpdate(summaryKey(spaceName), func(oldValue []byte) ([]byte, error) {
+		stats, err := decodeDailyStats(oldValue)
+		if err != nil {
+			return nil, err
+		}
+		reset := &dailyStats{Day: now.Format("2006-01-02"), Peak: stats.Occupants, Occupants: stats.Occupants}
+		if reset.Occupants > 0 {
+			reset.OccupiedSince = model.GetMillisForTime(now)
+		}
+		return encodeDailyStats(reset)
+	})
+}
+
+func decodeDailyStats(data []byte) (*dailyStats, error) {
+	stats := &dailyStats{}
+	if data != nil {
+		if err := json.Unmarshal(data, stats); err != nil {
+			return nil, errors.Wrap(err, "failed to decode daily stats")
+		}
+	}
+	return stats, nil
+}
+
+func encodeDailyStats(stats *dailyStats) ([]byte, error) {
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode daily stats")
+	}
+	return data, nil
+}
+
+// renderDailySummary formats the digest of stats for the named space.
+func renderDailySummary(stats *dailyStats, spaceName, locale string, now time.Time) string {
+	title := translate(locale, "Daily summary of the space for %s:", stats.Day)
+	if spaceName != "" {
+		title = translate(locale, "Daily summary of **%s** for %s:", spaceName, stats.Day)
+	}
+	return strings.Join([]string{
+		title,
+		translate(locale, "- Joins: %d", stats.Joins),
+		translate(locale, "- Unique visitors: %d", len(stats.Visitors)),
+		translate(locale, "- Peak occupancy: %d", stats.Peak),
+		translate(locale, "- Active time: %s", formatUptime(stats.activeTime(now))),
+	}, "\n")
+}
+
+// executeSummaryCommand posts the digest of a space's day so far to the channel, confirms it to
+// the user and starts its stats over.
+func (p *Plugin) executeSummaryCommand(args *model.CommandArgs, params []string, locale string) *model.CommandResponse {
+	spaceName := strings.Join(params, " ")
+	now := time.Now().In(p.getConfiguration().summaryLocation())
+
+	data, appErr := p.API.KVGet(summaryKey(spaceName))
+	if appErr != nil {
+		p.API.LogWarn("Failed to get daily stats", "space_name", spaceName, "err", appErr.Error())
+		return ephemeralResponse(translate(locale, "Failed to look up the space. Please try again later."))
+	}
+	stats, err := decodeDailyStats(data)
+	if err != nil {
+		p.API.LogWarn("Failed to decode daily stats", "space_name", spaceName, "err", err.Error())
+		return ephemeralResponse(translate(locale, "Failed to look up the space. Please try again later."))
+	}
+	stats.rollOver(now)
+
+	created, appErr := p.createIntegrationPost(&model.Post{
+		UserId:    p.botUserIDForSpace(spaceName),
+		ChannelId: args.ChannelId,
+		RootId:    args.RootId,
+		Message:   renderDailySummary(stats, spaceName, locale, now),
+	})
+	if appErr != nil {
+		p.API.LogWarn("Failed to post daily summary", "channel_id", args.ChannelId, "err", appErr.Error())
+		return ephemeralResponse(translate(locale, "Failed to post the daily summary. Please try again later."))
+	}
+
+	if err = p.resetDailyStats(spaceName, now); err != nil {
+		p.API.LogWarn("Failed to reset daily stats", "space_name", spaceName, "err", err.Error())
+	}
+	return p.postedResponse(args, created, locale)
+}
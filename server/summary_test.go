@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDailyStats(t *testing.T) {
+	enter := &presenceEvent{Event: presenceEventEnter, UserEmail: "alice@example.com", SpaceName: "HQ"}
+	enterBob := &presenceEvent{Event: presenceEventEnter, UserEmail: "bob@example.com", SpaceName: "HQ"}
+	leave := &presenceEvent{Event: presenceEventLeave, UserEmail: "alice@example.com", SpaceName: "HQ"}
+	leaveBob := &presenceEvent{Event: presenceEventLeave, UserEmail: "bob@example.com", SpaceName: "HQ"}
+
+	getStats := func(t *testing.T, p *Plugin) *dailyStats {
+		data, appErr := p.API.KVGet(summaryKey("HQ"))
+		require.Nil(t, appErr)
+		stats, err := decodeDailyStats(data)
+		require.NoError(t, err)
+		return stats
+	}
+
+	t.Run("accumulates joins, visitors, peak and active time", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, nil)
+		start := time.Date(2026, 10, 14, 9, 0, 0, 0, time.UTC)
+
+		require.NoError(t, p.recordDailyStats(enter, 1, start))
+		require.NoError(t, p.recordDailyStats(enterBob, 2, start.Add(10*time.Minute)))
+		require.NoError(t, p.recordDailyStats(leave, 1, start.Add(20*time.Minute)))
+		require.NoError(t, p.recordDailyStats(leaveBob, 0, start.Add(time.Hour)))
+		require.NoError(t, p.recordDailyStats(enter, 1, start.Add(2*time.Hour)))
+
+		stats := getStats(t, p)
+		assert.Equal(t, "2026-10-14", stats.Day)
+		assert.Equal(t, 3, stats.Joins)
+		assert.Len(t, stats.Visitors, 2)
+		assert.Equal(t, 2, stats.Peak)
+		assert.Equal(t, 1, stats.Occupants)
+		assert.Equal(t, 90*time.Minute, stats.activeTime(start.Add(150*time.Minute)))
+	})
+
+	t.Run("renders the digest", func(t *testing.T) {
+		stats := &dailyStats{Day: "2026-10-14", Joins: 12, Visitors: []string{"a", "b", "c", "d", "e"}, Peak: 4, ActiveMillis: (3*time.Hour + 20*time.Minute).Milliseconds()}
+
+		assert.Equal(t, "Daily summary of **HQ** for 2026-10-14:\n- Joins: 12\n- Unique visitors: 5\n- Peak occupancy: 4\n- Active time: 3h 20m", renderDailySummary(stats, "HQ", "en", time.Now()))
+		assert.Equal(t, "2026-10-14 の **HQ** の日次サマリー:\n- 入室数: 12\n- ユニーク訪問者数: 5\n- 最大在室人数: 4\n- アクティブ時間: 3h 20m", renderDailySummary(stats, "HQ", "ja", time.Now()))
+	})
+
+	t.Run("rolls over at midnight in the configured time zone", func(t *testing.T) {
+		tokyo, err := time.LoadLocation("Asia/Tokyo")
+		require.NoError(t, err)
+		p, _, _ := newTestPlugin(t, &configuration{SummaryTimezone: "Asia/Tokyo"})
+
+		// All of these are on the 14th in UTC, so only the Tokyo day boundary starts the stats over.
+		evening := time.Date(2026, 10, 14, 23, 30, 0, 0, tokyo)
+		require.NoError(t, p.recordDailyStats(enter, 1, evening))
+		require.NoError(t, p.recordDailyStats(enterBob, 2, evening.Add(20*time.Minute)))
+		assert.Equal(t, "2026-10-14", getStats(t, p).Day)
+
+		morning := time.Date(2026, 10, 15, 0, 30, 0, 0, tokyo)
+		require.NoError(t, p.recordDailyStats(leave, 1, morning))
+
+		stats := getStats(t, p)
+		assert.Equal(t, "2026-10-15", stats.Day)
+		assert.Equal(t, 0, stats.Joins)
+		assert.Empty(t, stats.Visitors)
+		assert.Equal(t, 2, stats.Peak)
+		assert.Equal(t, 1, stats.Occupants)
+		assert.Equal(t, 45*time.Minute, stats.activeTime(morning.Add(15*time.Minute)))
+	})
+
+	t.Run("summary command posts the digest and resets the counters", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockUserLocale(api, "alice", "")
+		posts := mockCreatePost(api)
+		now := time.Now()
+		require.NoError(t, p.recordDailyStats(enter, 1, now.Add(-time.Second)))
+		require.NoError(t, p.recordDailyStats(enterBob, 2, now.Add(-time.Second)))
+
+		mockSiteURL(api, "")
+
+		assert.Equal(t, "Posted.", executeCommand(t, p, "alice", "town", "/ovice summary HQ"))
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "town", (*posts)[0].ChannelId)
+		assert.Contains(t, (*posts)[0].Message, "Daily summary of **HQ** for "+now.UTC().Format("2006-01-02")+":\n- Joins: 2\n- Unique visitors: 2\n- Peak occupancy: 2\n")
+
+		stats := getStats(t, p)
+		assert.Equal(t, 0, stats.Joins)
+		assert.Empty(t, stats.Visitors)
+		assert.Equal(t, 2, stats.Peak)
+		assert.Equal(t, 2, stats.Occupants)
+	})
+
+	t.Run("failed post keeps the counters", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockUserLocale(api, "alice", "")
+		api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(nil, &model.AppError{Message: "boom", StatusCode: http.StatusInternalServerError})
+		require.NoError(t, p.recordDailyStats(enter, 1, time.Now()))
+
+		assert.Equal(t, "Failed to post the daily summary. Please try again later.", executeCommand(t, p, "alice", "town", "/ovice summary HQ"))
+		assert.Equal(t, 1, getStats(t, p).Joins)
+	})
+
+	t.Run("invalid time zone", func(t *testing.T) {
+		assert.Error(t, (&configuration{SummaryTimezone: "Mars/Olympus"}).process())
+	})
+}
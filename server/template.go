@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// messageTemplateData is the data a MessageTemplate is executed with.
+type messageTemplateData struct {
+	Message   string
+	ChannelID string
+}
+
+// compileMessageTemplate parses a MessageTemplate setting. An empty setting yields a nil
+// template, meaning messages are posted verbatim. The template is executed once against sample
+// data so references to unknown fields are caught before it can reach the request path.
+func compileMessageTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+
+	tmpl, err := template.New("message").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse message template")
+	}
+	if err = tmpl.Execute(&bytes.Buffer{}, messageTemplateData{Message: "message", ChannelID: "channel"}); err != nil {
+		return nil, errors.Wrap(err, "failed to execute message template")
+	}
+
+	return tmpl, nil
+}
+
+// compileChannelTemplates parses a ChannelMessageTemplates setting, a JSON object mapping a
+// channel ID to the template of that channel, into compiled templates keyed by channel ID.
+func compileChannelTemplates(value string) (map[string]*template.Template, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	var texts map[string]string
+	if err := json.Unmarshal([]byte(value), &texts); err != nil {
+		return nil, errors.Wrap(err, "failed to parse channel templates")
+	}
+
+	templates := make(map[string]*template.Template, len(texts))
+	for channelID, text := range texts {
+		if channelID == "" {
+			return nil, errors.New("a channel template has no channel id")
+		}
+		if text == "" {
+			return nil, errors.Errorf("channel %q has an empty template; use {{.Message}} to post messages as sent", channelID)
+		}
+		tmpl, err := compileMessageTemplate(text)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid template of channel %q", channelID)
+		}
+		templates[channelID] = tmpl
+	}
+	return templates, nil
+}
+
+// getMessageTemplate returns the compiled MessageTemplate, or nil if none is configured.
+func (p *Plugin) getMessageTemplate() *template.Template {
+	p.messageTemplateLock.RLock()
+	defer p.messageTemplateLock.RUnlock()
+
+	return p.messageTemplate
+}
+
+// setMessageTemplate replaces the compiled MessageTemplate.
+func (p *Plugin) setMessageTemplate(tmpl *template.Template) {
+	p.messageTemplateLock.Lock()
+	defer p.messageTemplateLock.Unlock()
+
+	p.messageTemplate = tmpl
+}
+
+// markdownEscaper backslash-escapes the characters Mattermost markdown gives a meaning to.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"`", "\\`",
+	"*", `\*`,
+	"_", `\_`,
+	"~", `\~`,
+	"#", `\#`,
+	"[", `\[`,
+	"]", `\]`,
+	"(", `\(`,
+	")", `\)`,
+	"<", `\<`,
+	">", `\>`,
+	"|", `\|`,
+	"!", `\!`,
+	"-", `\-`,
+	"+", `\+`,
+	":", `\:`,
+)
+
+// escapeMarkdown makes text render literally instead of as markdown.
+func escapeMarkdown(text string) string {
+	return markdownEscaper.Replace(text)
+}
+
+// renderMessage applies the template of body's channel, or else the active message template, to
+// body. A raw message is escaped first, so only the template itself is rendered as markdown.
+func (p *Plugin) renderMessage(body *RequestBody) (string, error) {
+	message := body.Message
+	if body.Raw {
+		message = escapeMarkdown(message)
+	}
+
+	tmpl := p.getConfiguration().channelTemplates[body.ChannelID]
+	if tmpl == nil {
+		tmpl = p.getMessageTemplate()
+	}
+	if tmpl == nil {
+		return message, nil
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, messageTemplateData{Message: message, ChannelID: body.ChannelID}); err != nil {
+		return "", errors.Wrap(err, "failed to render message template")
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileMessageTemplate(t *testing.T) {
+	tmpl, err := compileMessageTemplate("")
+	require.NoError(t, err)
+	assert.Nil(t, tmpl)
+
+	_, err = compileMessageTemplate("{{.Message")
+	assert.Error(t, err)
+
+	_, err = compileMessageTemplate("{{.Unknown}}")
+	assert.Error(t, err)
+}
+
+func TestMessageTemplateHotReload(t *testing.T) {
+	p, api, _ := newTestPlugin(t, nil)
+	posts := mockCreatePost(api)
+
+	loadConfig := func(messageTemplate string) *mock.Call {
+		return api.On("LoadPluginConfiguration", mock.AnythingOfType("*main.configuration")).Run(func(args mock.Arguments) {
+			args.Get(0).(*configuration).MessageTemplate = messageTemplate
+		}).Return(nil).Once()
+	}
+	post := func() string {
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hello"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		return (*posts)[len(*posts)-1].Message
+	}
+
+	t.Run("valid template is hot-swapped", func(t *testing.T) {
+		loadConfig("**oVice:** {{.Message}}")
+		require.NoError(t, p.OnConfigurationChange())
+		assert.Equal(t, "**oVice:** hello", post())
+
+		loadConfig("[{{.ChannelID}}] {{.Message}}")
+		require.NoError(t, p.OnConfigurationChange())
+		assert.Equal(t, "[channel] hello", post())
+	})
+
+	t.Run("bad template is rejected and the previous one kept", func(t *testing.T) {
+		loadConfig("{{.Message")
+		assert.Error(t, p.OnConfigurationChange())
+		assert.Equal(t, "[channel] hello", post())
+	})
+}
+
+func TestChannelMessageTemplates(t *testing.T) {
+	p, api, _ := newTestPlugin(t, &configuration{
+		ChannelMessageTemplates: `{"ops":"[{{.ChannelID}}] {{.Message}}","social":"Hey all! {{.Message}} :tada:"}`,
+	})
+	p.setMessageTemplate(mustCompileMessageTemplate(t, "**oVice:** {{.Message}}"))
+	posts := mockCreatePost(api)
+	post := func(channelID string) string {
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"`+channelID+`","message":"hello"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		return (*posts)[len(*posts)-1].Message
+	}
+
+	t.Run("channel override applies", func(t *testing.T) {
+		assert.Equal(t, "[ops] hello", post("ops"))
+		assert.Equal(t, "Hey all! hello :tada:", post("social"))
+	})
+
+	t.Run("other channels use the global template", func(t *testing.T) {
+		assert.Equal(t, "**oVice:** hello", post("town"))
+	})
+
+	t.Run("bad channel template rejects the configuration", func(t *testing.T) {
+		for _, value := range []string{
+			`{"ops":"{{.Message"}`,
+			`{"ops":"{{.Unknown}}"}`,
+			`{"ops":""}`,
+			`["ops"]`,
+		} {
+			err := (&configuration{ChannelMessageTemplates: value}).process()
+			assert.Error(t, err, value)
+		}
+
+		err := (&configuration{ChannelMessageTemplates: `{"ops":"{{.Message"}`}).process()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `invalid template of channel "ops"`)
+	})
+}
+
+func mustCompileMessageTemplate(t *testing.T, text string) *template.Template {
+	t.Helper()
+	tmpl, err := compileMessageTemplate(text)
+	require.NoError(t, err)
+	return tmpl
+}
+
+func TestEscapeMarkdown(t *testing.T) {
+	assert.Equal(t, `my\_file\_name.png`, escapeMarkdown("my_file_name.png"))
+	assert.Equal(t, `\*\*not bold\*\* \[link\]\(url\)`, escapeMarkdown("**not bold** [link](url)"))
+	assert.Equal(t, "\\`code\\`", escapeMarkdown("`code`"))
+	assert.Equal(t, `C\:\\Users`, escapeMarkdown(`C:\Users`))
+}
+
+func TestRawMessage(t *testing.T) {
+	t.Run("raw message is escaped", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"Uploaded my_board_snapshot_v2.png","raw":true}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, `Uploaded my\_board\_snapshot\_v2.png`, (*posts)[0].Message)
+	})
+
+	t.Run("markdown is kept by default", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"Uploaded my_board_snapshot_v2.png"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "Uploaded my_board_snapshot_v2.png", (*posts)[0].Message)
+	})
+
+	t.Run("template is still rendered as markdown", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		tmpl, err := compileMessageTemplate("**oVice:** {{.Message}}")
+		require.NoError(t, err)
+		p.setMessageTemplate(tmpl)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"*_*","raw":true}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, `**oVice:** \*\_\*`, (*posts)[0].Message)
+	})
+}
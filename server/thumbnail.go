@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+// thumbnailTTL bounds how long the thumbnail URL of a space is reused before the oVice API is
+// asked again.
+const thumbnailTTL = 5 * time.Minute
+
+// cachedThumbnail is a space thumbnail URL fetched from the oVice API.
+type cachedThumbnail struct {
+	url       string
+	expiresAt time.Time
+}
+
+// getSpaceThumbnail returns the URL of the current thumbnail of the named space. Results are
+// cached for thumbnailTTL; failures are not, so the next announcement tries again.
+func (p *Plugin) getSpaceThumbnail(spaceName string, now time.Time) (string, error) {
+	client := p.getConfiguration().oviceClient
+	if client == nil {
+		return "", errors.New("the oVice API is not configured")
+	}
+
+	key := strings.ToLower(spaceName)
+	p.thumbnailsLock.Lock()
+	cached, ok := p.thumbnails[key]
+	p.thumbnailsLock.Unlock()
+	if ok && now.Before(cached.expiresAt) {
+		return cached.url, nil
+	}
+
+	thumbnailURL, err := client.GetSpaceThumbnail(spaceName)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get space thumbnail")
+	}
+	if thumbnailURL != "" && !isHTTPURL(thumbnailURL) {
+		return "", errors.Errorf("invalid space thumbnail URL %q", thumbnailURL)
+	}
+
+	p.thumbnailsLock.Lock()
+	defer p.thumbnailsLock.Unlock()
+	if p.thumbnails == nil {
+		p.thumbnails = map[string]*cachedThumbnail{}
+	}
+	for name, entry := range p.thumbnails {
+		if !now.Before(entry.expiresAt) {
+			delete(p.thumbnails, name)
+		}
+	}
+	p.thumbnails[key] = &cachedThumbnail{url: thumbnailURL, expiresAt: now.Add(thumbnailTTL)}
+	return thumbnailURL, nil
+}
+
+// addSpaceThumbnail shows the thumbnail of the named space as the image of post's attachment,
+// turning a plain post into one. Without a thumbnail the post is left as it is.
+func (p *Plugin) addSpaceThumbnail(post *model.Post, spaceName string) {
+	thumbnailURL, err := p.getSpaceThumbnail(spaceName, time.Now())
+	if err != nil {
+		p.API.LogWarn("Failed to get space thumbnail", "space_name", spaceName, "err", err.Error())
+		return
+	}
+	if thumbnailURL == "" {
+		return
+	}
+
+	attachments := post.Attachments()
+	if len(attachments) == 0 {
+		attachments = []*model.SlackAttachment{{Fallback: post.Message, Text: post.Message}}
+		post.Message = ""
+	}
+	attachments[0].ImageURL = thumbnailURL
+	model.ParseSlackAttachment(post, attachments)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPresenceThumbnail(t *testing.T) {
+	const enter = `{"event":"enter","user_email":"alice@example.com","user_name":"Alice","space_name":"HQ"}`
+
+	thumbnailServer := func(t *testing.T, status int) (*httptest.Server, *int) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			assert.Equal(t, "/spaces/thumbnail", r.URL.Path)
+			assert.Equal(t, "HQ", r.URL.Query().Get("space_name"))
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+				return
+			}
+			fmt.Fprint(w, `{"thumbnail_url":"https://cdn.ovice.example/hq.png"}`)
+		}))
+		t.Cleanup(server.Close)
+		return server, &calls
+	}
+	setup := func(t *testing.T, server *httptest.Server) (*Plugin, *[]*model.Post) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "town", OviceAPIURL: server.URL, PresenceThumbnail: true})
+		api.On("GetUserByEmail", "alice@example.com").Return(&model.User{Id: "alice", Username: "alice"}, nil)
+		mockSiteURL(api, "")
+		return p, mockCreatePost(api)
+	}
+
+	t.Run("enter shows the space thumbnail", func(t *testing.T) {
+		server, _ := thumbnailServer(t, http.StatusOK)
+		p, posts := setup(t, server)
+
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", enter).Code)
+		require.Len(t, *posts, 1)
+		assert.Empty(t, (*posts)[0].Message)
+		attachments := (*posts)[0].Attachments()
+		require.Len(t, attachments, 1)
+		assert.Equal(t, ":large_green_circle: @alice entered **HQ**.", attachments[0].Text)
+		assert.Equal(t, "https://cdn.ovice.example/hq.png", attachments[0].ImageURL)
+	})
+
+	t.Run("thumbnail URL is cached", func(t *testing.T) {
+		server, calls := thumbnailServer(t, http.StatusOK)
+		p, posts := setup(t, server)
+
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", enter).Code)
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", enter).Code)
+		require.Len(t, *posts, 2)
+		assert.Equal(t, "https://cdn.ovice.example/hq.png", (*posts)[1].Attachments()[0].ImageURL)
+		assert.Equal(t, 1, *calls)
+	})
+
+	t.Run("fetch failure posts without the thumbnail", func(t *testing.T) {
+		server, calls := thumbnailServer(t, http.StatusBadGateway)
+		p, posts := setup(t, server)
+
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", enter).Code)
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", enter).Code)
+		require.Len(t, *posts, 2)
+		assert.Equal(t, ":large_green_circle: @alice entered **HQ**.", (*posts)[0].Message)
+		assert.Empty(t, (*posts)[0].Attachments())
+		assert.Equal(t, 2, *calls)
+	})
+
+	t.Run("leave has no thumbnail", func(t *testing.T) {
+		server, calls := thumbnailServer(t, http.StatusOK)
+		p, posts := setup(t, server)
+
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/events", `{"event":"leave","user_email":"alice@example.com","space_name":"HQ"}`).Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, ":red_circle: @alice left **HQ**.", (*posts)[0].Message)
+		assert.Zero(t, *calls)
+	})
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+// userTokenLength is the number of random characters of a personal token.
+const userTokenLength = 40
+
+// userTokenKey returns the KV key mapping the hash of token to the user it was issued to, so
+// the token itself is never stored.
+func userTokenKey(token string) string {
+	return hashedKey(userTokenKeyPrefix, token)
+}
+
+// userTokenOwnerKey returns the KV key holding the userTokenKey of the token of userID, so a
+// new token or a revocation can remove the old one. User IDs fit the key length limit as they
+// are.
+func userTokenOwnerKey(userID string) string {
+	return userTokenOwnerKeyPrefix + userID
+}
+
+// notifyRequest is the payload accepted by /me/notify.
+type notifyRequest struct {
+	Message string `json:"message"`
+}
+
+// issueUserToken creates a personal token for userID, revoking any previous one.
+func (p *Plugin) issueUserToken(userID string) (string, error) {
+	if err := p.revokeUserToken(userID); err != nil {
+		return "", err
+	}
+
+	token := model.NewRandomString(userTokenLength)
+	key := userTokenKey(token)
+	if appErr := p.API.KVSet(key, []byte(userID)); appErr != nil {
+		return "", errors.Wrap(appErr, "failed to store personal token")
+	}
+	if appErr := p.API.KVSet(userTokenOwnerKey(userID), []byte(key)); appErr != nil {
+		return "", errors.Wrap(appErr, "failed to store personal token owner")
+	}
+	return token, nil
+}
+
+// revokeUserToken removes the personal token of userID, if any.
+func (p *Plugin) revokeUserToken(userID string) error {
+	key, appErr := p.API.KVGet(userTokenOwnerKey(userID))
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to get personal token owner")
+	}
+	if key == nil {
+		return nil
+	}
+	if appErr = p.API.KVDelete(string(key)); appErr != nil {
+		return errors.Wrap(appErr, "failed to delete personal token")
+	}
+	if appErr = p.API.KVDelete(userTokenOwnerKey(userID)); appErr != nil {
+		return errors.Wrap(appErr, "failed to delete personal token owner")
+	}
+	return nil
+}
+
+// userForToken returns the ID of the user token was issued to, or an empty string if the token
+// is unknown or was revoked.
+func (p *Plugin) userForToken(token string) (string, error) {
+	userID, appErr := p.API.KVGet(userTokenKey(token))
+	if appErr != nil {
+		return "", errors.Wrap(appErr, "failed to get personal token")
+	}
+	return string(userID), nil
+}
+
+// executeTokenCommand issues the user a personal token for /me/notify, or with `revoke`
+// revokes it.
+func (p *Plugin) executeTokenCommand(args *model.CommandArgs, params []string, locale string) *model.CommandResponse {
+	if len(params) > 0 && strings.EqualFold(params[0], "revoke") {
+		if err := p.revokeUserToken(args.UserId); err != nil {
+			p.API.LogWarn("Failed to revoke personal token", "user_id", args.UserId, "err", err.Error())
+			return ephemeralResponse(translate(locale, "Failed to update your token. Please try again later."))
+		}
+		return ephemeralResponse(translate(locale, "Your personal token was revoked."))
+	}
+
+	token, err := p.issueUserToken(args.UserId)
+	if err != nil {
+		p.API.LogWarn("Failed to issue personal token", "user_id", args.UserId, "err", err.Error())
+		return ephemeralResponse(translate(locale, "Failed to update your token. Please try again later."))
+	}
+	return ephemeralResponse(translate(locale, "Your personal token is `%s`. Keep it secret: it lets any app send you direct messages from the oVice bot. Running this command again replaces it, and `/%s token revoke` revokes it.",
+		token, p.getConfiguration().commandTrigger()))
+}
+
+// handleNotify posts a direct message from the bot to the user whose personal token is sent as
+// a bearer token, e.g. from an oVice desktop widget. It can only reach that user.
+func (p *Plugin) handleNotify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		p.writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+		p.writeError(w, newHTTPError(http.StatusUnsupportedMediaType, "Content-Type must be application/json"))
+		return
+	}
+
+	token := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	if token == "" {
+		p.writeError(w, newHTTPError(http.StatusUnauthorized, "missing personal token"))
+		return
+	}
+	userID, err := p.userForToken(token)
+	if err != nil {
+		p.writeError(w, err)
+		return
+	}
+	if userID == "" {
+		p.writeError(w, newHTTPError(http.StatusUnauthorized, "invalid or revoked personal token"))
+		return
+	}
+
+	var request notifyRequest
+	if err = json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes)).Decode(&request); err != nil {
+		p.writeError(w, newHTTPError(http.StatusBadRequest, "invalid JSON payload"))
+		return
+	}
+	if strings.TrimSpace(request.Message) == "" {
+		p.writeError(w, newValidationError("message is required"))
+		return
+	}
+	if limit := p.getConfiguration().maxMessageRunes(); utf8.RuneCountInString(request.Message) > limit {
+		p.writeError(w, newValidationError("message exceeds %d characters", limit))
+		return
+	}
+
+	user, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		if appErr.StatusCode == http.StatusNotFound {
+			p.writeError(w, newHTTPError(http.StatusUnauthorized, "invalid or revoked personal token"))
+			return
+		}
+		p.writeError(w, errors.Wrap(appErr, "failed to get user"))
+		return
+	}
+	channel, appErr := p.API.GetDirectChannel(p.botUserID, user.Id)
+	if appErr != nil {
+		p.writeError(w, errors.Wrap(appErr, "failed to get direct message channel"))
+		return
+	}
+
+	post, appErr := p.createPost(&model.Post{
+		UserId:    p.botUserID,
+		ChannelId: channel.Id,
+		Message:   request.Message,
+	})
+	if appErr != nil {
+		p.writeError(w, errors.Wrap(appErr, "failed to create direct message"))
+		return
+	}
+	writeJSON(w, http.StatusOK, &webhookResponse{Status: "ok", PostID: post.Id})
+}
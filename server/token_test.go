@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserToken(t *testing.T) {
+	tokenPattern := regexp.MustCompile("`([a-z0-9]{40})`")
+	issue := func(t *testing.T, p *Plugin) string {
+		t.Helper()
+		matches := tokenPattern.FindStringSubmatch(executeCommand(t, p, "alice", "town", "/ovice token"))
+		require.Len(t, matches, 2)
+		return matches[1]
+	}
+	notify := func(p *Plugin, token, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/me/notify", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, r)
+		return w
+	}
+
+	t.Run("token is issued and stored hashed", func(t *testing.T) {
+		p, api, kv := newTestPlugin(t, nil)
+		mockUserLocale(api, "alice", "")
+
+		token := issue(t, p)
+		for key, value := range kv.data {
+			assert.NotContains(t, key, token)
+			assert.NotContains(t, string(value), token)
+		}
+		userID, err := p.userForToken(token)
+		require.NoError(t, err)
+		assert.Equal(t, "alice", userID)
+	})
+
+	t.Run("valid token sends a direct message to its owner", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockUserLocale(api, "alice", "")
+		api.On("GetUser", "alice").Return(&model.User{Id: "alice", Username: "alice"}, nil)
+		api.On("GetDirectChannel", testBotUserID, "alice").Return(&model.Channel{Id: "dm"}, nil)
+		posts := mockCreatePost(api)
+
+		w := notify(p, issue(t, p), `{"message":"Your meeting starts in 5 minutes"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "dm", (*posts)[0].ChannelId)
+		assert.Equal(t, testBotUserID, (*posts)[0].UserId)
+		assert.Equal(t, "Your meeting starts in 5 minutes", (*posts)[0].Message)
+	})
+
+	t.Run("revoked and replaced tokens are rejected", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockUserLocale(api, "alice", "")
+
+		replaced := issue(t, p)
+		revoked := issue(t, p)
+		assert.Equal(t, "Your personal token was revoked.", executeCommand(t, p, "alice", "town", "/ovice token revoke"))
+
+		for _, token := range []string{replaced, revoked, "made-up"} {
+			w := notify(p, token, `{"message":"hi"}`)
+			assert.Equal(t, http.StatusUnauthorized, w.Code, token)
+		}
+		assert.Equal(t, http.StatusUnauthorized, notify(p, "", `{"message":"hi"}`).Code)
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("message is required", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockUserLocale(api, "alice", "")
+
+		assert.Equal(t, http.StatusUnprocessableEntity, notify(p, issue(t, p), `{"message":" "}`).Code)
+	})
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// traceparentHeader carries the W3C Trace Context of the caller, see
+// https://www.w3.org/TR/trace-context/#traceparent-header.
+const traceparentHeader = "traceparent"
+
+var traceparentPattern = regexp.MustCompile(`^([0-9a-f]{2})-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+
+// traceSpan is a single timed operation of a traced request. Spans follow the OpenTelemetry
+// model and IDs so they can be correlated with the rest of the observability stack, without
+// pulling the OpenTelemetry SDK into the plugin binary.
+//
+// All methods are safe to call on a nil span, which is what tracing hands out when it is
+// disabled, so instrumented code never needs to check whether tracing is on.
+type traceSpan struct {
+	Name         string
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]interface{}
+
+	exporter spanExporter
+}
+
+// spanExporter receives every span once it has ended.
+type spanExporter interface {
+	ExportSpan(span *traceSpan)
+}
+
+// logSpanExporter writes spans to the plugin log. It is used unless another exporter is set.
+type logSpanExporter struct {
+	p *Plugin
+}
+
+func (e logSpanExporter) ExportSpan(span *traceSpan) {
+	keyValuePairs := []interface{}{
+		"name", span.Name,
+		"trace_id", span.TraceID,
+		"span_id", span.SpanID,
+		"parent_span_id", span.ParentSpanID,
+		"duration_ms", span.End.Sub(span.Start).Milliseconds(),
+	}
+	for key, value := range span.Attributes {
+		keyValuePairs = append(keyValuePairs, key, value)
+	}
+	e.p.API.LogDebug("oVice trace span", keyValuePairs...)
+}
+
+// startRequestSpan starts the root span of an incoming request, continuing the trace of its
+// traceparent header when present. It returns nil when tracing is disabled.
+func (p *Plugin) startRequestSpan(name string, header http.Header) *traceSpan {
+	if !p.getConfiguration().EnableTracing {
+		return nil
+	}
+
+	exporter := p.spanExporter
+	if exporter == nil {
+		exporter = logSpanExporter{p: p}
+	}
+
+	span := &traceSpan{
+		Name:       name,
+		SpanID:     newTraceID(8),
+		Start:      time.Now(),
+		Attributes: map[string]interface{}{},
+		exporter:   exporter,
+	}
+	if traceID, parentSpanID, ok := parseTraceparent(header.Get(traceparentHeader)); ok {
+		span.TraceID = traceID
+		span.ParentSpanID = parentSpanID
+	} else {
+		span.TraceID = newTraceID(16)
+	}
+	return span
+}
+
+// startChild starts a span for a phase of the operation s measures.
+func (s *traceSpan) startChild(name string) *traceSpan {
+	if s == nil {
+		return nil
+	}
+	return &traceSpan{
+		Name:         name,
+		TraceID:      s.TraceID,
+		SpanID:       newTraceID(8),
+		ParentSpanID: s.SpanID,
+		Start:        time.Now(),
+		Attributes:   map[string]interface{}{},
+		exporter:     s.exporter,
+	}
+}
+
+// setAttribute records key=value on s.
+func (s *traceSpan) setAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.Attributes[key] = value
+}
+
+// finish ends s and hands it to the exporter.
+func (s *traceSpan) finish() {
+	if s == nil {
+		return
+	}
+	s.End = time.Now()
+	s.exporter.ExportSpan(s)
+}
+
+// parseTraceparent extracts the trace and parent span IDs of a traceparent header value.
+func parseTraceparent(value string) (traceID, parentSpanID string, ok bool) {
+	match := traceparentPattern.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil || match[1] == "ff" {
+		return "", "", false
+	}
+	if strings.Trim(match[2], "0") == "" || strings.Trim(match[3], "0") == "" {
+		return "", "", false
+	}
+	return match[2], match[3], true
+}
+
+// newTraceID returns a random hex ID of n bytes.
+func newTraceID(n int) string {
+	id := make([]byte, n)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// statusRecorder remembers the status code written to the wrapped ResponseWriter.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memorySpanExporter collects exported spans for inspection.
+type memorySpanExporter struct {
+	mu    sync.Mutex
+	spans []*traceSpan
+}
+
+func (e *memorySpanExporter) ExportSpan(span *traceSpan) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+func (e *memorySpanExporter) span(name string) *traceSpan {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, span := range e.spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	return nil
+}
+
+func TestParseTraceparent(t *testing.T) {
+	traceID, parentSpanID, ok := parseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.True(t, ok)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceID)
+	assert.Equal(t, "00f067aa0ba902b7", parentSpanID)
+
+	for _, value := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+	} {
+		_, _, ok = parseTraceparent(value)
+		assert.False(t, ok, value)
+	}
+}
+
+func TestWebhookTracing(t *testing.T) {
+	doTracedRequest := func(p *Plugin, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set(traceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, r)
+		return w
+	}
+
+	t.Run("successful post produces a span with attributes", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{EnableTracing: true})
+		exporter := &memorySpanExporter{}
+		p.spanExporter = exporter
+		mockCreatePost(api)
+
+		w := doTracedRequest(p, `{"channel_id":"town","message":"hello"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		root := exporter.span("webhook")
+		require.NotNil(t, root)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", root.TraceID)
+		assert.Equal(t, "00f067aa0ba902b7", root.ParentSpanID)
+		assert.Equal(t, "town", root.Attributes["channel_id"])
+		assert.Equal(t, http.StatusOK, root.Attributes["status"])
+		assert.Contains(t, root.Attributes, "latency_ms")
+
+		for _, phase := range []string{"auth", "parse", "resolve", "post"} {
+			span := exporter.span(phase)
+			require.NotNil(t, span, phase)
+			assert.Equal(t, root.TraceID, span.TraceID)
+			assert.Equal(t, root.SpanID, span.ParentSpanID)
+		}
+	})
+
+	t.Run("failed request records its status", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, &configuration{EnableTracing: true})
+		exporter := &memorySpanExporter{}
+		p.spanExporter = exporter
+
+		w := doTracedRequest(p, `{"channel_id":"town"}`)
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+		root := exporter.span("webhook")
+		require.NotNil(t, root)
+		assert.Equal(t, http.StatusUnprocessableEntity, root.Attributes["status"])
+	})
+
+	t.Run("disabled tracing exports nothing", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		exporter := &memorySpanExporter{}
+		p.spanExporter = exporter
+		mockCreatePost(api)
+
+		w := doTracedRequest(p, `{"channel_id":"town","message":"hello"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, exporter.spans)
+	})
+}
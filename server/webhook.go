@@ -0,0 +1,881 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	// broadcastRootIDProp marks a channel post as the broadcast copy of a reply in the given thread.
+	broadcastRootIDProp = "ovice_broadcast_root_id"
+
+	// quickRepliesProp holds the reply suggestions the webapp renders as chips under a post.
+	quickRepliesProp = "ovice_quick_replies"
+
+	// unsafeLinksProp set to "true" makes Mattermost skip link previews and embeds for a post.
+	// model has no constant for it in the server version the plugin builds against.
+	unsafeLinksProp = "unsafe_links"
+
+	// maxQuickReplies and maxQuickReplyRunes bound the quick_replies of a message.
+	maxQuickReplies    = 10
+	maxQuickReplyRunes = 50
+
+	// lastBotPostSearchLimit is how many of the latest posts of a channel are searched for the
+	// bot's own post when replying to it.
+	lastBotPostSearchLimit = 60
+)
+
+// RequestBody is the payload accepted by the webhook endpoint.
+type RequestBody struct {
+	// ChannelID selects the target channel directly. Alternatively, ChannelName and TeamName
+	// select it by name.
+	ChannelID   string `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	TeamName    string `json:"team_name"`
+
+	// ChannelURL selects the target channel by a URL copied from Mattermost, either of the
+	// channel (/team/channels/name) or of a post in it (/team/pl/post_id).
+	ChannelURL string `json:"channel_url"`
+
+	// DMUserID sends the message to the direct message channel between the bot and this user,
+	// creating the channel if needed.
+	DMUserID string `json:"dm_user_id"`
+
+	// RoomID selects the channel an oVice room is mapped to in Spaces, looking only at the rooms
+	// of Space when it is set.
+	RoomID string `json:"room_id"`
+
+	// Category posts the message to every channel of a sidebar category of CategoryUserID in the
+	// team named TeamName, selected by ID or display name, answering with a result per channel.
+	// The category may hold at most maxBatchMessages channels.
+	Category       string `json:"category"`
+	CategoryUserID string `json:"category_user_id"`
+
+	// DMEphemeral shows a DMUserID message as an ephemeral post in the direct message channel
+	// instead of a permanent one.
+	DMEphemeral bool `json:"dm_ephemeral"`
+
+	Message string `json:"message"`
+	RootID  string `json:"root_id"`
+
+	// ReplyToLastBotPost threads the message under the most recent post of the bot in the
+	// channel, or starts a new thread if the bot has not posted there recently.
+	ReplyToLastBotPost bool `json:"reply_to_last_bot_post"`
+
+	// ResolveMentions leaves an @token a mention only if it names an existing user or group,
+	// showing any other token as plain text.
+	ResolveMentions bool `json:"resolve_mentions"`
+
+	// ReportMentions lists the users the posted message mentions in the response, so the caller
+	// can tell whether anyone was notified.
+	ReportMentions bool `json:"report_mentions"`
+
+	// Raw escapes markdown in Message so it renders literally, e.g. underscores in file names.
+	Raw bool `json:"raw"`
+
+	// Space names the configured oVice space the message belongs to, selecting its bot.
+	Space string `json:"space"`
+
+	// ReplyBroadcast also shows a reply in the channel, like "Also send to channel". It requires RootID.
+	ReplyBroadcast bool `json:"reply_broadcast"`
+
+	// EphemeralToMembers shows the message to every channel member as an ephemeral post
+	// instead of creating a permanent one.
+	EphemeralToMembers bool `json:"ephemeral_to_members"`
+
+	// SuppressPreviews keeps Mattermost from expanding link previews in the posts of the
+	// message, e.g. under a space URL.
+	SuppressPreviews bool `json:"suppress_previews"`
+
+	// Pin pins the created post to the channel. Failing to pin does not undo the post.
+	Pin bool `json:"pin"`
+
+	// Attachments are message attachments rendered under the post, such as a space banner.
+	Attachments []*model.SlackAttachment `json:"attachments"`
+
+	// Severity is "info", "warning" or "critical", posting the message as an attachment colored
+	// green, yellow or red. Empty posts it as plain text.
+	Severity string `json:"severity"`
+
+	// AttachmentURLs lists images to fetch and attach to the post, such as a whiteboard snapshot.
+	AttachmentURLs []string `json:"attachment_urls"`
+
+	// Props are merged into the props of every post created for the message, e.g. to let a
+	// compliance export filter on them. Values must be strings, numbers or booleans.
+	Props map[string]interface{} `json:"props"`
+
+	// QuickReplies are reply suggestions shown as chips under the post.
+	QuickReplies []string `json:"quick_replies"`
+
+	// ExpiresAt is an RFC3339 time after which the posts of the message are deleted, e.g. for
+	// "space open for the next hour". Due posts are deleted by a check that runs every minute.
+	ExpiresAt string `json:"expires_at"`
+
+	// Split posts a message longer than the limit as a thread of chunks instead of rejecting it.
+	Split bool `json:"split"`
+
+	// EventID identifies the message in the delivery receipt sent to ReceiptURL. Empty uses the
+	// Idempotency-Key header.
+	EventID string `json:"event_id"`
+
+	// Origin is the origin marker of the message. One naming this plugin, as sent in its
+	// receipts, has the message ignored when SuppressSelfOriginated is on.
+	Origin string `json:"origin"`
+
+	// signingTeam is the team whose TeamWebhookSecrets entry verified the request, or empty.
+	// The message may only be posted to channels authorizeChannelTeam allows for it.
+	signingTeam string
+}
+
+// webhookResponse is returned to the caller once a message has been processed.
+type webhookResponse struct {
+	// Status is "ok" when the message was posted. It is "partial" when the post was created but
+	// a follow-up step failed, or the message was posted as plain text. It is "accepted" when
+	// MaintenanceMode suppressed the message, and "ignored" when it originated from this plugin.
+	Status string `json:"status"`
+
+	// Suppressed reports that the message was valid but not posted because of MaintenanceMode.
+	Suppressed bool `json:"suppressed,omitempty"`
+
+	// Ignored reports that the message originated from this plugin, so nothing was posted.
+	Ignored bool   `json:"ignored,omitempty"`
+	PostID  string `json:"post_id,omitempty"`
+
+	// PostIDs lists every post created when the message was split, root first.
+	PostIDs []string `json:"post_ids,omitempty"`
+
+	// ChannelDisplayName and TeamName name the channel posted to. TeamName is empty for direct
+	// and group messages.
+	ChannelDisplayName string `json:"channel_display_name,omitempty"`
+	TeamName           string `json:"team_name,omitempty"`
+
+	// Recipients is the number of members an ephemeral message was sent to.
+	Recipients int `json:"recipients,omitempty"`
+
+	// MentionedUserIDs lists the users the message mentions when ReportMentions was requested,
+	// including the members of mentioned groups. It is left out when nobody was mentioned.
+	MentionedUserIDs []string `json:"mentioned_user_ids,omitempty"`
+
+	// Deduplicated reports that an identical message was posted to the channel within the
+	// dedup window, so nothing was posted this time.
+	Deduplicated bool `json:"deduplicated,omitempty"`
+
+	// skipped reports that nothing was posted because the channel has no members to read it.
+	skipped bool
+
+	// BroadcastPostID is the channel copy of a reply created for ReplyBroadcast.
+	BroadcastPostID string `json:"broadcast_post_id,omitempty"`
+
+	// Pinned reports whether a requested pin succeeded, with PinError explaining a failure.
+	Pinned   *bool  `json:"pinned,omitempty"`
+	PinError string `json:"pin_error,omitempty"`
+
+	// PlainTextFallback reports that a post was rejected for its attachments or props and was
+	// posted as plain text instead, because PlainTextFallback is set.
+	PlainTextFallback bool `json:"plain_text_fallback,omitempty"`
+
+	// ExpiryError explains why the expiry of a post could not be recorded, leaving it in place.
+	ExpiryError string `json:"expiry_error,omitempty"`
+}
+
+// handleWebhook decodes a RequestBody and posts it as the bot.
+func (p *Plugin) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	span := p.startRequestSpan("webhook", r.Header)
+	if span != nil {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		w = recorder
+		defer func() {
+			span.setAttribute("status", recorder.status)
+			span.setAttribute("latency_ms", time.Since(span.Start).Milliseconds())
+			span.finish()
+		}()
+	}
+
+	if r.Method != http.MethodPost {
+		p.writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+		p.writeError(w, newHTTPError(http.StatusUnsupportedMediaType, "Content-Type must be application/json"))
+		return
+	}
+
+	data, err := readRequestBody(w, r)
+	if err != nil {
+		p.writeError(w, err)
+		return
+	}
+	authSpan := span.startChild("auth")
+	signingTeam, err := p.verifySignature(r.Header, data, time.Now())
+	authSpan.finish()
+	if err != nil {
+		p.writeError(w, err)
+		return
+	}
+
+	var body RequestBody
+	parseSpan := span.startChild("parse")
+	err = p.decodeWebhookBody(data, &body)
+	parseSpan.finish()
+	if err != nil {
+		p.writeError(w, err)
+		return
+	}
+
+	body.signingTeam = signingTeam
+
+	idempotencyKey := r.Header.Get(idempotencyKeyHeader)
+	if attempt := parseDeliveryAttempt(r.Header.Get(deliveryAttemptHeader)); attempt > 1 {
+		p.API.LogInfo("Processing oVice webhook retry", "attempt", attempt, "idempotency_key", idempotencyKey)
+	}
+
+	if idempotencyKey != "" {
+		cached, cacheErr := p.claimIdempotencyKey(idempotencyKey, hashRequestBody(data))
+		if cacheErr != nil {
+			p.writeError(w, cacheErr)
+			return
+		}
+		if cached != nil {
+			p.API.LogInfo("Returning cached result for already processed webhook", "idempotency_key", idempotencyKey)
+			writeCachedResponse(w, cached)
+			return
+		}
+	}
+
+	if body.Category != "" {
+		p.handleCategoryWebhook(w, r, &body, idempotencyKey, hashRequestBody(data))
+		return
+	}
+
+	response, err := p.processMessage(&body, span)
+	span.setAttribute("channel_id", body.ChannelID)
+	if idempotencyKey != "" && (err != nil || response.Suppressed || response.Ignored || response.skipped) {
+		p.releaseIdempotencyKey(idempotencyKey)
+	}
+	if err != nil {
+		p.logAudit(auditEventPostFailed,
+			"channel_id", body.ChannelID,
+			"source_ip", p.sourceIP(r),
+			"idempotency_key", idempotencyKey,
+			"status", errorStatus(err),
+		)
+		p.reportError("webhook", body.ChannelID, err, time.Now())
+		p.writeError(w, err)
+		return
+	}
+
+	if response.Suppressed {
+		p.API.LogDebug("Suppressed webhook message in maintenance mode", "channel_id", body.ChannelID)
+		writeJSON(w, http.StatusOK, response)
+		return
+	}
+	if response.Ignored {
+		p.API.LogDebug("Ignored webhook message originating from this plugin", "origin", body.Origin)
+		writeJSON(w, http.StatusOK, response)
+		return
+	}
+	if response.skipped {
+		p.API.LogDebug("Skipped webhook message to empty channel", "channel_id", body.ChannelID)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	p.logAudit(auditEventPostCreated,
+		"channel_id", body.ChannelID,
+		"post_id", response.PostID,
+		"source_ip", p.sourceIP(r),
+		"idempotency_key", idempotencyKey,
+	)
+	if response.PostID != "" {
+		p.sendReceipt(receiptEventID(&body, idempotencyKey), response.PostID)
+	}
+
+	if idempotencyKey != "" {
+		if err = p.storeIdempotentResponse(idempotencyKey, &idempotencyRecord{Response: response, BodyHash: hashRequestBody(data)}); err != nil {
+			p.API.LogWarn("Failed to store idempotency record", "idempotency_key", idempotencyKey, "err", err.Error())
+		}
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// validateRequestBody checks the parts of body that do not depend on its channel, returning the
+// color of its severity and when it expires. The message is trimmed first unless
+// KeepMessageWhitespace is set.
+func (p *Plugin) validateRequestBody(body *RequestBody) (string, time.Time, error) {
+	config := p.getConfiguration()
+	hasFiles := len(body.Attachments) > 0 || len(body.AttachmentURLs) > 0
+	if body.Message == "" && !hasFiles {
+		return "", time.Time{}, newValidationError("message is required")
+	}
+	if strings.TrimSpace(body.Message) == "" {
+		if !hasFiles {
+			return "", time.Time{}, newHTTPError(http.StatusBadRequest, "message must not be blank")
+		}
+		body.Message = ""
+	} else if !config.KeepMessageWhitespace {
+		body.Message = trimMessage(body.Message)
+	}
+	if body.ReplyBroadcast && body.RootID == "" {
+		return "", time.Time{}, newValidationError("reply_broadcast requires root_id")
+	}
+	if body.ReplyToLastBotPost && body.RootID != "" {
+		return "", time.Time{}, newValidationError("reply_to_last_bot_post cannot be combined with root_id")
+	}
+	// Batches check this after dedup_attachments, so only the attachments that are posted count.
+	if limit := config.maxAttachmentsPerPost(); len(body.Attachments) > limit {
+		return "", time.Time{}, newHTTPError(http.StatusBadRequest, "%d attachments exceed the limit of %d per post", len(body.Attachments), limit)
+	}
+	if err := validateAttachments(body.Attachments); err != nil {
+		return "", time.Time{}, err
+	}
+	if limit := config.maxFilesPerPost(); len(body.AttachmentURLs) > limit {
+		return "", time.Time{}, newHTTPError(http.StatusBadRequest, "%d attachment_urls exceed the limit of %d files per post", len(body.AttachmentURLs), limit)
+	}
+	if body.DMEphemeral && body.DMUserID == "" {
+		return "", time.Time{}, newValidationError("dm_ephemeral requires dm_user_id")
+	}
+	// The flag of an ephemeral message, which cannot carry what only permanent posts support.
+	ephemeral := ""
+	if body.EphemeralToMembers {
+		ephemeral = "ephemeral_to_members"
+	} else if body.DMEphemeral {
+		ephemeral = "dm_ephemeral"
+	}
+	if ephemeral != "" && len(body.AttachmentURLs) > 0 {
+		return "", time.Time{}, newValidationError("attachment_urls cannot be sent as %s", ephemeral)
+	}
+	if ephemeral != "" && len(body.Attachments) > 0 {
+		return "", time.Time{}, newValidationError("attachments cannot be sent as %s", ephemeral)
+	}
+	color, err := severityColor(body.Severity)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if ephemeral != "" && color != "" {
+		return "", time.Time{}, newValidationError("severity cannot be sent as %s", ephemeral)
+	}
+	if ephemeral != "" && body.ExpiresAt != "" {
+		return "", time.Time{}, newValidationError("expires_at cannot be combined with %s", ephemeral)
+	}
+	var expiresAt time.Time
+	if body.ExpiresAt != "" {
+		if expiresAt, err = parseExpiresAt(body.ExpiresAt, time.Now()); err != nil {
+			return "", time.Time{}, err
+		}
+	}
+	if err = validateQuickReplies(body.QuickReplies); err != nil {
+		return "", time.Time{}, err
+	}
+	if err = config.validateCustomProps(body.Props); err != nil {
+		return "", time.Time{}, err
+	}
+	if body.Space != "" && config.space(body.Space) == nil {
+		return "", time.Time{}, newValidationError("unknown space %q", body.Space)
+	}
+	return color, expiresAt, nil
+}
+
+// processMessage validates body and creates the corresponding post, tracing its phases as
+// children of span.
+func (p *Plugin) processMessage(body *RequestBody, span *traceSpan) (*webhookResponse, error) {
+	// Checked before validation, since the reserved origin prop would otherwise be rejected.
+	if p.isSelfOriginated(body.Origin, body.Props) {
+		return &webhookResponse{Status: "ignored", Ignored: true}, nil
+	}
+	color, expiresAt, err := p.validateRequestBody(body)
+	if err != nil {
+		return nil, err
+	}
+	authorID := p.botUserIDForSpace(body.Space)
+
+	resolveSpan := span.startChild("resolve")
+	channelID, err := p.resolveChannelID(body)
+	resolveSpan.finish()
+	if err != nil {
+		return nil, err
+	}
+	body.ChannelID = channelID
+
+	if err = p.authorizeChannelTeam(channelID, body.signingTeam); err != nil {
+		return nil, err
+	}
+	if !p.API.HasPermissionToChannel(authorID, channelID, model.PermissionCreatePost) {
+		return nil, newHTTPError(http.StatusForbidden, "the oVice bot is not allowed to post in channel %s; add it to the channel first", channelID)
+	}
+
+	if body.ReplyToLastBotPost {
+		if body.RootID, err = p.lastBotPostRootID(channelID, authorID); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.getConfiguration().SkipEmptyChannels {
+		empty, emptyErr := p.isChannelEmpty(channelID, authorID)
+		if emptyErr != nil {
+			return nil, emptyErr
+		}
+		if empty {
+			return &webhookResponse{Status: "ok", skipped: true}, nil
+		}
+	}
+
+	message, err := p.renderMessage(body)
+	if err != nil {
+		return nil, err
+	}
+	if body.ResolveMentions {
+		message = p.resolveMentions(message)
+	}
+
+	// The footer goes on the last chunk, so every chunk leaves room for it.
+	footer := p.getConfiguration().timestampFooter(time.Now())
+	limit := p.getConfiguration().maxMessageRunes() - utf8.RuneCountInString(footer)
+	messages := []string{message}
+	if utf8.RuneCountInString(message) > limit {
+		if !body.Split {
+			return nil, newValidationError("message exceeds %d characters", limit)
+		}
+		messages = splitMessage(message, limit)
+	}
+
+	if p.getConfiguration().MaintenanceMode {
+		return &webhookResponse{Status: "accepted", Suppressed: true}, nil
+	}
+
+	// A message that only carries attachments has no content to tell duplicates apart by.
+	claimed := true
+	if message != "" {
+		if claimed, err = p.claimContent(channelID, message, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	if !claimed {
+		return &webhookResponse{Status: "ok", Deduplicated: true}, nil
+	}
+
+	postSpan := span.startChild("post")
+	defer postSpan.finish()
+
+	if body.EphemeralToMembers {
+		ephemeral := &webhookResponse{Status: "ok"}
+		if ephemeral.Recipients, err = p.sendEphemeralToMembers(authorID, body.ChannelID, body.RootID, messages); err != nil {
+			p.releaseContent(channelID, message)
+			return nil, err
+		}
+		return ephemeral, nil
+	}
+	if body.DMEphemeral {
+		for _, chunk := range messages {
+			p.API.SendEphemeralPost(body.DMUserID, &model.Post{
+				UserId:    authorID,
+				ChannelId: body.ChannelID,
+				RootId:    body.RootID,
+				Message:   chunk,
+			})
+		}
+		return &webhookResponse{Status: "ok", Recipients: 1}, nil
+	}
+
+	var fileIDs []string
+	if len(body.AttachmentURLs) > 0 {
+		if fileIDs, err = p.uploadAttachments(channelID, body.AttachmentURLs); err != nil {
+			p.releaseContent(channelID, message)
+			return nil, err
+		}
+	}
+
+	response := &webhookResponse{Status: "ok"}
+	rootID := body.RootID
+	var firstPost *model.Post
+	for i, chunk := range messages {
+		// The footer goes on the last chunk only, so a split message reads as one.
+		if i == len(messages)-1 && chunk != "" {
+			chunk += footer
+		}
+		post := &model.Post{
+			UserId:    authorID,
+			ChannelId: body.ChannelID,
+			RootId:    rootID,
+			Message:   chunk,
+		}
+		for key, value := range body.Props {
+			post.AddProp(key, value)
+		}
+		if body.SuppressPreviews {
+			post.AddProp(unsafeLinksProp, "true")
+		}
+		if p.getConfiguration().SuppressSelfOriginated {
+			post.AddProp(originProp, p.originMarker())
+		}
+		var attachments []*model.SlackAttachment
+		if color != "" {
+			attachments = append(attachments, severityAttachment(color, chunk))
+			post.Message = ""
+		}
+		if firstPost == nil {
+			post.FileIds = fileIDs
+			attachments = append(attachments, body.Attachments...)
+			if len(body.QuickReplies) > 0 {
+				post.AddProp(quickRepliesProp, body.QuickReplies)
+			}
+		}
+		if len(attachments) > 0 {
+			model.ParseSlackAttachment(post, attachments)
+		}
+		created, appErr := p.createPost(post)
+		if appErr != nil && len(post.GetProps()) > 0 && p.getConfiguration().PlainTextFallback && isAttachmentRejection(appErr) {
+			p.API.LogWarn("Retrying rejected post as plain text", "channel_id", body.ChannelID, "err", appErr.Error())
+			if created, appErr = p.createPost(plainTextFallback(post)); appErr == nil {
+				response.Status = "partial"
+				response.PlainTextFallback = true
+			}
+		}
+		post = created
+		if appErr != nil {
+			if firstPost == nil {
+				p.releaseContent(channelID, message)
+			}
+			return nil, errors.Wrap(appErr, "failed to create post")
+		}
+		p.metrics.recordPost()
+
+		p.addKeywordReactions(post)
+
+		if !expiresAt.IsZero() {
+			if err = p.schedulePostExpiry(post.Id, expiresAt); err != nil {
+				p.API.LogWarn("Failed to schedule post expiry", "post_id", post.Id, "err", err.Error())
+				response.Status = "partial"
+				response.ExpiryError = "failed to schedule post expiry"
+			}
+		}
+
+		if firstPost == nil {
+			firstPost = post
+			response.PostID = post.Id
+		}
+		if rootID == "" {
+			rootID = post.Id
+		}
+		if len(messages) > 1 {
+			response.PostIDs = append(response.PostIDs, post.Id)
+		}
+	}
+
+	// The names only help callers log the result, so failing to look them up does not fail the
+	// request.
+	if info, infoErr := p.getChannelInfo(body.ChannelID, time.Now()); infoErr != nil {
+		p.API.LogWarn("Failed to look up channel names", "channel_id", body.ChannelID, "err", infoErr.Error())
+	} else {
+		response.ChannelDisplayName = info.DisplayName
+		response.TeamName = info.TeamName
+	}
+
+	if body.ReplyBroadcast {
+		response.BroadcastPostID, err = p.broadcastReply(authorID, body.ChannelID, body.RootID, messages[0], body.Props)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if body.Pin {
+		pinned := true
+		if err = p.pinPost(firstPost); err != nil {
+			p.API.LogWarn("Failed to pin post", "post_id", firstPost.Id, "err", err.Error())
+			pinned = false
+			response.Status = "partial"
+			response.PinError = "failed to pin post"
+		}
+		response.Pinned = &pinned
+	}
+
+	if body.ReportMentions {
+		response.MentionedUserIDs = p.mentionedUserIDs(message)
+	}
+
+	return response, nil
+}
+
+// validateQuickReplies checks the number and length of the quick replies of a message.
+func validateQuickReplies(replies []string) error {
+	if len(replies) > maxQuickReplies {
+		return newValidationError("at most %d quick_replies are allowed", maxQuickReplies)
+	}
+	for i, reply := range replies {
+		if strings.TrimSpace(reply) == "" {
+			return newValidationError("quick_replies[%d] is empty", i)
+		}
+		if utf8.RuneCountInString(reply) > maxQuickReplyRunes {
+			return newValidationError("quick_replies[%d] exceeds %d characters", i, maxQuickReplyRunes)
+		}
+	}
+	return nil
+}
+
+// lastBotPostRootID returns the thread root of the most recent post of authorID among the latest
+// posts of channelID, or an empty string if there is none.
+func (p *Plugin) lastBotPostRootID(channelID, authorID string) (string, error) {
+	posts, appErr := p.API.GetPostsForChannel(channelID, 0, lastBotPostSearchLimit)
+	if appErr != nil {
+		return "", errors.Wrap(appErr, "failed to get channel posts")
+	}
+	for _, postID := range posts.Order {
+		post := posts.Posts[postID]
+		if post == nil || post.UserId != authorID {
+			continue
+		}
+		if post.RootId != "" {
+			return post.RootId, nil
+		}
+		return post.Id, nil
+	}
+	return "", nil
+}
+
+// isChannelEmpty reports whether channelID has no members other than authorID, the bot about to
+// post there.
+func (p *Plugin) isChannelEmpty(channelID, authorID string) (bool, error) {
+	stats, appErr := p.API.GetChannelStats(channelID)
+	if appErr != nil {
+		return false, errors.Wrap(appErr, "failed to get channel stats")
+	}
+	switch stats.MemberCount {
+	case 0:
+		return true, nil
+	case 1:
+		// The only member may be the bot itself, which must join private channels to post.
+		_, appErr = p.API.GetChannelMember(channelID, authorID)
+		return appErr == nil, nil
+	default:
+		return false, nil
+	}
+}
+
+// pinPost pins post to its channel.
+func (p *Plugin) pinPost(post *model.Post) error {
+	pinned := post.Clone()
+	pinned.IsPinned = true
+	if _, appErr := p.API.UpdatePost(pinned); appErr != nil {
+		return errors.Wrap(appErr, "failed to update post")
+	}
+	return nil
+}
+
+// broadcastReply shows a thread reply in the channel as well. Mattermost has no native "also
+// send to channel" flag for plugin posts, so the reply is repeated as a root post that links
+// back to the thread it belongs to.
+func (p *Plugin) broadcastReply(authorID, channelID, rootID, message string, props map[string]interface{}) (string, error) {
+	post := &model.Post{
+		UserId:    authorID,
+		ChannelId: channelID,
+		Message:   message,
+	}
+	for key, value := range props {
+		post.AddProp(key, value)
+	}
+	post.AddProp(broadcastRootIDProp, rootID)
+
+	created, appErr := p.createIntegrationPost(post)
+	if appErr != nil {
+		return "", errors.Wrap(appErr, "failed to broadcast reply to channel")
+	}
+	return created.Id, nil
+}
+
+// resolveChannelID returns the ID of the channel body targets.
+func (p *Plugin) resolveChannelID(body *RequestBody) (string, error) {
+	targets := 0
+	for _, target := range []string{body.ChannelID, body.ChannelName, body.ChannelURL, body.DMUserID, body.RoomID} {
+		if target != "" {
+			targets++
+		}
+	}
+
+	switch {
+	case body.Category != "":
+		return "", newValidationError("category is only supported by the webhook endpoint")
+	case targets > 1:
+		return "", newValidationError("channel_id, channel_name, channel_url, dm_user_id and room_id are mutually exclusive")
+	case body.ChannelURL != "":
+		return p.resolveChannelURL(body.ChannelURL)
+	case body.DMUserID != "":
+		return p.resolveDirectChannelID(p.botUserIDForSpace(body.Space), body.DMUserID)
+	case body.ChannelID != "":
+		return body.ChannelID, nil
+	case body.RoomID != "":
+		return p.resolveRoomChannelID(body.Space, body.RoomID)
+	case body.ChannelName != "":
+		if body.TeamName == "" {
+			return "", newValidationError("team_name is required with channel_name")
+		}
+		channel, appErr := p.API.GetChannelByNameForTeamName(body.TeamName, body.ChannelName, false)
+		if appErr != nil {
+			if appErr.StatusCode == http.StatusNotFound {
+				return "", newHTTPError(http.StatusNotFound, "channel %q not found in team %q", body.ChannelName, body.TeamName)
+			}
+			return "", errors.Wrap(appErr, "failed to get channel by name")
+		}
+		return channel.Id, nil
+	default:
+		return p.resolveDefaultChannelID()
+	}
+}
+
+// resolveRoomChannelID returns the channel roomID is mapped to in Spaces, in the named space or,
+// when spaceName is empty, in any space.
+func (p *Plugin) resolveRoomChannelID(spaceName, roomID string) (string, error) {
+	config := p.getConfiguration()
+	for _, space := range config.spaces {
+		if spaceName != "" && !strings.EqualFold(space.Name, spaceName) {
+			continue
+		}
+		if channelID := space.Rooms[roomID]; channelID != "" {
+			return channelID, nil
+		}
+	}
+	return "", newValidationError("room %q is not mapped to a channel", roomID)
+}
+
+// resolveDirectChannelID returns the ID of the direct message channel between authorID and
+// userID, creating it if needed. The user must exist.
+func (p *Plugin) resolveDirectChannelID(authorID, userID string) (string, error) {
+	if !model.IsValidId(userID) {
+		return "", newValidationError("invalid dm_user_id %q", userID)
+	}
+	if _, appErr := p.API.GetUser(userID); appErr != nil {
+		if appErr.StatusCode == http.StatusNotFound {
+			return "", newHTTPError(http.StatusNotFound, "user %q not found", userID)
+		}
+		return "", errors.Wrap(appErr, "failed to get user")
+	}
+
+	channel, appErr := p.API.GetDirectChannel(authorID, userID)
+	if appErr != nil {
+		return "", errors.Wrap(appErr, "failed to get direct message channel")
+	}
+	return channel.Id, nil
+}
+
+// resolveChannelURL returns the ID of the channel a Mattermost channel or post permalink URL
+// points to. The URL may include the path of a server hosted under a subpath.
+func (p *Plugin) resolveChannelURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", newValidationError("channel_url is not an http(s) URL")
+	}
+
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(segments) < 3 {
+		return "", newValidationError("channel_url must look like /team/channels/name or /team/pl/post_id")
+	}
+	teamName, kind, name := segments[len(segments)-3], segments[len(segments)-2], segments[len(segments)-1]
+
+	switch kind {
+	case "channels":
+		channel, appErr := p.API.GetChannelByNameForTeamName(teamName, name, false)
+		if appErr != nil {
+			if appErr.StatusCode == http.StatusNotFound {
+				return "", newHTTPError(http.StatusNotFound, "channel %q not found in team %q", name, teamName)
+			}
+			return "", errors.Wrap(appErr, "failed to get channel by name")
+		}
+		return channel.Id, nil
+	case "pl":
+		if !model.IsValidId(name) {
+			return "", newValidationError("channel_url links to an invalid post ID")
+		}
+		post, appErr := p.API.GetPost(name)
+		if appErr != nil {
+			if appErr.StatusCode == http.StatusNotFound {
+				return "", newHTTPError(http.StatusNotFound, "post %q not found", name)
+			}
+			return "", errors.Wrap(appErr, "failed to get post")
+		}
+		return post.ChannelId, nil
+	default:
+		return "", newValidationError("channel_url must look like /team/channels/name or /team/pl/post_id")
+	}
+}
+
+// resolveDefaultChannelID returns the channel used when a request names none: DefaultChannelID,
+// or with TownSquareFallback the Town Square of the only team on the server.
+func (p *Plugin) resolveDefaultChannelID() (string, error) {
+	config := p.getConfiguration()
+	if config.DefaultChannelID != "" {
+		return config.DefaultChannelID, nil
+	}
+	if !config.TownSquareFallback {
+		return "", newValidationError("channel_id or channel_name is required")
+	}
+
+	teams, appErr := p.API.GetTeams()
+	if appErr != nil {
+		return "", errors.Wrap(appErr, "failed to get teams")
+	}
+	if len(teams) != 1 {
+		return "", newValidationError("channel_id or channel_name is required when the server has more than one team")
+	}
+
+	channel, appErr := p.API.GetChannelByName(teams[0].Id, model.DefaultChannelName, false)
+	if appErr != nil {
+		return "", errors.Wrap(appErr, "failed to get the default channel")
+	}
+	return channel.Id, nil
+}
+
+// trimMessage removes the blank lines around message and the whitespace ending it. The
+// indentation of the first line is kept, since it may start a code block, and so is everything
+// between the first and last non-blank characters.
+func trimMessage(message string) string {
+	message = strings.TrimRightFunc(message, unicode.IsSpace)
+	start := strings.IndexFunc(message, func(r rune) bool { return !unicode.IsSpace(r) })
+	if start < 0 {
+		return ""
+	}
+	if lineStart := strings.LastIndex(message[:start], "\n"); lineStart >= 0 {
+		return message[lineStart+1:]
+	}
+	return message
+}
+
+// splitMessage chunks message into pieces of at most limit runes, breaking on line boundaries.
+// A single line longer than limit is hard-split. A blank line that does not fit before a
+// boundary starts the next chunk, so joining the chunks with "\n" restores the paragraph breaks.
+func splitMessage(message string, limit int) []string {
+	var chunks []string
+	var current []rune
+	// started is set once current holds a line, even an empty one.
+	started := false
+
+	for _, line := range strings.Split(message, "\n") {
+		runes := []rune(line)
+
+		if started && len(current)+1+len(runes) <= limit {
+			current = append(append(current, '\n'), runes...)
+			continue
+		}
+		if len(current) > 0 {
+			chunks = append(chunks, string(current))
+		}
+
+		for len(runes) > limit {
+			chunks = append(chunks, string(runes[:limit]))
+			runes = runes[limit:]
+		}
+		current = runes
+		started = true
+	}
+	if len(current) > 0 {
+		chunks = append(chunks, string(current))
+	}
+
+	return chunks
+}
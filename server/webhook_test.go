@@ -0,0 +1,932 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// mockCreatePost records every post created through api, assigning sequential IDs.
+func mockCreatePost(api *plugintest.API) *[]*model.Post {
+	var posts []*model.Post
+	api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(func(post *model.Post) *model.Post {
+		created := post.Clone()
+		created.Id = "post" + string(rune('0'+len(posts)))
+		posts = append(posts, created)
+		return created
+	}, nil)
+	return &posts
+}
+
+func TestSplitMessage(t *testing.T) {
+	t.Run("clean multi-line split", func(t *testing.T) {
+		assert.Equal(t, []string{"aaa\nbb", "cccc\nd"}, splitMessage("aaa\nbb\ncccc\nd", 6))
+	})
+
+	t.Run("single oversized line is hard-split", func(t *testing.T) {
+		assert.Equal(t, []string{"ab", "abcde", "fghij", "k"}, splitMessage("ab\nabcdefghijk", 5))
+	})
+
+	t.Run("multibyte runes", func(t *testing.T) {
+		assert.Equal(t, []string{"あいう", "えお"}, splitMessage("あいうえお", 3))
+	})
+
+	t.Run("paragraph breaks at the limit are kept", func(t *testing.T) {
+		for _, message := range []string{
+			"aaa\n\nbb",
+			"aaa\n\nbb\n\ncc",
+			"aaa\nbbb\n\nc\n",
+			"\nbb\naaa",
+		} {
+			chunks := splitMessage(message, 3)
+			for _, chunk := range chunks {
+				assert.LessOrEqual(t, utf8.RuneCountInString(chunk), 3)
+			}
+			assert.Equal(t, message, strings.Join(chunks, "\n"), "%q", message)
+		}
+	})
+}
+
+func TestProcessMessageSplit(t *testing.T) {
+	config := &configuration{MaxMessageLength: 6}
+
+	t.Run("split posts a thread in order", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"aaa\nbb\ncccc","split":true}`)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		require.Len(t, *posts, 2)
+		assert.Equal(t, "aaa\nbb", (*posts)[0].Message)
+		assert.Empty(t, (*posts)[0].RootId)
+		assert.Equal(t, "cccc", (*posts)[1].Message)
+		assert.Equal(t, (*posts)[0].Id, (*posts)[1].RootId)
+
+		var response webhookResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, (*posts)[0].Id, response.PostID)
+		assert.Equal(t, []string{(*posts)[0].Id, (*posts)[1].Id}, response.PostIDs)
+	})
+
+	t.Run("oversized single line is hard-split into replies", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"`+strings.Repeat("x", 14)+`","split":true}`)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		require.Len(t, *posts, 3)
+		assert.Equal(t, []int{6, 6, 2}, []int{len((*posts)[0].Message), len((*posts)[1].Message), len((*posts)[2].Message)})
+		assert.Equal(t, (*posts)[0].Id, (*posts)[2].RootId)
+	})
+
+	t.Run("under the limit posts once", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"short","split":true}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.NotContains(t, w.Body.String(), "post_ids")
+	})
+
+	t.Run("over the limit without split is rejected", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, config)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"too long message"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	})
+}
+
+func TestProcessMessageReplyBroadcast(t *testing.T) {
+	t.Run("broadcast reply is also posted to the channel", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi","root_id":"root","reply_broadcast":true}`)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		require.Len(t, *posts, 2)
+		assert.Equal(t, "root", (*posts)[0].RootId)
+		assert.Empty(t, (*posts)[1].RootId)
+		assert.Equal(t, "hi", (*posts)[1].Message)
+		assert.Equal(t, "root", (*posts)[1].GetProp(broadcastRootIDProp))
+		assert.Contains(t, w.Body.String(), `"broadcast_post_id":"`+(*posts)[1].Id+`"`)
+	})
+
+	t.Run("plain reply stays in the thread", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi","root_id":"root"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "root", (*posts)[0].RootId)
+		assert.NotContains(t, w.Body.String(), "broadcast_post_id")
+	})
+
+	t.Run("broadcast without root is rejected", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, nil)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi","reply_broadcast":true}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), "reply_broadcast requires root_id")
+	})
+}
+
+func TestWebhookValidationStatus(t *testing.T) {
+	p, api, _ := newTestPlugin(t, &configuration{MaxMessageLength: 5})
+	api.On("GetChannelByNameForTeamName", "team", "missing", false).Return(nil, &model.AppError{StatusCode: http.StatusNotFound})
+
+	for name, test := range map[string]struct {
+		body   string
+		status int
+	}{
+		"malformed JSON":                   {`{"channel_id":`, http.StatusBadRequest},
+		"wrong JSON type":                  {`{"channel_id":1,"message":"hi"}`, http.StatusBadRequest},
+		"both channel_id and channel_name": {`{"channel_id":"c","channel_name":"town","team_name":"team","message":"hi"}`, http.StatusUnprocessableEntity},
+		"no channel":                       {`{"message":"hi"}`, http.StatusUnprocessableEntity},
+		"channel_name without team_name":   {`{"channel_name":"town","message":"hi"}`, http.StatusUnprocessableEntity},
+		"unknown channel_name":             {`{"channel_name":"missing","team_name":"team","message":"hi"}`, http.StatusNotFound},
+		"empty message":                    {`{"channel_id":"c","message":""}`, http.StatusUnprocessableEntity},
+		"message too long":                 {`{"channel_id":"c","message":"too long"}`, http.StatusUnprocessableEntity},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := doRequest(p, http.MethodPost, "/webhook", test.body)
+			assert.Equal(t, test.status, w.Code)
+		})
+	}
+}
+
+func TestWebhookMethodAndMediaType(t *testing.T) {
+	p, _, _ := newTestPlugin(t, nil)
+
+	for _, path := range []string{"/webhook", "/events"} {
+		t.Run("GET "+path, func(t *testing.T) {
+			w := doRequest(p, http.MethodGet, path, "")
+			assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+			assert.Equal(t, http.MethodPost, w.Header().Get("Allow"))
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			assert.JSONEq(t, `{"error":"only POST is supported on this endpoint"}`, w.Body.String())
+		})
+	}
+
+	t.Run("non-JSON content type", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader("message=hi"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, r)
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{"error":"Content-Type must be application/json"}`, w.Body.String())
+	})
+}
+
+func TestProcessMessageChannelName(t *testing.T) {
+	p, api, _ := newTestPlugin(t, nil)
+	api.On("GetChannelByNameForTeamName", "team", "town", false).Return(&model.Channel{Id: "townid"}, nil)
+	posts := mockCreatePost(api)
+
+	w := doRequest(p, http.MethodPost, "/webhook", `{"channel_name":"town","team_name":"team","message":"hi"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, *posts, 1)
+	assert.Equal(t, "townid", (*posts)[0].ChannelId)
+}
+
+func TestProcessMessageDefaultChannel(t *testing.T) {
+	t.Run("default channel", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DefaultChannelID: "default"})
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"message":"hi"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "default", (*posts)[0].ChannelId)
+	})
+
+	t.Run("single team falls back to Town Square", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{TownSquareFallback: true})
+		api.On("GetTeams").Return([]*model.Team{{Id: "team"}}, nil)
+		api.On("GetChannelByName", "team", model.DefaultChannelName, false).Return(&model.Channel{Id: "townsquare"}, nil)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"message":"hi"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "townsquare", (*posts)[0].ChannelId)
+	})
+
+	t.Run("flag off requires a channel", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"message":"hi"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		api.AssertNotCalled(t, "GetTeams")
+	})
+
+	t.Run("multiple teams require a channel", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{TownSquareFallback: true})
+		api.On("GetTeams").Return([]*model.Team{{Id: "team1"}, {Id: "team2"}}, nil)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"message":"hi"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		api.AssertNotCalled(t, "GetChannelByName", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestProcessMessagePin(t *testing.T) {
+	pinnedPost := mock.MatchedBy(func(post *model.Post) bool { return post.Id == "post0" && post.IsPinned })
+
+	t.Run("pinned post", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockCreatePost(api)
+		api.On("UpdatePost", pinnedPost).Return(&model.Post{Id: "post0", IsPinned: true}, nil).Once()
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"code: 1234","pin":true}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"status":"ok","post_id":"post0","pinned":true}`, w.Body.String())
+	})
+
+	t.Run("pin failure reports partial success", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockCreatePost(api)
+		api.On("UpdatePost", pinnedPost).Return(nil, &model.AppError{Message: "boom"}).Once()
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"code: 1234","pin":true}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"status":"partial","post_id":"post0","pinned":false,"pin_error":"failed to pin post"}`, w.Body.String())
+	})
+
+	t.Run("unpinned by default", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"code: 1234"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"status":"ok","post_id":"post0"}`, w.Body.String())
+		api.AssertNotCalled(t, "UpdatePost", mock.Anything)
+	})
+}
+
+func TestProcessMessagePermission(t *testing.T) {
+	t.Run("permitted", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, *posts, 1)
+		api.AssertCalled(t, "HasPermissionToChannel", testBotUserID, "channel", model.PermissionCreatePost)
+	})
+
+	t.Run("denied", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		unmock(api, "HasPermissionToChannel")
+		api.On("HasPermissionToChannel", testBotUserID, "channel", model.PermissionCreatePost).Return(false)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi"}`)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "not allowed to post in channel channel")
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+}
+
+func TestProcessMessageChannelInfo(t *testing.T) {
+	t.Run("channel and team names", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		unmock(api, "GetChannel")
+		api.On("GetChannel", "channel").Return(&model.Channel{Id: "channel", DisplayName: "Town Square", TeamId: "teamid"}, nil).Once()
+		api.On("GetTeam", "teamid").Return(&model.Team{Id: "teamid", Name: "eng"}, nil).Once()
+		mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"status":"ok","post_id":"post0","channel_display_name":"Town Square","team_name":"eng"}`, w.Body.String())
+
+		// The second request reuses the cached names.
+		w = doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"again"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"status":"ok","post_id":"post1","channel_display_name":"Town Square","team_name":"eng"}`, w.Body.String())
+	})
+
+	t.Run("direct message has no team", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		unmock(api, "GetChannel")
+		api.On("GetChannel", "dm").Return(&model.Channel{Id: "dm", Type: model.ChannelTypeDirect, DisplayName: "alice, bob"}, nil)
+		mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"dm","message":"hi"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"status":"ok","post_id":"post0","channel_display_name":"alice, bob"}`, w.Body.String())
+		api.AssertNotCalled(t, "GetTeam", mock.Anything)
+	})
+
+	t.Run("lookup failure still succeeds", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		unmock(api, "GetChannel")
+		api.On("GetChannel", "channel").Return(nil, &model.AppError{Message: "boom"})
+		mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"status":"ok","post_id":"post0"}`, w.Body.String())
+	})
+
+	t.Run("cache expires", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		unmock(api, "GetChannel")
+		api.On("GetChannel", "channel").Return(&model.Channel{Id: "channel", DisplayName: "Old"}, nil).Once()
+		api.On("GetChannel", "channel").Return(&model.Channel{Id: "channel", DisplayName: "New"}, nil).Once()
+
+		now := time.Now()
+		info, err := p.getChannelInfo("channel", now)
+		require.NoError(t, err)
+		assert.Equal(t, "Old", info.DisplayName)
+
+		info, err = p.getChannelInfo("channel", now.Add(channelInfoTTL))
+		require.NoError(t, err)
+		assert.Equal(t, "New", info.DisplayName)
+	})
+}
+
+func TestProcessMessageSkipEmptyChannels(t *testing.T) {
+	config := &configuration{SkipEmptyChannels: true}
+	stats := func(api *plugintest.API, members int64) {
+		api.On("GetChannelStats", "channel").Return(&model.ChannelStats{ChannelId: "channel", MemberCount: members}, nil)
+	}
+
+	t.Run("channel with members", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		stats(api, 3)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, *posts, 1)
+	})
+
+	t.Run("empty channel", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		stats(api, 0)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi"}`)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Empty(t, w.Body.String())
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("bot is the only member", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		stats(api, 1)
+		api.On("GetChannelMember", "channel", testBotUserID).Return(&model.ChannelMember{ChannelId: "channel", UserId: testBotUserID}, nil)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi"}`)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("single member who is not the bot", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+		stats(api, 1)
+		api.On("GetChannelMember", "channel", testBotUserID).Return(nil, &model.AppError{Message: "not found", StatusCode: http.StatusNotFound})
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, *posts, 1)
+	})
+
+	t.Run("flag off", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, *posts, 1)
+		api.AssertNotCalled(t, "GetChannelStats", mock.Anything)
+	})
+}
+
+func TestProcessMessageQuickReplies(t *testing.T) {
+	t.Run("quick replies are set on the post", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"Lunch?","quick_replies":["Yes","No"]}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, []string{"Yes", "No"}, (*posts)[0].GetProp(quickRepliesProp))
+	})
+
+	t.Run("too many quick replies", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"Pick","quick_replies":["1","2","3","4","5","6","7","8","9","10","11"]}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), "at most 10 quick_replies")
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("over-length quick reply", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, nil)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"Pick","quick_replies":["`+strings.Repeat("a", maxQuickReplyRunes+1)+`"]}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), "quick_replies[0] exceeds")
+	})
+
+	t.Run("absent by default", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Nil(t, (*posts)[0].GetProp(quickRepliesProp))
+	})
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	config := &configuration{MaintenanceMode: true, DefaultChannelID: "town"}
+
+	t.Run("webhook is suppressed", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"status":"accepted","suppressed":true}`, w.Body.String())
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("webhook is still validated", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, config)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), "message is required")
+	})
+
+	t.Run("events are suppressed", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+
+		w := doRequest(p, http.MethodPost, "/events", `{"event":"enter","user_email":"alice@example.com","space_name":"HQ"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"status":"accepted","suppressed":true}`, w.Body.String())
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+
+		w = doRequest(p, http.MethodPost, "/events", `{"event":"teleport"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	})
+
+	t.Run("events are still validated", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, config)
+
+		w := doRequest(p, http.MethodPost, "/events", `{"event":"enter","space_name":"HQ"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), "user_email or user_name is required")
+
+		w = doRequest(p, http.MethodPost, "/events", `{"event":"recording_ready","download_url":"http://example.com/rec.mp4"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), "download_url must be an https URL")
+
+		w = doRequest(p, http.MethodPost, "/events", `{"event":"enter","user_email":7}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("every event type can be validated", func(t *testing.T) {
+		for event := range eventHandlers {
+			assert.Contains(t, eventPayloads, event)
+		}
+	})
+
+	t.Run("off posts normally", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, *posts, 1)
+		assert.NotContains(t, w.Body.String(), "suppressed")
+	})
+}
+
+func TestProcessMessageChannelURL(t *testing.T) {
+	postID := model.NewId()
+
+	t.Run("channel URL", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		api.On("GetChannelByNameForTeamName", "eng", "standup", false).Return(&model.Channel{Id: "standupid"}, nil)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_url":"https://chat.example.com/eng/channels/standup","message":"hi"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "standupid", (*posts)[0].ChannelId)
+	})
+
+	t.Run("post permalink under a subpath", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		api.On("GetPost", postID).Return(&model.Post{Id: postID, ChannelId: "threadchannel"}, nil)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_url":"https://example.com/chat/eng/pl/`+postID+`","message":"hi"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "threadchannel", (*posts)[0].ChannelId)
+	})
+
+	t.Run("malformed URL", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+
+		for _, channelURL := range []string{
+			"not a url",
+			"https://chat.example.com/eng",
+			"https://chat.example.com/eng/messages/@alice",
+			"https://chat.example.com/eng/pl/short",
+		} {
+			w := doRequest(p, http.MethodPost, "/webhook", `{"channel_url":"`+channelURL+`","message":"hi"}`)
+			assert.Equal(t, http.StatusUnprocessableEntity, w.Code, channelURL)
+		}
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("exclusive with channel_id", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, nil)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","channel_url":"https://chat.example.com/eng/channels/standup","message":"hi"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), "mutually exclusive")
+	})
+}
+
+func TestProcessMessageProps(t *testing.T) {
+	t.Run("custom props are merged", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi","props":{"compliance_tag":"ovice","retain":true,"priority":2}}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "ovice", (*posts)[0].GetProp("compliance_tag"))
+		assert.Equal(t, true, (*posts)[0].GetProp("retain"))
+		assert.Equal(t, float64(2), (*posts)[0].GetProp("priority"))
+	})
+
+	t.Run("protected props are rejected", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+
+		for _, key := range []string{"from_webhook", "attachments", "override_username", quickRepliesProp} {
+			w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi","props":{"`+key+`":"x"}}`)
+			assert.Equal(t, http.StatusUnprocessableEntity, w.Code, key)
+			assert.Contains(t, w.Body.String(), "props."+key+" is reserved", key)
+		}
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("protected props can be allowed, with any override username by default", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{AllowedProtectedProps: "override_username"})
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi","props":{"override_username":"oVice HQ"}}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "oVice HQ", (*posts)[0].GetProp("override_username"))
+	})
+
+	t.Run("allowed override username", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{AllowedProtectedProps: "override_username", AllowedOverrideUsernames: "oVice HQ, oVice Lab"})
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi","props":{"override_username":"ovice lab"}}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "ovice lab", (*posts)[0].GetProp("override_username"))
+	})
+
+	t.Run("disallowed override username", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{AllowedProtectedProps: "override_username", AllowedOverrideUsernames: "oVice HQ"})
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi","props":{"override_username":"Admin"}}`)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), `props.override_username \"Admin\" is not an allowed override username`)
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("only scalar values are accepted", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, nil)
+
+		for _, value := range []string{`{"a":1}`, `[1,2]`, `null`} {
+			w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi","props":{"tag":`+value+`}}`)
+			assert.Equal(t, http.StatusUnprocessableEntity, w.Code, value)
+			assert.Contains(t, w.Body.String(), "props.tag must be a string, number or boolean", value)
+		}
+	})
+}
+
+func TestProcessMessageSuppressPreviews(t *testing.T) {
+	t.Run("previews are suppressed when requested", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"Join https://hq.ovice.in","suppress_previews":true}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "true", (*posts)[0].GetProp(unsafeLinksProp))
+	})
+
+	t.Run("previews are left alone by default", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"Join https://hq.ovice.in"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Nil(t, (*posts)[0].GetProp(unsafeLinksProp))
+	})
+
+	t.Run("the prop cannot be set directly", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, nil)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi","props":{"unsafe_links":"true"}}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	})
+}
+
+func TestProcessMessageReplyToLastBotPost(t *testing.T) {
+	postList := func(posts ...*model.Post) *model.PostList {
+		list := model.NewPostList()
+		for _, post := range posts {
+			list.AddPost(post)
+			list.AddOrder(post.Id)
+		}
+		return list
+	}
+
+	t.Run("replies to the last bot post", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+		api.On("GetPostsForChannel", "channel", 0, lastBotPostSearchLimit).Return(postList(
+			&model.Post{Id: "latest", UserId: testBotUserID},
+			&model.Post{Id: "older", UserId: testBotUserID},
+		), nil)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"now 3 people","reply_to_last_bot_post":true}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "latest", (*posts)[0].RootId)
+	})
+
+	t.Run("joins the thread of a bot reply", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+		api.On("GetPostsForChannel", "channel", 0, lastBotPostSearchLimit).Return(postList(
+			&model.Post{Id: "reply", UserId: testBotUserID, RootId: "root"},
+		), nil)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"now 3 people","reply_to_last_bot_post":true}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "root", (*posts)[0].RootId)
+	})
+
+	t.Run("ignores posts of other users", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+		api.On("GetPostsForChannel", "channel", 0, lastBotPostSearchLimit).Return(postList(
+			&model.Post{Id: "alice", UserId: "alice"},
+			&model.Post{Id: "bot", UserId: testBotUserID},
+		), nil)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"now 3 people","reply_to_last_bot_post":true}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "bot", (*posts)[0].RootId)
+	})
+
+	t.Run("starts a thread without a prior bot post", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+		api.On("GetPostsForChannel", "channel", 0, lastBotPostSearchLimit).Return(postList(
+			&model.Post{Id: "alice", UserId: "alice"},
+		), nil)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"still 5 people here","reply_to_last_bot_post":true}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Empty(t, (*posts)[0].RootId)
+	})
+
+	t.Run("conflicts with root_id", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, nil)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","root_id":"root","message":"hi","reply_to_last_bot_post":true}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	})
+}
+
+func TestProcessMessageDirectMessage(t *testing.T) {
+	userID := model.NewId()
+	mockDirectory := func(api *plugintest.API) {
+		api.On("GetUser", userID).Return(&model.User{Id: userID, Username: "alice"}, nil)
+		api.On("GetDirectChannel", testBotUserID, userID).Return(&model.Channel{Id: "dm", Type: model.ChannelTypeDirect}, nil)
+	}
+
+	t.Run("persistent direct message", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockDirectory(api)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"dm_user_id":"`+userID+`","message":"Your meeting room is ready"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "dm", (*posts)[0].ChannelId)
+		assert.Equal(t, testBotUserID, (*posts)[0].UserId)
+		assert.Equal(t, "Your meeting room is ready", (*posts)[0].Message)
+	})
+
+	t.Run("ephemeral direct message", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		mockDirectory(api)
+		var sent []*model.Post
+		api.On("SendEphemeralPost", userID, mock.AnythingOfType("*model.Post")).Run(func(args mock.Arguments) {
+			sent = append(sent, args.Get(1).(*model.Post))
+		}).Return(&model.Post{})
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"dm_user_id":"`+userID+`","message":"Knock knock","dm_ephemeral":true}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"status":"ok","recipients":1}`, w.Body.String())
+		require.Len(t, sent, 1)
+		assert.Equal(t, "dm", sent[0].ChannelId)
+		assert.Equal(t, "Knock knock", sent[0].Message)
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("unknown user is rejected in both modes", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		api.On("GetUser", userID).Return(nil, &model.AppError{Message: "not found", StatusCode: http.StatusNotFound})
+
+		for _, flags := range []string{"", `,"dm_ephemeral":true`} {
+			w := doRequest(p, http.MethodPost, "/webhook", `{"dm_user_id":"`+userID+`","message":"hi"`+flags+`}`)
+			assert.Equal(t, http.StatusNotFound, w.Code, flags)
+			assert.Contains(t, w.Body.String(), "not found", flags)
+		}
+		api.AssertNotCalled(t, "GetDirectChannel", mock.Anything, mock.Anything)
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+		api.AssertNotCalled(t, "SendEphemeralPost", mock.Anything, mock.Anything)
+	})
+
+	t.Run("invalid combinations are rejected", func(t *testing.T) {
+		p, _, _ := newTestPlugin(t, nil)
+
+		for body, message := range map[string]string{
+			`{"channel_id":"channel","message":"hi","dm_ephemeral":true}`:                          "dm_ephemeral requires dm_user_id",
+			`{"dm_user_id":"` + userID + `","channel_id":"channel","message":"hi"}`:                "mutually exclusive",
+			`{"dm_user_id":"` + userID + `","message":"hi","dm_ephemeral":true,"severity":"info"}`: "severity cannot be sent as dm_ephemeral",
+			`{"dm_user_id":"not-an-id","message":"hi"}`:                                            "invalid dm_user_id",
+		} {
+			w := doRequest(p, http.MethodPost, "/webhook", body)
+			assert.Equal(t, http.StatusUnprocessableEntity, w.Code, body)
+			assert.Contains(t, w.Body.String(), message, body)
+		}
+	})
+}
+
+func TestProcessMessageWhitespace(t *testing.T) {
+	t.Run("whitespace-only message is rejected", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":" \n\t "}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "message must not be blank")
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("message is trimmed but keeps its formatting", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"\n\n    code\n\n- item  \n  - nested\n \n"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "    code\n\n- item  \n  - nested", (*posts)[0].Message)
+	})
+
+	t.Run("whitespace is kept when configured", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{KeepMessageWhitespace: true})
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"\n hi \n"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "\n hi \n", (*posts)[0].Message)
+
+		w = doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"  "}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("blank message with attachments is accepted", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{DedupWindowSeconds: 60})
+		posts := mockCreatePost(api)
+
+		for _, title := range []string{"HQ", "Annex"} {
+			w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"  ","attachments":[{"title":"`+title+`"}]}`)
+			require.Equal(t, http.StatusOK, w.Code)
+		}
+		require.Len(t, *posts, 2, "attachment-only posts are not deduplicated by their empty message")
+		assert.Empty(t, (*posts)[0].Message)
+		require.Len(t, (*posts)[0].Attachments(), 1)
+		assert.Equal(t, "HQ", (*posts)[0].Attachments()[0].Title)
+	})
+}
+
+func TestTrimMessage(t *testing.T) {
+	assert.Equal(t, "hi", trimMessage("hi\t\n"))
+	assert.Equal(t, " hi", trimMessage("\n\n hi \n"))
+	assert.Equal(t, "a\n\n b", trimMessage("a\n\n b\n\n"))
+	assert.Equal(t, "", trimMessage(" \n\t"))
+}
+
+func TestProcessMessageTimestampFooter(t *testing.T) {
+	t.Run("footer is rendered in the configured time zone", func(t *testing.T) {
+		config := &configuration{TimestampFooterTimezone: "Asia/Tokyo"}
+		require.NoError(t, config.process())
+
+		now := time.Date(2024, 4, 1, 5, 0, 0, 0, time.UTC)
+		assert.Equal(t, "\n\n_posted 14:00 JST_", config.timestampFooter(now))
+	})
+
+	t.Run("footer is appended to the last post", func(t *testing.T) {
+		// The 20-character footer leaves 10 for the message.
+		p, api, _ := newTestPlugin(t, &configuration{TimestampFooterTimezone: "UTC", MaxMessageLength: 30})
+		posts := mockCreatePost(api)
+
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"0123456789abcdef","split":true}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 2)
+		assert.Equal(t, "0123456789", (*posts)[0].Message)
+		assert.Regexp(t, `^abcdef\n\n_posted \d\d:\d\d UTC_$`, (*posts)[1].Message)
+	})
+
+	t.Run("footer counts toward the length limit", func(t *testing.T) {
+		config := &configuration{TimestampFooterTimezone: "UTC", MaxMessageLength: 30}
+		message := strings.Repeat("a", 30)
+
+		p, _, _ := newTestPlugin(t, config)
+		w := doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"`+message+`"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), "message exceeds 10 characters")
+
+		p, api, _ := newTestPlugin(t, config)
+		posts := mockCreatePost(api)
+		w = doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"`+message+`","split":true}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 3)
+		for _, post := range *posts {
+			assert.LessOrEqual(t, utf8.RuneCountInString(post.Message), 30)
+		}
+
+		p, api, _ = newTestPlugin(t, &configuration{TimestampFooterTimezone: "UTC"})
+		posts = mockCreatePost(api)
+		message = strings.Repeat("a", model.PostMessageMaxRunesV2)
+		w = doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"`+message+`","split":true}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, *posts, 2)
+		for _, post := range *posts {
+			assert.LessOrEqual(t, utf8.RuneCountInString(post.Message), model.PostMessageMaxRunesV2)
+		}
+	})
+
+	t.Run("length limit must leave room for the footer", func(t *testing.T) {
+		err := (&configuration{TimestampFooterTimezone: "UTC", MaxMessageLength: 20}).process()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "leave room for the 20-character timestamp footer")
+	})
+
+	t.Run("no footer by default", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{})
+		posts := mockCreatePost(api)
+
+		require.Equal(t, http.StatusOK, doRequest(p, http.MethodPost, "/webhook", `{"channel_id":"channel","message":"hi"}`).Code)
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "hi", (*posts)[0].Message)
+	})
+
+	t.Run("invalid time zone is rejected", func(t *testing.T) {
+		err := (&configuration{TimestampFooterTimezone: "Mars/Olympus"}).process()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid TimestampFooterTimezone")
+	})
+}
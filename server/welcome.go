@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/plugin"
+)
+
+// welcomeKey returns the KV key recording that the welcome message was posted in channelID.
+func welcomeKey(channelID string) string {
+	return welcomeKeyPrefix + channelID
+}
+
+// UserHasJoinedChannel introduces a plugin bot the first time it is added to a channel. Later
+// additions of any bot to the same channel stay silent.
+func (p *Plugin) UserHasJoinedChannel(_ *plugin.Context, channelMember *model.ChannelMember, _ *model.User) {
+	spaceName, ok := p.spaceOfBot(channelMember.UserId)
+	if !ok {
+		return
+	}
+
+	first, err := p.kvSetIfAbsent(welcomeKey(channelMember.ChannelId), []byte("1"))
+	if err != nil {
+		p.API.LogWarn("Failed to record welcome message", "channel_id", channelMember.ChannelId, "err", err.Error())
+		return
+	}
+	if !first {
+		return
+	}
+
+	if _, appErr := p.createIntegrationPost(&model.Post{
+		UserId:    channelMember.UserId,
+		ChannelId: channelMember.ChannelId,
+		Message:   p.renderWelcomeMessage(spaceName),
+	}); appErr != nil {
+		p.API.LogWarn("Failed to post welcome message", "channel_id", channelMember.ChannelId, "err", appErr.Error())
+	}
+}
+
+// spaceOfBot reports whether userID is one of the plugin bots, and the name of the space it
+// posts for, which is empty for the shared bot.
+func (p *Plugin) spaceOfBot(userID string) (string, bool) {
+	if userID == "" {
+		return "", false
+	}
+	if userID == p.botUserID {
+		return "", true
+	}
+
+	p.spaceBotsLock.RLock()
+	defer p.spaceBotsLock.RUnlock()
+	for _, space := range p.getConfiguration().spaces {
+		if space.BotUsername != "" && p.spaceBotIDs[space.BotUsername] == userID {
+			return space.Name, true
+		}
+	}
+	return "", false
+}
+
+// renderWelcomeMessage explains what the bot of the named space posts and how to join it.
+func (p *Plugin) renderWelcomeMessage(spaceName string) string {
+	space := "the oVice space"
+	if spaceName != "" {
+		space = "the oVice space **" + spaceName + "**"
+	}
+
+	message := fmt.Sprintf("Hi, I'm the oVice bot. I post what happens in %s to this channel, such as people entering and leaving, chat messages and screen shares.", space)
+	if url := p.resolveSpaceURL(spaceName); url != "" {
+		message += "\nJoin the space: " + url
+	}
+	return message + fmt.Sprintf("\nType `/%s` to see what else I can do.", p.getConfiguration().commandTrigger())
+}
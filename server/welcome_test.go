@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWelcomeMessage(t *testing.T) {
+	join := func(p *Plugin, userID, channelID string) {
+		p.UserHasJoinedChannel(nil, &model.ChannelMember{UserId: userID, ChannelId: channelID}, nil)
+	}
+
+	t.Run("welcome on first add only", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{SpaceURL: "https://hq.ovice.in"})
+		posts := mockCreatePost(api)
+
+		join(p, testBotUserID, "town")
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "town", (*posts)[0].ChannelId)
+		assert.Equal(t, testBotUserID, (*posts)[0].UserId)
+		assert.Equal(t, "Hi, I'm the oVice bot. I post what happens in the oVice space to this channel, such as people entering and leaving, chat messages and screen shares.\nJoin the space: https://hq.ovice.in\nType `/ovice` to see what else I can do.", (*posts)[0].Message)
+
+		join(p, testBotUserID, "town")
+		assert.Len(t, *posts, 1)
+	})
+
+	t.Run("space bot introduces its space", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, &configuration{Spaces: `[{"name":"Lab","url":"https://lab.ovice.in","bot_username":"lab-bot"}]`})
+		p.spaceBotIDs = map[string]string{"lab-bot": "labbotid"}
+		posts := mockCreatePost(api)
+
+		join(p, "labbotid", "lab")
+		require.Len(t, *posts, 1)
+		assert.Equal(t, "labbotid", (*posts)[0].UserId)
+		assert.Contains(t, (*posts)[0].Message, "the oVice space **Lab**")
+		assert.Contains(t, (*posts)[0].Message, "Join the space: https://lab.ovice.in")
+	})
+
+	t.Run("other users are not welcomed", func(t *testing.T) {
+		p, api, _ := newTestPlugin(t, nil)
+
+		join(p, "alice", "town")
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+}